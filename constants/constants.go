@@ -27,6 +27,9 @@ var (
 	devicePluginExitHostError     = 3                          // device plugin host check exit code, error occurred checking some attribute of the host
 	devicePluginExitPoolError     = 4                          // device plugin device pool exit code, error occurred while building a device pool
 	devicePluginExitKindError     = 5                          // device plugin Kind exit code, error occurred while creating a kind secondary network
+	cniStateDir                   = "/var/lib/cni/afxdp/"      // CNI state cache directory, persistent so device state can be restored after a node reboot
+	cniStateDirPermissions        = 0700                       // permissions for the CNI state cache directory
+	cniStateFilePermissions       = 0600                       // permissions for CNI state cache files
 
 	/* Kind Cluster */
 	kindCluster = false
@@ -41,12 +44,27 @@ var (
 	/* Devices */
 	devicesProhibited    = []string{"eno", "eth", "lo", "docker", "flannel", "cni"} // interfaces we never add to a pool
 	devicesEnvVarPrefix  = "AFXDP_DEVICES_"                                         // env var set in the end user application pod, lists AF_XDP devices attached
+	devicesEnvVarMac     = "AFXDP_MAC_"                                             // env var prefix set in the end user application pod, holds the MAC address of an attached device
 	deviceValidNameRegex = `^[a-zA-Z0-9_-]+$`                                       // regex to check if a string is a valid device name
 	deviceValidNameMin   = 1                                                        // minimum length of a device name
 	deviceValidNameMax   = 50                                                       // maximum length of a device name
 	deviceValidPciRegex  = `[0-9a-f]{4}:[0-9a-f]{2,4}:[0-9a-f]{2}\.[0-9a-f]`        // regex to check if a string is a valid pci address
 	deviceSecondaryMin   = 1                                                        // minimum number of secondary devices that can be created on top of a primary device
 	deviceSecondaryMax   = 64                                                       // maximum number of secondary devices that can be created on top of a primary device
+	deviceMtuMin         = 68                                                       // minimum MTU of a device, the IPv4 minimum
+	deviceVlanMin        = 0                                                        // minimum VLAN ID of a device, 0 disables VLAN tagging
+	deviceVlanMax        = 4094                                                     // maximum VLAN ID of a device
+	deviceLinkSettings   = []string{"on", "off"}                                    // accepted values of on/off device link settings
+	deviceValidQueues    = `^[1-9][0-9]{0,3}$`                                      // regex to check if a string is a valid queue count, 1 - 9999
+	deviceCdqDeleteRetry = 10                                                       // seconds between attempts to delete CDQ subfunctions whose deletion failed
+	deviceCdqWarmRefresh = 30                                                       // seconds between checks that the CDQ warm pool is full, it is also refilled after each allocation
+	deviceCdqCapacity    = 30                                                       // seconds between checks of CDQ subfunction capacity, secondaries beyond the capacity are reported unhealthy
+	deviceReleaseCheck   = 30                                                       // seconds between checks that the devices allocated by a pool are still assigned to a pod by the kubelet
+	deviceReleaseGrace   = 60                                                       // seconds a device must have been allocated before it is released for no longer being assigned to a pod
+	deviceValidRateRegex = `^[0-9]+[kmgt]?(bit|bps)$`                               // regex to check if a string is a valid devlink rate, e.g. 100mbit
+	deviceValidOuiRegex  = `^[0-9a-fA-F]{2}(:[0-9a-fA-F]{2}){2}$`                   // regex to check if a string is a valid three octet OUI, e.g. 02:00:5e
+	deviceMacNodeMax     = 4095                                                     // maximum CDQ MAC node index, the node index takes the upper 12 bits of the address after the OUI
+	deviceMacPrimaryMax  = 64                                                       // maximum CDQ primary devices on a node using a CDQ MAC node index, each takes 6 bits of the address
 
 	/* Drivers */
 	driversZeroCopy      = []string{"i40e", "E810", "ice", "veth"} // drivers that support zero copy AF_XDP
@@ -71,12 +89,28 @@ var (
 	uidMinimum = 1000   // minimum non-reserved UID in Alpine
 
 	/* AF_XDP */
-	afxdpMinimumLinux = "4.18.0" // minimum Linux version for AF_XDP support
+	afxdpMinimumLinux            = "4.18.0" // minimum Linux version for AF_XDP support
+	afxdpMultiBufferMinimumLinux = "6.6.0"  // minimum Linux version for AF_XDP multi-buffer support, needed for MTUs above the single buffer limit
+	afxdpSingleBufferMaxMtu      = 3498     // maximum MTU for single buffer XDP: 4K page, less XDP headroom, skb_shared_info, Ethernet header and two VLAN tags
+	afxdpMultiBufferMaxMtu       = 9702     // maximum MTU for multi-buffer XDP, the jumbo frame limit of supported drivers
+	afxdpDefaultChunkSize        = 4096     // UMEM chunk size of AF_XDP sockets created by the device plugin, if the pod does not set one
+	afxdpDefaultRingSize         = 2048     // ring size of AF_XDP sockets created by the device plugin, if the pod does not set one
+	afxdpMaxXsks                 = 64       // maximum number of AF_XDP sockets the device plugin creates for a pod, across its devices and queues
+	afxdpMaxUmemSize             = 1 << 30  // maximum total size in bytes of the UMEMs the device plugin registers for the sockets of a pod
+	afxdpBusyPollMaxTimeout      = 1000000  // maximum configurable pool busy poll timeout in microseconds
+	afxdpBusyPollMaxBudget       = 65535    // maximum busy poll budget accepted by the kernel
+	afxdpBusyPollDefaultBudget   = 64       // busy poll budget of a pool busy poll policy that does not set one
+	afxdpDefaultDeferHardIrqs    = 2        // napi_defer_hard_irqs of devices in a pool busy poll policy that does not set it
+	afxdpDefaultGroFlushTimeout  = 200000   // gro_flush_timeout in nanoseconds of devices in a pool busy poll policy that does not set it
+
+	afxdpSocketOptions = []string{"SO_RCVBUFFORCE", "SO_SNDBUFFORCE", "SO_PRIORITY", "SO_MARK", "SO_BUSY_POLL", "SO_BUSY_POLL_BUDGET", "SO_PREFER_BUSY_POLL"} // socket options the device plugin can set for pods, if allowed by the pool
 
 	/* UDS*/
 	udsMaxTimeout = 300              // maximum configurable uds timeout in seconds
 	udsMinTimeout = 30               // minimum (and default) uds timeout in seconds
 	udsMsgBufSize = 64               // uds message buffer size
+	udsMaxMsgSize = 4096             // uds message buffer size of the v1 protocol, which has larger length-prefixed JSON messages
+	udsMsgLimit   = 1 << 20          // largest uds message read, the buffer grows past the message buffer size for larger v1 messages
 	udsCtlBufSize = 4                // uds control buffer size
 	udsProtocol   = "unixpacket"     // uds protocol: "unix"=SOCK_STREAM, "unixdomain"=SOCK_DGRAM, "unixpacket"=SOCK_SEQPACKET
 	udsSockDir    = "/tmp/afxdp_dp/" // host location where we place our uds sockets. If changing location remember to update daemonset mount point
@@ -90,10 +124,14 @@ var (
 
 	udsDirFileMode = 0700 // permissions for the directory in which we create our uds sockets
 
+	udsPodNamespaceEnv  = "POD_NAMESPACE"                                           // env var holding the namespace of the end user application pod, set through the downward API
+	udsPodNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace" // file holding the namespace of the pod, used if the env var is not set
+
 	/* Handshake*/
 	handshakeHandshakeVersion    = "0.1"                   // increase this version if changes are made to the protocol below
+	handshakeProtocolVersion     = "1.0"                   // version of the v1 protocol of length-prefixed JSON messages, see the uds package
 	handshakeRequestVersion      = "/version"              // used to request the handshake version
-	handshakeRequestConnect      = "/connect"              // used to request a new connection, this request will be combined with the podname
+	handshakeRequestConnect      = "/connect"              // used to request a new connection, this request will be combined with the podname and optionally the pod namespace
 	handshakeResponseHostOk      = "/host_ok"              // the response given if a valid podname was sent along with the connection request
 	handshakeResponseHostNak     = "/host_nak"             // the response given if an invalid podname was sent with the connection request
 	handshakeRequestFd           = "/xsk_map_fd"           // used to request the xsk map file descriptor for a network device, this request will be combined with the device name
@@ -108,7 +146,22 @@ var (
 	handshakeResponseError       = "/error"                // general error occurred response, indicates an error occurred on the device plugin end
 
 	/*EthtoolFilters*/
-	ethtoolFilterRegex = `^[a-zA-Z0-9-:.-/\s/g]+$` // regex to validate ethtool filter commands.
+	ethtoolFilterRegex       = `^[a-zA-Z0-9-:.-/\s/g]+$`                                                // regex to validate ethtool filter commands.
+	ethtoolFilterFlowTypes   = []string{"tcp4", "udp4", "sctp4", "ip4", "tcp6", "udp6", "sctp6", "ip6"} // flow types supported by structured ethtool filters
+	ethtoolFilterIPHolder    = "-ip-"                                                                   // placeholder replaced by each pod IP address, one rule per IP family
+	ethtoolFilterIPv4Holder  = "-ip4-"                                                                  // placeholder replaced by the pod IPv4 address
+	ethtoolFilterIPv6Holder  = "-ip6-"                                                                  // placeholder replaced by the pod IPv6 address
+	ethtoolFilterActionDrop  = -1                                                                       // filter action that drops matching packets
+	ethtoolFilterPortMaximum = 65535                                                                    // maximum port number in a filter
+	ethtoolFilterLockDir     = "/var/run/afxdp/"                                                        // directory of the lock files serialising ntuple rule inserts per device
+
+	/* DP<=>CNI Syncer */
+	syncerVersion        = "1.0"         // syncer API version, increase the major version if incompatible changes are made to the API
+	syncerSockName       = "syncer.sock" // syncer socket name, prefixed with the device prefix in the device plugin directory
+	syncerRequestTimeout = 5             // seconds allowed for each syncer request, including the connection
+	syncerRequestRetries = 3             // number of attempts made for a syncer request when the server is unavailable
+	syncerRetryBackoff   = 200           // milliseconds between syncer request attempts, doubled after each attempt
+	syncerAllowedUID     = 0             // only callers running as this user id are accepted by the syncer server
 )
 
 /* Public variables and types */
@@ -137,9 +190,14 @@ var (
 	EthtoolFilter ethtoolFilter
 	/* Bpf contains constants related to the BPF Map pinning */
 	Bpf bpf
+	/* Syncer contains constants related to the DP<=>CNI syncer */
+	Syncer syncer
 )
 
 type cni struct {
+	StateDir             string
+	StateDirPermissions  int
+	StateFilePermissions int
 }
 
 type devicePlugin struct {
@@ -161,7 +219,20 @@ type plugins struct {
 }
 
 type afxdp struct {
-	MinumumKernel string
+	MinumumKernel            string
+	MultiBufferMinimumKernel string
+	SingleBufferMaxMtu       int
+	MultiBufferMaxMtu        int
+	DefaultChunkSize         int
+	DefaultRingSize          int
+	MaxXsks                  int
+	MaxUmemSize              int
+	BusyPollMaxTimeout       int
+	BusyPollMaxBudget        int
+	BusyPollDefaultBudget    int
+	DefaultDeferHardIrqs     int
+	DefaultGroFlushTimeout   int
+	SocketOptions            []string
 }
 
 type drivers struct {
@@ -177,12 +248,27 @@ type drivers struct {
 type devices struct {
 	Prohibited     []string
 	EnvVarList     string
+	EnvVarMac      string
 	ValidNameRegex string
 	ValidNameMin   int
 	ValidNameMax   int
 	ValidPciRegex  string
 	SecondaryMin   int
 	SecondaryMax   int
+	MtuMin         int
+	VlanMin        int
+	VlanMax        int
+	LinkSettings   []string
+	ValidQueues    string
+	CdqDeleteRetry int
+	CdqWarmRefresh int
+	CdqCapacity    int
+	ReleaseCheck   int
+	ReleaseGrace   int
+	ValidRateRegex string
+	ValidOuiRegex  string
+	MacNodeMax     int
+	MacPrimaryMax  int
 }
 
 type nodes struct {
@@ -213,12 +299,16 @@ type uds struct {
 	MaxTimeout  int
 	MinTimeout  int
 	MsgBufSize  int
+	MaxMsgSize  int
+	MsgLimit    int
 	CtlBufSize  int
 	Protocol    string
 	SockDir     string
 	DirFileMode int
 	PodPath     string
 	SockName    string
+	PodNsEnv    string
+	PodNsFile   string
 	Handshake   handshake
 }
 
@@ -230,6 +320,7 @@ type bpf struct {
 
 type handshake struct {
 	Version             string
+	ProtocolVersion     string
 	RequestVersion      string
 	RequestConnect      string
 	ResponseHostOk      string
@@ -254,12 +345,33 @@ type deviceFile struct {
 
 type ethtoolFilter struct {
 	EthtoolFilterRegex string
+	FlowTypes          []string
+	IPPlaceholder      string
+	IPv4Placeholder    string
+	IPv6Placeholder    string
+	ActionDrop         int
+	PortMaximum        int
+	LockDir            string
+}
+
+type syncer struct {
+	Version        string
+	SockName       string
+	RequestTimeout int
+	RequestRetries int
+	RetryBackoff   int
+	AllowedUID     int
 }
 
 func init() {
 	Plugins = plugins{
 		Modes:       pluginModes,
 		KindCluster: kindCluster,
+		Cni: cni{
+			StateDir:             cniStateDir,
+			StateDirPermissions:  cniStateDirPermissions,
+			StateFilePermissions: cniStateFilePermissions,
+		},
 		DevicePlugin: devicePlugin{
 			DefaultConfigFile: devicePluginDefaultConfigFile,
 			DevicePrefix:      devicePluginDevicePrefix,
@@ -273,7 +385,20 @@ func init() {
 	}
 
 	Afxdp = afxdp{
-		MinumumKernel: afxdpMinimumLinux,
+		MinumumKernel:            afxdpMinimumLinux,
+		MultiBufferMinimumKernel: afxdpMultiBufferMinimumLinux,
+		SingleBufferMaxMtu:       afxdpSingleBufferMaxMtu,
+		MultiBufferMaxMtu:        afxdpMultiBufferMaxMtu,
+		DefaultChunkSize:         afxdpDefaultChunkSize,
+		DefaultRingSize:          afxdpDefaultRingSize,
+		MaxXsks:                  afxdpMaxXsks,
+		MaxUmemSize:              afxdpMaxUmemSize,
+		BusyPollMaxTimeout:       afxdpBusyPollMaxTimeout,
+		BusyPollMaxBudget:        afxdpBusyPollMaxBudget,
+		BusyPollDefaultBudget:    afxdpBusyPollDefaultBudget,
+		DefaultDeferHardIrqs:     afxdpDefaultDeferHardIrqs,
+		DefaultGroFlushTimeout:   afxdpDefaultGroFlushTimeout,
+		SocketOptions:            afxdpSocketOptions,
 	}
 
 	Drivers = drivers{
@@ -289,12 +414,27 @@ func init() {
 	Devices = devices{
 		Prohibited:     devicesProhibited,
 		EnvVarList:     devicesEnvVarPrefix,
+		EnvVarMac:      devicesEnvVarMac,
 		ValidNameRegex: deviceValidNameRegex,
 		ValidNameMin:   deviceValidNameMin,
 		ValidNameMax:   deviceValidNameMax,
 		ValidPciRegex:  deviceValidPciRegex,
 		SecondaryMin:   deviceSecondaryMin,
 		SecondaryMax:   deviceSecondaryMax,
+		MtuMin:         deviceMtuMin,
+		VlanMin:        deviceVlanMin,
+		VlanMax:        deviceVlanMax,
+		LinkSettings:   deviceLinkSettings,
+		ValidQueues:    deviceValidQueues,
+		CdqDeleteRetry: deviceCdqDeleteRetry,
+		CdqWarmRefresh: deviceCdqWarmRefresh,
+		CdqCapacity:    deviceCdqCapacity,
+		ReleaseCheck:   deviceReleaseCheck,
+		ReleaseGrace:   deviceReleaseGrace,
+		ValidRateRegex: deviceValidRateRegex,
+		ValidOuiRegex:  deviceValidOuiRegex,
+		MacNodeMax:     deviceMacNodeMax,
+		MacPrimaryMax:  deviceMacPrimaryMax,
 	}
 
 	Nodes = nodes{
@@ -325,14 +465,19 @@ func init() {
 		MaxTimeout:  udsMaxTimeout,
 		MinTimeout:  udsMinTimeout,
 		MsgBufSize:  udsMsgBufSize,
+		MaxMsgSize:  udsMaxMsgSize,
+		MsgLimit:    udsMsgLimit,
 		CtlBufSize:  udsCtlBufSize,
 		Protocol:    udsProtocol,
 		SockDir:     udsSockDir,
 		DirFileMode: udsDirFileMode,
 		PodPath:     udsPodPath,
 		SockName:    udsPodSock,
+		PodNsEnv:    udsPodNamespaceEnv,
+		PodNsFile:   udsPodNamespaceFile,
 		Handshake: handshake{
 			Version:             handshakeHandshakeVersion,
+			ProtocolVersion:     handshakeProtocolVersion,
 			RequestVersion:      handshakeRequestVersion,
 			RequestConnect:      handshakeRequestConnect,
 			ResponseHostOk:      handshakeResponseHostOk,
@@ -358,5 +503,21 @@ func init() {
 
 	EthtoolFilter = ethtoolFilter{
 		EthtoolFilterRegex: ethtoolFilterRegex,
+		FlowTypes:          ethtoolFilterFlowTypes,
+		IPPlaceholder:      ethtoolFilterIPHolder,
+		IPv4Placeholder:    ethtoolFilterIPv4Holder,
+		IPv6Placeholder:    ethtoolFilterIPv6Holder,
+		ActionDrop:         ethtoolFilterActionDrop,
+		PortMaximum:        ethtoolFilterPortMaximum,
+		LockDir:            ethtoolFilterLockDir,
+	}
+
+	Syncer = syncer{
+		Version:        syncerVersion,
+		SockName:       syncerSockName,
+		RequestTimeout: syncerRequestTimeout,
+		RequestRetries: syncerRequestRetries,
+		RetryBackoff:   syncerRetryBackoff,
+		AllowedUID:     syncerAllowedUID,
 	}
 }
@@ -18,6 +18,7 @@ require (
 	github.com/stretchr/testify v1.8.3
 	github.com/vishvananda/netlink v1.1.1-0.20210330154013-f5de75959ad5
 	golang.org/x/net v0.17.0
+	golang.org/x/sys v0.13.0
 	google.golang.org/grpc v1.56.3
 	gotest.tools v2.2.0+incompatible
 	k8s.io/apimachinery v0.25.2
@@ -68,12 +68,13 @@ int Load_bpf_send_xsk_map(char *ifname) {
 	return -1;
 }
 
-int Configure_busy_poll(int fd, int busy_timeout, int busy_budget) {
+int Configure_busy_poll(int fd, int busy_timeout, int busy_budget, int prefer_busy_poll) {
 
-	int sock_opt = 1;
+	int sock_opt = prefer_busy_poll ? 1 : 0;
 	int err;
 
-	Log_Info("%s: setting SO_PREFER_BUSY_POLL on file descriptor %d", __FUNCTION__, fd);
+	Log_Info("%s: setting SO_PREFER_BUSY_POLL to %d on file descriptor %d", __FUNCTION__,
+		 sock_opt, fd);
 
 	err = setsockopt(fd, SOL_SOCKET, SO_PREFER_BUSY_POLL, (void *)&sock_opt, sizeof(sock_opt));
 	if (err < 0) {
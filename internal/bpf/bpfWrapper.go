@@ -30,6 +30,7 @@ import (
 
 	"github.com/pkg/errors"
 	logging "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 /*
@@ -40,9 +41,12 @@ without making actual BPF calls.
 type Handler interface {
 	LoadBpfSendXskMap(ifname string) (int, error)
 	LoadAttachBpfXdpPass(ifname string) error
-	ConfigureBusyPoll(fd int, busyTimeout int, busyBudget int) error
+	ConfigureBusyPoll(fd int, busyTimeout int, busyBudget int, preferBusyPoll bool) error
 	LoadBpfPinXskMap(ifname, pin_path string) error
 	Cleanbpf(ifname string) error
+	CloseXskMap(fd int) error
+	CreateXsk(config *XskConfig) (int, uint64, error)
+	SetSocketOption(fd int, name string, value int) error
 }
 
 /*
@@ -126,8 +130,13 @@ func XdpLoaderCmd(ifname, action, bpfProg, pin_path string) error {
 /*
 ConfigureBusyPoll is the GoLang wrapper for the C function Configure_busy_poll
 */
-func (r *handler) ConfigureBusyPoll(fd int, busyTimeout int, busyBudget int) error {
-	ret := C.Configure_busy_poll(C.int(fd), C.int(busyTimeout), C.int(busyBudget))
+func (r *handler) ConfigureBusyPoll(fd int, busyTimeout int, busyBudget int, preferBusyPoll bool) error {
+	var prefer C.int
+	if preferBusyPoll {
+		prefer = 1
+	}
+
+	ret := C.Configure_busy_poll(C.int(fd), C.int(busyTimeout), C.int(busyBudget), prefer)
 
 	if ret != 0 {
 		return errors.New("error configuring busy poll on interface")
@@ -150,6 +159,17 @@ func (r *handler) Cleanbpf(ifname string) error {
 	return nil
 }
 
+/*
+CloseXskMap closes the file descriptor of an XSK map returned by LoadBpfSendXskMap.
+It is called once the UDS server serving the map is stopped for good.
+*/
+func (r *handler) CloseXskMap(fd int) error {
+	if err := unix.Close(fd); err != nil {
+		return errors.Wrapf(err, "error closing XSK map fd %d", fd)
+	}
+	return nil
+}
+
 // Debugf is exported to C, so C code can write logs to the Golang logging package
 //
 //export Debugf
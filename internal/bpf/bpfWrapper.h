@@ -18,7 +18,7 @@
 #define _WRAPPER_H_
 
 int Load_bpf_send_xsk_map(char *ifname);
-int Configure_busy_poll(int fd, int busy_timeout, int busy_budget);
+int Configure_busy_poll(int fd, int busy_timeout, int busy_budget, int prefer_busy_poll);
 int Clean_bpf(char *ifname);
 
 #endif
@@ -16,6 +16,13 @@
 
 package bpf
 
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
 /*
 fakeHandler implements the Handler interface.
 */
@@ -57,7 +64,7 @@ func (f *fakeHandler) LoadBpfPinXskMap(ifname, pin_path string) error {
 ConfigureBusyPoll is the GoLang wrapper for the C function Configure_busy_poll
 In this fakeHandler it does nothing.
 */
-func (f *fakeHandler) ConfigureBusyPoll(fd int, busyTimeout int, busyBudget int) error {
+func (f *fakeHandler) ConfigureBusyPoll(fd int, busyTimeout int, busyBudget int, preferBusyPoll bool) error {
 	return nil
 }
 
@@ -68,3 +75,37 @@ In this fakeHandler it does nothing.
 func (f *fakeHandler) Cleanbpf(ifname string) error {
 	return nil
 }
+
+/*
+CloseXskMap closes the file descriptor of an XSK map.
+In this fakeHandler it does nothing, as the file descriptors are not real.
+*/
+func (f *fakeHandler) CloseXskMap(fd int) error {
+	return nil
+}
+
+/*
+CreateXsk creates an AF_XDP socket and returns its file descriptor and the size of its UMEM.
+In this fakeHandler it returns a file descriptor of /dev/null, as the caller closes it, and a
+UMEM of the size of the memfd, checked against the size allowed.
+*/
+func (f *fakeHandler) CreateXsk(config *XskConfig) (int, uint64, error) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(config.UmemFd, &stat); err != nil {
+		return -1, 0, err
+	}
+	if uint64(stat.Size) > config.MaxUmemSize {
+		return -1, 0, errors.Wrapf(ErrUmemLimit, "UMEM of %d bytes, %d bytes allowed", stat.Size, config.MaxUmemSize)
+	}
+
+	fd, err := unix.Open(os.DevNull, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	return fd, uint64(stat.Size), err
+}
+
+/*
+SetSocketOption takes a socket file descriptor and sets the named option to a value.
+In this fakeHandler it does nothing.
+*/
+func (f *fakeHandler) SetSocketOption(fd int, name string, value int) error {
+	return nil
+}
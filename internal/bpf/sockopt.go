@@ -0,0 +1,54 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bpf
+
+import (
+	"fmt"
+
+	logging "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+/*
+socketOptions maps the names of the socket options the device plugin can set on behalf of
+pods to their SOL_SOCKET option numbers. The names match constants.Afxdp.SocketOptions.
+*/
+var socketOptions = map[string]int{
+	"SO_RCVBUFFORCE":      unix.SO_RCVBUFFORCE,
+	"SO_SNDBUFFORCE":      unix.SO_SNDBUFFORCE,
+	"SO_PRIORITY":         unix.SO_PRIORITY,
+	"SO_MARK":             unix.SO_MARK,
+	"SO_BUSY_POLL":        unix.SO_BUSY_POLL,
+	"SO_BUSY_POLL_BUDGET": unix.SO_BUSY_POLL_BUDGET,
+	"SO_PREFER_BUSY_POLL": unix.SO_PREFER_BUSY_POLL,
+}
+
+/*
+SetSocketOption takes a socket file descriptor and sets the named SOL_SOCKET option to an
+integer value. Options not known to the device plugin are rejected.
+*/
+func (r *handler) SetSocketOption(fd int, name string, value int) error {
+	option, ok := socketOptions[name]
+	if !ok {
+		return fmt.Errorf("unknown socket option %s", name)
+	}
+
+	logging.Infof("Setting %s to %d on file descriptor %d", name, value, fd)
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, option, value); err != nil {
+		return fmt.Errorf("error setting %s to %d: %w", name, value, err)
+	}
+	return nil
+}
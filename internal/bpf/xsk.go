@@ -0,0 +1,180 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bpf
+
+import (
+	"unsafe"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+/*
+XskConfig holds the settings of an AF_XDP socket created on behalf of a pod.
+UmemFd is a memfd holding the UMEM of the pod, shared so the pod and the socket use the same
+memory. The socket is bound to QueueID of the netdev with index Ifindex, as seen in the
+network namespace at Netns, and inserted into the XSK map XskMapFd at that queue.
+The UMEM is not registered if it is larger than MaxUmemSize bytes.
+*/
+type XskConfig struct {
+	Netns       string
+	Ifindex     int
+	QueueID     uint32
+	XskMapFd    int
+	UmemFd      int
+	ChunkSize   uint32
+	Headroom    uint32
+	FillSize    uint32
+	CompSize    uint32
+	RxSize      uint32
+	TxSize      uint32
+	NeedWakeup  bool
+	MaxUmemSize uint64
+}
+
+/*
+ErrUmemLimit is returned by CreateXsk when the UMEM is larger than the size allowed.
+*/
+var ErrUmemLimit = errors.New("UMEM size limit exceeded")
+
+/*
+CreateXsk creates an AF_XDP socket as described by config and returns its file descriptor and
+the size of its UMEM. The socket is created in the network namespace of the netdev, its UMEM is
+registered from the memfd, its rings are sized and it is bound to the queue, then it is inserted
+into the XSK map.
+The rings are mapped by the pod from the returned file descriptor, which needs no privileges.
+The calling code must close the file descriptor once it has been passed to the pod.
+*/
+func (r *handler) CreateXsk(config *XskConfig) (int, uint64, error) {
+	fd := -1
+	create := func(_ ns.NetNS) error {
+		var err error
+		fd, err = unix.Socket(unix.AF_XDP, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+		return err
+	}
+
+	var err error
+	if config.Netns == "" {
+		err = create(nil)
+	} else {
+		err = ns.WithNetNSPath(config.Netns, create)
+	}
+	if err != nil {
+		return -1, 0, errors.Wrap(err, "error creating AF_XDP socket")
+	}
+
+	size, err := setupXsk(fd, config)
+	if err != nil {
+		unix.Close(fd)
+		return -1, 0, err
+	}
+
+	logging.Infof("AF_XDP socket %d bound to ifindex %d queue %d", fd, config.Ifindex, config.QueueID)
+	return fd, size, nil
+}
+
+func setupXsk(fd int, config *XskConfig) (uint64, error) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(config.UmemFd, &stat); err != nil {
+		return 0, errors.Wrap(err, "error reading UMEM size")
+	}
+	if stat.Size <= 0 {
+		return 0, errors.New("UMEM is empty")
+	}
+	// checked before the UMEM pages are mapped and pinned
+	if uint64(stat.Size) > config.MaxUmemSize {
+		return 0, errors.Wrapf(ErrUmemLimit, "UMEM of %d bytes, %d bytes allowed", stat.Size, config.MaxUmemSize)
+	}
+
+	// the UMEM pages are pinned on registration, so they stay shared with the pod once unmapped here
+	umem, err := unix.Mmap(config.UmemFd, 0, int(stat.Size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return 0, errors.Wrap(err, "error mapping UMEM")
+	}
+	defer unix.Munmap(umem)
+
+	reg := unix.XDPUmemReg{
+		Addr:     uint64(uintptr(unsafe.Pointer(&umem[0]))),
+		Len:      uint64(len(umem)),
+		Size:     config.ChunkSize,
+		Headroom: config.Headroom,
+	}
+	if _, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(fd), unix.SOL_XDP, unix.XDP_UMEM_REG,
+		uintptr(unsafe.Pointer(&reg)), unsafe.Sizeof(reg), 0); errno != 0 {
+		return 0, errors.Wrap(errno, "error registering UMEM")
+	}
+
+	rings := []struct {
+		name string
+		opt  int
+		size uint32
+	}{
+		{"fill", unix.XDP_UMEM_FILL_RING, config.FillSize},
+		{"completion", unix.XDP_UMEM_COMPLETION_RING, config.CompSize},
+		{"rx", unix.XDP_RX_RING, config.RxSize},
+		{"tx", unix.XDP_TX_RING, config.TxSize},
+	}
+	for _, ring := range rings {
+		if ring.size == 0 {
+			continue
+		}
+		if err := unix.SetsockoptInt(fd, unix.SOL_XDP, ring.opt, int(ring.size)); err != nil {
+			return 0, errors.Wrapf(err, "error setting %s ring size to %d", ring.name, ring.size)
+		}
+	}
+
+	var flags uint16
+	if config.NeedWakeup {
+		flags |= unix.XDP_USE_NEED_WAKEUP
+	}
+	addr := &unix.SockaddrXDP{Flags: flags, Ifindex: uint32(config.Ifindex), QueueID: config.QueueID}
+	if err := unix.Bind(fd, addr); err != nil {
+		return 0, errors.Wrapf(err, "error binding AF_XDP socket to ifindex %d queue %d", config.Ifindex, config.QueueID)
+	}
+
+	if err := updateXskMap(config.XskMapFd, config.QueueID, fd); err != nil {
+		return 0, errors.Wrapf(err, "error inserting AF_XDP socket into XSK map at queue %d", config.QueueID)
+	}
+
+	return uint64(stat.Size), nil
+}
+
+/*
+updateXskMap sets the entry for a queue in an XSK map to an AF_XDP socket.
+The key and value are held as pointers, so the attributes match the kernel layout on 64 bit hosts.
+*/
+func updateXskMap(mapFd int, queueID uint32, xskFd int) error {
+	key := queueID
+	value := uint32(xskFd)
+	attr := struct {
+		mapFd uint32
+		_     uint32
+		key   unsafe.Pointer
+		value unsafe.Pointer
+		flags uint64
+	}{
+		mapFd: uint32(mapFd),
+		key:   unsafe.Pointer(&key),
+		value: unsafe.Pointer(&value),
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_MAP_UPDATE_ELEM, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -17,11 +17,13 @@ package cni
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"regexp"
 	"runtime"
-	"strings"
+	"strconv"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
@@ -31,29 +33,43 @@ import (
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/bpf"
+	pb "github.com/intel/afxdp-plugins-for-kubernetes/internal/dpcnisyncer"
 	dpcnisyncer "github.com/intel/afxdp-plugins-for-kubernetes/internal/dpcnisyncerclient"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/host"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/logformats"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/tools"
 	logging "github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
 )
 
 var bpfHandler = bpf.NewHandler()
+var netHandler networking.Handler = networking.NewHandler()
 
 /*
 NetConfig holds the config passed via stdin
 */
 type NetConfig struct {
 	types.NetConf
-	Device        string   `json:"deviceID"`
-	Mode          string   `json:"mode"`
-	SkipUnloadBpf bool     `json:"skipUnloadBpf,omitempty"`
-	Queues        string   `json:"queues,omitempty"`
-	LogFile       string   `json:"logFile,omitempty"`
-	LogLevel      string   `json:"logLevel,omitempty"`
-	EthtoolCmds   []string `json:"ethtoolCmds,omitempty"`
-	DPSyncer      bool     `json:"dpSyncer,omitempty"`
+	Device              string                      `json:"deviceID"`
+	Mode                string                      `json:"mode"`
+	SkipUnloadBpf       bool                        `json:"skipUnloadBpf,omitempty"`
+	Queues              string                      `json:"queues,omitempty"`
+	LogFile             string                      `json:"logFile,omitempty"`
+	LogLevel            string                      `json:"logLevel,omitempty"`
+	EthtoolCmds         []string                    `json:"ethtoolCmds,omitempty"`
+	EthtoolFilters      []*networking.EthtoolFilter `json:"ethtoolFilters,omitempty"`
+	AllowRawEthtoolCmds bool                        `json:"allowRawEthtoolCmds,omitempty"`
+	DPSyncer            bool                        `json:"dpSyncer,omitempty"`
+	Mtu                 int                         `json:"mtu,omitempty"`
+	Mac                 string                      `json:"mac,omitempty"`
+	Vlan                *int                        `json:"vlan,omitempty"`
+	Promisc             string                      `json:"promisc,omitempty"`
+	Trust               string                      `json:"trust,omitempty"`
+	Spoofchk            string                      `json:"spoofchk,omitempty"`
+	XdpMultiBuffer      bool                        `json:"xdpMultiBuffer,omitempty"`
+	RxRingSize          int                         `json:"rxRingSize,omitempty"`
+	TxRingSize          int                         `json:"txRingSize,omitempty"`
 }
 
 func init() {
@@ -68,8 +84,11 @@ func (n NetConfig) Validate() error {
 		allowedLogLevels               = constants.Logging.Levels
 		allowedModes                   = constants.Plugins.Modes
 		ethtoolRegex                   = constants.EthtoolFilter.EthtoolFilterRegex
+		allowedSettings                = constants.Devices.LinkSettings
 		logLevels        []interface{} = make([]interface{}, len(allowedLogLevels))
 		modes            []interface{} = make([]interface{}, len(allowedModes))
+		settings         []interface{} = make([]interface{}, len(allowedSettings))
+		maxMtu                         = constants.Afxdp.SingleBufferMaxMtu
 	)
 
 	for i, logLevel := range allowedLogLevels {
@@ -78,6 +97,12 @@ func (n NetConfig) Validate() error {
 	for i, mode := range allowedModes {
 		modes[i] = mode
 	}
+	for i, setting := range allowedSettings {
+		settings[i] = setting
+	}
+	if n.XdpMultiBuffer {
+		maxMtu = constants.Afxdp.MultiBufferMaxMtu
+	}
 
 	return validation.ValidateStruct(&n,
 		validation.Field(
@@ -99,14 +124,156 @@ func (n NetConfig) Validate() error {
 		),
 		validation.Field(
 			&n.EthtoolCmds,
+			validation.Empty.When(!n.AllowRawEthtoolCmds).Error("validate(): raw ethtoolCmds are deprecated, use ethtoolFilters or set allowRawEthtoolCmds"),
 			validation.Each(
 				validation.Required.When(len(n.EthtoolCmds) > 0).Error("Ethtool field must not be empty"),
 				validation.Match(regexp.MustCompile(ethtoolRegex)).Error("Ethtool commands must be alphanumeric or approved characters"),
 			),
 		),
+		validation.Field(
+			&n.EthtoolFilters,
+			validation.Each(validation.NotNil.Error("cannot be null")),
+		),
+		validation.Field(
+			&n.Queues,
+			validation.Match(regexp.MustCompile(constants.Devices.ValidQueues)).Error("validate(): queues must be a positive whole number"),
+		),
+		validation.Field(
+			&n.RxRingSize,
+			validation.Min(1).Error("validate(): rxRingSize must be a positive whole number"),
+		),
+		validation.Field(
+			&n.TxRingSize,
+			validation.Min(1).Error("validate(): txRingSize must be a positive whole number"),
+		),
+		validation.Field(
+			&n.Mtu,
+			validation.Min(constants.Devices.MtuMin).Error("validate(): mtu must be at least "+fmt.Sprintf("%d", constants.Devices.MtuMin)),
+			validation.Max(maxMtu).Error("validate(): mtu must be no more than "+fmt.Sprintf("%d", maxMtu)+", larger MTUs require xdpMultiBuffer"),
+		),
+		validation.Field(
+			&n.Mac,
+			validation.By(validateMac),
+		),
+		validation.Field(
+			&n.Vlan,
+			validation.Min(constants.Devices.VlanMin).Error("validate(): vlan must be at least "+fmt.Sprintf("%d", constants.Devices.VlanMin)),
+			validation.Max(constants.Devices.VlanMax).Error("validate(): vlan must be no more than "+fmt.Sprintf("%d", constants.Devices.VlanMax)),
+		),
+		validation.Field(
+			&n.Promisc,
+			validation.In(settings...).Error("validate(): promisc must be "+fmt.Sprintf("%v", settings)),
+		),
+		validation.Field(
+			&n.Trust,
+			validation.In(settings...).Error("validate(): trust must be "+fmt.Sprintf("%v", settings)),
+		),
+		validation.Field(
+			&n.Spoofchk,
+			validation.In(settings...).Error("validate(): spoofchk must be "+fmt.Sprintf("%v", settings)),
+		),
 	)
 }
 
+/*
+validateMac checks that value is a valid unicast Ethernet MAC address
+*/
+func validateMac(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+
+	mac, err := net.ParseMAC(s)
+	if err != nil || len(mac) != 6 {
+		return fmt.Errorf("validate(): mac must be a valid Ethernet MAC address")
+	}
+	if mac[0]&0x01 != 0 {
+		return fmt.Errorf("validate(): mac must be a unicast MAC address")
+	}
+
+	return nil
+}
+
+/*
+linkConfig converts the link settings of the NetConfig into a networking.LinkConfig.
+It returns nil if no link settings are present.
+*/
+func (n NetConfig) linkConfig() *networking.LinkConfig {
+	if n.Mtu == 0 && n.Mac == "" && n.Vlan == nil && n.Promisc == "" && n.Trust == "" && n.Spoofchk == "" {
+		return nil
+	}
+
+	return &networking.LinkConfig{
+		Mtu:      n.Mtu,
+		Mac:      n.Mac,
+		Vlan:     n.Vlan,
+		Promisc:  settingToBool(n.Promisc),
+		Trust:    settingToBool(n.Trust),
+		Spoofchk: settingToBool(n.Spoofchk),
+	}
+}
+
+/*
+queueConfig converts the queue settings of the NetConfig into a networking.QueueConfig.
+It returns nil if no queue settings are present. Queues must already be validated.
+*/
+func (n NetConfig) queueConfig() *networking.QueueConfig {
+	if n.Queues == "" && n.RxRingSize == 0 && n.TxRingSize == 0 {
+		return nil
+	}
+
+	config := &networking.QueueConfig{
+		RxRing: uint32(n.RxRingSize),
+		TxRing: uint32(n.TxRingSize),
+	}
+	if n.Queues != "" {
+		queues, _ := strconv.ParseUint(n.Queues, 10, 32)
+		config.Combined = uint32(queues)
+	}
+
+	return config
+}
+
+/*
+settingToBool converts an "on"/"off" setting to a bool pointer, nil if the setting is not set
+*/
+func settingToBool(setting string) *bool {
+	if setting == "" {
+		return nil
+	}
+	on := setting == "on"
+	return &on
+}
+
+/*
+checkMultiBuffer verifies the host kernel supports XDP multi-buffer when the configured
+MTU is above the single buffer limit
+*/
+func checkMultiBuffer(cfg *NetConfig, hostHandler host.Handler) error {
+	if cfg.Mtu <= constants.Afxdp.SingleBufferMaxMtu {
+		return nil
+	}
+
+	kernel, err := hostHandler.KernelVersion()
+	if err != nil {
+		return err
+	}
+	kernelInt, err := tools.KernelVersionInt(kernel)
+	if err != nil {
+		return err
+	}
+	minKernelInt, err := tools.KernelVersionInt(constants.Afxdp.MultiBufferMinimumKernel)
+	if err != nil {
+		return err
+	}
+	if kernelInt < minKernelInt {
+		return fmt.Errorf("mtu %d requires XDP multi-buffer, kernel %s is older than the minimum %s", cfg.Mtu, kernel, constants.Afxdp.MultiBufferMinimumKernel)
+	}
+
+	return nil
+}
+
 func loadConf(bytes []byte) (*NetConfig, error) {
 	n := &NetConfig{}
 	logging.SetReportCaller(true)
@@ -153,8 +320,6 @@ CmdAdd is called by kubelet during pod create
 func CmdAdd(args *skel.CmdArgs) error {
 	host := host.NewHandler()
 	var result *current.Result
-	netHandler := networking.NewHandler()
-
 	cfg, err := loadConf(args.StdinData)
 	if err != nil {
 		err = fmt.Errorf("cmdAdd(): error loading config data: %w", err)
@@ -164,6 +329,24 @@ func CmdAdd(args *skel.CmdArgs) error {
 	}
 
 	logging.Debugf("cmdAdd(): loaded config: %+v", cfg)
+	podIfName := podInterfaceName(args, cfg)
+
+	if cfg.DPSyncer {
+		logging.Infof("cmdAdd(): asking Device Plugin for details of device %s", cfg.Device)
+		info, err := dpcnisyncer.GetNetDevInfo(cfg.Device)
+		if err != nil {
+			err = fmt.Errorf("cmdAdd(): unable to get details of device %q from Device Plugin: %w", cfg.Device, err)
+			logging.Errorf(err.Error())
+
+			return err
+		}
+		if err := checkNetDevInfo(info, cfg, args.ContainerID); err != nil {
+			logging.Errorf(err.Error())
+
+			return err
+		}
+	}
+
 	logging.Infof("cmdAdd(): getting container network namespace")
 	containerNs, err := ns.GetNS(args.Netns)
 	if err != nil {
@@ -183,6 +366,24 @@ func CmdAdd(args *skel.CmdArgs) error {
 		return err
 	}
 
+	logging.Infof("cmdAdd(): caching original device state")
+	if err := cacheDeviceState(args, cfg, netHandler); err != nil {
+		err = fmt.Errorf("cmdAdd(): failed to cache state of device %q: %w", cfg.Device, err)
+		logging.Errorf(err.Error())
+
+		return err
+	}
+
+	if queueConfig := cfg.queueConfig(); queueConfig != nil {
+		logging.Infof("cmdAdd(): setting queues on device: %s", cfg.Device)
+		if err := netHandler.SetQueueConfig(cfg.Device, queueConfig); err != nil {
+			err = fmt.Errorf("cmdAdd(): failed to set queues on device %q: %w", cfg.Device, err)
+			logging.Errorf(err.Error())
+
+			return err
+		}
+	}
+
 	logging.Infof("cmdAdd(): getting default network namespace")
 	defaultNs, err := ns.GetCurrentNS()
 	if err != nil {
@@ -195,7 +396,7 @@ func CmdAdd(args *skel.CmdArgs) error {
 
 	logging.Infof("cmdAdd(): checking if IPAM is required")
 	if cfg.IPAM.Type != "" {
-		result, err = getIPAM(args, cfg, device, defaultNs)
+		result, err = getIPAM(args, cfg, device, podIfName, defaultNs)
 		if err != nil {
 			err = fmt.Errorf("cmdAdd(): error configuring IPAM on device %q: %w", device.Attrs().Name, err)
 			logging.Errorf(err.Error())
@@ -204,30 +405,53 @@ func CmdAdd(args *skel.CmdArgs) error {
 		}
 	}
 
+	ipAddrs := extractIPs(result)
+	if cfg.EthtoolFilters != nil {
+		if err := setEthtoolFilters(args, cfg, netHandler, ipAddrs); err != nil {
+			logging.Errorf(err.Error())
+			return err
+		}
+	}
+
 	if cfg.Mode == "primary" {
 		if cfg.EthtoolCmds != nil {
-			ethInstalled, version, err := host.HasEthtool()
+			logging.Warningf("cmdAdd(): ethtoolCmds are deprecated and will be removed in a future release, use ethtoolFilters")
+			logging.Infof("cmdAdd(): applying ethtool filters on device: %s", cfg.Device)
+			locations, err := netHandler.SetEthtool(cfg.EthtoolCmds, cfg.Device, ipAddrs)
 			if err != nil {
-				logging.Warningf("cmdAdd(): failed to discover ethtool on host: %v", err)
+				logging.Errorf("cmdAdd(): unable to executed ethtool filter: %v", err)
+				return err
 			}
-			if ethInstalled {
-				logging.Debugf("cmdAdd(): ethtool found on host")
-				logging.Debugf("\t" + version)
-				logging.Infof("cmdAdd(): applying ethtool filters on device: %s", cfg.Device)
-				iPAddr, err := extractIP(result)
-				if err != nil {
-					logging.Errorf("cmdAdd(): Error extracting IP from result interface %v", err)
-					return err
-				}
-				err = netHandler.SetEthtool(cfg.EthtoolCmds, cfg.Device, iPAddr)
-				if err != nil {
-					logging.Errorf("cmdAdd(): unable to executed ethtool filter: %v", err)
-					return err
+			if err := recordEthtoolRules(args.ContainerID, args.IfName, "", locations); err != nil {
+				if delErr := netHandler.DeleteEthtoolRules(cfg.Device, locations); delErr != nil {
+					logging.Warningf("cmdAdd(): failed to remove ethtool filters after error: %v", delErr)
 				}
+				err = fmt.Errorf("cmdAdd(): unable to record ethtool filters: %w", err)
+				logging.Errorf(err.Error())
+				return err
 			}
-		} else {
+		} else if cfg.EthtoolFilters == nil {
 			logging.Debugf("cmdAdd(): ethtool filters have not been specified")
 		}
+	} else if cfg.EthtoolCmds != nil {
+		logging.Warningf("cmdAdd(): ethtoolCmds are only applied in primary mode, use ethtoolFilters in %s mode", cfg.Mode)
+	}
+
+	if linkConfig := cfg.linkConfig(); linkConfig != nil {
+		if err := checkMultiBuffer(cfg, host); err != nil {
+			err = fmt.Errorf("cmdAdd(): unable to set mtu on device %q: %w", cfg.Device, err)
+			logging.Errorf(err.Error())
+
+			return err
+		}
+
+		logging.Infof("cmdAdd(): applying link settings on device: %s", cfg.Device)
+		if err := netHandler.SetLinkConfig(cfg.Device, linkConfig); err != nil {
+			err = fmt.Errorf("cmdAdd(): failed to apply link settings on device %q: %w", cfg.Device, err)
+			logging.Errorf(err.Error())
+
+			return err
+		}
 	}
 
 	logging.Infof("cmdAdd(): moving device from default to container network namespace")
@@ -241,6 +465,29 @@ func CmdAdd(args *skel.CmdArgs) error {
 	logging.Infof("cmdAdd(): executing within container network namespace:")
 	if err := containerNs.Do(func(_ ns.NetNS) error {
 
+		if podIfName != cfg.Device {
+			logging.Infof("cmdAdd(): renaming device %s to %s", cfg.Device, podIfName)
+			if err := netHandler.RenameDevice(cfg.Device, podIfName); err != nil {
+				err = fmt.Errorf("cmdAdd(): failed to rename device %q to %q: %w", cfg.Device, podIfName, err)
+				logging.Errorf(err.Error())
+
+				return err
+			}
+
+			// the host name, as known to the pod via the device plugin, remains usable as an altname
+			if err := netHandler.AddAltName(podIfName, cfg.Device); err != nil {
+				logging.Warningf("cmdAdd(): unable to add altname %s to device %s: %v", cfg.Device, podIfName, err)
+			}
+
+			device, err = netlink.LinkByName(podIfName)
+			if err != nil {
+				err = fmt.Errorf("cmdAdd(): failed to find renamed device %q: %w", podIfName, err)
+				logging.Errorf(err.Error())
+
+				return err
+			}
+		}
+
 		logging.Infof("cmdAdd(): set device to UP state")
 		if err := netlink.LinkSetUp(device); err != nil {
 			err = fmt.Errorf("cmdAdd(): failed to set device %q to UP state: %w", device.Attrs().Name, err)
@@ -254,6 +501,21 @@ func CmdAdd(args *skel.CmdArgs) error {
 		return err
 	}
 
+	if cfg.DPSyncer {
+		podNamespace, podName := podRef(args)
+		logging.Infof("cmdAdd(): notifying Device Plugin that device %s is attached to pod %s/%s", cfg.Device, podNamespace, podName)
+		if err := dpcnisyncer.AttachNetDev(&pb.AttachNetDevReq{
+			Name:         cfg.Device,
+			ContainerId:  args.ContainerID,
+			Netns:        args.Netns,
+			PodNamespace: podNamespace,
+			PodName:      podName,
+			IfName:       podIfName,
+		}); err != nil {
+			logging.Warningf("cmdAdd(): AttachNetDev to Syncer Server failed for %s: %v", cfg.Device, err)
+		}
+	}
+
 	if cfg.IPAM.Type != "" {
 		result, err = setIPAM(cfg, result, device, containerNs)
 		if err != nil {
@@ -275,9 +537,6 @@ func CmdAdd(args *skel.CmdArgs) error {
 CmdDel is called by kublet during pod delete
 */
 func CmdDel(args *skel.CmdArgs) error {
-	host := host.NewHandler()
-	netHandler := networking.NewHandler()
-
 	cfg, err := loadConf(args.StdinData)
 	if err != nil {
 		err = fmt.Errorf("cmdDel(): error loading config data: %w", err)
@@ -286,15 +545,34 @@ func CmdDel(args *skel.CmdArgs) error {
 		return err
 	}
 
+	logging.Infof("cmdDel(): loading cached device state")
+	state, err := loadState(args.ContainerID, args.IfName)
+	if err != nil {
+		logging.Warningf("cmdDel(): unable to load cached device state, device will not be fully restored: %v", err)
+	}
+
+	originalName := cfg.Device
+	if state != nil && state.Device != nil && state.Device.Name != "" {
+		originalName = state.Device.Name
+	}
+	podIfName := podInterfaceName(args, cfg)
+	hostName := originalName
+
 	logging.Infof("cmdDel(): getting container network namespace")
 	containerNs, err := ns.GetNS(args.Netns)
 	if err != nil {
-		err = fmt.Errorf("cmdDel(): failed to open container netns %q: %w", args.Netns, err)
-		logging.Errorf(err.Error())
+		var nsErr ns.NSPathNotExistErr
+		if !errors.As(err, &nsErr) {
+			err = fmt.Errorf("cmdDel(): failed to open container netns %q: %w", args.Netns, err)
+			logging.Errorf(err.Error())
 
-		return err
+			return err
+		}
+		logging.Infof("cmdDel(): container netns %q no longer exists, device has returned to host", args.Netns)
+		containerNs = nil
+	} else {
+		defer containerNs.Close()
 	}
-	defer containerNs.Close()
 
 	logging.Infof("cmdDel(): getting default network namespace")
 	defaultNs, err := ns.GetCurrentNS()
@@ -306,29 +584,69 @@ func CmdDel(args *skel.CmdArgs) error {
 	}
 	defer defaultNs.Close()
 
-	logging.Infof("cmdDel(): executing within container network namespace:")
-	if err := containerNs.Do(func(_ ns.NetNS) error {
-
-		logging.Infof("cmdDel(): getting device from name")
-		device, err := netlink.LinkByName(cfg.Device)
+	if containerNs != nil {
+		collision, err := netHandler.NetDevExists(originalName)
 		if err != nil {
-			err = fmt.Errorf("cmdDel(): failed to find device %q in containerNS: %w", cfg.Device, err)
-			logging.Errorf(err.Error())
-
-			return err
+			logging.Warningf("cmdDel(): unable to check host for device name %s: %v", originalName, err)
+		}
+		if collision {
+			hostName = tempDeviceName(args.ContainerID)
+			logging.Warningf("cmdDel(): device name %s is in use on host, device will be returned as %s", originalName, hostName)
 		}
 
-		logging.Infof("cmdDel(): moving device from container to default network namespace")
-		if err = netlink.LinkSetNsFd(device, int(defaultNs.Fd())); err != nil {
-			err = fmt.Errorf("cmdDel(): failed to move %q to host netns: %w", device.Attrs().Alias, err)
-			logging.Errorf(err.Error())
+		logging.Infof("cmdDel(): executing within container network namespace:")
+		if err := containerNs.Do(func(_ ns.NetNS) error {
+
+			logging.Infof("cmdDel(): getting device from name")
+			device, err := netlink.LinkByName(podIfName)
+			if err != nil {
+				// device may have been added before devices were renamed
+				device, err = netlink.LinkByName(cfg.Device)
+			}
+			if err != nil {
+				err = fmt.Errorf("cmdDel(): failed to find device %q in containerNS: %w", podIfName, err)
+				logging.Errorf(err.Error())
+
+				return err
+			}
+
+			if device.Attrs().Name != hostName {
+				// an altname matching the new name would block the rename
+				if err := netHandler.DeleteAltName(device.Attrs().Name, originalName); err != nil {
+					logging.Debugf("cmdDel(): no altname %s to remove from device %s: %v", originalName, device.Attrs().Name, err)
+				}
+
+				logging.Infof("cmdDel(): renaming device %s to %s", device.Attrs().Name, hostName)
+				if err := netHandler.RenameDevice(device.Attrs().Name, hostName); err != nil {
+					err = fmt.Errorf("cmdDel(): failed to rename device %q to %q: %w", device.Attrs().Name, hostName, err)
+					logging.Errorf(err.Error())
+
+					return err
+				}
+
+				device, err = netlink.LinkByName(hostName)
+				if err != nil {
+					err = fmt.Errorf("cmdDel(): failed to find renamed device %q: %w", hostName, err)
+					logging.Errorf(err.Error())
+
+					return err
+				}
+			}
 
+			logging.Infof("cmdDel(): moving device from container to default network namespace")
+			if err = netlink.LinkSetNsFd(device, int(defaultNs.Fd())); err != nil {
+				err = fmt.Errorf("cmdDel(): failed to move %q to host netns: %w", device.Attrs().Alias, err)
+				logging.Errorf(err.Error())
+
+				return err
+			}
+
+			return nil
+		}); err != nil {
 			return err
 		}
-
-		return nil
-	}); err != nil {
-		return err
+	} else {
+		hostName = locateHostDevice(netHandler, originalName, state)
 	}
 
 	logging.Infof("cmdDel(): cleaning IPAM config on device")
@@ -339,64 +657,223 @@ func CmdDel(args *skel.CmdArgs) error {
 	}
 
 	if cfg.DPSyncer {
-		logging.Infof("cmdDel(): Asking Device Plugin to delete any BPF maps for %s", cfg.Device)
-		err := dpcnisyncer.DeleteNetDev(cfg.Device)
+		logging.Infof("cmdDel(): Asking Device Plugin to delete any BPF maps for %s", originalName)
+		err := dpcnisyncer.DeleteNetDev(originalName)
 		if err != nil {
-			logging.Errorf("cmdDel(): DeleteNetDev from Syncer Server Failed for %s: %v", cfg.Device, err)
+			logging.Errorf("cmdDel(): DeleteNetDev from Syncer Server Failed for %s: %v", originalName, err)
 		}
+
 	}
 
 	if !cfg.SkipUnloadBpf {
 		logging.Infof("cmdDel(): removing BPF program from device")
-		if err := bpfHandler.Cleanbpf(cfg.Device); err != nil {
+		if err := bpfHandler.Cleanbpf(hostName); err != nil {
 			err = fmt.Errorf("cmdDel(): error removing BPF program from device: %w", err)
 			logging.Errorf(err.Error())
 
 			return err
 		}
 	}
-	if cfg.Mode == "primary" {
-		if cfg.EthtoolCmds != nil {
-			logging.Debugf("cmdDel: checking host for Ethtool")
-			ethInstalled, _, err := host.HasEthtool()
-			if err != nil {
-				logging.Errorf("cmdDel(): error checking if Ethtool is present on host: %v", err)
-				return err
+	if state != nil {
+		for _, rules := range state.EthtoolRules {
+			ruleDevice := rules.Device
+			if ruleDevice == "" {
+				ruleDevice = hostName
 			}
-			if ethInstalled {
-				logging.Infof("cmdDel(): Removing ethtool filters on device: %s", cfg.Device)
-				err := netHandler.DeleteEthtool(cfg.Device)
-				if err != nil {
-					logging.Warningf("cmdDel(): failed to remove ethtool filter: %v", err)
-				}
+			logging.Infof("cmdDel(): removing ethtool filters from device %s", ruleDevice)
+			if err := netHandler.DeleteEthtoolRules(ruleDevice, rules.Locations); err != nil {
+				logging.Warningf("cmdDel(): failed to remove ethtool filters from device %s: %v", ruleDevice, err)
+			}
+		}
+	}
+	if state != nil && state.Device != nil {
+		logging.Infof("cmdDel(): restoring device %s to its original state", hostName)
+		if err := netHandler.RestoreDeviceState(hostName, state.Device); err != nil {
+			logging.Warningf("cmdDel(): failed to fully restore device state: %v", err)
+		}
+	}
+	if state == nil && (cfg.EthtoolCmds != nil || cfg.EthtoolFilters != nil) {
+		if cfg.Mode == "primary" {
+			logging.Warningf("cmdDel(): no record of the ethtool filters added for this attachment, removing all filters on device: %s", hostName)
+			if err := netHandler.DeleteEthtool(hostName); err != nil {
+				logging.Warningf("cmdDel(): failed to remove ethtool filter: %v", err)
 			}
+		} else {
+			logging.Warningf("cmdDel(): no record of the ethtool filters added for this attachment, filters have not been removed")
 		}
 	}
 
-	if cfg.Mode == "cdq" {
-		isSf, err := netHandler.IsCdqSubfunction(cfg.Device)
+	detached := false
+	if cfg.DPSyncer {
+		logging.Infof("cmdDel(): notifying Device Plugin that device %s is detached", originalName)
+		if err := dpcnisyncer.DetachNetDev(originalName, args.ContainerID); err != nil {
+			logging.Errorf("cmdDel(): DetachNetDev from Syncer Server Failed for %s: %v", originalName, err)
+		} else {
+			detached = true
+		}
+	}
+
+	if cfg.Mode == "cdq" && detached {
+		logging.Infof("cmdDel(): subfunction %s will be deleted by the Device Plugin", hostName)
+	} else if cfg.Mode == "cdq" {
+		isSf, err := netHandler.IsCdqSubfunction(hostName)
 		if err != nil {
-			logging.Errorf("cmdDel(): error determining if %s is a CDQ subfunction: %v", cfg.Device, err)
+			logging.Errorf("cmdDel(): error determining if %s is a CDQ subfunction: %v", hostName, err)
 			isSf = false
 		}
 		if isSf {
-			logging.Debugf("cmdDel(): deleting subfunction %s", cfg.Device)
-			portIndex, err := netHandler.GetCdqPortIndex(cfg.Device)
+			logging.Debugf("cmdDel(): deleting subfunction %s", hostName)
+			portIndex, err := netHandler.GetCdqPortIndex(hostName)
 			if err != nil {
-				logging.Errorf("cmdDel(): error getting port index of device %s: %v", cfg.Device, err)
+				logging.Errorf("cmdDel(): error getting port index of device %s: %v", hostName, err)
 			} else {
 				if err := netHandler.DeleteCdqSubfunction(portIndex); err != nil {
-					logging.Errorf("cmdDel(): error deleting CDQ subfunction %s: %v", cfg.Device, err)
+					logging.Errorf("cmdDel(): error deleting CDQ subfunction %s: %v", hostName, err)
 				} else {
-					logging.Infof("cmdDel(): subfunction %s deleted", cfg.Device)
+					logging.Infof("cmdDel(): subfunction %s deleted", hostName)
 				}
 			}
 		}
 	}
 
+	if err := deleteState(args.ContainerID, args.IfName); err != nil {
+		logging.Warningf("cmdDel(): failed to remove cached device state: %v", err)
+	}
+
+	return nil
+}
+
+/*
+podInterfaceName returns the name the device is given inside the container.
+This is the interface name requested by the runtime, or the host name of the device if none was requested.
+*/
+func podInterfaceName(args *skel.CmdArgs, cfg *NetConfig) string {
+	if args.IfName != "" {
+		return args.IfName
+	}
+	return cfg.Device
+}
+
+/*
+podRef returns the namespace and name of the pod, as passed by the runtime in the CNI_ARGS.
+Empty strings are returned if the runtime did not pass them.
+*/
+func podRef(args *skel.CmdArgs) (string, string) {
+	k8sArgs := struct {
+		types.CommonArgs
+		K8S_POD_NAMESPACE types.UnmarshallableString
+		K8S_POD_NAME      types.UnmarshallableString
+	}{}
+
+	if err := types.LoadArgs(args.Args, &k8sArgs); err != nil {
+		logging.Warningf("Unable to parse CNI args %q: %v", args.Args, err)
+		return "", ""
+	}
+	return string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME)
+}
+
+/*
+checkNetDevInfo validates the device details returned by the Device Plugin. The device must
+be in the mode of the network attachment, allocated by the kubelet and not attached to
+another container.
+*/
+func checkNetDevInfo(info *pb.GetNetDevInfoResp, cfg *NetConfig, containerID string) error {
+	if info.GetMode() != cfg.Mode {
+		return fmt.Errorf("cmdAdd(): device %q is in %s mode, not %s mode", cfg.Device, info.GetMode(), cfg.Mode)
+	}
+	if !info.GetAllocated() {
+		return fmt.Errorf("cmdAdd(): device %q has not been allocated by the Device Plugin", cfg.Device)
+	}
+	if info.GetContainerId() != "" && info.GetContainerId() != containerID {
+		return fmt.Errorf("cmdAdd(): device %q is already attached to pod %s/%s", cfg.Device, info.GetPodNamespace(), info.GetPodName())
+	}
 	return nil
 }
 
+/*
+tempDeviceName returns a host device name that is unique to the container. It is used to
+return a device to the host when its original name has since been taken by another device.
+*/
+func tempDeviceName(containerID string) string {
+	suffix := containerID
+	if len(suffix) > 10 {
+		suffix = suffix[:10]
+	}
+	return "afxdp" + suffix
+}
+
+/*
+locateHostDevice finds a device that returned to the host namespace when its container
+network namespace was destroyed, for example after a node reboot. The device still has the
+name it was given in the container, so it is found by its original MAC address, or by the
+altname holding its original name. The device is renamed back to its original name if possible.
+The name of the device on the host is returned.
+*/
+func locateHostDevice(netHandler networking.Handler, originalName string, state *attachmentState) string {
+	currentName := ""
+
+	if state != nil && state.Device != nil && state.Device.Mac != "" {
+		name, err := netHandler.GetDeviceByMAC(state.Device.Mac)
+		if err != nil {
+			logging.Warningf("locateHostDevice(): error searching for device with MAC %s: %v", state.Device.Mac, err)
+		}
+		currentName = name
+	}
+
+	if currentName == "" {
+		device, err := netlink.LinkByName(originalName)
+		if err != nil {
+			logging.Warningf("locateHostDevice(): unable to find device %s on host: %v", originalName, err)
+			return originalName
+		}
+		currentName = device.Attrs().Name
+	}
+
+	if currentName == originalName {
+		return originalName
+	}
+
+	if err := netHandler.DeleteAltName(currentName, originalName); err != nil {
+		logging.Debugf("locateHostDevice(): no altname %s to remove from device %s: %v", originalName, currentName, err)
+	}
+
+	logging.Infof("locateHostDevice(): renaming device %s to %s", currentName, originalName)
+	if err := netHandler.RenameDevice(currentName, originalName); err != nil {
+		logging.Warningf("locateHostDevice(): unable to rename device %s to %s, device remains %s: %v", currentName, originalName, currentName, err)
+		return currentName
+	}
+
+	return originalName
+}
+
+/*
+cacheDeviceState takes a snapshot of the device before it is modified or moved into the
+container and writes it to the state cache. If state already exists for this attachment,
+ADD is being retried and the device may already be modified, so the existing state is kept.
+*/
+func cacheDeviceState(args *skel.CmdArgs, cfg *NetConfig, netHandler networking.Handler) error {
+	existing, err := loadState(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		logging.Debugf("cacheDeviceState(): state already cached for %s %s, keeping original", args.ContainerID, args.IfName)
+		return nil
+	}
+
+	deviceState, err := netHandler.GetDeviceState(cfg.Device)
+	if err != nil {
+		return err
+	}
+
+	return saveState(&attachmentState{
+		ContainerID: args.ContainerID,
+		IfName:      args.IfName,
+		Netns:       args.Netns,
+		Device:      deviceState,
+	})
+}
+
 func printLink(dev netlink.Link, cniVersion string, containerNs ns.NetNS) error {
 	result := current.Result{
 		CNIVersion: current.ImplementedSpecVersion,
@@ -411,7 +888,7 @@ func printLink(dev netlink.Link, cniVersion string, containerNs ns.NetNS) error
 	return types.PrintResult(&result, cniVersion)
 }
 
-func getIPAM(args *skel.CmdArgs, cfg *NetConfig, device netlink.Link, netns ns.NetNS) (*current.Result, error) {
+func getIPAM(args *skel.CmdArgs, cfg *NetConfig, device netlink.Link, podIfName string, netns ns.NetNS) (*current.Result, error) {
 	var result *current.Result
 
 	logging.Infof("configureIPAM(): running IPAM plugin: " + cfg.IPAM.Type)
@@ -450,7 +927,7 @@ func getIPAM(args *skel.CmdArgs, cfg *NetConfig, device netlink.Link, netns ns.N
 	}
 
 	result.Interfaces = []*current.Interface{{
-		Name:    device.Attrs().Name,
+		Name:    podIfName,
 		Mac:     device.Attrs().HardwareAddr.String(),
 		Sandbox: netns.Path(),
 	}}
@@ -492,17 +969,104 @@ func CmdCheck(args *skel.CmdArgs) error {
 }
 
 /*
-extractIP extracts the IP address from the Result interface
-and returns the IP as type string
+setEthtoolFilters applies the structured ethtool filters of the attachment and records the
+rules in the attachment state. In primary mode the filters are applied to the device itself.
+In cdq mode they are applied to the parent port of the subfunction, where the steering rules
+for the pod traffic must be programmed, with the actions translated by cdqFilters.
+*/
+func setEthtoolFilters(args *skel.CmdArgs, cfg *NetConfig, netHandler networking.Handler, ipAddrs []string) error {
+	filters := cfg.EthtoolFilters
+	filterDevice := cfg.Device
+	recordDevice := ""
+	if cfg.Mode == "cdq" {
+		primary, err := netHandler.GetCdqPrimary(cfg.Device)
+		if err != nil {
+			return fmt.Errorf("cmdAdd(): unable to find parent port of subfunction %q: %w", cfg.Device, err)
+		}
+		start, count, err := netHandler.GetCdqQueueRange(cfg.Device)
+		if err != nil {
+			return fmt.Errorf("cmdAdd(): unable to find queues of subfunction %q on parent port: %w", cfg.Device, err)
+		}
+		filters, err = cdqFilters(filters, start, count)
+		if err != nil {
+			return fmt.Errorf("cmdAdd(): invalid ethtool filters for subfunction %q: %w", cfg.Device, err)
+		}
+		filterDevice, recordDevice = primary, primary
+	}
+
+	if usesIPPlaceholder(cfg.EthtoolFilters) && len(ipAddrs) == 0 {
+		return fmt.Errorf("cmdAdd(): ethtool filters use the pod IP but IPAM returned no addresses")
+	}
+
+	logging.Infof("cmdAdd(): applying structured ethtool filters on device: %s", filterDevice)
+	locations, err := netHandler.SetEthtoolFilters(filters, filterDevice, ipAddrs)
+	if err != nil {
+		return fmt.Errorf("cmdAdd(): unable to apply ethtool filters on device %q: %w", filterDevice, err)
+	}
+
+	if err := recordEthtoolRules(args.ContainerID, args.IfName, recordDevice, locations); err != nil {
+		if delErr := netHandler.DeleteEthtoolRules(filterDevice, locations); delErr != nil {
+			logging.Warningf("cmdAdd(): failed to remove ethtool filters after error: %v", delErr)
+		}
+		return fmt.Errorf("cmdAdd(): unable to record ethtool filters: %w", err)
+	}
+
+	return nil
+}
+
+/*
+cdqFilters translates filters written for a subfunction into filters for its parent port.
+The action of a filter is a queue of the subfunction, 0 to count-1, and is moved to the
+queues of the subfunction on the parent port, which start at start. Drop actions are kept.
+RSS contexts belong to the parent port and are not supported.
 */
-func extractIP(result *current.Result) (string, error) {
-	resultIP := fmt.Sprintf("%s", result.IPs)
-	if len(resultIP) != 0 {
-		ip := strings.Split(resultIP, " ")[1]
-		ip = strings.Split(ip, "IP:")[1]
-		return ip, nil
+func cdqFilters(filters []*networking.EthtoolFilter, start uint32, count uint32) ([]*networking.EthtoolFilter, error) {
+	var translated []*networking.EthtoolFilter
+
+	for _, filter := range filters {
+		parentFilter := *filter
+		if filter.Context != nil {
+			return nil, fmt.Errorf("filter [%s]: context is not supported in cdq mode", filter)
+		}
+		if filter.Action != nil && *filter.Action != constants.EthtoolFilter.ActionDrop {
+			if *filter.Action < 0 || uint32(*filter.Action) >= count {
+				return nil, fmt.Errorf("filter [%s]: action must be a queue of the subfunction, 0 to %d", filter, int(count)-1)
+			}
+			action := int(start) + *filter.Action
+			parentFilter.Action = &action
+		}
+		translated = append(translated, &parentFilter)
 	}
-	err := fmt.Errorf("extractIP(): ip is an empty string")
 
-	return resultIP, err
+	return translated, nil
+}
+
+/*
+usesIPPlaceholder returns true if any of the filters contain the pod IP placeholder
+*/
+func usesIPPlaceholder(filters []*networking.EthtoolFilter) bool {
+	for _, filter := range filters {
+		if filter.UsesIPPlaceholder() {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+extractIPs returns the addresses from the IPAM result, without prefix lengths,
+in the order IPAM returned them. A nil result returns no addresses.
+*/
+func extractIPs(result *current.Result) []string {
+	var ipAddrs []string
+	if result == nil {
+		return ipAddrs
+	}
+	for _, ipConfig := range result.IPs {
+		if ipConfig == nil || ipConfig.Address.IP == nil {
+			continue
+		}
+		ipAddrs = append(ipAddrs, ipConfig.Address.IP.String())
+	}
+	return ipAddrs
 }
@@ -19,9 +19,15 @@ import (
 	"errors"
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/bpf"
+	pb "github.com/intel/afxdp-plugins-for-kubernetes/internal/dpcnisyncer"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -99,6 +105,144 @@ func TestGetConfig(t *testing.T) {
 			expConfig: nil,
 			expErr:    errors.New("loadConf(): Config validation error: deviceID: device names must only contain letters, numbers and selected symbols"),
 		},
+		{
+			name:      "load good config 8 - link settings",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","mtu":3000,"mac":"02:00:00:00:00:01","vlan":100,"promisc":"on","trust":"on","spoofchk":"off"}`,
+			expConfig: &NetConfig{NetConf: netConf, Device: "dev1", Mode: "primary", Mtu: 3000, Mac: "02:00:00:00:00:01", Vlan: intPtr(100), Promisc: "on", Trust: "on", Spoofchk: "off"},
+		},
+		{
+			name:      "load good config 9 - jumbo mtu with multi-buffer",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","mtu":9000,"xdpMultiBuffer":true}`,
+			expConfig: &NetConfig{NetConf: netConf, Device: "dev1", Mode: "primary", Mtu: 9000, XdpMultiBuffer: true},
+		},
+		{
+			name:      "load bad config 10 - jumbo mtu without multi-buffer",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","mtu":9000}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): mtu must be no more than 3498"),
+		},
+		{
+			name:      "load bad config 11 - mtu too small",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","mtu":10}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): mtu must be at least 68"),
+		},
+		{
+			name:      "load bad config 12 - multicast mac",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","mac":"01:00:5e:00:00:01"}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): mac must be a unicast MAC address"),
+		},
+		{
+			name:      "load bad config 13 - invalid mac",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","mac":"not-a-mac"}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): mac must be a valid Ethernet MAC address"),
+		},
+		{
+			name:      "load bad config 14 - vlan out of range",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","vlan":4095}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): vlan must be no more than 4094"),
+		},
+		{
+			name:      "load bad config 15 - invalid trust setting",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","trust":"yes"}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): trust must be [on off]"),
+		},
+		{
+			name:      "load good config 16 - queues and ring sizes",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","queues":"8","rxRingSize":2048,"txRingSize":1024}`,
+			expConfig: &NetConfig{NetConf: netConf, Device: "dev1", Mode: "primary", Queues: "8", RxRingSize: 2048, TxRingSize: 1024},
+		},
+		{
+			name:      "load bad config 17 - zero queues",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","queues":"0"}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): queues must be a positive whole number"),
+		},
+		{
+			name:      "load bad config 18 - non numeric queues",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","queues":"four"}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): queues must be a positive whole number"),
+		},
+		{
+			name:      "load bad config 19 - negative ring size",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","rxRingSize":-1}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): rxRingSize must be a positive whole number"),
+		},
+		{
+			name:   "load good config 20 - structured ethtool filters",
+			config: `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[{"flowType":"udp4","dstIp":"-ip-","dstPort":4789,"action":3},{"flowType":"tcp6","srcIp":"fd00::1","action":-1}]}`,
+			expConfig: &NetConfig{NetConf: netConf, Device: "dev1", Mode: "primary", EthtoolFilters: []*networking.EthtoolFilter{
+				{FlowType: "udp4", DstIP: "-ip-", DstPort: intPtr(4789), Action: intPtr(3)},
+				{FlowType: "tcp6", SrcIP: "fd00::1", Action: intPtr(-1)},
+			}},
+		},
+		{
+			name:      "load bad config 21 - ethtool filter bad flow type",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[{"flowType":"ether","action":1}]}`,
+			expConfig: nil,
+			expErr:    errors.New("flowType must be"),
+		},
+		{
+			name:      "load bad config 22 - ethtool filter missing action",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[{"flowType":"udp4","dstPort":4789}]}`,
+			expConfig: nil,
+			expErr:    errors.New("action must be specified"),
+		},
+		{
+			name:      "load bad config 23 - ethtool filter IP version mismatch",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[{"flowType":"udp4","dstIp":"fd00::1","action":1}]}`,
+			expConfig: nil,
+			expErr:    errors.New("IP address version does not match flowType udp4"),
+		},
+		{
+			name:      "load bad config 24 - ethtool filter port on ip4 flow",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[{"flowType":"ip4","dstPort":80,"action":1}]}`,
+			expConfig: nil,
+			expErr:    errors.New("dstPort is only valid for tcp, udp and sctp flow types"),
+		},
+		{
+			name:      "load bad config 25 - ethtool filter port out of range",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[{"flowType":"tcp4","srcPort":70000,"action":1}]}`,
+			expConfig: nil,
+			expErr:    errors.New("srcPort must be between 0 and 65535"),
+		},
+		{
+			name:   "load good config 26 - ethtool filter family placeholders",
+			config: `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[{"flowType":"udp6","dstIp":"-ip6-","action":1},{"flowType":"tcp4","srcIp":"-ip4-","action":2}]}`,
+			expConfig: &NetConfig{NetConf: netConf, Device: "dev1", Mode: "primary", EthtoolFilters: []*networking.EthtoolFilter{
+				{FlowType: "udp6", DstIP: "-ip6-", Action: intPtr(1)},
+				{FlowType: "tcp4", SrcIP: "-ip4-", Action: intPtr(2)},
+			}},
+		},
+		{
+			name:      "load bad config 27 - ethtool filter IPv6 placeholder on IPv4 flow",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[{"flowType":"udp4","dstIp":"-ip6-","action":1}]}`,
+			expConfig: nil,
+			expErr:    errors.New("-ip6- cannot be used with flowType udp4"),
+		},
+		{
+			name:      "load bad config 28 - raw ethtool commands without opt-in",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolCmds":["-N -device- flow-type udp4 dst-ip -ip- action 3"]}`,
+			expConfig: nil,
+			expErr:    errors.New("validate(): raw ethtoolCmds are deprecated"),
+		},
+		{
+			name:      "load good config 29 - raw ethtool commands with opt-in",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","allowRawEthtoolCmds":true,"ethtoolCmds":["-N -device- flow-type udp4 dst-ip -ip- action 3"]}`,
+			expConfig: &NetConfig{NetConf: netConf, Device: "dev1", Mode: "primary", AllowRawEthtoolCmds: true, EthtoolCmds: []string{"-N -device- flow-type udp4 dst-ip -ip- action 3"}},
+		},
+		{
+			name:      "load bad config 30 - null ethtool filter",
+			config:    `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","type":"afxdp","mode":"primary","ethtoolFilters":[null]}`,
+			expConfig: nil,
+			expErr:    errors.New("ethtoolFilters: (0: cannot be null.)"),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -229,3 +373,415 @@ func TestCmdDel(t *testing.T) {
 		})
 	}
 }
+
+func TestCmdDelHostDevice(t *testing.T) {
+	stateDir = t.TempDir()
+	defer func(handler networking.Handler) { netHandler = handler }(netHandler)
+	containerID := "0123456789abcdef"
+	netConfStr := `{"cniVersion":"0.3.0","deviceID":"dev1","name":"test-network","skipUnloadBpf":true,"type":"afxdp"}`
+
+	testCases := []struct {
+		name         string
+		netNS        string
+		ifName       string
+		state        *attachmentState
+		macDevices   map[string]string
+		netDevExists bool
+		needsRoot    bool
+		expError     string
+		expRenames   map[string]string
+	}{
+		{
+			name:   "netns gone - device found by MAC and renamed",
+			netNS:  filepath.Join(t.TempDir(), "missing-netns"),
+			ifName: "net1",
+			state: &attachmentState{
+				ContainerID: containerID,
+				IfName:      "net1",
+				Device:      &networking.DeviceState{Name: "dev1", Mac: "02:00:00:00:00:01"},
+			},
+			macDevices: map[string]string{"02:00:00:00:00:01": "net1"},
+			expRenames: map[string]string{"net1": "dev1"},
+		},
+		{
+			name:   "netns gone - device already has original name",
+			netNS:  filepath.Join(t.TempDir(), "missing-netns"),
+			ifName: "net1",
+			state: &attachmentState{
+				ContainerID: containerID,
+				IfName:      "net1",
+				Device:      &networking.DeviceState{Name: "dev1", Mac: "02:00:00:00:00:01"},
+			},
+			macDevices: map[string]string{"02:00:00:00:00:01": "dev1"},
+		},
+		{
+			name:         "name collision on host - device returned under temporary name",
+			netNS:        "/proc/self/ns/net",
+			ifName:       "lo",
+			netDevExists: true,
+			needsRoot:    true,
+			expError:     "cmdDel(): failed to find renamed device \"" + tempDeviceName(containerID) + "\"",
+			expRenames:   map[string]string{"lo": tempDeviceName(containerID)},
+		},
+		{
+			name:         "no name collision on host - device returned under original name",
+			netNS:        "/proc/self/ns/net",
+			ifName:       "lo",
+			netDevExists: false,
+			needsRoot:    true,
+			expError:     "cmdDel(): failed to find renamed device \"dev1\"",
+			expRenames:   map[string]string{"lo": "dev1"},
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.needsRoot && os.Geteuid() != 0 {
+				t.Skip("entering a network namespace requires root")
+			}
+
+			fakeNet := networking.NewFakeHandler()
+			fakeNet.SetNetDevExists(tc.netDevExists)
+			for mac, name := range tc.macDevices {
+				fakeNet.SetDeviceByMAC(mac, name)
+			}
+			netHandler = fakeNet
+			bpfHandler = bpf.NewFakeHandler()
+
+			if tc.state != nil {
+				require.NoError(t, saveState(tc.state), "Unexpected error saving state")
+			}
+
+			args := &skel.CmdArgs{
+				ContainerID: containerID,
+				Netns:       tc.netNS,
+				IfName:      tc.ifName,
+				StdinData:   []byte(netConfStr),
+			}
+			err := CmdDel(args)
+
+			if tc.expError == "" {
+				require.NoError(t, err, "Unexpected error")
+			} else {
+				require.Error(t, err, "Expected error")
+				assert.Contains(t, err.Error(), tc.expError, "Unexpected error")
+			}
+			assert.Equal(t, len(tc.expRenames), len(fakeNet.GetRenamedDevices()), "Unexpected number of renames")
+			for from, to := range tc.expRenames {
+				assert.Equal(t, to, fakeNet.GetRenamedDevices()[from], "Unexpected rename of "+from)
+			}
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	stateDir = t.TempDir()
+
+	testCases := []struct {
+		name        string
+		containerID string
+		ifName      string
+		expError    string
+	}{
+		{
+			name:        "valid state key",
+			containerID: "0123456789abcdef",
+			ifName:      "net1",
+		},
+		{
+			name:        "invalid container ID",
+			containerID: "../../etc",
+			ifName:      "net1",
+			expError:    "statePath(): invalid state key",
+		},
+		{
+			name:        "invalid interface name",
+			containerID: "0123456789abcdef",
+			ifName:      "net/1",
+			expError:    "statePath(): invalid state key",
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			ntuple := true
+			state := &attachmentState{
+				ContainerID: tc.containerID,
+				IfName:      tc.ifName,
+				Netns:       "/var/run/netns/test",
+				Device: &networking.DeviceState{
+					Name:     "ens801f0",
+					Mtu:      1500,
+					Mac:      "aa:bb:cc:dd:ee:ff",
+					Up:       true,
+					Channels: &networking.DeviceChannels{Combined: 16},
+					RssTable: []uint32{0, 1, 2, 3},
+					Ntuple:   &ntuple,
+				},
+			}
+
+			err := saveState(state)
+			if tc.expError != "" {
+				require.Error(t, err, "Unexpected success")
+				assert.Contains(t, err.Error(), tc.expError, "Unexpected error")
+				return
+			}
+			require.NoError(t, err, "Unexpected error saving state")
+
+			loaded, err := loadState(tc.containerID, tc.ifName)
+			require.NoError(t, err, "Unexpected error loading state")
+			assert.Equal(t, state, loaded, "Loaded state does not match saved state")
+
+			require.NoError(t, deleteState(tc.containerID, tc.ifName), "Unexpected error deleting state")
+
+			loaded, err = loadState(tc.containerID, tc.ifName)
+			require.NoError(t, err, "Unexpected error loading deleted state")
+			assert.Nil(t, loaded, "State still present after delete")
+
+			require.NoError(t, deleteState(tc.containerID, tc.ifName), "Deleting absent state should not error")
+		})
+	}
+}
+
+func TestRecordEthtoolRules(t *testing.T) {
+	stateDir = t.TempDir()
+
+	testCases := []struct {
+		name     string
+		existing *attachmentState
+		records  []*ethtoolRules
+		expRules []*ethtoolRules
+	}{
+		{
+			name:     "no existing state",
+			records:  []*ethtoolRules{{Locations: []uint32{1, 2}}},
+			expRules: []*ethtoolRules{{Locations: []uint32{1, 2}}},
+		},
+		{
+			name: "existing device state is kept",
+			existing: &attachmentState{
+				ContainerID: "0123456789abcdef",
+				IfName:      "net1",
+				Device:      &networking.DeviceState{Name: "ens801f0sf1", Mtu: 1500},
+			},
+			records:  []*ethtoolRules{{Device: "ens801f0", Locations: []uint32{7}}},
+			expRules: []*ethtoolRules{{Device: "ens801f0", Locations: []uint32{7}}},
+		},
+		{
+			name: "rules are appended",
+			records: []*ethtoolRules{
+				{Device: "ens801f0", Locations: []uint32{7}},
+				{Device: "ens801f0", Locations: []uint32{8, 9}},
+			},
+			expRules: []*ethtoolRules{
+				{Device: "ens801f0", Locations: []uint32{7}},
+				{Device: "ens801f0", Locations: []uint32{8, 9}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			containerID, ifName := "0123456789abcdef", "net1"
+			defer deleteState(containerID, ifName)
+
+			if tc.existing != nil {
+				require.NoError(t, saveState(tc.existing), "Unexpected error saving state")
+			}
+			for _, record := range tc.records {
+				require.NoError(t, recordEthtoolRules(containerID, ifName, record.Device, record.Locations), "Unexpected error recording rules")
+			}
+
+			loaded, err := loadState(containerID, ifName)
+			require.NoError(t, err, "Unexpected error loading state")
+			require.NotNil(t, loaded, "State was not saved")
+			assert.Equal(t, tc.expRules, loaded.EthtoolRules, "Unexpected ethtool rules")
+			if tc.existing != nil {
+				assert.Equal(t, tc.existing.Device, loaded.Device, "Device state was not kept")
+			}
+		})
+	}
+}
+
+func TestExtractIPs(t *testing.T) {
+	testCases := []struct {
+		name   string
+		result *current.Result
+		expIPs []string
+	}{
+		{
+			name:   "nil result",
+			result: nil,
+			expIPs: nil,
+		},
+		{
+			name:   "no addresses",
+			result: &current.Result{},
+			expIPs: nil,
+		},
+		{
+			name: "single IPv4 address",
+			result: &current.Result{IPs: []*current.IPConfig{
+				{Address: net.IPNet{IP: net.ParseIP("192.168.1.200"), Mask: net.CIDRMask(24, 32)}},
+			}},
+			expIPs: []string{"192.168.1.200"},
+		},
+		{
+			name: "dual-stack addresses",
+			result: &current.Result{IPs: []*current.IPConfig{
+				{Address: net.IPNet{IP: net.ParseIP("fd00::c8"), Mask: net.CIDRMask(64, 128)}},
+				{Address: net.IPNet{IP: net.ParseIP("192.168.1.200"), Mask: net.CIDRMask(24, 32)}},
+			}},
+			expIPs: []string{"fd00::c8", "192.168.1.200"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expIPs, extractIPs(tc.result), "Unexpected IP addresses")
+		})
+	}
+}
+
+func TestCdqFilters(t *testing.T) {
+	queue := func(q int) *int { return &q }
+
+	testCases := []struct {
+		name       string
+		filters    []*networking.EthtoolFilter
+		expActions []int
+		expErr     string
+	}{
+		{
+			name: "actions moved to the queues of the subfunction",
+			filters: []*networking.EthtoolFilter{
+				{FlowType: "udp4", DstIP: "-ip4-", Action: queue(0)},
+				{FlowType: "tcp4", DstIP: "-ip4-", Action: queue(3)},
+			},
+			expActions: []int{16, 19},
+		},
+		{
+			name: "drop action kept",
+			filters: []*networking.EthtoolFilter{
+				{FlowType: "udp4", DstIP: "-ip4-", Action: queue(-1)},
+			},
+			expActions: []int{-1},
+		},
+		{
+			name: "action outside the subfunction",
+			filters: []*networking.EthtoolFilter{
+				{FlowType: "udp4", DstIP: "-ip4-", Action: queue(4)},
+			},
+			expErr: "action must be a queue of the subfunction, 0 to 3",
+		},
+		{
+			name: "context not supported",
+			filters: []*networking.EthtoolFilter{
+				{FlowType: "udp4", DstIP: "-ip4-", Action: queue(0), Context: queue(1)},
+			},
+			expErr: "context is not supported in cdq mode",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			original := *tc.filters[0].Action
+			filters, err := cdqFilters(tc.filters, 16, 4)
+			if tc.expErr != "" {
+				require.Error(t, err, "Expected an error")
+				assert.Contains(t, err.Error(), tc.expErr, "Unexpected error message")
+				return
+			}
+			require.NoError(t, err, "Unexpected error")
+			require.Len(t, filters, len(tc.expActions), "Unexpected number of filters")
+			for i, filter := range filters {
+				assert.Equal(t, tc.expActions[i], *filter.Action, "Unexpected action")
+			}
+			assert.Equal(t, original, *tc.filters[0].Action, "Config filter was modified")
+		})
+	}
+}
+
+func TestCheckNetDevInfo(t *testing.T) {
+	cfg := &NetConfig{Device: "dev_1", Mode: "primary"}
+
+	testCases := []struct {
+		name   string
+		info   *pb.GetNetDevInfoResp
+		expErr string
+	}{
+		{
+			name: "allocated and unattached",
+			info: &pb.GetNetDevInfoResp{Mode: "primary", Allocated: true},
+		},
+		{
+			name: "already attached to this container",
+			info: &pb.GetNetDevInfoResp{Mode: "primary", Allocated: true, ContainerId: "container_1"},
+		},
+		{
+			name:   "mode mismatch",
+			info:   &pb.GetNetDevInfoResp{Mode: "cdq", Allocated: true},
+			expErr: "is in cdq mode, not primary mode",
+		},
+		{
+			name:   "not allocated",
+			info:   &pb.GetNetDevInfoResp{Mode: "primary"},
+			expErr: "has not been allocated",
+		},
+		{
+			name:   "attached to another container",
+			info:   &pb.GetNetDevInfoResp{Mode: "primary", Allocated: true, ContainerId: "container_2", PodNamespace: "default", PodName: "pod_2"},
+			expErr: "is already attached to pod default/pod_2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkNetDevInfo(tc.info, cfg, "container_1")
+			if tc.expErr == "" {
+				assert.NoError(t, err, "Unexpected error")
+			} else {
+				require.Error(t, err, "Expected an error")
+				assert.Contains(t, err.Error(), tc.expErr, "Unexpected error message")
+			}
+		})
+	}
+}
+
+func TestPodRef(t *testing.T) {
+	testCases := []struct {
+		name         string
+		cniArgs      string
+		expNamespace string
+		expName      string
+	}{
+		{
+			name:         "kubernetes args",
+			cniArgs:      "IgnoreUnknown=1;K8S_POD_NAMESPACE=default;K8S_POD_NAME=pod_1;K8S_POD_INFRA_CONTAINER_ID=abc",
+			expNamespace: "default",
+			expName:      "pod_1",
+		},
+		{
+			name:    "no args",
+			cniArgs: "",
+		},
+		{
+			name:    "malformed args",
+			cniArgs: "K8S_POD_NAME",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			namespace, name := podRef(&skel.CmdArgs{Args: tc.cniArgs})
+			assert.Equal(t, tc.expNamespace, namespace, "Unexpected pod namespace")
+			assert.Equal(t, tc.expName, name, "Unexpected pod name")
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
+)
+
+var (
+	stateDir      = constants.Plugins.Cni.StateDir
+	stateKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+$`)
+)
+
+/*
+attachmentState is the per-attachment state cached by the CNI on ADD.
+It records the original host state of the device so that DEL can restore it,
+and the ntuple rules added for the attachment so that DEL can remove them.
+*/
+type attachmentState struct {
+	ContainerID  string                  `json:"containerID"`
+	IfName       string                  `json:"ifName"`
+	Netns        string                  `json:"netns"`
+	Device       *networking.DeviceState `json:"device"`
+	EthtoolRules []*ethtoolRules         `json:"ethtoolRules,omitempty"`
+}
+
+/*
+ethtoolRules records the locations of ntuple rules added to a device for an attachment.
+An empty Device is the attached device itself, which may be renamed while in the pod.
+*/
+type ethtoolRules struct {
+	Device    string   `json:"device,omitempty"`
+	Locations []uint32 `json:"locations"`
+}
+
+/*
+statePath takes a container ID and interface name and returns the path of the state file
+*/
+func statePath(containerID string, ifName string) (string, error) {
+	if !stateKeyRegex.MatchString(containerID) || !stateKeyRegex.MatchString(ifName) {
+		return "", fmt.Errorf("statePath(): invalid state key %q %q", containerID, ifName)
+	}
+	return filepath.Join(stateDir, containerID+"-"+ifName+".json"), nil
+}
+
+/*
+saveState writes the attachment state to disk. The file is written to a temporary
+file and synced before being renamed into place, so a partially written state file
+is never left behind.
+*/
+func saveState(state *attachmentState) error {
+	path, err := statePath(state.ContainerID, state.IfName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(stateDir, os.FileMode(constants.Plugins.Cni.StateDirPermissions)); err != nil {
+		return fmt.Errorf("saveState(): failed to create state directory %s: %w", stateDir, err)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("saveState(): failed to marshal state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(stateDir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("saveState(): failed to create temporary state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saveState(): failed to write state file: %w", err)
+	}
+	if err := tmp.Chmod(os.FileMode(constants.Plugins.Cni.StateFilePermissions)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saveState(): failed to set state file permissions: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saveState(): failed to sync state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saveState(): failed to close state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("saveState(): failed to move state file into place: %w", err)
+	}
+
+	return nil
+}
+
+/*
+loadState reads the attachment state from disk.
+A nil state and nil error are returned if no state exists for the attachment.
+*/
+func loadState(containerID string, ifName string) (*attachmentState, error) {
+	path, err := statePath(containerID, ifName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("loadState(): failed to read state file %s: %w", path, err)
+	}
+
+	state := &attachmentState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("loadState(): failed to unmarshal state file %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+/*
+recordEthtoolRules adds the locations of ntuple rules added to a device to the attachment state
+*/
+func recordEthtoolRules(containerID string, ifName string, device string, locations []uint32) error {
+	state, err := loadState(containerID, ifName)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &attachmentState{ContainerID: containerID, IfName: ifName}
+	}
+
+	state.EthtoolRules = append(state.EthtoolRules, &ethtoolRules{Device: device, Locations: locations})
+
+	return saveState(state)
+}
+
+/*
+deleteState removes the attachment state from disk. Removing state that does not exist is not an error.
+*/
+func deleteState(containerID string, ifName string) error {
+	path, err := statePath(containerID, ifName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("deleteState(): failed to remove state file %s: %w", path, err)
+	}
+
+	return nil
+}
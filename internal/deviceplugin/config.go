@@ -19,8 +19,10 @@ package deviceplugin
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"regexp"
+	"sort"
 	"strconv"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
@@ -64,7 +66,13 @@ type PoolConfig struct {
 	UdsFuzz                 bool                            // a boolean to turn on fuzz testing within the UDS server, has no use outside of development and testing
 	RequiresUnprivilegedBpf bool                            // a boolean to say if this pool requires unprivileged BPF
 	UID                     int                             // the id of the pod user, we give this user ACL access to the UDS socket
-	EthtoolCmds             []string                        // list of ethtool filters to apply to the netdev
+	EthtoolFilters          []*networking.EthtoolFilter     // list of structured ethtool filters to apply to the netdev at allocation
+	CdqWarmPool             int                             // number of CDQ subfunctions per primary device to keep created ahead of allocation
+	CdqRate                 *networking.RateConfig          // devlink rates applied to each CDQ subfunction of the pool
+	CdqPoolRate             *networking.RateConfig          // devlink rates applied to the rate node grouping the CDQ subfunctions of the pool
+	CdqMac                  *networking.MacConfig           // settings used to assign deterministic MAC addresses to the CDQ subfunctions of the pool
+	BusyPoll                *networking.BusyPollConfig      // busy poll policy applied to the AF_XDP sockets and devices of the pool
+	SocketOptions           []string                        // socket options pods in this pool may ask the device plugin to set
 	DPCNIServer             *dpcnisyncerserver.SyncerServer // grpc syncer between DP and CNI
 }
 
@@ -252,6 +260,27 @@ func GetPoolConfigs(configFile string, net networking.Handler, host host.Handler
 		*/
 		devices := getSecondaryDevices(pool)
 
+		var cdqRate, cdqPoolRate *networking.RateConfig
+		if pool.CdqRate != nil {
+			cdqRate = &networking.RateConfig{TxShare: pool.CdqRate.TxShare, TxMax: pool.CdqRate.TxMax}
+			cdqPoolRate = &networking.RateConfig{TxShare: pool.CdqRate.PoolTxShare, TxMax: pool.CdqRate.PoolTxMax}
+		}
+
+		var cdqMac *networking.MacConfig
+		if pool.CdqMac != nil {
+			cdqMac = &networking.MacConfig{Oui: pool.CdqMac.Oui, Seed: hostname + "/" + pool.Name}
+			if index, ok := pool.CdqMac.NodeIndex[hostname]; ok {
+				cdqMac.NodeIndex = &index
+			} else if len(pool.CdqMac.NodeIndex) > 0 {
+				logging.Warningf("Pool %s has no CDQ MAC node index for %s, MAC addresses are derived from a hash of the hostname", pool.Name, hostname)
+			}
+		}
+
+		var busyPoll *networking.BusyPollConfig
+		if pool.BusyPoll != nil {
+			busyPoll = getBusyPollConfig(pool.BusyPoll)
+		}
+
 		if len(devices) != 0 {
 			poolConfigs = append(poolConfigs, PoolConfig{
 				Name:                    pool.Name,
@@ -263,14 +292,97 @@ func GetPoolConfigs(configFile string, net networking.Handler, host host.Handler
 				UdsFuzz:                 pool.UdsFuzz,
 				RequiresUnprivilegedBpf: pool.RequiresUnprivilegedBpf,
 				UID:                     pool.UID,
+				EthtoolFilters:          pool.EthtoolFilters,
+				CdqWarmPool:             pool.CdqWarmPool,
+				CdqRate:                 cdqRate,
+				CdqPoolRate:             cdqPoolRate,
+				CdqMac:                  cdqMac,
+				BusyPoll:                busyPoll,
+				SocketOptions:           pool.SocketOptions,
 				DPCNIServer:             dpcniserver,
 			})
 		}
 	}
 
+	if err := indexCdqPrimaries(poolConfigs); err != nil {
+		logging.Errorf("Error indexing CDQ primary devices: %v", err)
+		return poolConfigs, err
+	}
+
 	return poolConfigs, nil
 }
 
+/*
+indexCdqPrimaries gives each CDQ primary device on the node an index, used with the CDQ MAC
+node index so subfunctions of different primary devices get different MAC addresses. Indexes
+follow the order of the primary device names, and are shared by all pools on the node.
+*/
+func indexCdqPrimaries(poolConfigs []PoolConfig) error {
+	indexed := false
+	primaries := make(map[string]int)
+	for _, pool := range poolConfigs {
+		if pool.Mode != "cdq" {
+			continue
+		}
+		indexed = indexed || (pool.CdqMac != nil && pool.CdqMac.NodeIndex != nil)
+		for _, device := range pool.Devices {
+			if device.Primary() != nil {
+				primaries[device.Primary().Name()] = 0
+			}
+		}
+	}
+	if !indexed {
+		return nil
+	}
+	if len(primaries) > constants.Devices.MacPrimaryMax {
+		return fmt.Errorf("%d CDQ primary devices on this node, at most %d can be used with a CDQ MAC node index", len(primaries), constants.Devices.MacPrimaryMax)
+	}
+
+	names := make([]string, 0, len(primaries))
+	for name := range primaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		primaries[name] = i
+	}
+
+	for _, pool := range poolConfigs {
+		if pool.CdqMac != nil && pool.CdqMac.NodeIndex != nil {
+			pool.CdqMac.Primaries = primaries
+		}
+	}
+	return nil
+}
+
+/*
+getBusyPollConfig returns the busy poll policy of a pool, with defaults for the values
+the user did not set.
+*/
+func getBusyPollConfig(cfg *configFile_BusyPoll) *networking.BusyPollConfig {
+	busyPoll := &networking.BusyPollConfig{
+		Timeout:         cfg.Timeout,
+		Budget:          cfg.Budget,
+		Prefer:          cfg.PreferBusyPoll,
+		DeferHardIrqs:   cfg.NapiDeferHardIrqs,
+		GroFlushTimeout: cfg.GroFlushTimeout,
+	}
+
+	if busyPoll.Budget == 0 {
+		busyPoll.Budget = constants.Afxdp.BusyPollDefaultBudget
+	}
+	if busyPoll.DeferHardIrqs == 0 {
+		busyPoll.DeferHardIrqs = constants.Afxdp.DefaultDeferHardIrqs
+	}
+	if busyPoll.GroFlushTimeout == 0 {
+		busyPoll.GroFlushTimeout = constants.Afxdp.DefaultGroFlushTimeout
+	}
+	logging.Debugf("Busy poll policy: timeout %d, budget %d, prefer %t, napi_defer_hard_irqs %d, gro_flush_timeout %d",
+		busyPoll.Timeout, busyPoll.Budget, busyPoll.Prefer, busyPoll.DeferHardIrqs, busyPoll.GroFlushTimeout)
+
+	return busyPoll
+}
+
 func getDeviceListOfDriverType(driver *configFile_Driver, pool *configFile_Pool) []*configFile_Device {
 	var devices []*configFile_Device
 	var counting bool
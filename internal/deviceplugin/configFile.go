@@ -17,12 +17,15 @@
 package deviceplugin
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
 )
 
 const (
@@ -55,6 +58,30 @@ const (
 	poolUdsTimeoutError   = "UDS socket timeout must be -1, 0, or between 30 and 300 seconds"
 	poolModeRequiredError = "Plugin must have a mode"
 	poolModeMustBeError   = "Plugin mode must be one of "
+	poolEthtoolIPError    = "Pool ethtool filters cannot use the pod IP placeholders, use ethtoolFilters in the network attachment definition"
+	poolWarmPoolError     = "CDQ warm pool size must be between 0 and 64"
+	poolWarmPoolModeError = "CDQ warm pool can only be used in cdq mode"
+	poolRateModeError     = "CDQ rates can only be used in cdq mode"
+	poolMacModeError      = "CDQ MAC assignment can only be used in cdq mode"
+	poolBusyPollUdsError  = "Busy poll policy requires the UDS server"
+	poolSockOptUdsError   = "Socket options require the UDS server"
+	poolSockOptError      = "Socket option must be one of "
+
+	// busy poll errors
+	busyPollTimeoutError  = "Busy poll timeout must be between 1 and 1000000 microseconds"
+	busyPollBudgetError   = "Busy poll budget must be between 0 and 65535"
+	busyPollDeferError    = "NAPI defer hard IRQs must be 0 or more"
+	busyPollGroFlushError = "GRO flush timeout must be 0 or more nanoseconds"
+
+	// rate errors
+	rateValidError = "Rate must be a number followed by a devlink rate unit, e.g. 100mbit or 1gbit"
+
+	// mac errors
+	macOuiRequiredError  = "CDQ MAC assignment must have an OUI"
+	macOuiValidError     = "OUI must be three octets separated by colons, e.g. 02:00:5e"
+	macOuiMulticastError = "OUI must not have the multicast bit set"
+	macNodeIndexError    = "CDQ MAC node index must be between 0 and 4095"
+	macNodeUniqueError   = "CDQ MAC node indexes must be unique"
 
 	// logging errors
 	filenameValidError = "must be a valid .log or .txt filename"
@@ -82,17 +109,43 @@ type configFile_Node struct {
 }
 
 type configFile_Pool struct {
-	Name                    string               `json:"Name"`
-	Mode                    string               `json:"Mode"`
-	Drivers                 []*configFile_Driver `json:"Drivers"`
-	Devices                 []*configFile_Device `json:"Devices"`
-	Nodes                   []*configFile_Node   `json:"Nodes"`
-	UdsServerDisable        bool                 `json:"UdsServerDisable"`
-	BpfMapPinningEnable     bool                 `json:"BpfMapPinningEnable"`
-	UdsTimeout              int                  `json:"UdsTimeout"`
-	UdsFuzz                 bool                 `json:"UdsFuzz"`
-	RequiresUnprivilegedBpf bool                 `json:"RequiresUnprivilegedBpf"`
-	UID                     int                  `json:"uid"`
+	Name                    string                      `json:"Name"`
+	Mode                    string                      `json:"Mode"`
+	Drivers                 []*configFile_Driver        `json:"Drivers"`
+	Devices                 []*configFile_Device        `json:"Devices"`
+	Nodes                   []*configFile_Node          `json:"Nodes"`
+	UdsServerDisable        bool                        `json:"UdsServerDisable"`
+	BpfMapPinningEnable     bool                        `json:"BpfMapPinningEnable"`
+	UdsTimeout              int                         `json:"UdsTimeout"`
+	UdsFuzz                 bool                        `json:"UdsFuzz"`
+	RequiresUnprivilegedBpf bool                        `json:"RequiresUnprivilegedBpf"`
+	UID                     int                         `json:"uid"`
+	EthtoolFilters          []*networking.EthtoolFilter `json:"EthtoolFilters"`
+	CdqWarmPool             int                         `json:"CdqWarmPool"`
+	CdqRate                 *configFile_Rate            `json:"CdqRate"`
+	CdqMac                  *configFile_Mac             `json:"CdqMac"`
+	BusyPoll                *configFile_BusyPoll        `json:"BusyPoll"`
+	SocketOptions           []string                    `json:"SocketOptions"`
+}
+
+type configFile_Rate struct {
+	TxShare     string `json:"TxShare"`
+	TxMax       string `json:"TxMax"`
+	PoolTxShare string `json:"PoolTxShare"`
+	PoolTxMax   string `json:"PoolTxMax"`
+}
+
+type configFile_Mac struct {
+	Oui       string         `json:"Oui"`
+	NodeIndex map[string]int `json:"NodeIndex"`
+}
+
+type configFile_BusyPoll struct {
+	Timeout           int  `json:"Timeout"`
+	Budget            int  `json:"Budget"`
+	PreferBusyPoll    bool `json:"PreferBusyPoll"`
+	NapiDeferHardIrqs int  `json:"NapiDeferHardIrqs"`
+	GroFlushTimeout   int  `json:"GroFlushTimeout"`
 }
 
 type configFile struct {
@@ -185,11 +238,16 @@ func (c configFile_Node) Validate() error {
 
 func (c configFile_Pool) Validate() error {
 	var iModes []interface{} = make([]interface{}, len(constants.Plugins.Modes))
+	var iSockOpts []interface{} = make([]interface{}, len(constants.Afxdp.SocketOptions))
 
 	for i, mode := range constants.Plugins.Modes {
 		iModes[i] = mode
 	}
 
+	for i, option := range constants.Afxdp.SocketOptions {
+		iSockOpts[i] = option
+	}
+
 	return validation.ValidateStruct(&c,
 		validation.Field(
 			&c.Name,
@@ -227,9 +285,136 @@ func (c configFile_Pool) Validate() error {
 			validation.When(!(c.UID == 0), validation.Max(constants.UID.Maximum)),
 			validation.When(!(c.UID == 0), validation.Min(constants.UID.Minimum)),
 		),
+		validation.Field(
+			&c.EthtoolFilters,
+			validation.Each(
+				validation.NotNil.Error("cannot be null"),
+				validation.By(validateNoIPPlaceholder),
+			),
+		),
+		validation.Field(
+			&c.CdqWarmPool,
+			validation.Min(0).Error(poolWarmPoolError),
+			validation.Max(constants.Devices.SecondaryMax).Error(poolWarmPoolError),
+			validation.When(c.Mode != "cdq", validation.In(0).Error(poolWarmPoolModeError)),
+		),
+		validation.Field(
+			&c.CdqRate,
+			validation.When(c.Mode != "cdq", validation.Nil.Error(poolRateModeError)),
+		),
+		validation.Field(
+			&c.CdqMac,
+			validation.When(c.Mode != "cdq", validation.Nil.Error(poolMacModeError)),
+		),
+		validation.Field(
+			&c.BusyPoll,
+			validation.When(c.UdsServerDisable, validation.Nil.Error(poolBusyPollUdsError)),
+		),
+		validation.Field(
+			&c.SocketOptions,
+			validation.When(c.UdsServerDisable, validation.Empty.Error(poolSockOptUdsError)),
+			validation.Each(
+				validation.In(iSockOpts...).Error(poolSockOptError+fmt.Sprintf("%v", iSockOpts)),
+			),
+		),
+	)
+}
+
+func (c configFile_Rate) Validate() error {
+	rateRegex := regexp.MustCompile(constants.Devices.ValidRateRegex)
+
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.TxShare, validation.Match(rateRegex).Error(rateValidError)),
+		validation.Field(&c.TxMax, validation.Match(rateRegex).Error(rateValidError)),
+		validation.Field(&c.PoolTxShare, validation.Match(rateRegex).Error(rateValidError)),
+		validation.Field(&c.PoolTxMax, validation.Match(rateRegex).Error(rateValidError)),
 	)
 }
 
+func (c configFile_Mac) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(
+			&c.Oui,
+			validation.Required.Error(macOuiRequiredError),
+			validation.Match(regexp.MustCompile(constants.Devices.ValidOuiRegex)).Error(macOuiValidError),
+			validation.By(validateUnicastOui),
+		),
+		validation.Field(
+			&c.NodeIndex,
+			validation.Each(
+				validation.Min(0).Error(macNodeIndexError),
+				validation.Max(constants.Devices.MacNodeMax).Error(macNodeIndexError),
+			),
+			validation.By(validateUniqueNodeIndex),
+		),
+	)
+}
+
+func (c configFile_BusyPoll) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(
+			&c.Timeout,
+			validation.Required.Error(busyPollTimeoutError),
+			validation.Min(1).Error(busyPollTimeoutError),
+			validation.Max(constants.Afxdp.BusyPollMaxTimeout).Error(busyPollTimeoutError),
+		),
+		validation.Field(
+			&c.Budget,
+			validation.Min(0).Error(busyPollBudgetError),
+			validation.Max(constants.Afxdp.BusyPollMaxBudget).Error(busyPollBudgetError),
+		),
+		validation.Field(&c.NapiDeferHardIrqs, validation.Min(0).Error(busyPollDeferError)),
+		validation.Field(&c.GroFlushTimeout, validation.Min(0).Error(busyPollGroFlushError)),
+	)
+}
+
+/*
+validateUnicastOui checks the first octet of an OUI does not have the multicast bit set,
+as multicast addresses cannot be assigned to a device
+*/
+func validateUnicastOui(value interface{}) error {
+	oui, ok := value.(string)
+	if !ok || len(oui) < 2 {
+		return nil
+	}
+	octet, err := strconv.ParseUint(oui[:2], 16, 8)
+	if err == nil && octet&0x01 != 0 {
+		return errors.New(macOuiMulticastError)
+	}
+	return nil
+}
+
+/*
+validateUniqueNodeIndex checks no two nodes are given the same CDQ MAC node index,
+as they would then assign the same MAC addresses
+*/
+func validateUniqueNodeIndex(value interface{}) error {
+	nodeIndex, ok := value.(map[string]int)
+	if !ok {
+		return nil
+	}
+	seen := make(map[int]bool)
+	for _, index := range nodeIndex {
+		if seen[index] {
+			return errors.New(macNodeUniqueError)
+		}
+		seen[index] = true
+	}
+	return nil
+}
+
+/*
+validateNoIPPlaceholder checks a pool ethtool filter does not use the pod IP placeholders.
+The device plugin applies pool filters at allocation, before the pod has an IP address.
+*/
+func validateNoIPPlaceholder(value interface{}) error {
+	filter, ok := value.(networking.EthtoolFilter)
+	if ok && filter.UsesIPPlaceholder() {
+		return errors.New(poolEthtoolIPError)
+	}
+	return nil
+}
+
 func (c configFile) Validate() error {
 	var iLogLevels []interface{} = make([]interface{}, len(constants.Logging.Levels))
 
@@ -1130,6 +1130,540 @@ func TestReadConfigFile(t *testing.T) {
 						}`,
 			expErr: errors.New(poolUdsTimeoutError),
 		},
+
+		/*********************** Ethtool Filter Validation ***********************/
+		{
+			name: "ethtool filter valid",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"ethtoolFilters":[
+										{"flowType":"udp4","dstIp":"192.168.1.10","dstPort":4789,"action":2}
+									],
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: nil,
+		},
+		{
+			name: "ethtool filter must not use pod IP placeholder",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"ethtoolFilters":[
+										{"flowType":"udp4","dstIp":"-ip-","action":2}
+									],
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolEthtoolIPError),
+		},
+		{
+			name: "ethtool filter must have a valid flow type",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"ethtoolFilters":[
+										{"flowType":"arp","action":2}
+									],
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New("flowType must be"),
+		},
+		{
+			name: "ethtool filter must have an action",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"ethtoolFilters":[
+										{"flowType":"tcp4","dstPort":80}
+									],
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New("action must be specified"),
+		},
+		{
+			name: "cdq warm pool valid",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqWarmPool":4,
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: nil,
+		},
+		{
+			name: "cdq warm pool must not be negative",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqWarmPool":-1,
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolWarmPoolError),
+		},
+		{
+			name: "cdq warm pool must not exceed secondary maximum",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqWarmPool":65,
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolWarmPoolError),
+		},
+		{
+			name: "cdq warm pool only in cdq mode",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"cdqWarmPool":2,
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolWarmPoolModeError),
+		},
+		{
+			name: "cdq rate valid",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqRate":{"txShare":"100mbit","txMax":"1gbit","poolTxMax":"10gbit"},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: nil,
+		},
+		{
+			name: "cdq rate must have a unit",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqRate":{"txMax":"1000"},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(rateValidError),
+		},
+		{
+			name: "cdq rate must be a number",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqRate":{"poolTxShare":"fastmbit"},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(rateValidError),
+		},
+		{
+			name: "cdq rate only in cdq mode",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"cdqRate":{"txMax":"1gbit"},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolRateModeError),
+		},
+		{
+			name: "cdq mac valid",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqMac":{"oui":"02:00:5e"},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: nil,
+		},
+		{
+			name: "cdq mac must have an oui",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqMac":{},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(macOuiRequiredError),
+		},
+		{
+			name: "cdq mac oui must be three octets",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqMac":{"oui":"02:00:5e:00"},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(macOuiValidError),
+		},
+		{
+			name: "cdq mac oui must not be multicast",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqMac":{"oui":"01:00:5e"},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(macOuiMulticastError),
+		},
+		{
+			name: "cdq mac node index",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqMac":{"oui":"02:00:5e","nodeIndex":{"node1":0,"node2":4095}},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: nil,
+		},
+		{
+			name: "cdq mac node index out of range",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqMac":{"oui":"02:00:5e","nodeIndex":{"node1":4096}},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(macNodeIndexError),
+		},
+		{
+			name: "cdq mac node index must be unique",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"cdq",
+									"cdqMac":{"oui":"02:00:5e","nodeIndex":{"node1":7,"node2":7}},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(macNodeUniqueError),
+		},
+		{
+			name: "cdq mac only in cdq mode",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"cdqMac":{"oui":"02:00:5e"},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolMacModeError),
+		},
+		{
+			name: "busy poll policy",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"busyPoll":{"timeout":50,"budget":64,"preferBusyPoll":true,"napiDeferHardIrqs":2,"groFlushTimeout":200000},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: nil,
+		},
+		{
+			name: "busy poll must have a timeout",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"busyPoll":{"budget":64},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(busyPollTimeoutError),
+		},
+		{
+			name: "busy poll timeout too large",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"busyPoll":{"timeout":1000001},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(busyPollTimeoutError),
+		},
+		{
+			name: "busy poll budget too large",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"busyPoll":{"timeout":50,"budget":65536},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(busyPollBudgetError),
+		},
+		{
+			name: "busy poll gro flush timeout negative",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"busyPoll":{"timeout":50,"groFlushTimeout":-1},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(busyPollGroFlushError),
+		},
+		{
+			name: "busy poll requires uds server",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"udsServerDisable":true,
+									"busyPoll":{"timeout":50},
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolBusyPollUdsError),
+		},
+		{
+			name: "socket options",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"socketOptions":["SO_PRIORITY","SO_MARK","SO_BUSY_POLL"],
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: nil,
+		},
+		{
+			name: "socket option must be supported",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"socketOptions":["SO_PRIORITY","SO_REUSEPORT"],
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolSockOptError),
+		},
+		{
+			name: "socket options require uds server",
+			configFile: `{
+							"pools":[
+								{
+									"name":"testPool",
+									"mode":"primary",
+									"udsServerDisable":true,
+									"socketOptions":["SO_PRIORITY"],
+									"drivers":[
+										{
+											"name":"ice"
+										}
+									]
+								}
+							]
+						}`,
+			expErr: errors.New(poolSockOptUdsError),
+		},
 	}
 
 	for _, tc := range testCases {
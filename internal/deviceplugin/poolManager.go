@@ -20,14 +20,17 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/bpf"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/dpcnisyncerserver"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/resourcesapi"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/tools"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/udsserver"
 	logging "github.com/sirupsen/logrus"
@@ -54,16 +57,37 @@ type PoolManager struct {
 	DevicePrefix        string
 	UdsFuzz             bool
 	UID                 string
-	EthtoolFilters      []string
+	EthtoolFilters      []*networking.EthtoolFilter
+	ethtoolRules        map[string][]uint32
+	ethtoolMutex        *sync.Mutex
 	DpAPIServer         *grpc.Server
 	ServerFactory       udsserver.ServerFactory
 	MapManagerFactory   bpf.MapManagerFactory
 	BpfHandler          bpf.Handler
 	NetHandler          networking.Handler
+	PodResources        resourcesapi.Handler
 	DpCniSyncerServer   *dpcnisyncerserver.SyncerServer
 	DpCniSyncerSocket   string
 	SyncerActive        bool
 	Pbm                 bpf.PoolBpfMapManager
+	CdqWarmPool         int
+	CdqRate             *networking.RateConfig
+	CdqPoolRate         *networking.RateConfig
+	CdqMac              *networking.MacConfig
+	BusyPoll            *networking.BusyPollConfig
+	SocketOptions       []string
+	napiSettings        map[string]*networking.NapiSettings
+	napiMutex           *sync.Mutex
+	rateNodes           map[*networking.Device]bool
+	udsServers          map[string]udsserver.Server
+	udsMutex            *sync.Mutex
+	allocated           map[string]time.Time
+	unhealthy           map[string]bool
+	pendingDeletes      map[string]bool
+	cdqMutex            *sync.Mutex
+	stopCdq             chan struct{}
+	stopRelease         chan struct{}
+	warmPoolSignal      chan struct{}
 }
 
 func NewPoolManager(config PoolConfig) PoolManager {
@@ -80,8 +104,26 @@ func NewPoolManager(config PoolConfig) PoolManager {
 		DevicePrefix:        constants.Plugins.DevicePlugin.DevicePrefix,
 		UdsFuzz:             config.UdsFuzz,
 		UID:                 strconv.Itoa(config.UID),
-		EthtoolFilters:      config.EthtoolCmds,
+		EthtoolFilters:      config.EthtoolFilters,
+		ethtoolRules:        make(map[string][]uint32),
+		ethtoolMutex:        &sync.Mutex{},
 		DpCniSyncerServer:   config.DPCNIServer,
+		CdqWarmPool:         config.CdqWarmPool,
+		CdqRate:             config.CdqRate,
+		CdqPoolRate:         config.CdqPoolRate,
+		CdqMac:              config.CdqMac,
+		BusyPoll:            config.BusyPoll,
+		SocketOptions:       config.SocketOptions,
+		napiSettings:        make(map[string]*networking.NapiSettings),
+		napiMutex:           &sync.Mutex{},
+		rateNodes:           make(map[*networking.Device]bool),
+		udsServers:          make(map[string]udsserver.Server),
+		udsMutex:            &sync.Mutex{},
+		allocated:           make(map[string]time.Time),
+		unhealthy:           make(map[string]bool),
+		pendingDeletes:      make(map[string]bool),
+		cdqMutex:            &sync.Mutex{},
+		warmPoolSignal:      make(chan struct{}, 1),
 	}
 }
 
@@ -93,6 +135,7 @@ func (pm *PoolManager) Init(config PoolConfig) error {
 	pm.MapManagerFactory = bpf.NewMapMangerFactory()
 	pm.BpfHandler = bpf.NewHandler()
 	pm.NetHandler = networking.NewHandler()
+	pm.PodResources = resourcesapi.NewHandler()
 
 	if err := pm.startGRPC(); err != nil {
 		return err
@@ -119,6 +162,33 @@ func (pm *PoolManager) Init(config PoolConfig) error {
 		pm.DpCniSyncerServer.BpfMapPinEnable = true
 	}
 
+	if pm.Mode == "cdq" {
+		if err := pm.assignCdqMacs(); err != nil {
+			logging.Errorf("Error assigning MAC addresses to CDQ subfunctions: %v", err)
+			return err
+		}
+		pm.stopCdq = make(chan struct{})
+		pm.checkCdqCapacity()
+		go pm.monitorCdqCapacity(pm.stopCdq)
+		if pm.DpCniSyncerServer != nil {
+			go pm.retryCdqDeletions(pm.stopCdq)
+		}
+		if pm.CdqWarmPool > 0 {
+			logging.Infof("Keeping %d CDQ subfunctions per primary device warm in pool %s", pm.CdqWarmPool, pm.Name)
+			go pm.replenishWarmPool(pm.stopCdq)
+			pm.signalWarmPool()
+		}
+	}
+
+	pm.stopRelease = make(chan struct{})
+	go pm.monitorAllocations(pm.stopRelease)
+
+	if pm.DpCniSyncerServer != nil {
+		for name, device := range pm.Devices {
+			pm.DpCniSyncerServer.RegisterNetDev(name, pm.Name, device.Mode(), device.Primary().Name(), pm.releaseDevice)
+		}
+	}
+
 	if len(pm.Devices) > 0 {
 		pm.UpdateSignal <- true
 	}
@@ -131,6 +201,16 @@ Terminate is called it terminate the PoolManager.
 */
 func (pm *PoolManager) Terminate() error {
 	pm.stopGRPC()
+	if pm.stopCdq != nil {
+		close(pm.stopCdq)
+		pm.stopCdq = nil
+	}
+	if pm.stopRelease != nil {
+		close(pm.stopRelease)
+		pm.stopRelease = nil
+	}
+	pm.deleteRateNodes()
+	pm.stopUdsServers()
 	if err := pm.cleanup(); err != nil {
 		logging.Infof("Cleanup error: %v", err)
 	}
@@ -161,9 +241,15 @@ func (pm *PoolManager) ListAndWatch(empty *pluginapi.Empty,
 		<-pm.UpdateSignal
 		resp := new(pluginapi.ListAndWatchResponse)
 
+		pm.cdqMutex.Lock()
 		for devName := range pm.Devices {
-			resp.Devices = append(resp.Devices, &pluginapi.Device{ID: devName, Health: pluginapi.Healthy})
+			health := pluginapi.Healthy
+			if pm.unhealthy[devName] {
+				health = pluginapi.Unhealthy
+			}
+			resp.Devices = append(resp.Devices, &pluginapi.Device{ID: devName, Health: health})
 		}
+		pm.cdqMutex.Unlock()
 
 		if err := stream.Send(resp); err != nil {
 			logging.Errorf("Failed to send stream to kubelet: %v", err)
@@ -188,7 +274,7 @@ func (pm *PoolManager) Allocate(ctx context.Context,
 
 	if !pm.UdsServerDisable {
 		logging.Infof("Creating new UDS server")
-		udsServer, udsPath, err = pm.ServerFactory.CreateServer(pm.DevicePrefix+"/"+pm.Name, pm.UID, pm.UdsTimeout, pm.UdsFuzz)
+		udsServer, udsPath, err = pm.ServerFactory.CreateServer(pm.DevicePrefix+"/"+pm.Name, pm.UID, pm.UdsTimeout, pm.UdsFuzz, pm.BusyPoll, pm.SocketOptions)
 		if err != nil {
 			logging.Errorf("Error Creating new UDS server: %v", err)
 			return &response, err
@@ -225,17 +311,37 @@ func (pm *PoolManager) Allocate(ctx context.Context,
 			switch pm.Mode {
 			case "primary":
 				logging.Debugf("Primary mode")
+				if len(pm.EthtoolFilters) > 0 {
+					if err := pm.applyEthtoolFilters(device.Name()); err != nil {
+						logging.Errorf("Error applying ethtool filters to device %s: %v", device.Name(), err)
+						return &response, err
+					}
+				}
+				pm.setAllocated(device.Name())
 			case "cdq":
-				if err := device.ActivateCdqSubfunction(); err != nil {
+				if err := pm.activateCdqSubfunction(device); err != nil {
 					logging.Errorf("Error creating CDQ subfunction: %v", err)
 					return &response, err
 				}
+				mac, err := device.Mac()
+				if err != nil {
+					logging.Warningf("Error getting MAC address of CDQ subfunction %s: %v", device.Name(), err)
+				} else {
+					envs[macEnvVar(device.Name())] = mac
+				}
 			default:
 				err := fmt.Errorf("unsupported pool mode: %s", pm.Mode)
 				logging.Errorf("%v", err)
 				return &response, err
 			}
 
+			if pm.BusyPoll != nil {
+				if err := pm.applyNapiSettings(device.Name()); err != nil {
+					logging.Errorf("Error applying busy poll settings to device %s: %v", device.Name(), err)
+					return &response, err
+				}
+			}
+
 			logging.Debugf("Cycling state of device %s", device.Name())
 			if err := device.Cycle(); err != nil {
 				logging.Errorf("Error cycling the state of device %s: %v", device.Name(), err)
@@ -251,8 +357,13 @@ func (pm *PoolManager) Allocate(ctx context.Context,
 				}
 				logging.Infof("BPF program loaded on: %s File descriptor: %s", device.Name(), strconv.Itoa(fd))
 				udsServer.AddDevice(device.Name(), fd)
+				if pm.Mode == "cdq" && device.Primary() != nil {
+					udsServer.SetParent(device.Name(), device.Primary().Name())
+				}
+				pm.setUdsServer(device.Name(), udsServer)
 			}
 
+			var mapPath string
 			if pm.BpfMapPinningEnable {
 				logging.Infof("Loading BPF program on device: %s and pinning the map", device.Name())
 				pinPath, err := pm.Pbm.Manager.CreateBPFFS()
@@ -271,6 +382,7 @@ func (pm *PoolManager) Allocate(ctx context.Context,
 
 				//FULL PATH WILL INCLUDE THE XSKMAP...
 				fullPath := pinPath + constants.Bpf.Xsk_map
+				mapPath = fullPath
 				containerMapPath := constants.Bpf.BpfMapPodPath + device.Name() + constants.Bpf.Xsk_map
 				logging.Debugf("mapping %s to %s", fullPath, containerMapPath)
 				cresp.Mounts = append(cresp.Mounts, &pluginapi.Mount{
@@ -279,6 +391,16 @@ func (pm *PoolManager) Allocate(ctx context.Context,
 					ReadOnly:      false,
 				})
 			}
+
+			if pm.DpCniSyncerServer != nil {
+				pci, err := device.Pci()
+				if err != nil {
+					logging.Warningf("Error getting PCI address of device %s: %v", device.Name(), err)
+				}
+				if err := pm.DpCniSyncerServer.SetNetDevAllocated(device.Name(), pci, mapPath); err != nil {
+					logging.Warningf("Error updating the DP<=>CNI syncer for device %s: %v", device.Name(), err)
+				}
+			}
 		}
 
 		envVar := constants.Devices.EnvVarList + strings.ToUpper(pm.Name)
@@ -300,12 +422,654 @@ func (pm *PoolManager) Allocate(ctx context.Context,
 	return &response, nil
 }
 
+/*
+applyEthtoolFilters applies the pool ethtool filters to a device. Rules left on the
+device by a previous allocation are removed first, so a device reused by a new pod
+does not accumulate duplicate rules.
+*/
+func (pm *PoolManager) applyEthtoolFilters(device string) error {
+	pm.ethtoolMutex.Lock()
+	defer pm.ethtoolMutex.Unlock()
+
+	if locations, ok := pm.ethtoolRules[device]; ok {
+		logging.Debugf("Removing ethtool filters from previous allocation of device %s", device)
+		if err := pm.NetHandler.DeleteEthtoolRules(device, locations); err != nil {
+			logging.Warningf("Error removing previous ethtool filters from device %s: %v", device, err)
+		}
+		delete(pm.ethtoolRules, device)
+	}
+
+	logging.Infof("Applying ethtool filters to device %s", device)
+	locations, err := pm.NetHandler.SetEthtoolFilters(pm.EthtoolFilters, device, nil)
+	if err != nil {
+		return err
+	}
+	pm.ethtoolRules[device] = locations
+
+	return nil
+}
+
+/*
+removeEthtoolFilters removes the pool ethtool filters applied to a device, if there are any
+*/
+func (pm *PoolManager) removeEthtoolFilters(device string) {
+	pm.ethtoolMutex.Lock()
+	defer pm.ethtoolMutex.Unlock()
+
+	locations, ok := pm.ethtoolRules[device]
+	if !ok {
+		return
+	}
+	delete(pm.ethtoolRules, device)
+
+	logging.Infof("Removing ethtool filters from device %s", device)
+	if err := pm.NetHandler.DeleteEthtoolRules(device, locations); err != nil {
+		logging.Warningf("Error removing ethtool filters from device %s: %v", device, err)
+	}
+}
+
+/*
+applyNapiSettings applies the NAPI settings of the pool busy poll policy to a device, so
+interrupts are deferred while the pod busy polls. The settings found on the device are kept
+and restored when the device is released. If the device is allocated again before its
+release was seen, the settings kept from the first allocation are not overwritten.
+*/
+func (pm *PoolManager) applyNapiSettings(device string) error {
+	pm.napiMutex.Lock()
+	defer pm.napiMutex.Unlock()
+
+	if _, ok := pm.napiSettings[device]; !ok {
+		settings, err := pm.NetHandler.GetNapiSettings(device)
+		if err != nil {
+			return err
+		}
+		pm.napiSettings[device] = settings
+	}
+
+	logging.Infof("Setting napi_defer_hard_irqs %d and gro_flush_timeout %d on device %s", pm.BusyPoll.DeferHardIrqs, pm.BusyPoll.GroFlushTimeout, device)
+	return pm.NetHandler.SetNapiSettings(device, &networking.NapiSettings{
+		DeferHardIrqs:   pm.BusyPoll.DeferHardIrqs,
+		GroFlushTimeout: pm.BusyPoll.GroFlushTimeout,
+	})
+}
+
+/*
+restoreNapiSettings puts back the NAPI settings found on a device before it was allocated.
+If they cannot be restored, for example while the device is still in the network namespace
+of a pod, they are kept, so a later release or allocation does not lose them.
+*/
+func (pm *PoolManager) restoreNapiSettings(device string) {
+	pm.napiMutex.Lock()
+	defer pm.napiMutex.Unlock()
+
+	settings, ok := pm.napiSettings[device]
+	if !ok {
+		return
+	}
+
+	logging.Infof("Restoring napi_defer_hard_irqs %d and gro_flush_timeout %d on device %s", settings.DeferHardIrqs, settings.GroFlushTimeout, device)
+	if err := pm.NetHandler.SetNapiSettings(device, settings); err != nil {
+		logging.Warningf("Error restoring busy poll settings of device %s: %v", device, err)
+		return
+	}
+	delete(pm.napiSettings, device)
+}
+
+/*
+activateCdqSubfunction creates the CDQ subfunction of a device allocated to a pod. A subfunction
+already created by the warm pool is used as is. If the subfunction from a previous allocation
+is still waiting to be deleted, it is deleted first so the new pod gets a fresh subfunction.
+The warm pool is refilled after the allocation.
+*/
+func (pm *PoolManager) activateCdqSubfunction(device *networking.Device) error {
+	pm.cdqMutex.Lock()
+	defer pm.cdqMutex.Unlock()
+
+	if pm.pendingDeletes[device.Name()] {
+		if err := pm.deleteCdqSubfunction(device); err != nil {
+			return fmt.Errorf("previous CDQ subfunction %s has not been deleted: %w", device.Name(), err)
+		}
+		delete(pm.pendingDeletes, device.Name())
+	}
+
+	if device.IsActive() && !pm.isAllocated(device.Name()) {
+		logging.Debugf("Using warm CDQ subfunction %s", device.Name())
+	} else if err := device.ActivateCdqSubfunction(); err != nil {
+		return err
+	}
+
+	if err := pm.applyCdqRate(device); err != nil {
+		return fmt.Errorf("error applying rates to CDQ subfunction %s: %w", device.Name(), err)
+	}
+
+	pm.allocated[device.Name()] = time.Now()
+	pm.signalWarmPool()
+	return nil
+}
+
+/*
+setAllocated records that a device has been allocated to a pod
+*/
+func (pm *PoolManager) setAllocated(name string) {
+	pm.cdqMutex.Lock()
+	defer pm.cdqMutex.Unlock()
+
+	pm.allocated[name] = time.Now()
+}
+
+/*
+isAllocated returns true if a device is allocated to a pod. The caller must hold cdqMutex.
+*/
+func (pm *PoolManager) isAllocated(name string) bool {
+	_, ok := pm.allocated[name]
+	return ok
+}
+
+/*
+releaseDevice is called through the DP<=>CNI syncer when the CNI detaches a device, or by
+monitorAllocations when the kubelet no longer assigns the device to a pod.
+The UDS server of the device is stopped, the pool ethtool filters are removed, the NAPI
+settings found on the device before allocation are restored and, in cdq mode, the CDQ
+subfunction is deleted.
+*/
+func (pm *PoolManager) releaseDevice(name string) error {
+	pm.stopUdsServer(name)
+	pm.removeEthtoolFilters(name)
+	pm.restoreNapiSettings(name)
+
+	if pm.Mode == "cdq" {
+		return pm.releaseCdqSubfunction(name)
+	}
+
+	pm.cdqMutex.Lock()
+	delete(pm.allocated, name)
+	pm.cdqMutex.Unlock()
+	return nil
+}
+
+/*
+monitorAllocations periodically releases the devices the kubelet no longer assigns to a pod.
+Devices are normally released when the CNI detaches them, this covers devices the CNI never
+attached through the DP<=>CNI syncer, such as when the syncer is disabled in the CNI config.
+*/
+func (pm *PoolManager) monitorAllocations(stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(constants.Devices.ReleaseCheck) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			pm.releaseUnassignedDevices()
+		}
+	}
+}
+
+/*
+releaseUnassignedDevices releases the devices allocated by the pool that no pod holds in the
+pod resources API. A device is given a grace period after allocation, as the kubelet only
+reports it once the container is created. A device attached to a pod by the CNI is left to
+be released when the CNI detaches it.
+*/
+func (pm *PoolManager) releaseUnassignedDevices() {
+	podResources, err := pm.PodResources.GetPodResources()
+	if err != nil {
+		logging.Warningf("Error getting pod resources, allocated devices not checked: %v", err)
+		return
+	}
+
+	resourceName := pm.DevicePrefix + "/" + pm.Name
+	assigned := make(map[string]bool)
+	for _, pod := range podResources {
+		for _, container := range pod.GetContainers() {
+			for _, devices := range container.GetDevices() {
+				if devices.GetResourceName() != resourceName {
+					continue
+				}
+				for _, id := range devices.GetDeviceIds() {
+					assigned[id] = true
+				}
+			}
+		}
+	}
+
+	grace := time.Duration(constants.Devices.ReleaseGrace) * time.Second
+	unassigned := make(map[string]time.Time)
+	pm.cdqMutex.Lock()
+	for name, since := range pm.allocated {
+		if !assigned[name] && time.Since(since) >= grace {
+			unassigned[name] = since
+		}
+	}
+	pm.cdqMutex.Unlock()
+
+	for name, since := range unassigned {
+		pm.cdqMutex.Lock()
+		reallocated := pm.allocated[name] != since
+		pm.cdqMutex.Unlock()
+		if reallocated {
+			continue
+		}
+
+		// the pod holding the device is gone, so its UDS server is stopped and its busy poll
+		// settings restored even if still attached, whether or not the CNI uses the syncer
+		pm.stopUdsServer(name)
+		pm.restoreNapiSettings(name)
+
+		if pm.DpCniSyncerServer != nil && !pm.DpCniSyncerServer.ClearNetDevAllocated(name) {
+			logging.Debugf("Device %s is no longer assigned to a pod but is still attached, waiting for the CNI to detach it", name)
+			continue
+		}
+
+		logging.Infof("Device %s is no longer assigned to a pod, releasing it", name)
+		if err := pm.releaseDevice(name); err != nil {
+			logging.Warningf("Error releasing device %s: %v", name, err)
+		}
+	}
+}
+
+/*
+setUdsServer records the UDS server serving a device. The UDS server keeps listening
+until the device is released. If the device is allocated again before the release
+was seen, the UDS server of the previous allocation is stopped.
+*/
+func (pm *PoolManager) setUdsServer(name string, server udsserver.Server) {
+	pm.udsMutex.Lock()
+	old := pm.udsServers[name]
+	pm.udsServers[name] = server
+	pm.udsMutex.Unlock()
+
+	if old != nil && old != server {
+		logging.Infof("Stopping UDS server of previous allocation of device %s", name)
+		old.Stop()
+	}
+}
+
+/*
+stopUdsServer stops the UDS server serving a device, if there is one
+*/
+func (pm *PoolManager) stopUdsServer(name string) {
+	pm.udsMutex.Lock()
+	server := pm.udsServers[name]
+	delete(pm.udsServers, name)
+	pm.udsMutex.Unlock()
+
+	if server != nil {
+		logging.Infof("Stopping UDS server of device %s", name)
+		server.Stop()
+	}
+}
+
+/*
+stopUdsServers stops the UDS servers of all devices in the pool
+*/
+func (pm *PoolManager) stopUdsServers() {
+	pm.udsMutex.Lock()
+	servers := pm.udsServers
+	pm.udsServers = make(map[string]udsserver.Server)
+	pm.udsMutex.Unlock()
+
+	for _, server := range servers {
+		server.Stop()
+	}
+}
+
+/*
+assignCdqMacs assigns each CDQ subfunction of the pool the MAC address derived from the
+pool MAC config. The address is set on the subfunction each time it is activated.
+*/
+func (pm *PoolManager) assignCdqMacs() error {
+	if pm.CdqMac == nil {
+		return nil
+	}
+
+	for _, device := range pm.Devices {
+		if err := device.AssignCdqMac(pm.CdqMac); err != nil {
+			return err
+		}
+		mac, _ := device.Mac()
+		logging.Debugf("Assigned MAC address %s to CDQ subfunction %s", mac, device.Name())
+	}
+	return nil
+}
+
+/*
+releaseCdqSubfunction is called through the DP<=>CNI syncer when the CNI detaches a device.
+It deletes the CDQ subfunction of the device. If the deletion fails it is retried in the
+background until it succeeds or the device is allocated again.
+*/
+func (pm *PoolManager) releaseCdqSubfunction(name string) error {
+	pm.cdqMutex.Lock()
+	defer pm.cdqMutex.Unlock()
+
+	device, ok := pm.Devices[name]
+	if !ok {
+		return fmt.Errorf("device %s is not in pool %s", name, pm.Name)
+	}
+
+	delete(pm.allocated, name)
+
+	logging.Infof("Deleting CDQ subfunction %s", name)
+	if err := pm.deleteCdqSubfunction(device); err != nil {
+		pm.pendingDeletes[name] = true
+		return err
+	}
+	delete(pm.pendingDeletes, name)
+
+	logging.Infof("CDQ subfunction %s deleted", name)
+	pm.signalWarmPool()
+	return nil
+}
+
+/*
+deleteCdqSubfunction removes the rates of a CDQ subfunction and deletes it
+*/
+func (pm *PoolManager) deleteCdqSubfunction(device *networking.Device) error {
+	if pm.CdqRate != nil || pm.CdqPoolRate != nil {
+		if portIndex, err := device.PortIndex(); err == nil {
+			if err := pm.NetHandler.ClearCdqRate(portIndex); err != nil {
+				logging.Warningf("Error removing rates from CDQ subfunction %s: %v", device.Name(), err)
+			}
+		}
+	}
+
+	return device.DeactivateCdqSubfunction()
+}
+
+/*
+applyCdqRate applies the pool rates to a CDQ subfunction and groups it under the rate node
+of the pool on its primary device. The rate node is created on first use.
+*/
+func (pm *PoolManager) applyCdqRate(device *networking.Device) error {
+	if pm.CdqRate == nil && pm.CdqPoolRate == nil {
+		return nil
+	}
+
+	primary := device.Primary()
+	node := pm.rateNodeName()
+	if !pm.rateNodes[primary] {
+		pci, err := primary.Pci()
+		if err != nil {
+			return err
+		}
+		logging.Infof("Creating rate node %s on %s", node, primary.Name())
+		if err := pm.NetHandler.CreateCdqRateNode(pci, node, pm.CdqPoolRate); err != nil {
+			return err
+		}
+		pm.rateNodes[primary] = true
+	}
+
+	portIndex, err := device.PortIndex()
+	if err != nil {
+		return err
+	}
+
+	logging.Debugf("Applying rates to CDQ subfunction %s", device.Name())
+	return pm.NetHandler.SetCdqRate(portIndex, node, pm.CdqRate)
+}
+
+/*
+deleteRateNodes deletes the rate nodes of the pool. A node still grouping subfunctions
+allocated to pods cannot be deleted and is left in place.
+*/
+func (pm *PoolManager) deleteRateNodes() {
+	pm.cdqMutex.Lock()
+	defer pm.cdqMutex.Unlock()
+
+	for primary := range pm.rateNodes {
+		pci, err := primary.Pci()
+		if err == nil {
+			err = pm.NetHandler.DeleteCdqRateNode(pci, pm.rateNodeName())
+		}
+		if err != nil {
+			logging.Warningf("Error deleting rate node %s on %s: %v", pm.rateNodeName(), primary.Name(), err)
+			continue
+		}
+		delete(pm.rateNodes, primary)
+	}
+}
+
+/*
+rateNodeName returns the name of the devlink rate node grouping the subfunctions of the pool
+*/
+func (pm *PoolManager) rateNodeName() string {
+	return pm.DevicePrefix + "_" + pm.Name
+}
+
+/*
+retryCdqDeletions periodically retries the deletion of CDQ subfunctions whose deletion failed
+*/
+func (pm *PoolManager) retryCdqDeletions(stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(constants.Devices.CdqDeleteRetry) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			pm.cdqMutex.Lock()
+			for name := range pm.pendingDeletes {
+				logging.Debugf("Retrying deletion of CDQ subfunction %s", name)
+				if err := pm.deleteCdqSubfunction(pm.Devices[name]); err != nil {
+					logging.Warningf("Error deleting CDQ subfunction %s: %v", name, err)
+					continue
+				}
+				delete(pm.pendingDeletes, name)
+				logging.Infof("CDQ subfunction %s deleted", name)
+			}
+			pm.cdqMutex.Unlock()
+		}
+	}
+}
+
+/*
+monitorCdqCapacity periodically checks the CDQ subfunction capacity of the pool devices
+and notifies the kubelet of any change in device health
+*/
+func (pm *PoolManager) monitorCdqCapacity(stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(constants.Devices.CdqCapacity) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if pm.checkCdqCapacity() {
+				pm.UpdateSignal <- true
+			}
+		}
+	}
+}
+
+/*
+checkCdqCapacity compares the subfunctions devlink reports available on each primary device
+with the secondaries of the pool that have not been created. Secondaries that could not be
+created, because other users of the port have taken the capacity, are marked unhealthy so the
+kubelet stops allocating them. Secondaries already created are always healthy.
+It returns true if the health of any device changed.
+*/
+func (pm *PoolManager) checkCdqCapacity() bool {
+	pm.cdqMutex.Lock()
+	defer pm.cdqMutex.Unlock()
+
+	names := make([]string, 0, len(pm.Devices))
+	for name := range pm.Devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	placeholders := make(map[*networking.Device][]string)
+	unhealthy := make(map[string]bool)
+	for _, name := range names {
+		device := pm.Devices[name]
+		if device.IsPrimary() || device.IsActive() || pm.isAllocated(name) {
+			continue
+		}
+		placeholders[device.Primary()] = append(placeholders[device.Primary()], name)
+	}
+
+	for primary, names := range placeholders {
+		pci, err := primary.Pci()
+		if err != nil {
+			logging.Warningf("Error getting PCI address of primary device %s: %v", primary.Name(), err)
+			continue
+		}
+		available, err := pm.NetHandler.NumAvailableCdqSubfunctions(pci)
+		if err != nil {
+			logging.Warningf("Error getting available CDQ subfunctions on %s: %v", primary.Name(), err)
+			continue
+		}
+		for i, name := range names {
+			if i >= available {
+				unhealthy[name] = true
+			}
+		}
+	}
+
+	changed := len(unhealthy) != len(pm.unhealthy)
+	for name := range unhealthy {
+		if !pm.unhealthy[name] {
+			logging.Warningf("No capacity left to create CDQ subfunction %s, marking it unhealthy", name)
+			changed = true
+		}
+	}
+	for name := range pm.unhealthy {
+		if !unhealthy[name] {
+			logging.Infof("Capacity available to create CDQ subfunction %s, marking it healthy", name)
+		}
+	}
+	pm.unhealthy = unhealthy
+
+	return changed
+}
+
+/*
+signalWarmPool asks the warm pool replenisher to refill the warm pool. It does not block,
+a refill already requested covers this request.
+*/
+func (pm *PoolManager) signalWarmPool() {
+	if pm.CdqWarmPool <= 0 {
+		return
+	}
+	select {
+	case pm.warmPoolSignal <- struct{}{}:
+	default:
+	}
+}
+
+/*
+replenishWarmPool refills the warm pool when signalled after an allocation or release,
+and periodically in case an earlier refill could not complete.
+*/
+func (pm *PoolManager) replenishWarmPool(stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(constants.Devices.CdqWarmRefresh) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-pm.warmPoolSignal:
+			pm.fillWarmPool()
+		case <-ticker.C:
+			pm.fillWarmPool()
+		}
+	}
+}
+
+/*
+fillWarmPool creates CDQ subfunctions until each primary device has CdqWarmPool subfunctions
+created and not allocated, or until the hardware has no more subfunctions available.
+Subfunctions are created one at a time, so an allocation waits for at most one creation.
+*/
+func (pm *PoolManager) fillWarmPool() {
+	for {
+		device := pm.nextWarmCandidate()
+		if device == nil {
+			return
+		}
+
+		pm.cdqMutex.Lock()
+		if device.IsActive() || pm.isAllocated(device.Name()) || pm.pendingDeletes[device.Name()] {
+			pm.cdqMutex.Unlock()
+			continue
+		}
+		logging.Debugf("Creating warm CDQ subfunction %s", device.Name())
+		err := device.ActivateCdqSubfunction()
+		pm.cdqMutex.Unlock()
+
+		if err != nil {
+			logging.Warningf("Error creating warm CDQ subfunction %s: %v", device.Name(), err)
+			return
+		}
+	}
+}
+
+/*
+nextWarmCandidate returns the next subfunction to create for the warm pool, or nil if
+the warm pool is full or no more subfunctions can be created
+*/
+func (pm *PoolManager) nextWarmCandidate() *networking.Device {
+	pm.cdqMutex.Lock()
+	defer pm.cdqMutex.Unlock()
+
+	warm := make(map[*networking.Device]int)
+	candidates := make(map[*networking.Device][]*networking.Device)
+
+	names := make([]string, 0, len(pm.Devices))
+	for name := range pm.Devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		device := pm.Devices[name]
+		if device.IsPrimary() || pm.isAllocated(name) || pm.pendingDeletes[name] {
+			continue
+		}
+		if device.IsActive() {
+			warm[device.Primary()]++
+		} else {
+			candidates[device.Primary()] = append(candidates[device.Primary()], device)
+		}
+	}
+
+	for _, name := range names {
+		primary := pm.Devices[name].Primary()
+		if warm[primary] >= pm.CdqWarmPool || len(candidates[primary]) == 0 {
+			continue
+		}
+
+		pci, err := primary.Pci()
+		if err != nil {
+			logging.Warningf("Error getting PCI address of primary device %s: %v", primary.Name(), err)
+			continue
+		}
+		available, err := pm.NetHandler.NumAvailableCdqSubfunctions(pci)
+		if err != nil {
+			logging.Warningf("Error getting available CDQ subfunctions on %s: %v", primary.Name(), err)
+			continue
+		}
+		if available <= 0 {
+			logging.Debugf("No CDQ subfunctions available on %s, warm pool not refilled", primary.Name())
+			continue
+		}
+
+		return candidates[primary][0]
+	}
+
+	return nil
+}
+
 /*
 GetDevicePluginOptions is part of the device plugin API.
-Unused.
+The kubelet is asked for preferred allocations, see GetPreferredAllocation.
 */
 func (pm *PoolManager) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
-	return &pluginapi.DevicePluginOptions{}, nil
+	return &pluginapi.DevicePluginOptions{GetPreferredAllocationAvailable: true}, nil
 }
 
 /*
@@ -318,10 +1082,50 @@ func (pm *PoolManager) PreStartContainer(context.Context, *pluginapi.PreStartCon
 
 /*
 GetPreferredAllocation is part of the device plugin API.
-Unused.
+Devices the kubelet requires are preferred first, then CDQ subfunctions already created by the
+warm pool and not allocated, so a pod does not wait for a subfunction to be created. Other
+devices follow in name order.
 */
-func (pm *PoolManager) GetPreferredAllocation(context.Context, *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
-	return &pluginapi.PreferredAllocationResponse{}, nil
+func (pm *PoolManager) GetPreferredAllocation(ctx context.Context, rqt *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
+	response := &pluginapi.PreferredAllocationResponse{}
+
+	pm.cdqMutex.Lock()
+	defer pm.cdqMutex.Unlock()
+
+	for _, crqt := range rqt.ContainerRequests {
+		preferred := append([]string{}, crqt.MustIncludeDeviceIDs...)
+		included := make(map[string]bool)
+		for _, name := range preferred {
+			included[name] = true
+		}
+
+		var warm, cold []string
+		for _, name := range crqt.AvailableDeviceIDs {
+			if included[name] {
+				continue
+			}
+			device, ok := pm.Devices[name]
+			if ok && pm.Mode == "cdq" && device.IsActive() && !pm.isAllocated(name) && !pm.pendingDeletes[name] {
+				warm = append(warm, name)
+			} else {
+				cold = append(cold, name)
+			}
+		}
+		sort.Strings(warm)
+		sort.Strings(cold)
+
+		for _, name := range append(warm, cold...) {
+			if len(preferred) >= int(crqt.AllocationSize) {
+				break
+			}
+			preferred = append(preferred, name)
+		}
+
+		logging.Debugf("Preferred allocation on pool %s: %v", pm.Name, preferred)
+		response.ContainerResponses = append(response.ContainerResponses, &pluginapi.ContainerPreferredAllocationResponse{DeviceIDs: preferred})
+	}
+
+	return response, nil
 }
 
 func (pm *PoolManager) registerWithKubelet() error {
@@ -398,3 +1202,10 @@ func (pm *PoolManager) cleanup() error {
 	}
 	return nil
 }
+
+/*
+macEnvVar returns the name of the container environment variable holding the MAC address of a device
+*/
+func macEnvVar(device string) string {
+	return constants.Devices.EnvVarMac + strings.ToUpper(strings.ReplaceAll(device, "-", "_"))
+}
@@ -19,11 +19,16 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/bpf"
+	pb "github.com/intel/afxdp-plugins-for-kubernetes/internal/dpcnisyncer"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/dpcnisyncerserver"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/resourcesapi"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/udsserver"
 	"github.com/stretchr/testify/assert"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
@@ -252,3 +257,440 @@ func TestAllocate(t *testing.T) {
 		})
 	}
 }
+
+func TestReleaseCdqSubfunction(t *testing.T) {
+	netHandler := networking.NewFakeHandler()
+	primary := networking.CreateTestDevice("ens801f0", "", "ice", "0000:81:00.0", "68:05:ca:2d:e9:00", netHandler)
+	secondaries, err := primary.AssignCdqSecondaries(2)
+	if err != nil {
+		assert.FailNow(t, "Unexpected error assigning CDQ secondaries %v", err)
+	}
+
+	devices := make(map[string]*networking.Device)
+	for _, sf := range secondaries {
+		devices[sf.Name()] = sf
+	}
+
+	pm := NewPoolManager(PoolConfig{Name: "myCdqPool", Mode: "cdq", Devices: devices})
+
+	testCases := []struct {
+		name   string
+		device string
+		expErr bool
+	}{
+		{
+			name:   "release active subfunction",
+			device: "ens801f0sf1",
+		},
+		{
+			name:   "release subfunction pending deletion",
+			device: "ens801f0sf2",
+		},
+		{
+			name:   "release device not in pool",
+			device: "ens801f0sf9",
+			expErr: true,
+		},
+	}
+
+	pm.pendingDeletes["ens801f0sf2"] = true
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if device, ok := devices[tc.device]; ok {
+				if err := pm.activateCdqSubfunction(device); err != nil {
+					assert.FailNow(t, "Unexpected error activating subfunction %v", err)
+				}
+				assert.True(t, device.IsActive(), "Subfunction should be active")
+			}
+
+			err := pm.releaseCdqSubfunction(tc.device)
+
+			if tc.expErr {
+				assert.Error(t, err, "Expected an error")
+				return
+			}
+			assert.NoError(t, err, "Unexpected error")
+			assert.False(t, devices[tc.device].IsActive(), "Subfunction should not be active")
+			assert.False(t, pm.pendingDeletes[tc.device], "Subfunction should not be pending deletion")
+		})
+	}
+}
+
+func TestFillWarmPool(t *testing.T) {
+	netHandler := networking.NewFakeHandler()
+	primary := networking.CreateTestDevice("ens801f0", "", "ice", "0000:81:00.0", "68:05:ca:2d:e9:00", netHandler)
+	secondaries, err := primary.AssignCdqSecondaries(4)
+	if err != nil {
+		assert.FailNow(t, "Unexpected error assigning CDQ secondaries %v", err)
+	}
+
+	devices := make(map[string]*networking.Device)
+	for _, sf := range secondaries {
+		devices[sf.Name()] = sf
+	}
+
+	pm := NewPoolManager(PoolConfig{Name: "myCdqPool", Mode: "cdq", Devices: devices, CdqWarmPool: 2})
+	pm.NetHandler = netHandler
+
+	countActive := func() int {
+		active := 0
+		for _, device := range devices {
+			if device.IsActive() {
+				active++
+			}
+		}
+		return active
+	}
+
+	pm.fillWarmPool()
+	assert.Equal(t, 2, countActive(), "Unexpected number of warm subfunctions")
+
+	warm := devices["ens801f0sf1"]
+	assert.True(t, warm.IsActive(), "Subfunction should be warm")
+	if err := pm.activateCdqSubfunction(warm); err != nil {
+		assert.FailNow(t, "Unexpected error activating subfunction %v", err)
+	}
+
+	pm.fillWarmPool()
+	assert.Equal(t, 3, countActive(), "Warm pool should be refilled after allocation")
+
+	if err := pm.releaseCdqSubfunction(warm.Name()); err != nil {
+		assert.FailNow(t, "Unexpected error releasing subfunction %v", err)
+	}
+
+	pm.fillWarmPool()
+	assert.Equal(t, 2, countActive(), "Warm pool should not grow beyond its size")
+}
+
+func TestCheckCdqCapacity(t *testing.T) {
+	netHandler := networking.NewFakeHandler()
+	netHandler.SetCdqCapacity(4)
+	primary := networking.CreateTestDevice("ens801f0", "", "ice", "0000:81:00.0", "68:05:ca:2d:e9:00", netHandler)
+	secondaries, err := primary.AssignCdqSecondaries(0)
+	if err != nil {
+		assert.FailNow(t, "Unexpected error assigning CDQ secondaries %v", err)
+	}
+	assert.Equal(t, 4, len(secondaries), "Secondaries should be sized from the hardware capacity")
+
+	devices := make(map[string]*networking.Device)
+	for _, sf := range secondaries {
+		devices[sf.Name()] = sf
+	}
+
+	pm := NewPoolManager(PoolConfig{Name: "myCdqPool", Mode: "cdq", Devices: devices})
+	pm.NetHandler = netHandler
+
+	assert.False(t, pm.checkCdqCapacity(), "Device health should not change")
+	assert.Empty(t, pm.unhealthy, "All devices should be healthy")
+
+	if err := pm.activateCdqSubfunction(devices["ens801f0sf1"]); err != nil {
+		assert.FailNow(t, "Unexpected error activating subfunction %v", err)
+	}
+
+	netHandler.SetCdqCapacity(1)
+	assert.True(t, pm.checkCdqCapacity(), "Device health should change")
+	assert.Equal(t, map[string]bool{"ens801f0sf3": true, "ens801f0sf4": true}, pm.unhealthy, "Unexpected unhealthy devices")
+
+	netHandler.SetCdqCapacity(3)
+	assert.True(t, pm.checkCdqCapacity(), "Device health should change")
+	assert.Empty(t, pm.unhealthy, "All devices should be healthy")
+}
+
+func TestApplyCdqRate(t *testing.T) {
+	netHandler := networking.NewFakeHandler()
+	primary := networking.CreateTestDevice("ens801f0", "", "ice", "0000:81:00.0", "68:05:ca:2d:e9:00", netHandler)
+	secondaries, err := primary.AssignCdqSecondaries(2)
+	if err != nil {
+		assert.FailNow(t, "Unexpected error assigning CDQ secondaries %v", err)
+	}
+
+	devices := make(map[string]*networking.Device)
+	for _, sf := range secondaries {
+		devices[sf.Name()] = sf
+	}
+
+	pm := NewPoolManager(PoolConfig{
+		Name:        "myCdqPool",
+		Mode:        "cdq",
+		Devices:     devices,
+		CdqRate:     &networking.RateConfig{TxShare: "100mbit", TxMax: "1gbit"},
+		CdqPoolRate: &networking.RateConfig{TxMax: "10gbit"},
+	})
+	pm.NetHandler = netHandler
+
+	assert.Equal(t, "afxdp_myCdqPool", pm.rateNodeName(), "Unexpected rate node name")
+
+	for _, sf := range secondaries {
+		if err := pm.activateCdqSubfunction(sf); err != nil {
+			assert.FailNow(t, "Unexpected error activating subfunction %v", err)
+		}
+	}
+	assert.Equal(t, map[*networking.Device]bool{primary: true}, pm.rateNodes, "One rate node should be created per primary")
+
+	for _, sf := range secondaries {
+		if err := pm.releaseCdqSubfunction(sf.Name()); err != nil {
+			assert.FailNow(t, "Unexpected error releasing subfunction %v", err)
+		}
+	}
+
+	pm.deleteRateNodes()
+	assert.Empty(t, pm.rateNodes, "Rate nodes should be deleted")
+}
+
+func TestAssignCdqMacs(t *testing.T) {
+	netHandler := networking.NewFakeHandler()
+	primary := networking.CreateTestDevice("ens801f0", "", "ice", "0000:81:00.0", "68:05:ca:2d:e9:00", netHandler)
+	secondaries, err := primary.AssignCdqSecondaries(3)
+	if err != nil {
+		assert.FailNow(t, "Unexpected error assigning CDQ secondaries %v", err)
+	}
+
+	devices := make(map[string]*networking.Device)
+	for _, sf := range secondaries {
+		devices[sf.Name()] = sf
+	}
+
+	pm := NewPoolManager(PoolConfig{
+		Name:    "myCdqPool",
+		Mode:    "cdq",
+		Devices: devices,
+		CdqMac:  &networking.MacConfig{Oui: "02:00:5e", Seed: "node1/myCdqPool"},
+	})
+	pm.NetHandler = netHandler
+
+	if err := pm.assignCdqMacs(); err != nil {
+		assert.FailNow(t, "Unexpected error assigning MAC addresses %v", err)
+	}
+
+	macs := make(map[string]string)
+	for _, sf := range secondaries {
+		mac, err := sf.Mac()
+		assert.NoError(t, err, "Unexpected error getting MAC address")
+		assert.Regexp(t, "^02:00:5e:", mac, "MAC address should use the configured OUI")
+		assert.NotContains(t, macs, mac, "MAC addresses should be unique")
+		macs[mac] = sf.Name()
+	}
+
+	for _, sf := range secondaries {
+		if err := pm.activateCdqSubfunction(sf); err != nil {
+			assert.FailNow(t, "Unexpected error activating subfunction %v", err)
+		}
+		if err := pm.releaseCdqSubfunction(sf.Name()); err != nil {
+			assert.FailNow(t, "Unexpected error releasing subfunction %v", err)
+		}
+	}
+
+	if err := pm.assignCdqMacs(); err != nil {
+		assert.FailNow(t, "Unexpected error assigning MAC addresses %v", err)
+	}
+	for _, sf := range secondaries {
+		mac, _ := sf.Mac()
+		assert.Equal(t, sf.Name(), macs[mac], "MAC address should not change when the subfunction is recreated")
+	}
+
+	pm.CdqMac = &networking.MacConfig{Oui: "02:00:5e", Seed: "node2/myCdqPool"}
+	if err := pm.assignCdqMacs(); err != nil {
+		assert.FailNow(t, "Unexpected error assigning MAC addresses %v", err)
+	}
+	for _, sf := range secondaries {
+		mac, _ := sf.Mac()
+		assert.NotContains(t, macs, mac, "MAC addresses should differ between nodes")
+	}
+
+	nodeIndex := 0x123
+	pm.CdqMac = &networking.MacConfig{Oui: "02:00:5e", Seed: "node1/myCdqPool", NodeIndex: &nodeIndex, Primaries: map[string]int{"ens801f0": 2}}
+	if err := pm.assignCdqMacs(); err != nil {
+		assert.FailNow(t, "Unexpected error assigning MAC addresses %v", err)
+	}
+	mac, _ := devices["ens801f0sf3"].Mac()
+	assert.Equal(t, "02:00:5e:12:30:82", mac, "MAC address should be taken from the node range")
+
+	pm.CdqMac.Primaries = map[string]int{}
+	assert.Error(t, pm.assignCdqMacs(), "Expected an error for a primary device without an index")
+}
+
+func TestEthtoolFilters(t *testing.T) {
+	action := 1
+	pm := NewPoolManager(PoolConfig{
+		Name: "myPool",
+		Mode: "primary",
+		EthtoolFilters: []*networking.EthtoolFilter{
+			{FlowType: "udp4", Action: &action},
+			{FlowType: "tcp4", Action: &action},
+		},
+	})
+	pm.NetHandler = networking.NewFakeHandler()
+
+	var wg sync.WaitGroup
+	for _, device := range []string{"dev1", "dev2", "dev1", "dev2"} {
+		wg.Add(1)
+		go func(device string) {
+			defer wg.Done()
+			assert.NoError(t, pm.applyEthtoolFilters(device), "Unexpected error applying ethtool filters")
+		}(device)
+	}
+	wg.Wait()
+	assert.Equal(t, map[string][]uint32{"dev1": {0, 1}, "dev2": {0, 1}}, pm.ethtoolRules, "Rules should be recorded once per device")
+
+	if err := pm.releaseDevice("dev1"); err != nil {
+		assert.FailNow(t, "Unexpected error releasing device %v", err)
+	}
+	assert.Equal(t, map[string][]uint32{"dev2": {0, 1}}, pm.ethtoolRules, "Rules should be removed on release")
+}
+
+func TestGetPreferredAllocation(t *testing.T) {
+	netHandler := networking.NewFakeHandler()
+	primary := networking.CreateTestDevice("ens801f0", "", "ice", "0000:81:00.0", "68:05:ca:2d:e9:00", netHandler)
+	secondaries, err := primary.AssignCdqSecondaries(4)
+	if err != nil {
+		assert.FailNow(t, "Unexpected error assigning CDQ secondaries %v", err)
+	}
+
+	devices := make(map[string]*networking.Device)
+	for _, sf := range secondaries {
+		devices[sf.Name()] = sf
+	}
+
+	pm := NewPoolManager(PoolConfig{Name: "myCdqPool", Mode: "cdq", Devices: devices})
+	pm.NetHandler = netHandler
+
+	for _, name := range []string{"ens801f0sf2", "ens801f0sf3", "ens801f0sf4"} {
+		if err := devices[name].ActivateCdqSubfunction(); err != nil {
+			assert.FailNow(t, "Unexpected error activating subfunction %v", err)
+		}
+	}
+	pm.allocated["ens801f0sf4"] = time.Now()
+
+	options, err := pm.GetDevicePluginOptions(context.Background(), &pluginapi.Empty{})
+	assert.NoError(t, err, "Unexpected error")
+	assert.True(t, options.GetPreferredAllocationAvailable, "Preferred allocation should be available")
+
+	testCases := []struct {
+		name        string
+		available   []string
+		mustInclude []string
+		size        int32
+		expDevices  []string
+	}{
+		{
+			name:       "warm subfunctions first",
+			available:  []string{"ens801f0sf1", "ens801f0sf2", "ens801f0sf3", "ens801f0sf4"},
+			size:       2,
+			expDevices: []string{"ens801f0sf2", "ens801f0sf3"},
+		},
+		{
+			name:       "allocated subfunction is not warm",
+			available:  []string{"ens801f0sf1", "ens801f0sf3", "ens801f0sf4"},
+			size:       2,
+			expDevices: []string{"ens801f0sf3", "ens801f0sf1"},
+		},
+		{
+			name:        "required devices first",
+			available:   []string{"ens801f0sf1", "ens801f0sf2", "ens801f0sf3"},
+			mustInclude: []string{"ens801f0sf1"},
+			size:        2,
+			expDevices:  []string{"ens801f0sf1", "ens801f0sf2"},
+		},
+		{
+			name:       "fewer available than requested",
+			available:  []string{"ens801f0sf1"},
+			size:       2,
+			expDevices: []string{"ens801f0sf1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response, err := pm.GetPreferredAllocation(context.Background(), &pluginapi.PreferredAllocationRequest{
+				ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{
+					{AvailableDeviceIDs: tc.available, MustIncludeDeviceIDs: tc.mustInclude, AllocationSize: tc.size},
+				},
+			})
+			assert.NoError(t, err, "Unexpected error")
+			if assert.Len(t, response.ContainerResponses, 1, "Expected one container response") {
+				assert.Equal(t, tc.expDevices, response.ContainerResponses[0].DeviceIDs, "Unexpected preferred devices")
+			}
+		})
+	}
+}
+
+func TestReleaseUnassignedDevices(t *testing.T) {
+	netHandler := networking.NewFakeHandler()
+	primary := networking.CreateTestDevice("ens801f0", "", "ice", "0000:81:00.0", "68:05:ca:2d:e9:00", netHandler)
+	secondaries, err := primary.AssignCdqSecondaries(4)
+	if err != nil {
+		assert.FailNow(t, "Unexpected error assigning CDQ secondaries %v", err)
+	}
+
+	devices := make(map[string]*networking.Device)
+	for _, sf := range secondaries {
+		devices[sf.Name()] = sf
+	}
+
+	syncer := &dpcnisyncerserver.SyncerServer{}
+	pm := NewPoolManager(PoolConfig{Name: "myCdqPool", Mode: "cdq", Devices: devices, DPCNIServer: syncer})
+	pm.NetHandler = netHandler
+	podResources := resourcesapi.NewFakeHandler()
+	podResources.CreateFakePod("pod1", "default", pm.DevicePrefix+"/"+pm.Name, []string{"ens801f0sf1"})
+	pm.PodResources = podResources
+
+	for name, device := range devices {
+		syncer.RegisterNetDev(name, pm.Name, device.Mode(), primary.Name(), pm.releaseDevice)
+		if err := pm.activateCdqSubfunction(device); err != nil {
+			assert.FailNow(t, "Unexpected error activating subfunction %v", err)
+		}
+		assert.NoError(t, syncer.SetNetDevAllocated(name, "", ""), "Unexpected error")
+	}
+
+	past := time.Now().Add(-time.Duration(constants.Devices.ReleaseGrace+1) * time.Second)
+	pm.allocated["ens801f0sf1"] = past // still assigned to pod1
+	pm.allocated["ens801f0sf2"] = past // no longer assigned
+	pm.allocated["ens801f0sf3"] = past // no longer assigned, but attached by the CNI
+	// ens801f0sf4 was allocated within the grace period
+
+	_, err = syncer.AttachNetDev(context.Background(), &pb.AttachNetDevReq{Name: "ens801f0sf3", ContainerId: "container3"})
+	assert.NoError(t, err, "Unexpected error")
+
+	for _, name := range []string{"ens801f0sf1", "ens801f0sf2", "ens801f0sf3"} {
+		pm.napiSettings[name] = &networking.NapiSettings{}
+	}
+
+	pm.releaseUnassignedDevices()
+
+	assert.True(t, devices["ens801f0sf1"].IsActive(), "Assigned device should not be released")
+	assert.False(t, devices["ens801f0sf2"].IsActive(), "Unassigned device should be released")
+	assert.True(t, devices["ens801f0sf3"].IsActive(), "Attached device should be left to the CNI")
+	assert.True(t, devices["ens801f0sf4"].IsActive(), "Recently allocated device should not be released")
+	assert.NotContains(t, pm.allocated, "ens801f0sf2", "Released device should not be allocated")
+	assert.Len(t, pm.allocated, 3, "Other devices should stay allocated")
+	assert.Contains(t, pm.napiSettings, "ens801f0sf1", "NAPI settings of an assigned device should not be restored")
+	assert.NotContains(t, pm.napiSettings, "ens801f0sf2", "NAPI settings of a released device should be restored")
+	assert.NotContains(t, pm.napiSettings, "ens801f0sf3", "NAPI settings of an unassigned attached device should be restored")
+}
+
+func TestNapiSettings(t *testing.T) {
+	netHandler := networking.NewFakeHandler()
+	pm := NewPoolManager(PoolConfig{
+		Name:     "myPool",
+		Mode:     "primary",
+		BusyPoll: &networking.BusyPollConfig{Timeout: 50, Budget: 64, DeferHardIrqs: 2, GroFlushTimeout: 200000},
+	})
+	pm.NetHandler = netHandler
+
+	if err := pm.applyNapiSettings("dev1"); err != nil {
+		assert.FailNow(t, "Unexpected error applying NAPI settings %v", err)
+	}
+	original := pm.napiSettings["dev1"]
+	assert.Equal(t, &networking.NapiSettings{}, original, "Settings found on the device should be kept")
+
+	if err := pm.applyNapiSettings("dev1"); err != nil {
+		assert.FailNow(t, "Unexpected error applying NAPI settings %v", err)
+	}
+	assert.Same(t, original, pm.napiSettings["dev1"], "Settings kept from the first allocation should not be overwritten")
+
+	if err := pm.releaseDevice("dev1"); err != nil {
+		assert.FailNow(t, "Unexpected error releasing device %v", err)
+	}
+	assert.Empty(t, pm.napiSettings, "Settings should be restored on release")
+}
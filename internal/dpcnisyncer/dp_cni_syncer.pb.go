@@ -113,9 +113,465 @@ func (m *DeleteNetDevResp) GetRet() int32 {
 	return 0
 }
 
+type GetNetDevInfoReq struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetNetDevInfoReq) Reset()         { *m = GetNetDevInfoReq{} }
+func (m *GetNetDevInfoReq) String() string { return proto.CompactTextString(m) }
+func (*GetNetDevInfoReq) ProtoMessage()    {}
+func (*GetNetDevInfoReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f9ab154255673e38, []int{2}
+}
+
+func (m *GetNetDevInfoReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetNetDevInfoReq.Unmarshal(m, b)
+}
+func (m *GetNetDevInfoReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetNetDevInfoReq.Marshal(b, m, deterministic)
+}
+func (m *GetNetDevInfoReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetNetDevInfoReq.Merge(m, src)
+}
+func (m *GetNetDevInfoReq) XXX_Size() int {
+	return xxx_messageInfo_GetNetDevInfoReq.Size(m)
+}
+func (m *GetNetDevInfoReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetNetDevInfoReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetNetDevInfoReq proto.InternalMessageInfo
+
+func (m *GetNetDevInfoReq) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type GetNetDevInfoResp struct {
+	Ret                  int32    `protobuf:"varint,1,opt,name=ret,proto3" json:"ret,omitempty"`
+	Pool                 string   `protobuf:"bytes,2,opt,name=pool,proto3" json:"pool,omitempty"`
+	Mode                 string   `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	Primary              string   `protobuf:"bytes,4,opt,name=primary,proto3" json:"primary,omitempty"`
+	Pci                  string   `protobuf:"bytes,5,opt,name=pci,proto3" json:"pci,omitempty"`
+	MapPath              string   `protobuf:"bytes,6,opt,name=map_path,json=mapPath,proto3" json:"map_path,omitempty"`
+	Allocated            bool     `protobuf:"varint,7,opt,name=allocated,proto3" json:"allocated,omitempty"`
+	ContainerId          string   `protobuf:"bytes,8,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	Netns                string   `protobuf:"bytes,9,opt,name=netns,proto3" json:"netns,omitempty"`
+	PodNamespace         string   `protobuf:"bytes,10,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+	PodName              string   `protobuf:"bytes,11,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetNetDevInfoResp) Reset()         { *m = GetNetDevInfoResp{} }
+func (m *GetNetDevInfoResp) String() string { return proto.CompactTextString(m) }
+func (*GetNetDevInfoResp) ProtoMessage()    {}
+func (*GetNetDevInfoResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f9ab154255673e38, []int{3}
+}
+
+func (m *GetNetDevInfoResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetNetDevInfoResp.Unmarshal(m, b)
+}
+func (m *GetNetDevInfoResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetNetDevInfoResp.Marshal(b, m, deterministic)
+}
+func (m *GetNetDevInfoResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetNetDevInfoResp.Merge(m, src)
+}
+func (m *GetNetDevInfoResp) XXX_Size() int {
+	return xxx_messageInfo_GetNetDevInfoResp.Size(m)
+}
+func (m *GetNetDevInfoResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetNetDevInfoResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetNetDevInfoResp proto.InternalMessageInfo
+
+func (m *GetNetDevInfoResp) GetRet() int32 {
+	if m != nil {
+		return m.Ret
+	}
+	return 0
+}
+
+func (m *GetNetDevInfoResp) GetPool() string {
+	if m != nil {
+		return m.Pool
+	}
+	return ""
+}
+
+func (m *GetNetDevInfoResp) GetMode() string {
+	if m != nil {
+		return m.Mode
+	}
+	return ""
+}
+
+func (m *GetNetDevInfoResp) GetPrimary() string {
+	if m != nil {
+		return m.Primary
+	}
+	return ""
+}
+
+func (m *GetNetDevInfoResp) GetPci() string {
+	if m != nil {
+		return m.Pci
+	}
+	return ""
+}
+
+func (m *GetNetDevInfoResp) GetMapPath() string {
+	if m != nil {
+		return m.MapPath
+	}
+	return ""
+}
+
+func (m *GetNetDevInfoResp) GetAllocated() bool {
+	if m != nil {
+		return m.Allocated
+	}
+	return false
+}
+
+func (m *GetNetDevInfoResp) GetContainerId() string {
+	if m != nil {
+		return m.ContainerId
+	}
+	return ""
+}
+
+func (m *GetNetDevInfoResp) GetNetns() string {
+	if m != nil {
+		return m.Netns
+	}
+	return ""
+}
+
+func (m *GetNetDevInfoResp) GetPodNamespace() string {
+	if m != nil {
+		return m.PodNamespace
+	}
+	return ""
+}
+
+func (m *GetNetDevInfoResp) GetPodName() string {
+	if m != nil {
+		return m.PodName
+	}
+	return ""
+}
+
+type AttachNetDevReq struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	ContainerId          string   `protobuf:"bytes,2,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	Netns                string   `protobuf:"bytes,3,opt,name=netns,proto3" json:"netns,omitempty"`
+	PodNamespace         string   `protobuf:"bytes,4,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+	PodName              string   `protobuf:"bytes,5,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	IfName               string   `protobuf:"bytes,6,opt,name=if_name,json=ifName,proto3" json:"if_name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AttachNetDevReq) Reset()         { *m = AttachNetDevReq{} }
+func (m *AttachNetDevReq) String() string { return proto.CompactTextString(m) }
+func (*AttachNetDevReq) ProtoMessage()    {}
+func (*AttachNetDevReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f9ab154255673e38, []int{4}
+}
+
+func (m *AttachNetDevReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AttachNetDevReq.Unmarshal(m, b)
+}
+func (m *AttachNetDevReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AttachNetDevReq.Marshal(b, m, deterministic)
+}
+func (m *AttachNetDevReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AttachNetDevReq.Merge(m, src)
+}
+func (m *AttachNetDevReq) XXX_Size() int {
+	return xxx_messageInfo_AttachNetDevReq.Size(m)
+}
+func (m *AttachNetDevReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_AttachNetDevReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AttachNetDevReq proto.InternalMessageInfo
+
+func (m *AttachNetDevReq) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *AttachNetDevReq) GetContainerId() string {
+	if m != nil {
+		return m.ContainerId
+	}
+	return ""
+}
+
+func (m *AttachNetDevReq) GetNetns() string {
+	if m != nil {
+		return m.Netns
+	}
+	return ""
+}
+
+func (m *AttachNetDevReq) GetPodNamespace() string {
+	if m != nil {
+		return m.PodNamespace
+	}
+	return ""
+}
+
+func (m *AttachNetDevReq) GetPodName() string {
+	if m != nil {
+		return m.PodName
+	}
+	return ""
+}
+
+func (m *AttachNetDevReq) GetIfName() string {
+	if m != nil {
+		return m.IfName
+	}
+	return ""
+}
+
+type AttachNetDevResp struct {
+	Ret                  int32    `protobuf:"varint,1,opt,name=ret,proto3" json:"ret,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AttachNetDevResp) Reset()         { *m = AttachNetDevResp{} }
+func (m *AttachNetDevResp) String() string { return proto.CompactTextString(m) }
+func (*AttachNetDevResp) ProtoMessage()    {}
+func (*AttachNetDevResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f9ab154255673e38, []int{5}
+}
+
+func (m *AttachNetDevResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AttachNetDevResp.Unmarshal(m, b)
+}
+func (m *AttachNetDevResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AttachNetDevResp.Marshal(b, m, deterministic)
+}
+func (m *AttachNetDevResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AttachNetDevResp.Merge(m, src)
+}
+func (m *AttachNetDevResp) XXX_Size() int {
+	return xxx_messageInfo_AttachNetDevResp.Size(m)
+}
+func (m *AttachNetDevResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_AttachNetDevResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AttachNetDevResp proto.InternalMessageInfo
+
+func (m *AttachNetDevResp) GetRet() int32 {
+	if m != nil {
+		return m.Ret
+	}
+	return 0
+}
+
+type DetachNetDevReq struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	ContainerId          string   `protobuf:"bytes,2,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DetachNetDevReq) Reset()         { *m = DetachNetDevReq{} }
+func (m *DetachNetDevReq) String() string { return proto.CompactTextString(m) }
+func (*DetachNetDevReq) ProtoMessage()    {}
+func (*DetachNetDevReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f9ab154255673e38, []int{6}
+}
+
+func (m *DetachNetDevReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DetachNetDevReq.Unmarshal(m, b)
+}
+func (m *DetachNetDevReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DetachNetDevReq.Marshal(b, m, deterministic)
+}
+func (m *DetachNetDevReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DetachNetDevReq.Merge(m, src)
+}
+func (m *DetachNetDevReq) XXX_Size() int {
+	return xxx_messageInfo_DetachNetDevReq.Size(m)
+}
+func (m *DetachNetDevReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_DetachNetDevReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DetachNetDevReq proto.InternalMessageInfo
+
+func (m *DetachNetDevReq) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *DetachNetDevReq) GetContainerId() string {
+	if m != nil {
+		return m.ContainerId
+	}
+	return ""
+}
+
+type DetachNetDevResp struct {
+	Ret                  int32    `protobuf:"varint,1,opt,name=ret,proto3" json:"ret,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DetachNetDevResp) Reset()         { *m = DetachNetDevResp{} }
+func (m *DetachNetDevResp) String() string { return proto.CompactTextString(m) }
+func (*DetachNetDevResp) ProtoMessage()    {}
+func (*DetachNetDevResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f9ab154255673e38, []int{7}
+}
+
+func (m *DetachNetDevResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DetachNetDevResp.Unmarshal(m, b)
+}
+func (m *DetachNetDevResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DetachNetDevResp.Marshal(b, m, deterministic)
+}
+func (m *DetachNetDevResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DetachNetDevResp.Merge(m, src)
+}
+func (m *DetachNetDevResp) XXX_Size() int {
+	return xxx_messageInfo_DetachNetDevResp.Size(m)
+}
+func (m *DetachNetDevResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_DetachNetDevResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DetachNetDevResp proto.InternalMessageInfo
+
+func (m *DetachNetDevResp) GetRet() int32 {
+	if m != nil {
+		return m.Ret
+	}
+	return 0
+}
+
+type GetVersionReq struct {
+	Version              string   `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetVersionReq) Reset()         { *m = GetVersionReq{} }
+func (m *GetVersionReq) String() string { return proto.CompactTextString(m) }
+func (*GetVersionReq) ProtoMessage()    {}
+func (*GetVersionReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f9ab154255673e38, []int{8}
+}
+
+func (m *GetVersionReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetVersionReq.Unmarshal(m, b)
+}
+func (m *GetVersionReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetVersionReq.Marshal(b, m, deterministic)
+}
+func (m *GetVersionReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetVersionReq.Merge(m, src)
+}
+func (m *GetVersionReq) XXX_Size() int {
+	return xxx_messageInfo_GetVersionReq.Size(m)
+}
+func (m *GetVersionReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetVersionReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetVersionReq proto.InternalMessageInfo
+
+func (m *GetVersionReq) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+type GetVersionResp struct {
+	Ret                  int32    `protobuf:"varint,1,opt,name=ret,proto3" json:"ret,omitempty"`
+	Version              string   `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetVersionResp) Reset()         { *m = GetVersionResp{} }
+func (m *GetVersionResp) String() string { return proto.CompactTextString(m) }
+func (*GetVersionResp) ProtoMessage()    {}
+func (*GetVersionResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f9ab154255673e38, []int{9}
+}
+
+func (m *GetVersionResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetVersionResp.Unmarshal(m, b)
+}
+func (m *GetVersionResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetVersionResp.Marshal(b, m, deterministic)
+}
+func (m *GetVersionResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetVersionResp.Merge(m, src)
+}
+func (m *GetVersionResp) XXX_Size() int {
+	return xxx_messageInfo_GetVersionResp.Size(m)
+}
+func (m *GetVersionResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetVersionResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetVersionResp proto.InternalMessageInfo
+
+func (m *GetVersionResp) GetRet() int32 {
+	if m != nil {
+		return m.Ret
+	}
+	return 0
+}
+
+func (m *GetVersionResp) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*DeleteNetDevReq)(nil), "dpcnisyncer.DeleteNetDevReq")
 	proto.RegisterType((*DeleteNetDevResp)(nil), "dpcnisyncer.DeleteNetDevResp")
+	proto.RegisterType((*GetNetDevInfoReq)(nil), "dpcnisyncer.GetNetDevInfoReq")
+	proto.RegisterType((*GetNetDevInfoResp)(nil), "dpcnisyncer.GetNetDevInfoResp")
+	proto.RegisterType((*AttachNetDevReq)(nil), "dpcnisyncer.AttachNetDevReq")
+	proto.RegisterType((*AttachNetDevResp)(nil), "dpcnisyncer.AttachNetDevResp")
+	proto.RegisterType((*DetachNetDevReq)(nil), "dpcnisyncer.DetachNetDevReq")
+	proto.RegisterType((*DetachNetDevResp)(nil), "dpcnisyncer.DetachNetDevResp")
+	proto.RegisterType((*GetVersionReq)(nil), "dpcnisyncer.GetVersionReq")
+	proto.RegisterType((*GetVersionResp)(nil), "dpcnisyncer.GetVersionResp")
 }
 
 func init() {
@@ -123,18 +579,38 @@ func init() {
 }
 
 var fileDescriptor_f9ab154255673e38 = []byte{
-	// 202 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x4e, 0x29, 0x88, 0x4f,
-	0xce, 0xcb, 0x8c, 0x2f, 0xae, 0xcc, 0x4b, 0x4e, 0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17,
-	0xe2, 0x4e, 0x29, 0x48, 0xce, 0xcb, 0x84, 0x08, 0x29, 0xa9, 0x72, 0xf1, 0xbb, 0xa4, 0xe6, 0xa4,
-	0x96, 0xa4, 0xfa, 0xa5, 0x96, 0xb8, 0xa4, 0x96, 0x05, 0xa5, 0x16, 0x0a, 0x09, 0x71, 0xb1, 0xe4,
-	0x25, 0xe6, 0xa6, 0x4a, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x81, 0xd9, 0x4a, 0x2a, 0x5c, 0x02,
-	0xa8, 0xca, 0x8a, 0x0b, 0x84, 0x04, 0xb8, 0x98, 0x8b, 0x52, 0x4b, 0xc0, 0xca, 0x58, 0x83, 0x40,
-	0x4c, 0xa3, 0x20, 0x2e, 0x36, 0x88, 0xbc, 0x90, 0x07, 0x17, 0xa7, 0x4b, 0x6a, 0x0e, 0x94, 0x23,
-	0xa3, 0x87, 0x64, 0xa3, 0x1e, 0x9a, 0x75, 0x52, 0xb2, 0x78, 0x64, 0x8b, 0x0b, 0x9c, 0x5c, 0xa2,
-	0x9c, 0xd2, 0x33, 0x4b, 0x32, 0x4a, 0x93, 0xf4, 0x92, 0xf3, 0x73, 0xf5, 0x33, 0xf3, 0x4a, 0x52,
-	0x73, 0xf4, 0x13, 0xd3, 0x2a, 0x52, 0x0a, 0x74, 0x0b, 0x72, 0x4a, 0xd3, 0x33, 0xf3, 0x8a, 0x75,
-	0xd3, 0xf2, 0x8b, 0x74, 0xb3, 0x4b, 0x93, 0x52, 0x8b, 0xf2, 0x52, 0x4b, 0x52, 0x8b, 0xc1, 0x4a,
-	0x8a, 0xf2, 0x12, 0x73, 0xf4, 0x91, 0x8c, 0x4d, 0x62, 0x03, 0x7b, 0xdd, 0x18, 0x10, 0x00, 0x00,
-	0xff, 0xff, 0x74, 0x57, 0xca, 0xf4, 0x11, 0x01, 0x00, 0x00,
+	// 520 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x54, 0x4d, 0x6f, 0x13, 0x31,
+	0x10, 0x55, 0x92, 0xe6, 0x6b, 0x92, 0xd2, 0x60, 0x90, 0x30, 0xa1, 0x45, 0x25, 0x7c, 0xa8, 0x1c,
+	0x92, 0x48, 0x70, 0xe5, 0x42, 0xb5, 0xa8, 0xad, 0x90, 0x22, 0x94, 0x03, 0x07, 0x2e, 0x91, 0xb3,
+	0x3b, 0x69, 0x2c, 0x76, 0x6d, 0x63, 0x3b, 0x15, 0x3d, 0xf3, 0x73, 0xf8, 0x01, 0xfc, 0x3d, 0x64,
+	0x3b, 0x21, 0xc9, 0x36, 0xd9, 0x5e, 0xb8, 0xcd, 0xbc, 0xf7, 0x66, 0xfc, 0xbc, 0x9e, 0x59, 0x78,
+	0x94, 0xa8, 0x49, 0x2c, 0xf8, 0xc4, 0xdc, 0x8a, 0x18, 0xf5, 0x40, 0x69, 0x69, 0x25, 0x69, 0x25,
+	0x2a, 0x16, 0x3c, 0x40, 0xbd, 0xd7, 0x70, 0x14, 0x61, 0x8a, 0x16, 0x47, 0x68, 0x23, 0xbc, 0x19,
+	0xe3, 0x0f, 0x42, 0xe0, 0x40, 0xb0, 0x0c, 0x69, 0xe9, 0xb4, 0x74, 0xd6, 0x1c, 0xfb, 0xb8, 0xf7,
+	0x0a, 0x3a, 0xdb, 0x32, 0xa3, 0x48, 0x07, 0x2a, 0x1a, 0xad, 0x97, 0x55, 0xc7, 0x2e, 0xec, 0xbd,
+	0x81, 0xce, 0x05, 0xda, 0x20, 0xb9, 0x12, 0x33, 0xb9, 0xaf, 0xdb, 0xef, 0x32, 0x3c, 0xcc, 0x09,
+	0x77, 0xf5, 0x73, 0xb5, 0x4a, 0xca, 0x94, 0x96, 0x43, 0xad, 0x8b, 0x1d, 0x96, 0xc9, 0x04, 0x69,
+	0x25, 0x60, 0x2e, 0x26, 0x14, 0xea, 0x4a, 0xf3, 0x8c, 0xe9, 0x5b, 0x7a, 0xe0, 0xe1, 0x55, 0xea,
+	0x7a, 0xaa, 0x98, 0xd3, 0xaa, 0x47, 0x5d, 0x48, 0x9e, 0x42, 0x23, 0x63, 0x6a, 0xa2, 0x98, 0x9d,
+	0xd3, 0x5a, 0x10, 0x67, 0x4c, 0x7d, 0x61, 0x76, 0x4e, 0x8e, 0xa1, 0xc9, 0xd2, 0x54, 0xc6, 0xcc,
+	0x62, 0x42, 0xeb, 0xa7, 0xa5, 0xb3, 0xc6, 0x78, 0x0d, 0x90, 0x17, 0xd0, 0x8e, 0xa5, 0xb0, 0x8c,
+	0x0b, 0xd4, 0x13, 0x9e, 0xd0, 0x86, 0x2f, 0x6e, 0xfd, 0xc3, 0xae, 0x12, 0xf2, 0x18, 0xaa, 0x02,
+	0xad, 0x30, 0xb4, 0xe9, 0xb9, 0x90, 0x90, 0x97, 0x70, 0xa8, 0x64, 0x32, 0x71, 0x37, 0x37, 0x8a,
+	0xc5, 0x48, 0xc1, 0xb3, 0x6d, 0x25, 0x93, 0xd1, 0x0a, 0x73, 0xb6, 0x56, 0x22, 0xda, 0x5a, 0xde,
+	0x21, 0xf0, 0xbd, 0x3f, 0x25, 0x38, 0xfa, 0x68, 0x2d, 0x8b, 0xe7, 0x85, 0x6f, 0x74, 0xc7, 0x60,
+	0xb9, 0xc0, 0x60, 0xa5, 0xd0, 0xe0, 0xc1, 0x3d, 0x06, 0xab, 0x5b, 0x06, 0xc9, 0x13, 0xa8, 0xf3,
+	0x59, 0x60, 0xc2, 0x17, 0xad, 0xf1, 0xd9, 0x68, 0x39, 0x35, 0xdb, 0xc6, 0x77, 0x4e, 0xcd, 0xa5,
+	0x1b, 0xc1, 0xff, 0x71, 0xbd, 0x30, 0xa5, 0xf7, 0x9e, 0xf7, 0x16, 0x0e, 0x2f, 0xd0, 0x7e, 0x45,
+	0x6d, 0xb8, 0x14, 0xee, 0x34, 0x0a, 0xf5, 0x9b, 0x90, 0x2d, 0x0f, 0x5c, 0xa5, 0xbd, 0x0f, 0xf0,
+	0x60, 0x53, 0xba, 0x73, 0x48, 0x37, 0xaa, 0xcb, 0x5b, 0xd5, 0xef, 0x7e, 0x55, 0xa0, 0x16, 0x9c,
+	0x90, 0x4b, 0x68, 0x46, 0x98, 0x2e, 0x93, 0xe3, 0xc1, 0xc6, 0x06, 0x0e, 0x72, 0xeb, 0xd7, 0x3d,
+	0x29, 0x60, 0x8d, 0x22, 0x23, 0xef, 0x7e, 0xbd, 0x3a, 0x64, 0x5b, 0x9f, 0xdf, 0xbf, 0xee, 0xf3,
+	0x22, 0xda, 0x28, 0xf2, 0x19, 0xda, 0x9b, 0x6f, 0x94, 0x33, 0x97, 0x9b, 0xbb, 0xee, 0x49, 0x01,
+	0x1b, 0x9a, 0x45, 0xb8, 0xb7, 0x59, 0x84, 0x45, 0xcd, 0xee, 0xbc, 0xdc, 0x27, 0x80, 0xf5, 0xc7,
+	0x27, 0xdd, 0xfc, 0x3d, 0xd6, 0x0f, 0xd8, 0x7d, 0xb6, 0x97, 0x33, 0xea, 0x3c, 0xfa, 0x76, 0x7e,
+	0xcd, 0xed, 0x7c, 0x31, 0x1d, 0xc4, 0x32, 0x1b, 0x72, 0x61, 0x31, 0x1d, 0xb2, 0xd9, 0xcf, 0x44,
+	0xf5, 0x55, 0xba, 0xb8, 0xe6, 0xc2, 0xf4, 0x67, 0x52, 0xf7, 0xbf, 0x2f, 0xa6, 0xa8, 0x05, 0x5a,
+	0x34, 0x5e, 0xa2, 0x05, 0x4b, 0x87, 0x1b, 0x4d, 0xa7, 0x35, 0xff, 0xef, 0x7c, 0xff, 0x77, 0x00,
+	0xa2, 0xdf, 0x57, 0x73, 0x52, 0x05, 0x00, 0x00,
 }
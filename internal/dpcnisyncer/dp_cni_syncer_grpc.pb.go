@@ -34,7 +34,11 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	NetDev_DelNetDev_FullMethodName = "/dpcnisyncer.NetDev/DelNetDev"
+	NetDev_DelNetDev_FullMethodName     = "/dpcnisyncer.NetDev/DelNetDev"
+	NetDev_GetNetDevInfo_FullMethodName = "/dpcnisyncer.NetDev/GetNetDevInfo"
+	NetDev_AttachNetDev_FullMethodName  = "/dpcnisyncer.NetDev/AttachNetDev"
+	NetDev_DetachNetDev_FullMethodName  = "/dpcnisyncer.NetDev/DetachNetDev"
+	NetDev_GetVersion_FullMethodName    = "/dpcnisyncer.NetDev/GetVersion"
 )
 
 // NetDevClient is the client API for NetDev service.
@@ -42,6 +46,10 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type NetDevClient interface {
 	DelNetDev(ctx context.Context, in *DeleteNetDevReq, opts ...grpc.CallOption) (*DeleteNetDevResp, error)
+	GetNetDevInfo(ctx context.Context, in *GetNetDevInfoReq, opts ...grpc.CallOption) (*GetNetDevInfoResp, error)
+	AttachNetDev(ctx context.Context, in *AttachNetDevReq, opts ...grpc.CallOption) (*AttachNetDevResp, error)
+	DetachNetDev(ctx context.Context, in *DetachNetDevReq, opts ...grpc.CallOption) (*DetachNetDevResp, error)
+	GetVersion(ctx context.Context, in *GetVersionReq, opts ...grpc.CallOption) (*GetVersionResp, error)
 }
 
 type netDevClient struct {
@@ -61,11 +69,51 @@ func (c *netDevClient) DelNetDev(ctx context.Context, in *DeleteNetDevReq, opts
 	return out, nil
 }
 
+func (c *netDevClient) GetNetDevInfo(ctx context.Context, in *GetNetDevInfoReq, opts ...grpc.CallOption) (*GetNetDevInfoResp, error) {
+	out := new(GetNetDevInfoResp)
+	err := c.cc.Invoke(ctx, NetDev_GetNetDevInfo_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *netDevClient) AttachNetDev(ctx context.Context, in *AttachNetDevReq, opts ...grpc.CallOption) (*AttachNetDevResp, error) {
+	out := new(AttachNetDevResp)
+	err := c.cc.Invoke(ctx, NetDev_AttachNetDev_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *netDevClient) DetachNetDev(ctx context.Context, in *DetachNetDevReq, opts ...grpc.CallOption) (*DetachNetDevResp, error) {
+	out := new(DetachNetDevResp)
+	err := c.cc.Invoke(ctx, NetDev_DetachNetDev_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *netDevClient) GetVersion(ctx context.Context, in *GetVersionReq, opts ...grpc.CallOption) (*GetVersionResp, error) {
+	out := new(GetVersionResp)
+	err := c.cc.Invoke(ctx, NetDev_GetVersion_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NetDevServer is the server API for NetDev service.
 // All implementations must embed UnimplementedNetDevServer
 // for forward compatibility
 type NetDevServer interface {
 	DelNetDev(context.Context, *DeleteNetDevReq) (*DeleteNetDevResp, error)
+	GetNetDevInfo(context.Context, *GetNetDevInfoReq) (*GetNetDevInfoResp, error)
+	AttachNetDev(context.Context, *AttachNetDevReq) (*AttachNetDevResp, error)
+	DetachNetDev(context.Context, *DetachNetDevReq) (*DetachNetDevResp, error)
+	GetVersion(context.Context, *GetVersionReq) (*GetVersionResp, error)
 	mustEmbedUnimplementedNetDevServer()
 }
 
@@ -76,6 +124,18 @@ type UnimplementedNetDevServer struct {
 func (UnimplementedNetDevServer) DelNetDev(context.Context, *DeleteNetDevReq) (*DeleteNetDevResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DelNetDev not implemented")
 }
+func (UnimplementedNetDevServer) GetNetDevInfo(context.Context, *GetNetDevInfoReq) (*GetNetDevInfoResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNetDevInfo not implemented")
+}
+func (UnimplementedNetDevServer) AttachNetDev(context.Context, *AttachNetDevReq) (*AttachNetDevResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AttachNetDev not implemented")
+}
+func (UnimplementedNetDevServer) DetachNetDev(context.Context, *DetachNetDevReq) (*DetachNetDevResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DetachNetDev not implemented")
+}
+func (UnimplementedNetDevServer) GetVersion(context.Context, *GetVersionReq) (*GetVersionResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVersion not implemented")
+}
 func (UnimplementedNetDevServer) mustEmbedUnimplementedNetDevServer() {}
 
 // UnsafeNetDevServer may be embedded to opt out of forward compatibility for this service.
@@ -107,6 +167,78 @@ func _NetDev_DelNetDev_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _NetDev_GetNetDevInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNetDevInfoReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetDevServer).GetNetDevInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NetDev_GetNetDevInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetDevServer).GetNetDevInfo(ctx, req.(*GetNetDevInfoReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NetDev_AttachNetDev_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AttachNetDevReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetDevServer).AttachNetDev(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NetDev_AttachNetDev_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetDevServer).AttachNetDev(ctx, req.(*AttachNetDevReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NetDev_DetachNetDev_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DetachNetDevReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetDevServer).DetachNetDev(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NetDev_DetachNetDev_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetDevServer).DetachNetDev(ctx, req.(*DetachNetDevReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NetDev_GetVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVersionReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetDevServer).GetVersion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NetDev_GetVersion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetDevServer).GetVersion(ctx, req.(*GetVersionReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // NetDev_ServiceDesc is the grpc.ServiceDesc for NetDev service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -118,6 +250,22 @@ var NetDev_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DelNetDev",
 			Handler:    _NetDev_DelNetDev_Handler,
 		},
+		{
+			MethodName: "GetNetDevInfo",
+			Handler:    _NetDev_GetNetDevInfo_Handler,
+		},
+		{
+			MethodName: "AttachNetDev",
+			Handler:    _NetDev_AttachNetDev_Handler,
+		},
+		{
+			MethodName: "DetachNetDev",
+			Handler:    _NetDev_DetachNetDev_Handler,
+		},
+		{
+			MethodName: "GetVersion",
+			Handler:    _NetDev_GetVersion_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "dp_cni_syncer.proto",
@@ -17,13 +17,17 @@ package dpcnisyncerclient
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"time"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	pb "github.com/intel/afxdp-plugins-for-kubernetes/internal/dpcnisyncer"
 	logging "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
@@ -32,28 +36,150 @@ const (
 )
 
 var (
-	sock = pluginapi.DevicePluginPath + constants.Plugins.DevicePlugin.DevicePrefix + "-" + "syncer.sock"
+	sock = pluginapi.DevicePluginPath + constants.Plugins.DevicePlugin.DevicePrefix + "-" + constants.Syncer.SockName
 )
 
-func DeleteNetDev(name string) error {
-	ctx := context.Background()
+/*
+dial connects to the device plugin syncer server
+*/
+func dial(ctx context.Context) (*grpc.ClientConn, error) {
 	conn, err := grpc.DialContext(ctx, sock, grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
 			return (&net.Dialer{}).DialContext(ctx, _proto, addr)
 		}))
 	if err != nil {
 		logging.Errorf("error connecting to Server")
+		return nil, err
+	}
+	return conn, nil
+}
+
+/*
+call runs a syncer request. Each attempt connects to the server, performs the version
+handshake and runs the request within the request timeout, see retry.
+*/
+func call(request func(ctx context.Context, c pb.NetDevClient) error) error {
+	return retry(func() error {
+		return callOnce(request)
+	})
+}
+
+/*
+retry calls run until it succeeds or fails for a reason other than the server being
+unavailable, up to the configured number of attempts, with an increasing backoff.
+*/
+func retry(run func() error) error {
+	backoff := time.Duration(constants.Syncer.RetryBackoff) * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || status.Code(err) != codes.Unavailable || attempt >= constants.Syncer.RequestRetries {
+			return err
+		}
+
+		logging.Warningf("Syncer server unavailable, retrying in %v (attempt %d of %d): %v", backoff, attempt, constants.Syncer.RequestRetries, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func callOnce(request func(ctx context.Context, c pb.NetDevClient) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(constants.Syncer.RequestTimeout)*time.Second)
+	defer cancel()
+
+	conn, err := dial(ctx)
+	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
 	c := pb.NewNetDevClient(conn)
-	r, err := c.DelNetDev(ctx, &pb.DeleteNetDevReq{Name: name})
-	if err != nil || r.Ret == -1 {
-		logging.Errorf("error deleting netdev resources for netdev %s", name)
+	if err := handshake(ctx, c); err != nil {
+		return err
+	}
+
+	return request(ctx, c)
+}
+
+/*
+handshake checks the device plugin supports the syncer API version of this CNI
+*/
+func handshake(ctx context.Context, c pb.NetDevClient) error {
+	r, err := c.GetVersion(ctx, &pb.GetVersionReq{Version: constants.Syncer.Version})
+	switch status.Code(err) {
+	case codes.OK:
+		logging.Debugf("Syncer API version %s, device plugin version %s", constants.Syncer.Version, r.GetVersion())
+		return nil
+	case codes.Unimplemented:
+		return fmt.Errorf("device plugin does not support syncer API version %s, the device plugin must be upgraded", constants.Syncer.Version)
+	case codes.FailedPrecondition:
+		return fmt.Errorf("syncer API version mismatch: %s", status.Convert(err).Message())
+	default:
 		return err
 	}
-	logging.Infof("Server response:%v", r)
+}
+
+func DeleteNetDev(name string) error {
+	return call(func(ctx context.Context, c pb.NetDevClient) error {
+		r, err := c.DelNetDev(ctx, &pb.DeleteNetDevReq{Name: name})
+		if err != nil || r.Ret == -1 {
+			logging.Errorf("error deleting netdev resources for netdev %s", name)
+			return err
+		}
+		logging.Infof("Server response:%v", r)
+
+		return nil
+	})
+}
+
+/*
+GetNetDevInfo asks the device plugin for the pool, allocation and attachment details of a netdev
+*/
+func GetNetDevInfo(name string) (*pb.GetNetDevInfoResp, error) {
+	var info *pb.GetNetDevInfoResp
+	err := call(func(ctx context.Context, c pb.NetDevClient) error {
+		r, err := c.GetNetDevInfo(ctx, &pb.GetNetDevInfoReq{Name: name})
+		if err != nil {
+			logging.Errorf("error getting info for netdev %s: %v", name, err)
+			return err
+		}
+		logging.Debugf("Server response:%v", r)
+		info = r
+
+		return nil
+	})
+
+	return info, err
+}
+
+/*
+AttachNetDev notifies the device plugin that a netdev has been moved into a pod
+*/
+func AttachNetDev(req *pb.AttachNetDevReq) error {
+	return call(func(ctx context.Context, c pb.NetDevClient) error {
+		r, err := c.AttachNetDev(ctx, req)
+		if err != nil {
+			logging.Errorf("error attaching netdev %s: %v", req.GetName(), err)
+			return err
+		}
+		logging.Infof("Server response:%v", r)
+
+		return nil
+	})
+}
+
+/*
+DetachNetDev notifies the device plugin that a netdev has been removed from a pod
+*/
+func DetachNetDev(name, containerID string) error {
+	return call(func(ctx context.Context, c pb.NetDevClient) error {
+		r, err := c.DetachNetDev(ctx, &pb.DetachNetDevReq{Name: name, ContainerId: containerID})
+		if err != nil {
+			logging.Errorf("error detaching netdev %s: %v", name, err)
+			return err
+		}
+		logging.Infof("Server response:%v", r)
 
-	return nil
+		return nil
+	})
 }
@@ -0,0 +1,95 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dpcnisyncerclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		name        string
+		errs        []error
+		expAttempts int
+		expCode     codes.Code
+	}{
+		{
+			name:        "success",
+			errs:        []error{nil},
+			expAttempts: 1,
+			expCode:     codes.OK,
+		},
+		{
+			name:        "success after the server becomes available",
+			errs:        []error{status.Error(codes.Unavailable, "connection refused"), nil},
+			expAttempts: 2,
+			expCode:     codes.OK,
+		},
+		{
+			name:        "server unavailable",
+			errs:        []error{status.Error(codes.Unavailable, "connection refused")},
+			expAttempts: constants.Syncer.RequestRetries,
+			expCode:     codes.Unavailable,
+		},
+		{
+			name:        "version mismatch not retried",
+			errs:        []error{status.Error(codes.FailedPrecondition, "version mismatch")},
+			expAttempts: 1,
+			expCode:     codes.FailedPrecondition,
+		},
+		{
+			name:        "deadline not retried",
+			errs:        []error{status.Error(codes.DeadlineExceeded, "timeout")},
+			expAttempts: 1,
+			expCode:     codes.DeadlineExceeded,
+		},
+		{
+			name:        "permission denied not retried",
+			errs:        []error{status.Error(codes.PermissionDenied, "uid 1000 is not allowed")},
+			expAttempts: 1,
+			expCode:     codes.PermissionDenied,
+		},
+		{
+			name:        "other errors not retried",
+			errs:        []error{errors.New("device plugin does not support syncer API version")},
+			expAttempts: 1,
+			expCode:     codes.Unknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			err := retry(func() error {
+				err := tc.errs[len(tc.errs)-1]
+				if attempts < len(tc.errs) {
+					err = tc.errs[attempts]
+				}
+				attempts++
+				return err
+			})
+
+			assert.Equal(t, tc.expAttempts, attempts, "Unexpected number of attempts")
+			assert.Equal(t, tc.expCode, status.Code(err), "Unexpected error code")
+		})
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright(c) 2023 Intel Corporation.
+ * Copyright(c) Red Hat Inc.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package dpcnisyncerserver
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	logging "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/credentials"
+)
+
+const authType = "peercred"
+
+/*
+peerCredentials are gRPC transport credentials for the syncer unix socket. No data is
+exchanged during the handshake. Instead the server reads the credentials of the calling
+process from the socket with SO_PEERCRED and rejects callers not running as one of the
+allowed users.
+*/
+type peerCredentials struct {
+	allowedUIDs []uint32
+}
+
+/*
+PeerAuthInfo holds the credentials of the process on the other end of the syncer socket.
+Handlers can retrieve it from the peer in the request context.
+*/
+type PeerAuthInfo struct {
+	credentials.CommonAuthInfo
+	Ucred *unix.Ucred
+}
+
+/*
+AuthType is part of the gRPC credentials.AuthInfo interface
+*/
+func (p PeerAuthInfo) AuthType() string {
+	return authType
+}
+
+/*
+newPeerCredentials returns credentials accepting callers running as allowedUID or as the
+same user as the server itself
+*/
+func newPeerCredentials(allowedUID int) credentials.TransportCredentials {
+	return &peerCredentials{allowedUIDs: []uint32{uint32(allowedUID), uint32(os.Geteuid())}}
+}
+
+/*
+ServerHandshake checks the credentials of the connecting process
+*/
+func (c *peerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	ucred, err := getPeerCred(conn)
+	if err != nil {
+		logging.Errorf("Unable to get credentials of syncer client: %v", err)
+		return nil, nil, err
+	}
+
+	if !c.allowed(ucred.Uid) {
+		logging.Errorf("Rejecting syncer client pid %d: uid %d is not allowed", ucred.Pid, ucred.Uid)
+		return nil, nil, errors.Errorf("uid %d is not allowed to use the syncer", ucred.Uid)
+	}
+
+	logging.Debugf("Accepted syncer client pid %d uid %d", ucred.Pid, ucred.Uid)
+	return conn, PeerAuthInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}, Ucred: ucred}, nil
+}
+
+/*
+ClientHandshake is part of the gRPC credentials.TransportCredentials interface.
+Clients use insecure credentials, as peer credentials are checked by the server only.
+*/
+func (c *peerCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("peer credentials are only supported on the server")
+}
+
+func (c *peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: authType}
+}
+
+func (c *peerCredentials) Clone() credentials.TransportCredentials {
+	return &peerCredentials{allowedUIDs: append([]uint32{}, c.allowedUIDs...)}
+}
+
+func (c *peerCredentials) OverrideServerName(serverName string) error {
+	return nil
+}
+
+func (c *peerCredentials) allowed(uid uint32) bool {
+	for _, allowed := range c.allowedUIDs {
+		if uid == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+getPeerCred reads the credentials of the process on the other end of a unix socket
+*/
+func getPeerCred(conn net.Conn) (*unix.Ucred, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, errors.Errorf("connection is not a unix socket: %T", conn)
+	}
+
+	rawConn, err := unixConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	return ucred, nil
+}
@@ -19,6 +19,8 @@ import (
 	"context"
 	"net"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
@@ -27,7 +29,11 @@ import (
 	"github.com/pkg/errors"
 	logging "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
@@ -36,14 +42,122 @@ const (
 )
 
 var (
-	sockAddr = pluginapi.DevicePluginPath + constants.Plugins.DevicePlugin.DevicePrefix + "-" + "syncer.sock"
+	sockAddr = pluginapi.DevicePluginPath + constants.Plugins.DevicePlugin.DevicePrefix + "-" + constants.Syncer.SockName
 )
 
 type SyncerServer struct {
 	pb.UnimplementedNetDevServer
 	mapManagers     []bpf.PoolBpfMapManager
 	grpcServer      *grpc.Server
+	healthServer    *health.Server
 	BpfMapPinEnable bool
+	netDevs         map[string]*netDevRecord
+	mutex           sync.Mutex
+}
+
+/*
+netDevRecord holds what the device plugin knows about a netdev: the pool it belongs to,
+its allocation and, once the CNI has moved it into a pod, the attachment details.
+*/
+type netDevRecord struct {
+	pool         string
+	mode         string
+	primary      string
+	pci          string
+	mapPath      string
+	allocated    bool
+	containerID  string
+	netns        string
+	podNamespace string
+	podName      string
+	ifName       string
+	release      ReleaseFunc
+}
+
+/*
+ReleaseFunc is called by the syncer when the CNI detaches a netdev from a pod, so the owner
+of the netdev can release any host resources, such as a CDQ subfunction, created for it.
+*/
+type ReleaseFunc func(name string) error
+
+/*
+RegisterNetDev records a netdev belonging to a pool so the CNI can look it up.
+Registering an already known netdev updates its pool details and keeps its state.
+If release is not nil it is called when the netdev is detached.
+*/
+func (s *SyncerServer) RegisterNetDev(name, pool, mode, primary string, release ReleaseFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.netDevs == nil {
+		s.netDevs = make(map[string]*netDevRecord)
+	}
+
+	record, ok := s.netDevs[name]
+	if !ok {
+		record = &netDevRecord{}
+		s.netDevs[name] = record
+	}
+	record.pool = pool
+	record.mode = mode
+	record.primary = primary
+	record.release = release
+}
+
+/*
+SetNetDevAllocated marks a registered netdev as allocated to a pod by the kubelet.
+Any attachment left from a previous allocation is cleared.
+*/
+func (s *SyncerServer) SetNetDevAllocated(name, pci, mapPath string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, ok := s.netDevs[name]
+	if !ok {
+		return errors.Errorf("netdev %s is not registered with the syncer", name)
+	}
+
+	if record.containerID != "" {
+		logging.Warningf("Netdev %s allocated while still attached to container %s", name, record.containerID)
+	}
+
+	*record = netDevRecord{
+		pool:      record.pool,
+		mode:      record.mode,
+		primary:   record.primary,
+		release:   record.release,
+		pci:       pci,
+		mapPath:   mapPath,
+		allocated: true,
+	}
+
+	return nil
+}
+
+/*
+ClearNetDevAllocated clears the allocation of a netdev that was never attached to a pod by
+the CNI, so its owner can release it. It returns false, leaving the netdev allocated, if the
+netdev is attached, as it is then released when the CNI detaches it.
+*/
+func (s *SyncerServer) ClearNetDevAllocated(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, ok := s.netDevs[name]
+	if !ok {
+		return true
+	}
+	if record.containerID != "" {
+		return false
+	}
+
+	*record = netDevRecord{
+		pool:    record.pool,
+		mode:    record.mode,
+		primary: record.primary,
+		release: record.release,
+	}
+	return true
 }
 
 func (s *SyncerServer) RegisterMapManager(b bpf.PoolBpfMapManager) {
@@ -96,7 +210,141 @@ func (s *SyncerServer) DelNetDev(ctx context.Context, in *pb.DeleteNetDevReq) (*
 	return &pb.DeleteNetDevResp{Ret: -1}, errors.New("BPF Map pinning is not enabled")
 }
 
+/*
+GetNetDevInfo returns the pool, allocation and attachment details of a netdev.
+*/
+func (s *SyncerServer) GetNetDevInfo(ctx context.Context, in *pb.GetNetDevInfoReq) (*pb.GetNetDevInfoResp, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	netDevName := in.GetName()
+	record, ok := s.netDevs[netDevName]
+	if !ok {
+		logging.Errorf("Netdev %s is not known to the syncer", netDevName)
+		return &pb.GetNetDevInfoResp{Ret: -1}, status.Errorf(codes.NotFound, "netdev %s not found", netDevName)
+	}
+
+	return &pb.GetNetDevInfoResp{
+		Ret:          0,
+		Pool:         record.pool,
+		Mode:         record.mode,
+		Primary:      record.primary,
+		Pci:          record.pci,
+		MapPath:      record.mapPath,
+		Allocated:    record.allocated,
+		ContainerId:  record.containerID,
+		Netns:        record.netns,
+		PodNamespace: record.podNamespace,
+		PodName:      record.podName,
+	}, nil
+}
+
+/*
+AttachNetDev records that the CNI has moved an allocated netdev into a pod network namespace.
+A netdev can only be attached to one container at a time.
+*/
+func (s *SyncerServer) AttachNetDev(ctx context.Context, in *pb.AttachNetDevReq) (*pb.AttachNetDevResp, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	netDevName := in.GetName()
+	record, ok := s.netDevs[netDevName]
+	if !ok {
+		logging.Errorf("Netdev %s is not known to the syncer", netDevName)
+		return &pb.AttachNetDevResp{Ret: -1}, status.Errorf(codes.NotFound, "netdev %s not found", netDevName)
+	}
+
+	if !record.allocated {
+		logging.Errorf("Netdev %s has not been allocated", netDevName)
+		return &pb.AttachNetDevResp{Ret: -1}, status.Errorf(codes.FailedPrecondition, "netdev %s has not been allocated", netDevName)
+	}
+
+	if record.containerID != "" && record.containerID != in.GetContainerId() {
+		logging.Errorf("Netdev %s is already attached to container %s", netDevName, record.containerID)
+		return &pb.AttachNetDevResp{Ret: -1}, status.Errorf(codes.AlreadyExists, "netdev %s is already attached to container %s", netDevName, record.containerID)
+	}
+
+	record.containerID = in.GetContainerId()
+	record.netns = in.GetNetns()
+	record.podNamespace = in.GetPodNamespace()
+	record.podName = in.GetPodName()
+	record.ifName = in.GetIfName()
+
+	logging.Infof("Netdev %s attached to pod %s/%s, container %s", netDevName, record.podNamespace, record.podName, record.containerID)
+	return &pb.AttachNetDevResp{Ret: 0}, nil
+}
+
+/*
+DetachNetDev clears the attachment of a netdev when the CNI removes it from a pod.
+The netdev is no longer considered allocated after it is detached, and the owner of
+the netdev is asked to release it. A failed release is retried by the owner, so it
+is not reported to the CNI. A detach for a netdev that is not attached to the container
+succeeds without releasing it, as DEL may be repeated or arrive after a new attachment.
+*/
+func (s *SyncerServer) DetachNetDev(ctx context.Context, in *pb.DetachNetDevReq) (*pb.DetachNetDevResp, error) {
+	s.mutex.Lock()
+
+	netDevName := in.GetName()
+	record, ok := s.netDevs[netDevName]
+	if !ok {
+		s.mutex.Unlock()
+		logging.Errorf("Netdev %s is not known to the syncer", netDevName)
+		return &pb.DetachNetDevResp{Ret: -1}, status.Errorf(codes.NotFound, "netdev %s not found", netDevName)
+	}
+
+	if record.containerID == "" || record.containerID != in.GetContainerId() {
+		s.mutex.Unlock()
+		if record.containerID == "" {
+			logging.Infof("Netdev %s is not attached, nothing to detach for container %s", netDevName, in.GetContainerId())
+		} else {
+			logging.Infof("Netdev %s is attached to container %s, nothing to detach for container %s", netDevName, record.containerID, in.GetContainerId())
+		}
+		return &pb.DetachNetDevResp{Ret: 0}, nil
+	}
+
+	*record = netDevRecord{
+		pool:    record.pool,
+		mode:    record.mode,
+		primary: record.primary,
+		release: record.release,
+	}
+	release := record.release
+	s.mutex.Unlock()
+
+	logging.Infof("Netdev %s detached", netDevName)
+
+	if release != nil {
+		if err := release(netDevName); err != nil {
+			logging.Warningf("Error releasing netdev %s: %v", netDevName, err)
+		}
+	}
+
+	return &pb.DetachNetDevResp{Ret: 0}, nil
+}
+
+/*
+GetVersion is the version handshake of the syncer API. A CNI with a different major
+version is rejected, so mismatched CNI and device plugin binaries fail clearly.
+*/
+func (s *SyncerServer) GetVersion(ctx context.Context, in *pb.GetVersionReq) (*pb.GetVersionResp, error) {
+	version := constants.Syncer.Version
+	if majorVersion(in.GetVersion()) != majorVersion(version) {
+		logging.Errorf("CNI syncer API version %s is not compatible with device plugin version %s", in.GetVersion(), version)
+		return &pb.GetVersionResp{Ret: -1, Version: version}, status.Errorf(codes.FailedPrecondition,
+			"CNI syncer API version %s is not compatible with device plugin version %s", in.GetVersion(), version)
+	}
+
+	return &pb.GetVersionResp{Ret: 0, Version: version}, nil
+}
+
+func majorVersion(version string) string {
+	return strings.SplitN(version, ".", 2)[0]
+}
+
 func (s *SyncerServer) StopGRPCSyncer() {
+	if s.healthServer != nil {
+		s.healthServer.Shutdown()
+	}
 	if s.grpcServer != nil {
 		s.grpcServer.Stop()
 		s.grpcServer = nil
@@ -113,8 +361,10 @@ func NewSyncerServer() (*SyncerServer, error) {
 	}
 
 	server := &SyncerServer{
-		grpcServer:      grpc.NewServer(),
+		grpcServer:      grpc.NewServer(grpc.Creds(newPeerCredentials(constants.Syncer.AllowedUID))),
+		healthServer:    health.NewServer(),
 		BpfMapPinEnable: false,
+		netDevs:         make(map[string]*netDevRecord),
 	}
 
 	lis, err := net.Listen(protocol, sockAddr)
@@ -124,6 +374,8 @@ func NewSyncerServer() (*SyncerServer, error) {
 	}
 
 	pb.RegisterNetDevServer(server.grpcServer, server)
+	healthpb.RegisterHealthServer(server.grpcServer, server.healthServer)
+	server.healthServer.SetServingStatus(pb.NetDev_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
 	go func() {
 		if err := server.grpcServer.Serve(lis); err != nil {
 			logging.Errorf("Could not RegisterNetDevServer: %v", err)
@@ -140,7 +392,16 @@ func NewSyncerServer() (*SyncerServer, error) {
 		logging.Errorf("Unable to establish test connection with gRPC server: %v", err)
 		return nil, err
 	}
-	conn.Close()
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: pb.NetDev_ServiceDesc.ServiceName})
+	if err != nil {
+		logging.Errorf("Unable to check health of gRPC server: %v", err)
+		return nil, err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return nil, errors.Errorf("gRPC server is %s", resp.GetStatus())
+	}
 	logging.Debugf("NewSyncerServer up and Running")
 	return server, nil
 }
@@ -0,0 +1,156 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dpcnisyncerserver
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	pb "github.com/intel/afxdp-plugins-for-kubernetes/internal/dpcnisyncer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+unixConnPair returns both ends of a connected unix socket pair
+*/
+func unixConnPair(t *testing.T) (net.Conn, net.Conn) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	require.NoError(t, err, "Unable to create socket pair")
+
+	var conns []net.Conn
+	for _, fd := range fds {
+		f := os.NewFile(uintptr(fd), "syncer-test")
+		conn, err := net.FileConn(f)
+		f.Close()
+		require.NoError(t, err, "Unable to create connection from socket")
+		conns = append(conns, conn)
+	}
+	return conns[0], conns[1]
+}
+
+func TestPeerCredentials(t *testing.T) {
+	euid := uint32(os.Geteuid())
+
+	testCases := []struct {
+		name        string
+		allowedUIDs []uint32
+		expAllowed  bool
+	}{
+		{
+			name:        "caller uid allowed",
+			allowedUIDs: []uint32{euid},
+			expAllowed:  true,
+		},
+		{
+			name:        "caller uid among allowed uids",
+			allowedUIDs: []uint32{euid + 1, euid},
+			expAllowed:  true,
+		},
+		{
+			name:        "caller uid not allowed",
+			allowedUIDs: []uint32{euid + 1},
+			expAllowed:  false,
+		},
+		{
+			name:        "no allowed uids",
+			allowedUIDs: nil,
+			expAllowed:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := unixConnPair(t)
+			defer server.Close()
+			defer client.Close()
+
+			creds := &peerCredentials{allowedUIDs: tc.allowedUIDs}
+			conn, authInfo, err := creds.ServerHandshake(server)
+			if !tc.expAllowed {
+				require.Error(t, err, "Expected the caller to be rejected")
+				assert.Contains(t, err.Error(), "is not allowed to use the syncer", "Unexpected error message")
+				assert.Nil(t, conn, "Rejected caller should not get a connection")
+				return
+			}
+			require.NoError(t, err, "Unexpected error")
+			assert.Equal(t, server, conn, "Unexpected connection")
+			peer, ok := authInfo.(PeerAuthInfo)
+			require.True(t, ok, "Unexpected auth info type")
+			assert.Equal(t, euid, peer.Ucred.Uid, "Unexpected peer uid")
+			assert.Equal(t, int32(os.Getpid()), peer.Ucred.Pid, "Unexpected peer pid")
+		})
+	}
+}
+
+func TestPeerCredentialsNotUnixSocket(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	_, _, err := newPeerCredentials(constants.Syncer.AllowedUID).ServerHandshake(server)
+	require.Error(t, err, "Expected an error")
+	assert.Contains(t, err.Error(), "connection is not a unix socket", "Unexpected error message")
+}
+
+func TestGetVersion(t *testing.T) {
+	testCases := []struct {
+		name    string
+		version string
+		expCode codes.Code
+	}{
+		{
+			name:    "same version",
+			version: constants.Syncer.Version,
+			expCode: codes.OK,
+		},
+		{
+			name:    "same major version",
+			version: majorVersion(constants.Syncer.Version) + ".99",
+			expCode: codes.OK,
+		},
+		{
+			name:    "different major version",
+			version: "99.0",
+			expCode: codes.FailedPrecondition,
+		},
+		{
+			name:    "no version",
+			version: "",
+			expCode: codes.FailedPrecondition,
+		},
+	}
+
+	server := &SyncerServer{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := server.GetVersion(context.Background(), &pb.GetVersionReq{Version: tc.version})
+			assert.Equal(t, tc.expCode, status.Code(err), "Unexpected error code")
+			assert.Equal(t, constants.Syncer.Version, resp.GetVersion(), "Unexpected server version")
+			if tc.expCode == codes.OK {
+				assert.Equal(t, int32(0), resp.GetRet(), "Unexpected return value")
+			} else {
+				assert.Equal(t, int32(-1), resp.GetRet(), "Unexpected return value")
+			}
+		})
+	}
+}
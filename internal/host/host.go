@@ -16,7 +16,9 @@
 package host
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -33,10 +35,25 @@ against a fake API.
 type Handler interface {
 	AllowsUnprivilegedBpf() (bool, error)
 	KernelVersion() (string, error)
-	HasEthtool() (bool, string, error)
 	HasLibxdp() (bool, []string, error)
 	HasDevlink() (bool, string, error)
 	Hostname() (string, error)
+	PodIdentity(pid int) (string, string, error)
+	ContainerIdentity(containerID string) (string, string, error)
+}
+
+/*
+containerBundles are the OCI bundle configs of running containers in the runtime state directories
+of the host, reached through the root of PID 1, and the annotations holding the pod UID and
+container name, for containerd and CRI-O.
+*/
+var containerBundles = []struct {
+	path    string
+	uidKey  string
+	nameKey string
+}{
+	{"/proc/1/root/run/containerd/io.containerd.runtime.v2.task/k8s.io/%s/config.json", "io.kubernetes.cri.sandbox-uid", "io.kubernetes.cri.container-name"},
+	{"/proc/1/root/run/containers/storage/overlay-containers/%s/userdata/config.json", "io.kubernetes.pod.uid", "io.kubernetes.container.name"},
 }
 
 /*
@@ -130,20 +147,20 @@ func (r *handler) AllowsUnprivilegedBpf() (bool, error) {
 }
 
 /*
-HasEthtool checks if the host has ethtool installed and returns a boolean.
-It also executes the command: ethtool --version and returns the version as
+HasDevlink checks if the host has devlink installed and returns a boolean.
+It also executes the command: devlink -Version and returns the version as
 a string.
 */
-func (r *handler) HasEthtool() (bool, string, error) {
-	app := "ethtool"
-	args := "--version"
+func (r *handler) HasDevlink() (bool, string, error) {
+	app := "devlink"
+	args := "-Version"
 
 	path, err := exec.LookPath(app)
 	if err != nil {
 		if errors.Is(err, exec.ErrNotFound) {
 			return false, "", nil
 		}
-		logging.Errorf("Error checking if ethtool is present: %v", err)
+		logging.Errorf("Error checking if devlink is present: %v", err)
 		return false, "", err
 	}
 	if path == "" {
@@ -152,7 +169,7 @@ func (r *handler) HasEthtool() (bool, string, error) {
 
 	output, err := exec.Command(app, args).Output()
 	if err != nil {
-		logging.Errorf("Error getting ethtool version: %v", err.Error())
+		logging.Errorf("Error getting devlink version: %v", err.Error())
 		return false, "", err
 	}
 
@@ -161,41 +178,116 @@ func (r *handler) HasEthtool() (bool, string, error) {
 }
 
 /*
-HasDevlink checks if the host has devlink installed and returns a boolean.
-It also executes the command: devlink -Version and returns the version as
-a string.
+Hostname is a wrapper function for unit testing that calls os.Hostname.
 */
-func (r *handler) HasDevlink() (bool, string, error) {
-	app := "devlink"
-	args := "-Version"
+func (r *handler) Hostname() (string, error) {
+	return os.Hostname()
+}
 
-	path, err := exec.LookPath(app)
+/*
+PodIdentity returns the pod UID and container ID of a process, taken from the cgroup of the
+process. The process must be in the PID namespace of the host, or of this process.
+*/
+func (r *handler) PodIdentity(pid int) (string, string, error) {
+	if pid <= 0 {
+		return "", "", fmt.Errorf("invalid PID %d, the process may be in another PID namespace", pid)
+	}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
 	if err != nil {
-		if errors.Is(err, exec.ErrNotFound) {
-			return false, "", nil
-		}
-		logging.Errorf("Error checking if devlink is present: %v", err)
-		return false, "", err
+		return "", "", err
 	}
-	if path == "" {
-		return false, "", nil
+
+	return parsePodCgroup(string(data))
+}
+
+/*
+ContainerIdentity returns the pod UID and container name of a container, from the annotations the
+container runtime sets on the OCI bundle of the container. The bundle is on the host, out of reach
+of the container, so the identity cannot be forged from within the pod. The device plugin must run
+with hostPID: true to reach the host filesystem.
+*/
+func (r *handler) ContainerIdentity(containerID string) (string, string, error) {
+	if containerID == "" || strings.ContainsAny(containerID, "/.") {
+		return "", "", fmt.Errorf("invalid container ID %q", containerID)
 	}
 
-	output, err := exec.Command(app, args).Output()
-	if err != nil {
-		logging.Errorf("Error getting devlink version: %v", err.Error())
-		return false, "", err
+	for _, bundle := range containerBundles {
+		data, err := ioutil.ReadFile(fmt.Sprintf(bundle.path, containerID))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", "", err
+		}
+
+		var config struct {
+			Annotations map[string]string `json:"annotations"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return "", "", fmt.Errorf("error parsing OCI config of container %s: %v", containerID, err)
+		}
+
+		podUID, name := config.Annotations[bundle.uidKey], config.Annotations[bundle.nameKey]
+		if podUID == "" || name == "" {
+			return "", "", fmt.Errorf("container %s has no pod annotations", containerID)
+		}
+		return podUID, name, nil
 	}
 
-	version := strings.Split(string(output), "\n")[0]
-	return true, version, nil
+	return "", "", fmt.Errorf("container %s not found in a supported container runtime", containerID)
 }
 
 /*
-Hostname is a wrapper function for unit testing that calls os.Hostname.
+parsePodCgroup finds the pod UID and container ID in the contents of a /proc/<pid>/cgroup file.
+Both the cgroupfs layout, /kubepods/besteffort/pod<uid>/<id>, and the systemd layout,
+/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod<uid>.slice/cri-containerd-<id>.scope,
+are supported, in cgroup v1 and v2. Only pod cgroups below a kubepods cgroup are accepted.
 */
-func (r *handler) Hostname() (string, error) {
-	return os.Hostname()
+func parsePodCgroup(cgroup string) (string, string, error) {
+	for _, line := range strings.Split(cgroup, "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		kubepods := false
+		segments := strings.Split(fields[2], "/")
+		for i, segment := range segments {
+			segment = strings.TrimSuffix(segment, ".slice")
+			if strings.HasPrefix(segment, "kubepods") {
+				kubepods = true
+			}
+			index := strings.LastIndex(segment, "pod")
+			if !kubepods || index < 0 || (index > 0 && segment[index-1] != '-') || i+1 >= len(segments) {
+				continue
+			}
+
+			podUID := strings.ReplaceAll(segment[index+3:], "_", "-")
+			containerID := strings.TrimSuffix(segments[i+1], ".scope")
+			containerID = containerID[strings.LastIndex(containerID, "-")+1:]
+			if isPodUID(podUID) && containerID != "" {
+				return podUID, containerID, nil
+			}
+		}
+	}
+
+	return "", "", errors.New("process is not in a pod cgroup")
+}
+
+/*
+isPodUID returns true if uid looks like a pod UID, a UUID or the 32 hex digit hash of a static pod.
+*/
+func isPodUID(uid string) bool {
+	if len(uid) != 32 && len(uid) != 36 {
+		return false
+	}
+	for _, c := range uid {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && c != '-' {
+			return false
+		}
+	}
+	return true
 }
 
 /*
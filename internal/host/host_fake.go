@@ -15,6 +15,10 @@
 
 package host
 
+import (
+	"errors"
+)
+
 /*
 FakeHandler interface extends the Handler interface to provide additional testing methods.
 */
@@ -22,6 +26,8 @@ type FakeHandler interface {
 	Handler
 	SetKernalVersion(version string)
 	SetAllowsUnprivilegedBpf(allowed bool)
+	SetPodIdentity(uid string, containerID string)
+	SetContainerName(name string)
 }
 
 /*
@@ -32,6 +38,9 @@ type fakeHandler struct{}
 var (
 	kernelVersion        string
 	privilegedBpfAllowed bool
+	podUID               string
+	podContainerID       string
+	podContainerName     = "container-01"
 )
 
 /*
@@ -53,14 +62,6 @@ func (r *fakeHandler) SetKernalVersion(version string) {
 	kernelVersion = version
 }
 
-/*
-HasEthtool checks if the host has ethtool installed and returns a boolean.
-In this FakeHandler it returns a dummy version for testing purposes.
-*/
-func (r *fakeHandler) HasEthtool() (bool, string, error) {
-	return true, "ethtool version 5.4", nil
-}
-
 //setter
 
 /*
@@ -101,3 +102,35 @@ func (r *fakeHandler) Hostname() (string, error) {
 }
 
 //set setter for setDevLink
+
+/*
+PodIdentity returns the pod UID and container ID of a process.
+In this FakeHandler it returns the values set with SetPodIdentity, whatever the PID.
+*/
+func (r *fakeHandler) PodIdentity(pid int) (string, string, error) {
+	if podUID == "" {
+		return "", "", errors.New("process is not in a pod cgroup")
+	}
+	return podUID, podContainerID, nil
+}
+
+func (r *fakeHandler) SetPodIdentity(uid string, containerID string) {
+	podUID = uid
+	podContainerID = containerID
+}
+
+/*
+ContainerIdentity returns the pod UID and container name of a container.
+In this FakeHandler it returns the pod UID set with SetPodIdentity and the name set with
+SetContainerName, for the container ID set with SetPodIdentity only.
+*/
+func (r *fakeHandler) ContainerIdentity(containerID string) (string, string, error) {
+	if containerID == "" || containerID != podContainerID {
+		return "", "", errors.New("container " + containerID + " not found")
+	}
+	return podUID, podContainerName, nil
+}
+
+func (r *fakeHandler) SetContainerName(name string) {
+	podContainerName = name
+}
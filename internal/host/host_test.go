@@ -0,0 +1,249 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPodUID      = "0a1b2c3d-1111-2222-3333-444455556666"
+	testStaticUID   = "0a1b2c3d111122223333444455556666"
+	testContainerID = "4f3e2d1c0b9a88776655443322110099aabbccddeeff00112233445566778899"
+)
+
+func TestParsePodCgroup(t *testing.T) {
+	testCases := []struct {
+		name           string
+		cgroup         string
+		expPodUID      string
+		expContainerID string
+		expErr         bool
+	}{
+		{
+			name: "cgroup v1 cgroupfs",
+			cgroup: "12:pids:/kubepods/besteffort/pod" + testPodUID + "/" + testContainerID + "\n" +
+				"11:memory:/kubepods/besteffort/pod" + testPodUID + "/" + testContainerID + "\n",
+			expPodUID:      testPodUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name:           "cgroup v1 cgroupfs guaranteed pod",
+			cgroup:         "11:memory:/kubepods/pod" + testPodUID + "/" + testContainerID + "\n",
+			expPodUID:      testPodUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name: "cgroup v1 systemd containerd",
+			cgroup: "11:memory:/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0a1b2c3d_1111_2222_3333_444455556666.slice/" +
+				"cri-containerd-" + testContainerID + ".scope\n",
+			expPodUID:      testPodUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name:           "cgroup v2 cgroupfs",
+			cgroup:         "0::/kubepods/burstable/pod" + testPodUID + "/" + testContainerID + "\n",
+			expPodUID:      testPodUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name: "cgroup v2 systemd containerd",
+			cgroup: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0a1b2c3d_1111_2222_3333_444455556666.slice/" +
+				"cri-containerd-" + testContainerID + ".scope\n",
+			expPodUID:      testPodUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name: "cgroup v2 systemd CRI-O",
+			cgroup: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0a1b2c3d_1111_2222_3333_444455556666.slice/" +
+				"crio-" + testContainerID + ".scope\n",
+			expPodUID:      testPodUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name: "cgroup v2 systemd static pod",
+			cgroup: "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + testStaticUID + ".slice/" +
+				"cri-containerd-" + testContainerID + ".scope\n",
+			expPodUID:      testStaticUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name: "cgroup namespace of the reader",
+			cgroup: "0::/../../kubepods-besteffort-pod0a1b2c3d_1111_2222_3333_444455556666.slice/" +
+				"cri-containerd-" + testContainerID + ".scope\n",
+			expPodUID:      testPodUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name:           "malformed lines before a pod line",
+			cgroup:         "garbage\n\n0:\n0::/kubepods/besteffort/pod" + testPodUID + "/" + testContainerID + "\n",
+			expPodUID:      testPodUID,
+			expContainerID: testContainerID,
+		},
+		{
+			name:   "host service",
+			cgroup: "0::/system.slice/containerd.service\n",
+			expErr: true,
+		},
+		{
+			name:   "pod named directory outside kubepods",
+			cgroup: "0::/user.slice/user-1000.slice/pod" + testPodUID + "/" + testContainerID + "\n",
+			expErr: true,
+		},
+		{
+			name:   "podman container",
+			cgroup: "0::/machine.slice/libpod-" + testContainerID + ".scope/podman/" + testContainerID + "\n",
+			expErr: true,
+		},
+		{
+			name:   "pod cgroup without a container",
+			cgroup: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0a1b2c3d_1111_2222_3333_444455556666.slice\n",
+			expErr: true,
+		},
+		{
+			name:   "invalid pod UID",
+			cgroup: "0::/kubepods/besteffort/pod../" + testContainerID + "\n",
+			expErr: true,
+		},
+		{
+			name:   "malformed lines",
+			cgroup: "garbage\nkubepods/pod" + testPodUID + "/" + testContainerID + "\n",
+			expErr: true,
+		},
+		{
+			name:   "empty",
+			cgroup: "",
+			expErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			podUID, containerID, err := parsePodCgroup(tc.cgroup)
+			if tc.expErr {
+				assert.Error(t, err, "Expected an error")
+				return
+			}
+			require.NoError(t, err, "Unexpected error")
+			assert.Equal(t, tc.expPodUID, podUID, "Unexpected pod UID")
+			assert.Equal(t, tc.expContainerID, containerID, "Unexpected container ID")
+		})
+	}
+}
+
+func TestContainerIdentity(t *testing.T) {
+	dir := t.TempDir()
+	original := containerBundles
+	defer func() { containerBundles = original }()
+
+	containerBundles = []struct {
+		path    string
+		uidKey  string
+		nameKey string
+	}{
+		{filepath.Join(dir, "containerd", "%s", "config.json"), "io.kubernetes.cri.sandbox-uid", "io.kubernetes.cri.container-name"},
+		{filepath.Join(dir, "crio", "%s", "userdata", "config.json"), "io.kubernetes.pod.uid", "io.kubernetes.container.name"},
+	}
+
+	writeBundle := func(path string, config string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+	}
+	writeBundle(filepath.Join(dir, "containerd", "containerd01", "config.json"),
+		`{"annotations":{"io.kubernetes.cri.sandbox-uid":"`+testPodUID+`","io.kubernetes.cri.container-name":"app"}}`)
+	writeBundle(filepath.Join(dir, "crio", "crio01", "userdata", "config.json"),
+		`{"annotations":{"io.kubernetes.pod.uid":"`+testPodUID+`","io.kubernetes.container.name":"sidecar"}}`)
+	writeBundle(filepath.Join(dir, "containerd", "noannotations01", "config.json"), `{"annotations":{}}`)
+	writeBundle(filepath.Join(dir, "containerd", "malformed01", "config.json"), `{"annotations":`)
+	writeBundle(filepath.Join(dir, "escaped", "config.json"),
+		`{"annotations":{"io.kubernetes.cri.sandbox-uid":"`+testPodUID+`","io.kubernetes.cri.container-name":"app"}}`)
+
+	testCases := []struct {
+		name        string
+		containerID string
+		expPodUID   string
+		expName     string
+		expErr      string
+	}{
+		{
+			name:        "containerd",
+			containerID: "containerd01",
+			expPodUID:   testPodUID,
+			expName:     "app",
+		},
+		{
+			name:        "CRI-O",
+			containerID: "crio01",
+			expPodUID:   testPodUID,
+			expName:     "sidecar",
+		},
+		{
+			name:        "no pod annotations",
+			containerID: "noannotations01",
+			expErr:      "has no pod annotations",
+		},
+		{
+			name:        "malformed config",
+			containerID: "malformed01",
+			expErr:      "error parsing OCI config",
+		},
+		{
+			name:        "unknown container",
+			containerID: "unknown01",
+			expErr:      "not found in a supported container runtime",
+		},
+		{
+			name:        "empty ID",
+			containerID: "",
+			expErr:      "invalid container ID",
+		},
+		{
+			name:        "ID with a slash",
+			containerID: "../escaped",
+			expErr:      "invalid container ID",
+		},
+		{
+			name:        "ID with a dot",
+			containerID: "..",
+			expErr:      "invalid container ID",
+		},
+		{
+			name:        "ID with a slash only",
+			containerID: "containerd01/",
+			expErr:      "invalid container ID",
+		},
+	}
+
+	handler := NewHandler()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			podUID, name, err := handler.ContainerIdentity(tc.containerID)
+			if tc.expErr != "" {
+				require.Error(t, err, "Expected an error")
+				assert.Contains(t, err.Error(), tc.expErr, "Unexpected error message")
+				return
+			}
+			require.NoError(t, err, "Unexpected error")
+			assert.Equal(t, tc.expPodUID, podUID, "Unexpected pod UID")
+			assert.Equal(t, tc.expName, name, "Unexpected container name")
+		})
+	}
+}
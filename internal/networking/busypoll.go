@@ -0,0 +1,96 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	napiDeferHardIrqsFile   = "napi_defer_hard_irqs" // sysfs file of the number of NAPI polls to defer hard interrupts for
+	napiGroFlushTimeoutFile = "gro_flush_timeout"    // sysfs file of the timeout, in nanoseconds, of the deferred interrupts
+)
+
+/*
+BusyPollConfig holds the busy poll policy of a pool. The socket settings are applied to the
+AF_XDP sockets of the pool, and the NAPI settings to its devices while they are allocated.
+*/
+type BusyPollConfig struct {
+	Timeout         int  // SO_BUSY_POLL, in microseconds
+	Budget          int  // SO_BUSY_POLL_BUDGET, the number of packets processed per busy poll
+	Prefer          bool // SO_PREFER_BUSY_POLL
+	DeferHardIrqs   int  // napi_defer_hard_irqs of the device
+	GroFlushTimeout int  // gro_flush_timeout of the device, in nanoseconds
+}
+
+/*
+NapiSettings holds the sysfs NAPI settings of a netdev that busy polling depends on.
+*/
+type NapiSettings struct {
+	DeferHardIrqs   int
+	GroFlushTimeout int
+}
+
+/*
+GetNapiSettings takes a netdev name and returns its current NAPI settings.
+*/
+func (r *handler) GetNapiSettings(interfaceName string) (*NapiSettings, error) {
+	deferHardIrqs, err := readNapiSetting(interfaceName, napiDeferHardIrqsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	groFlushTimeout, err := readNapiSetting(interfaceName, napiGroFlushTimeoutFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NapiSettings{DeferHardIrqs: deferHardIrqs, GroFlushTimeout: groFlushTimeout}, nil
+}
+
+/*
+SetNapiSettings takes a netdev name and writes the given NAPI settings to it.
+*/
+func (r *handler) SetNapiSettings(interfaceName string, settings *NapiSettings) error {
+	if err := writeNapiSetting(interfaceName, napiDeferHardIrqsFile, settings.DeferHardIrqs); err != nil {
+		return err
+	}
+	return writeNapiSetting(interfaceName, napiGroFlushTimeoutFile, settings.GroFlushTimeout)
+}
+
+func readNapiSetting(interfaceName string, file string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(sysClassNet, interfaceName, file))
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s of device %s: %w", file, interfaceName, err)
+	}
+	return value, nil
+}
+
+func writeNapiSetting(interfaceName string, file string, value int) error {
+	if err := os.WriteFile(filepath.Join(sysClassNet, interfaceName, file), []byte(strconv.Itoa(value)), 0644); err != nil {
+		return fmt.Errorf("error setting %s of device %s to %d: %w", file, interfaceName, value, err)
+	}
+	return nil
+}
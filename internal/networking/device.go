@@ -33,7 +33,10 @@ type Device struct {
 	driver        string
 	pci           string
 	macAddress    string
+	fixedMac      bool
 	fullyAssigned bool
+	active        bool
+	portIndex     string
 	primary       *Device
 	secondaries   []*Device
 	netHandler    Handler
@@ -95,7 +98,7 @@ func (d *Device) AssignCdqSecondaries(limit int) ([]*Device, error) {
 	}
 
 	if d.secondaries == nil {
-		numSF := constants.Devices.SecondaryMax
+		numSF := d.cdqCapacity()
 		for i := 1; i <= numSF; i++ {
 			newSF, err := newSecondaryDevice(d.name+"sf"+strconv.Itoa(i), d)
 			if err != nil {
@@ -121,6 +124,33 @@ func (d *Device) AssignCdqSecondaries(limit int) ([]*Device, error) {
 	return subFunctions, nil
 }
 
+/*
+cdqCapacity returns the number of secondary devices to create for this primary device.
+This is the number of subfunctions devlink reports available on the port, capped at the
+secondary device maximum. If devlink cannot report the capacity, the maximum is used.
+*/
+func (d *Device) cdqCapacity() int {
+	numSF := constants.Devices.SecondaryMax
+
+	pci, err := d.Pci()
+	if err != nil {
+		logging.Warningf("Unable to get PCI address of %s, assuming %d CDQ subfunctions available: %v", d.name, numSF, err)
+		return numSF
+	}
+
+	available, err := d.netHandler.NumAvailableCdqSubfunctions(pci)
+	if err != nil {
+		logging.Warningf("Unable to get CDQ subfunction capacity of %s, assuming %d available: %v", d.name, numSF, err)
+		return numSF
+	}
+
+	if available < numSF {
+		logging.Infof("Device %s has capacity for %d CDQ subfunctions", d.name, available)
+		numSF = available
+	}
+	return numSF
+}
+
 /*
 ActivateCdqSubfunction converts our device object in code into an actual CDQ subfunction on the host
 */
@@ -145,6 +175,7 @@ func (d *Device) ActivateCdqSubfunction() error {
 
 	if exists {
 		logging.Warningf("Subfunction %s already exists", d.name)
+		d.active = true
 		return nil
 	}
 
@@ -158,16 +189,96 @@ func (d *Device) ActivateCdqSubfunction() error {
 		return fmt.Errorf("error getting primary device pfnum while activating subfunction %s: %v", d.name, err)
 	}
 
+	available, err := d.netHandler.NumAvailableCdqSubfunctions(pci)
+	if err != nil {
+		logging.Warningf("Unable to check CDQ subfunction capacity before activating subfunction %s: %v", d.name, err)
+	} else if available <= 0 {
+		return fmt.Errorf("cannot activate CDQ subfunction %s. No subfunctions available on %s", d.name, d.primary.name)
+	}
+
 	sfNum := strings.Split(d.name, "sf")[1]
 
-	err = d.netHandler.CreateCdqSubfunction(pci, pfnum, sfNum)
+	var hwAddr string
+	if d.fixedMac {
+		hwAddr = d.macAddress
+	}
+
+	portIndex, err := d.netHandler.CreateCdqSubfunction(pci, pfnum, sfNum, hwAddr)
 	if err != nil {
 		return fmt.Errorf("error creating CDQ subfunction %s: %v", d.name, err)
 	}
 
+	d.portIndex = portIndex
+	d.active = true
 	return nil
 }
 
+/*
+DeactivateCdqSubfunction deletes the CDQ subfunction of our device object from the host
+The port index recorded when the subfunction was activated is used. If there is none,
+for example because the subfunction was created by a previous run, it is looked up by name.
+*/
+func (d *Device) DeactivateCdqSubfunction() error {
+	if d.IsPrimary() {
+		return fmt.Errorf("cannot deactivate CDQ subfunction %s. This is a primary device", d.name)
+	}
+
+	if d.portIndex == "" {
+		exists, err := d.netHandler.NetDevExists(d.name)
+		if err != nil {
+			return fmt.Errorf("error determining if subfunction %s exists: %v", d.name, err)
+		}
+		if !exists {
+			logging.Debugf("Subfunction %s does not exist", d.name)
+			d.active = false
+			return nil
+		}
+	}
+
+	portIndex, err := d.PortIndex()
+	if err != nil {
+		return err
+	}
+
+	if err := d.netHandler.DeleteCdqSubfunction(portIndex); err != nil {
+		// the CNI deletes the subfunction itself when not using the DP<=>CNI syncer
+		exists, existsErr := d.netHandler.NetDevExists(d.name)
+		if existsErr != nil || exists {
+			return fmt.Errorf("error deleting CDQ subfunction %s: %v", d.name, err)
+		}
+		logging.Debugf("Subfunction %s was already deleted", d.name)
+	}
+
+	d.portIndex = ""
+	d.active = false
+	return nil
+}
+
+/*
+PortIndex returns the devlink port index (pci/index) of the CDQ subfunction of this device,
+without the pci/ prefix. The index recorded when the subfunction was activated is returned,
+otherwise it is looked up by name.
+*/
+func (d *Device) PortIndex() (string, error) {
+	if d.portIndex != "" {
+		return d.portIndex, nil
+	}
+
+	portIndex, err := d.netHandler.GetCdqPortIndex(d.name)
+	if err != nil {
+		return "", fmt.Errorf("error getting port index of subfunction %s: %v", d.name, err)
+	}
+	return portIndex, nil
+}
+
+/*
+IsActive returns true if the CDQ subfunction of this device has been activated on the host
+and not since deleted
+*/
+func (d *Device) IsActive() bool {
+	return d.active
+}
+
 /*
 Name returns the name of the device
 */
@@ -223,10 +334,10 @@ Mac will check Device object for its mac and return the result
 If mac is not stored it will be discovered through the netHandler
 Mac is then stored for subsequent calls
 For secondary devices, which tend to be created and deleted regularly,
-we always recheck the mac.
+we always recheck the mac, unless it was assigned with AssignCdqMac.
 */
 func (d *Device) Mac() (string, error) {
-	if d.IsSecondary() {
+	if d.IsSecondary() && !d.fixedMac {
 		mac, err := d.netHandler.GetMacAddress(d.name)
 		if err != nil {
 			return "", err
@@ -0,0 +1,200 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	_ethtool "github.com/safchain/ethtool"
+	logging "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	netdevGenlName        = "netdev" // generic netlink family reporting the XDP features of netdevs, kernel 6.3 and later
+	netdevCmdDevGet       = 1        // NETDEV_CMD_DEV_GET
+	netdevAttrIfindex     = 1        // NETDEV_A_DEV_IFINDEX
+	netdevAttrXdpFeatures = 3        // NETDEV_A_DEV_XDP_FEATURES
+	netdevXdpActRxSg      = 1 << 5   // NETDEV_XDP_ACT_RX_SG, the device supports multi-buffer XDP on receive
+)
+
+/*
+DeviceInfo holds what an AF_XDP application needs to know about a netdev.
+Queues is the number of RX queues an XSK can be bound to. QueueStart and QueueCount are the
+range of queues packets are steered to, see queueRange. MultiBuffer is nil if the kernel
+does not report the XDP features of the netdev.
+*/
+type DeviceInfo struct {
+	Ifindex     int
+	Queues      uint32
+	QueueStart  uint32
+	QueueCount  uint32
+	Mtu         int
+	MultiBuffer *bool
+}
+
+/*
+GetDeviceInfo takes a netdev name and returns its DeviceInfo. If netnsPath is not empty the
+netdev is looked up in that network namespace, for example the namespace of the pod it has
+been moved into. A netdev renamed in the pod can be found by its original name, which the CNI
+keeps as an alternative name.
+*/
+func (r *handler) GetDeviceInfo(netnsPath string, interfaceName string) (*DeviceInfo, error) {
+	if netnsPath == "" {
+		return getDeviceInfo(interfaceName)
+	}
+
+	var info *DeviceInfo
+	err := ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		var err error
+		info, err = getDeviceInfo(interfaceName)
+		return err
+	})
+	return info, err
+}
+
+func getDeviceInfo(interfaceName string) (*DeviceInfo, error) {
+	link, err := netlink.LinkByName(interfaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &DeviceInfo{
+		Ifindex: link.Attrs().Index,
+		Mtu:     link.Attrs().MTU,
+		Queues:  uint32(link.Attrs().NumRxQueues),
+	}
+
+	e, err := _ethtool.NewEthtool()
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+
+	// the queues in use, rather than the number allocated by the driver
+	channels, err := e.GetChannels(link.Attrs().Name)
+	if err != nil {
+		logging.Debugf("Unable to read channels of device %s, using %d RX queues: %v", interfaceName, info.Queues, err)
+	} else if channels.CombinedCount+channels.RxCount > 0 {
+		info.Queues = channels.CombinedCount + channels.RxCount
+	}
+
+	info.QueueStart, info.QueueCount = queueRange(interfaceName, info.Queues)
+
+	features, err := getXdpFeatures(info.Ifindex)
+	if err != nil {
+		logging.Debugf("Unable to read XDP features of device %s: %v", interfaceName, err)
+	} else {
+		multiBuffer := features&netdevXdpActRxSg != 0
+		info.MultiBuffer = &multiBuffer
+	}
+
+	return info, nil
+}
+
+/*
+queueRange returns the range of queues of a device that packets are steered to, by the RSS
+indirection table and by ntuple rules, as set up by the CNI queues and ethtool settings and
+by the pool ethtool filters. An XSK bound outside the range would receive nothing. If the
+steering cannot be read, all queues of the device are in the range.
+*/
+func queueRange(interfaceName string, queues uint32) (uint32, uint32) {
+	steered, err := getRssTable(interfaceName)
+	if err != nil || len(steered) == 0 {
+		logging.Debugf("Unable to read RSS table of device %s, allowing all %d queues: %v", interfaceName, queues, err)
+		return 0, queues
+	}
+
+	ruleQueues, err := getRuleQueues(interfaceName)
+	if err != nil {
+		logging.Debugf("Unable to read ntuple rules of device %s: %v", interfaceName, err)
+	}
+	steered = append(steered, ruleQueues...)
+
+	start, end := queues, uint32(0)
+	for _, queue := range steered {
+		if queue >= queues {
+			continue
+		}
+		if queue < start {
+			start = queue
+		}
+		if queue >= end {
+			end = queue + 1
+		}
+	}
+	if start >= end {
+		return 0, queues
+	}
+	return start, end - start
+}
+
+/*
+getXdpFeatures reads the XDP features of a netdev from the netdev generic netlink family.
+The netlink library does not support this family, so the request is built here.
+*/
+func getXdpFeatures(ifindex int) (uint64, error) {
+	family, err := netlink.GenlFamilyGet(netdevGenlName)
+	if err != nil {
+		return 0, err
+	}
+
+	req := nl.NewNetlinkRequest(int(family.ID), 0)
+	req.AddData(&genlHeader{command: netdevCmdDevGet, version: 1})
+	req.AddData(nl.NewRtAttr(netdevAttrIfindex, nl.Uint32Attr(uint32(ifindex))))
+
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range msgs {
+		if len(msg) < nl.SizeofGenlmsg {
+			continue
+		}
+		attrs, err := nl.ParseRouteAttr(msg[nl.SizeofGenlmsg:])
+		if err != nil {
+			return 0, err
+		}
+		for _, attr := range attrs {
+			if int(attr.Attr.Type) == netdevAttrXdpFeatures && len(attr.Value) == 8 {
+				return nl.NativeEndian().Uint64(attr.Value), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("no XDP features reported for ifindex %d", ifindex)
+}
+
+/*
+genlHeader is a generic netlink message header. The netlink library's nl.Genlmsg omits
+the reserved field of the header, and serializes whatever follows it in memory instead.
+*/
+type genlHeader struct {
+	command uint8
+	version uint8
+}
+
+func (h *genlHeader) Len() int {
+	return nl.SizeofGenlmsg
+}
+
+func (h *genlHeader) Serialize() []byte {
+	return []byte{h.command, h.version, 0, 0}
+}
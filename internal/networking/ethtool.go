@@ -16,59 +16,186 @@
 package networking
 
 import (
-	logging "github.com/sirupsen/logrus"
+	"errors"
+	"fmt"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	_ethtool "github.com/safchain/ethtool"
+	logging "github.com/sirupsen/logrus"
 )
 
 var ethtool = "ethtool"
 
+/*
+ruleAddedRegex matches the rule location printed by the ethtool binary when it adds an ntuple rule
+*/
+var ruleAddedRegex = regexp.MustCompile(`Added rule with ID (\d+)`)
+
+/*
+errNativeUnsupported is returned by the native ethtool backend for commands or
+options it does not implement. These commands fall back to the ethtool binary.
+*/
+var errNativeUnsupported = errors.New("not supported by native ethtool backend")
+
+/*
+EthtoolError is returned when an ethtool command fails. Op describes the operation
+that failed and Err holds the underlying error, typically a syscall.Errno from the
+driver, which can be checked with errors.Is.
+*/
+type EthtoolError struct {
+	Device  string
+	Command string
+	Op      string
+	Output  string
+	Err     error
+}
+
+func (e *EthtoolError) Error() string {
+	msg := fmt.Sprintf("ethtool %s failed on device %s", e.Op, e.Device)
+	if e.Command != "" {
+		msg += fmt.Sprintf(" [%s]", e.Command)
+	}
+	msg += fmt.Sprintf(": %v", e.Err)
+	if e.Output != "" {
+		msg += ": " + e.Output
+	}
+	return msg
+}
+
+func (e *EthtoolError) Unwrap() error {
+	return e.Err
+}
+
 /*
 SetEthtool applies ethtool filters on the physical device during cmdAdd().
-Ethtool filters are set via the DP config.json file.
+Ethtool filters are set via the DP config.json file. IP placeholders are
+replaced by the pod addresses in ipAddrs, see expandEthtoolCmd.
+It returns the locations of any ntuple rules added by the commands.
+If a command fails, the rules already added by this call are removed.
 */
-func (r *handler) SetEthtool(ethtoolFilters []string, interfaceName string, ipAddr string) error {
-	fd := "on"
-	err := flowDirector(interfaceName, fd)
+func (r *handler) SetEthtool(ethtoolFilters []string, interfaceName string, ipAddrs []string) ([]uint32, error) {
+	var locations []uint32
+
+	err := flowDirector(interfaceName, true)
 	if err != nil {
 		logging.Errorf("Failed to enable flow director: %s", err.Error())
-		return err
+		return nil, err
 	}
 	for _, ethtoolFilter := range ethtoolFilters {
 		ethtoolFilter = strings.Replace(ethtoolFilter, "-device-", interfaceName, -1)
 
-		ethtoolFilter = strings.Replace(ethtoolFilter, "-ip-", ipAddr, -1)
-
-		cmd := exec.Command(ethtool, strings.Split(ethtoolFilter, " ")...)
-		stdout, err := cmd.CombinedOutput()
+		ethtoolCmds, err := expandEthtoolCmd(ethtoolFilter, ipAddrs)
 		if err != nil {
-			logging.Errorf("Error setting ethtool filter [%s]: %s", ethtoolFilter, string(stdout))
-			return err
+			logging.Errorf("Error setting ethtool filter [%s]: %v", ethtoolFilter, err)
+			return nil, r.rollbackEthtool(interfaceName, locations, err)
 		}
 
-		logging.Debugf("Ethtool filters [%s] successfully executed", ethtoolFilter)
+		for _, ethtoolCmd := range ethtoolCmds {
+			added, err := runEthtoolCmd(ethtoolCmd)
+			if err != nil {
+				logging.Errorf("Error setting ethtool filter [%s]: %v", ethtoolCmd, err)
+				return nil, r.rollbackEthtool(interfaceName, locations, err)
+			}
+			locations = append(locations, added...)
+
+			logging.Debugf("Ethtool filters [%s] successfully executed", ethtoolCmd)
+		}
 	}
 
-	return nil
+	return locations, nil
+}
+
+/*
+rollbackEthtool removes the ntuple rules added before an error and returns the error
+*/
+func (r *handler) rollbackEthtool(interfaceName string, locations []uint32, err error) error {
+	if delErr := r.DeleteEthtoolRules(interfaceName, locations); delErr != nil {
+		logging.Warningf("Failed to remove ethtool filters after error: %v", delErr)
+	}
+	return err
+}
+
+/*
+expandEthtoolCmd replaces the pod IP placeholders in an ethtool command line.
+The -ip4- and -ip6- placeholders take the pod address of that family. If the command
+has a flow-type and uses -ip- without the family specific placeholders, one command is
+returned for each IP family the pod has an address in, with the flow-type converted
+to that family. Otherwise -ip- takes the pod IPv4 address, or IPv6 if there is none.
+*/
+func expandEthtoolCmd(ethtoolCmd string, ipAddrs []string) ([]string, error) {
+	args := strings.Fields(ethtoolCmd)
+	generic, specific, flowType := false, false, -1
+
+	for i, arg := range args {
+		switch {
+		case arg == constants.EthtoolFilter.IPPlaceholder:
+			generic = true
+		case arg == constants.EthtoolFilter.IPv4Placeholder || arg == constants.EthtoolFilter.IPv6Placeholder:
+			specific = true
+		case arg == "flow-type" && i+1 < len(args):
+			if f := args[i+1]; strings.HasSuffix(f, "4") || strings.HasSuffix(f, "6") {
+				flowType = i + 1
+			}
+		}
+	}
+
+	if !generic && !specific {
+		return []string{ethtoolCmd}, nil
+	}
+
+	families := []bool{podIP(ipAddrs, false) == ""}
+	switch {
+	case flowType >= 0 && specific:
+		families = []bool{strings.HasSuffix(args[flowType], "6")}
+	case flowType >= 0:
+		families = nil
+		for _, v6 := range []bool{false, true} {
+			if podIP(ipAddrs, v6) != "" {
+				families = append(families, v6)
+			}
+		}
+		if len(families) == 0 {
+			return nil, fmt.Errorf("%s placeholder used but no pod IP address available", constants.EthtoolFilter.IPPlaceholder)
+		}
+	}
+
+	var cmds []string
+	for _, v6 := range families {
+		cmd := make([]string, len(args))
+		for i, arg := range args {
+			value, err := resolveIPPlaceholder(arg, ipAddrs, v6)
+			if err != nil {
+				return nil, err
+			}
+			cmd[i] = value
+		}
+		if flowType >= 0 && !specific {
+			cmd[flowType] = familyFlowType(args[flowType], v6)
+		}
+		cmds = append(cmds, strings.Join(cmd, " "))
+	}
+
+	return cmds, nil
 }
 
 /*
 DeleteEthtool sets the default queue size ethtool filter.
-It also removes perfect-flow ethtool filter entries during cmdDel()
+It also removes perfect-flow ethtool filter entries during cmdDel().
+This removes every ntuple rule on the device, it is only used when no
+record of the rules added for an attachment exists, see DeleteEthtoolRules.
 */
 func (r *handler) DeleteEthtool(interfaceName string) error {
-	defaultArg := "-X"
-	fd := "off"
-
-	ethtoolFilter := []string{defaultArg, interfaceName, "default"}
-	cmd := exec.Command(ethtool, ethtoolFilter...)
-	stdout, err := cmd.CombinedOutput()
-	if err != nil {
-		logging.Errorf("Error setting default ethtool queue size [%s]: %v", ethtoolFilter, string(stdout))
+	if err := setRssTable(interfaceName, []uint32{}); err != nil {
+		err = &EthtoolError{Device: interfaceName, Op: "RSS reset", Err: err}
+		logging.Errorf("Error setting default ethtool queue size: %v", err)
 		return err
 	}
 
-	err = flowDirector(interfaceName, fd)
+	err := flowDirector(interfaceName, false)
 	if err != nil {
 		logging.Errorf("Error removing perfect flow entries: %v", err.Error())
 		return err
@@ -83,11 +210,64 @@ func (r *handler) DeleteEthtool(interfaceName string) error {
 flowDirector enables and disables the Ethernet Flow Director. It must be enabled
 for filter flow entries. Disabling, enables entries to be removed from device.
 */
-func flowDirector(interfaceName string, fdStatus string) error {
-	final := exec.Command(ethtool, "--features", interfaceName, "ntuple", fdStatus)
-	_, err := final.CombinedOutput()
+func flowDirector(interfaceName string, enable bool) error {
+	e, err := _ethtool.NewEthtool()
 	if err != nil {
-		return err
+		return &EthtoolError{Device: interfaceName, Op: "features", Err: err}
+	}
+	defer e.Close()
+
+	if err := e.Change(interfaceName, map[string]bool{ntupleFeature: enable}); err != nil {
+		return &EthtoolError{Device: interfaceName, Op: "features", Err: err}
 	}
 	return nil
 }
+
+/*
+runEthtoolCmd takes an ethtool command line, without the ethtool prefix, and applies it.
+Commands are applied through the native backend where supported. Other commands fall
+back to the ethtool binary, if it is installed on the host. It returns the location of
+the ntuple rule added by the command, if any.
+*/
+func runEthtoolCmd(ethtoolCmd string) ([]uint32, error) {
+	args := strings.Fields(ethtoolCmd)
+
+	op, err := parseEthtoolCmd(args)
+	if err == nil {
+		if err := op.apply(); err != nil {
+			return nil, err
+		}
+		if ntuple, ok := op.(*ntupleOp); ok && !ntuple.delete {
+			return []uint32{ntuple.location}, nil
+		}
+		return nil, nil
+	}
+	if !errors.Is(err, errNativeUnsupported) {
+		return nil, err
+	}
+
+	logging.Debugf("Ethtool command [%s] %v, falling back to ethtool binary", ethtoolCmd, err)
+	device := ""
+	if len(args) > 1 {
+		device = args[1]
+	}
+
+	path, lookErr := exec.LookPath(ethtool)
+	if lookErr != nil {
+		return nil, &EthtoolError{Device: device, Command: ethtoolCmd, Op: "command", Err: err}
+	}
+
+	stdout, execErr := exec.Command(path, args...).CombinedOutput()
+	if execErr != nil {
+		return nil, &EthtoolError{Device: device, Command: ethtoolCmd, Op: "command", Output: strings.TrimSpace(string(stdout)), Err: execErr}
+	}
+
+	if match := ruleAddedRegex.FindSubmatch(stdout); match != nil {
+		loc, err := strconv.ParseUint(string(match[1]), 10, 32)
+		if err == nil {
+			return []uint32{uint32(loc)}, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,387 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	logging "github.com/sirupsen/logrus"
+)
+
+/*
+EthtoolFilter is a structured ntuple filter. It is translated into ntuple rules on the
+device the filter is applied to, so the device itself is never part of the filter.
+SrcIP and DstIP accept the pod IP placeholders -ip-, -ip4- and -ip6-, which are
+replaced by the pod addresses when the filter is applied, see rules.
+An action of -1 drops matching packets.
+*/
+type EthtoolFilter struct {
+	FlowType string `json:"flowType"`
+	SrcIP    string `json:"srcIp,omitempty"`
+	DstIP    string `json:"dstIp,omitempty"`
+	SrcPort  *int   `json:"srcPort,omitempty"`
+	DstPort  *int   `json:"dstPort,omitempty"`
+	L4Proto  *int   `json:"l4proto,omitempty"`
+	Action   *int   `json:"action"`
+	Context  *int   `json:"context,omitempty"`
+	Loc      *int   `json:"loc,omitempty"`
+}
+
+/*
+Validate validates the contents of the EthtoolFilter struct
+*/
+func (f EthtoolFilter) Validate() error {
+	var (
+		allowedFlowTypes               = constants.EthtoolFilter.FlowTypes
+		flowTypes        []interface{} = make([]interface{}, len(allowedFlowTypes))
+		maxPort                        = constants.EthtoolFilter.PortMaximum
+		hasPorts                       = f.isL4()
+		hasProto                       = f.FlowType == "ip4" || f.FlowType == "ip6"
+	)
+
+	for i, flowType := range allowedFlowTypes {
+		flowTypes[i] = flowType
+	}
+
+	return validation.ValidateStruct(&f,
+		validation.Field(
+			&f.FlowType,
+			validation.Required.Error("flowType must be specified"),
+			validation.In(flowTypes...).Error("flowType must be "+fmt.Sprintf("%v", flowTypes)),
+		),
+		validation.Field(
+			&f.SrcIP,
+			validation.By(f.validateIP),
+		),
+		validation.Field(
+			&f.DstIP,
+			validation.By(f.validateIP),
+		),
+		validation.Field(
+			&f.SrcPort,
+			validation.Nil.When(!hasPorts).Error("srcPort is only valid for tcp, udp and sctp flow types"),
+			validation.Min(0).Error("srcPort must be between 0 and "+fmt.Sprintf("%d", maxPort)),
+			validation.Max(maxPort).Error("srcPort must be between 0 and "+fmt.Sprintf("%d", maxPort)),
+		),
+		validation.Field(
+			&f.DstPort,
+			validation.Nil.When(!hasPorts).Error("dstPort is only valid for tcp, udp and sctp flow types"),
+			validation.Min(0).Error("dstPort must be between 0 and "+fmt.Sprintf("%d", maxPort)),
+			validation.Max(maxPort).Error("dstPort must be between 0 and "+fmt.Sprintf("%d", maxPort)),
+		),
+		validation.Field(
+			&f.L4Proto,
+			validation.Nil.When(!hasProto).Error("l4proto is only valid for ip4 and ip6 flow types"),
+			validation.Min(0).Error("l4proto must be between 0 and 255"),
+			validation.Max(255).Error("l4proto must be between 0 and 255"),
+		),
+		validation.Field(
+			&f.Action,
+			validation.NotNil.Error("action must be specified"),
+			validation.Min(constants.EthtoolFilter.ActionDrop).Error("action must be a queue number, or -1 to drop"),
+		),
+		validation.Field(
+			&f.Context,
+			validation.Min(0).Error("context must be a positive whole number"),
+		),
+		validation.Field(
+			&f.Loc,
+			validation.Min(0).Error("loc must be a positive whole number"),
+		),
+	)
+}
+
+/*
+validateIP checks an IP field is either a pod IP placeholder or an address
+matching the IP version of the flow type
+*/
+func (f EthtoolFilter) validateIP(value interface{}) error {
+	s, _ := value.(string)
+	switch s {
+	case "", constants.EthtoolFilter.IPPlaceholder:
+		return nil
+	case constants.EthtoolFilter.IPv4Placeholder:
+		if f.isIPv6() {
+			return errors.New(s + " cannot be used with flowType " + f.FlowType)
+		}
+		return nil
+	case constants.EthtoolFilter.IPv6Placeholder:
+		if !f.isIPv6() {
+			return errors.New(s + " cannot be used with flowType " + f.FlowType)
+		}
+		return nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return errors.New("must be a valid IP address or one of " + constants.EthtoolFilter.IPPlaceholder + ", " +
+			constants.EthtoolFilter.IPv4Placeholder + ", " + constants.EthtoolFilter.IPv6Placeholder)
+	}
+	if f.isIPv6() == (ip.To4() != nil) {
+		return errors.New("IP address version does not match flowType " + f.FlowType)
+	}
+
+	return nil
+}
+
+/*
+UsesIPPlaceholder returns true if the filter contains any of the pod IP placeholders
+*/
+func (f *EthtoolFilter) UsesIPPlaceholder() bool {
+	return isIPPlaceholder(f.SrcIP) || isIPPlaceholder(f.DstIP)
+}
+
+func (f *EthtoolFilter) isL4() bool {
+	return strings.HasPrefix(f.FlowType, "tcp") || strings.HasPrefix(f.FlowType, "udp") || strings.HasPrefix(f.FlowType, "sctp")
+}
+
+func (f *EthtoolFilter) isIPv6() bool {
+	return strings.HasSuffix(f.FlowType, "6")
+}
+
+/*
+isDualStack returns true if the filter is written for any IP family, meaning it
+uses the -ip- placeholder and no family specific addresses or placeholders
+*/
+func (f *EthtoolFilter) isDualStack() bool {
+	generic := false
+	for _, value := range []string{f.SrcIP, f.DstIP} {
+		switch value {
+		case "":
+		case constants.EthtoolFilter.IPPlaceholder:
+			generic = true
+		default:
+			return false
+		}
+	}
+	return generic
+}
+
+/*
+String returns the filter in ethtool ntuple syntax, for logging
+*/
+func (f *EthtoolFilter) String() string {
+	params, _ := f.params(f.FlowType, func(value string) (string, error) { return value, nil })
+	return strings.Join(params, " ")
+}
+
+/*
+rules translates the filter into the ethtool ntuple parameters of one or more rules.
+A filter using only the -ip- placeholder produces one rule for each IP family the pod
+has an address in, with the flow type converted to that family, so a udp4 filter also
+produces a udp6 rule for a dual-stack pod. Any rule location applies to the first rule.
+*/
+func (f *EthtoolFilter) rules(ipAddrs []string) ([][]string, error) {
+	var rules [][]string
+
+	families := []bool{f.isIPv6()}
+	if f.isDualStack() {
+		families = []bool{false, true}
+	}
+
+	for _, v6 := range families {
+		if f.isDualStack() && podIP(ipAddrs, v6) == "" {
+			continue
+		}
+		params, err := f.params(familyFlowType(f.FlowType, v6), func(value string) (string, error) {
+			return resolveIPPlaceholder(value, ipAddrs, v6)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) > 0 && f.Loc != nil {
+			params = params[:len(params)-2]
+		}
+		rules = append(rules, params)
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s placeholder used but no pod IP address available", constants.EthtoolFilter.IPPlaceholder)
+	}
+
+	return rules, nil
+}
+
+/*
+params translates the filter into ethtool ntuple parameters for the given flow type.
+IP fields are passed through resolve, to replace any placeholders. The loc parameter
+is always last.
+*/
+func (f *EthtoolFilter) params(flowType string, resolve func(string) (string, error)) ([]string, error) {
+	params := []string{"flow-type", flowType}
+
+	for _, field := range []struct {
+		name  string
+		value string
+	}{{"src-ip", f.SrcIP}, {"dst-ip", f.DstIP}} {
+		if field.value == "" {
+			continue
+		}
+		value, err := resolve(field.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.name, err)
+		}
+		params = append(params, field.name, value)
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{
+		{"src-port", f.SrcPort},
+		{"dst-port", f.DstPort},
+		{"l4proto", f.L4Proto},
+		{"action", f.Action},
+		{"context", f.Context},
+		{"loc", f.Loc},
+	} {
+		if field.value != nil {
+			params = append(params, field.name, strconv.Itoa(*field.value))
+		}
+	}
+
+	return params, nil
+}
+
+/*
+isIPPlaceholder returns true if value is one of the pod IP placeholders
+*/
+func isIPPlaceholder(value string) bool {
+	return value == constants.EthtoolFilter.IPPlaceholder ||
+		value == constants.EthtoolFilter.IPv4Placeholder ||
+		value == constants.EthtoolFilter.IPv6Placeholder
+}
+
+/*
+resolveIPPlaceholder replaces a pod IP placeholder with the matching pod address.
+The -ip- placeholder takes the address of the family given by v6. Values that are
+not placeholders are returned unchanged.
+*/
+func resolveIPPlaceholder(value string, ipAddrs []string, v6 bool) (string, error) {
+	switch value {
+	case constants.EthtoolFilter.IPPlaceholder:
+	case constants.EthtoolFilter.IPv4Placeholder:
+		v6 = false
+	case constants.EthtoolFilter.IPv6Placeholder:
+		v6 = true
+	default:
+		return value, nil
+	}
+
+	ip := podIP(ipAddrs, v6)
+	if ip == "" {
+		family := "IPv4"
+		if v6 {
+			family = "IPv6"
+		}
+		return "", fmt.Errorf("%s placeholder used but the pod has no %s address", value, family)
+	}
+
+	return ip, nil
+}
+
+/*
+podIP returns the first address of the requested IP family in ipAddrs,
+or an empty string if there is none
+*/
+func podIP(ipAddrs []string, v6 bool) string {
+	for _, addr := range ipAddrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		if (ip.To4() == nil) == v6 {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+/*
+familyFlowType converts a flow type to its IPv4 or IPv6 variant, udp4 becomes udp6
+*/
+func familyFlowType(flowType string, v6 bool) string {
+	base := strings.TrimRight(flowType, "46")
+	if v6 {
+		return base + "6"
+	}
+	return base + "4"
+}
+
+/*
+SetEthtoolFilters takes a list of structured filters and inserts them as ntuple rules
+on the device, replacing IP placeholders with the pod addresses in ipAddrs. It returns
+the locations of the inserted rules. If a filter fails, the rules already inserted by
+this call are removed. The ntuple feature is turned on if needed, see enableNtuple.
+*/
+func (r *handler) SetEthtoolFilters(filters []*EthtoolFilter, interfaceName string, ipAddrs []string) ([]uint32, error) {
+	var locations []uint32
+
+	for _, filter := range filters {
+		rules, err := filter.rules(ipAddrs)
+		for i := 0; err == nil && i < len(rules); i++ {
+			var op ethtoolOp
+			op, err = parseNtuple(interfaceName, rules[i])
+			if err == nil {
+				err = op.apply()
+			}
+			if err == nil {
+				locations = append(locations, op.(*ntupleOp).location)
+				logging.Debugf("Ethtool filter [%s] successfully applied", strings.Join(rules[i], " "))
+			}
+		}
+		if err != nil {
+			logging.Errorf("Error setting ethtool filter [%s]: %v", filter, err)
+			if delErr := r.DeleteEthtoolRules(interfaceName, locations); delErr != nil {
+				logging.Warningf("Failed to remove ethtool filters after error: %v", delErr)
+			}
+			return nil, err
+		}
+	}
+
+	return locations, nil
+}
+
+/*
+DeleteEthtoolRules removes the ntuple rules at the given locations from the device.
+All locations are attempted and the first error is returned. If these were the last
+rules on the device, the ntuple feature is restored, see restoreNtuple.
+*/
+func (r *handler) DeleteEthtoolRules(interfaceName string, locations []uint32) error {
+	var firstErr error
+
+	for _, loc := range locations {
+		if err := deleteRule(interfaceName, loc); err != nil {
+			err = &EthtoolError{Device: interfaceName, Op: "ntuple delete", Err: err}
+			logging.Warningf("Error removing ethtool filter at location %d: %v", loc, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if err := restoreNtuple(interfaceName); err != nil {
+		logging.Warningf("Error restoring ntuple feature of device %s: %v", interfaceName, err)
+	}
+
+	return firstErr
+}
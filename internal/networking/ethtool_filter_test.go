@@ -0,0 +1,122 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestEthtoolFilterRules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filter   EthtoolFilter
+		ipAddrs  []string
+		expRules []string
+		expError string
+	}{
+		{
+			name:     "address without placeholders",
+			filter:   EthtoolFilter{FlowType: "tcp6", SrcIP: "fd00::1", Action: intPtr(-1)},
+			ipAddrs:  dualStack,
+			expRules: []string{"flow-type tcp6 src-ip fd00::1 action -1"},
+		},
+		{
+			name:     "generic placeholder on an IPv4 pod",
+			filter:   EthtoolFilter{FlowType: "udp4", DstIP: "-ip-", DstPort: intPtr(4789), Action: intPtr(3)},
+			ipAddrs:  ipv4Only,
+			expRules: []string{"flow-type udp4 dst-ip 192.168.1.200 dst-port 4789 action 3"},
+		},
+		{
+			name:     "generic placeholder on an IPv6 pod",
+			filter:   EthtoolFilter{FlowType: "udp4", DstIP: "-ip-", DstPort: intPtr(4789), Action: intPtr(3)},
+			ipAddrs:  ipv6Only,
+			expRules: []string{"flow-type udp6 dst-ip fd00::c8 dst-port 4789 action 3"},
+		},
+		{
+			name:    "generic placeholder on a dual-stack pod",
+			filter:  EthtoolFilter{FlowType: "udp4", DstIP: "-ip-", DstPort: intPtr(4789), Action: intPtr(3)},
+			ipAddrs: dualStack,
+			expRules: []string{
+				"flow-type udp4 dst-ip 192.168.1.200 dst-port 4789 action 3",
+				"flow-type udp6 dst-ip fd00::c8 dst-port 4789 action 3",
+			},
+		},
+		{
+			name:    "location applies to the first rule only",
+			filter:  EthtoolFilter{FlowType: "ip6", SrcIP: "-ip-", L4Proto: intPtr(17), Action: intPtr(2), Loc: intPtr(10)},
+			ipAddrs: dualStack,
+			expRules: []string{
+				"flow-type ip4 src-ip 192.168.1.200 l4proto 17 action 2 loc 10",
+				"flow-type ip6 src-ip fd00::c8 l4proto 17 action 2",
+			},
+		},
+		{
+			name:     "generic placeholder with no pod address",
+			filter:   EthtoolFilter{FlowType: "udp4", DstIP: "-ip-", Action: intPtr(3)},
+			ipAddrs:  nil,
+			expError: "no pod IP address available",
+		},
+		{
+			name:     "IPv4 placeholder on a dual-stack pod",
+			filter:   EthtoolFilter{FlowType: "tcp4", SrcIP: "-ip4-", Action: intPtr(2)},
+			ipAddrs:  dualStack,
+			expRules: []string{"flow-type tcp4 src-ip 192.168.1.200 action 2"},
+		},
+		{
+			name:     "IPv6 placeholder on a dual-stack pod",
+			filter:   EthtoolFilter{FlowType: "udp6", DstIP: "-ip6-", Action: intPtr(1), Context: intPtr(1)},
+			ipAddrs:  dualStack,
+			expRules: []string{"flow-type udp6 dst-ip fd00::c8 action 1 context 1"},
+		},
+		{
+			name:     "IPv6 placeholder on an IPv4 pod",
+			filter:   EthtoolFilter{FlowType: "udp6", DstIP: "-ip6-", Action: intPtr(1)},
+			ipAddrs:  ipv4Only,
+			expError: "dst-ip: -ip6- placeholder used but the pod has no IPv6 address",
+		},
+		{
+			name:     "generic and family placeholders together",
+			filter:   EthtoolFilter{FlowType: "udp4", SrcIP: "-ip-", DstIP: "-ip4-", Action: intPtr(3)},
+			ipAddrs:  dualStack,
+			expRules: []string{"flow-type udp4 src-ip 192.168.1.200 dst-ip 192.168.1.200 action 3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := tc.filter.rules(tc.ipAddrs)
+			if tc.expError != "" {
+				require.Error(t, err, "Expected an error")
+				assert.Contains(t, err.Error(), tc.expError, "Unexpected error message")
+				return
+			}
+			require.NoError(t, err, "Unexpected error")
+			var joined []string
+			for _, rule := range rules {
+				joined = append(joined, strings.Join(rule, " "))
+			}
+			assert.Equal(t, tc.expRules, joined, "Unexpected rules")
+		})
+	}
+}
@@ -0,0 +1,453 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	_ethtool "github.com/safchain/ethtool"
+	logging "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+/*
+ethtool ioctl commands and structures, see include/uapi/linux/ethtool.h
+*/
+const (
+	siocEthtool         = 0x8946 // SIOCETHTOOL
+	ifNameSize          = 16     // IFNAMSIZ
+	ethtoolGetRingParam = 0x10   // ETHTOOL_GRINGPARAM
+	ethtoolSetRingParam = 0x11   // ETHTOOL_SRINGPARAM
+	ethtoolGetRxRings   = 0x2d   // ETHTOOL_GRXRINGS
+	ethtoolGetRuleCount = 0x2e   // ETHTOOL_GRXCLSRLCNT
+	ethtoolGetRule      = 0x2f   // ETHTOOL_GRXCLSRULE
+	ethtoolGetRuleAll   = 0x30   // ETHTOOL_GRXCLSRLALL
+	ethtoolDelRule      = 0x31   // ETHTOOL_SRXCLSRLDEL
+	ethtoolInsRule      = 0x32   // ETHTOOL_SRXCLSRLINS
+	ethtoolGetRxfhIndir = 0x38   // ETHTOOL_GRXFHINDIR
+	ethtoolSetRxfhIndir = 0x39   // ETHTOOL_SRXFHINDIR
+
+	rxClsLocAny     = 0xffffffff         // RX_CLS_LOC_ANY, let the driver choose a rule location
+	rxClsLocSpecial = 0x80000000         // RX_CLS_LOC_SPECIAL, driver supports special rule locations
+	rxClsFlowDisc   = 0xffffffffffffffff // RX_CLS_FLOW_DISC, drop matching packets
+	flowRss         = 0x20000000         // FLOW_RSS, rule directs to an RSS context
+)
+
+/*
+ifreq mirrors struct ifreq. data is held as a pointer, so the ethtool command structure it
+points to is kept alive and in place by the garbage collector during the ioctl.
+*/
+type ifreq struct {
+	name [ifNameSize]byte
+	data unsafe.Pointer
+	_    [16]byte
+}
+
+/*
+ethtoolRxFlowSpec mirrors struct ethtool_rx_flow_spec.
+The flow union and the flow extension are held as raw bytes.
+*/
+type ethtoolRxFlowSpec struct {
+	FlowType   uint32
+	HU         [52]byte
+	HExt       [20]byte
+	MU         [52]byte
+	MExt       [20]byte
+	RingCookie uint64
+	Location   uint32
+}
+
+/*
+ethtoolRxnfc mirrors struct ethtool_rxnfc, without the trailing rule_locs array.
+*/
+type ethtoolRxnfc struct {
+	Cmd      uint32
+	FlowType uint32
+	Data     uint64
+	Fs       ethtoolRxFlowSpec
+	RuleCnt  uint32
+}
+
+/*
+ethtoolRingParam mirrors struct ethtool_ringparam.
+*/
+type ethtoolRingParam struct {
+	Cmd               uint32
+	RxMaxPending      uint32
+	RxMiniMaxPending  uint32
+	RxJumboMaxPending uint32
+	TxMaxPending      uint32
+	RxPending         uint32
+	RxMiniPending     uint32
+	RxJumboPending    uint32
+	TxPending         uint32
+}
+
+/*
+ethtoolIoctl issues a SIOCETHTOOL ioctl against the named interface.
+data must point to an ethtool command structure.
+*/
+func ethtoolIoctl(interfaceName string, data unsafe.Pointer) error {
+	if len(interfaceName) >= ifNameSize {
+		return fmt.Errorf("interface name %s is too long", interfaceName)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, syscall.IPPROTO_IP)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var ifr ifreq
+	copy(ifr.name[:], interfaceName)
+	ifr.data = data
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), siocEthtool, uintptr(unsafe.Pointer(&ifr)))
+	runtime.KeepAlive(&ifr)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+/*
+getRxRings returns the number of RX rings the device currently uses for RSS.
+*/
+func getRxRings(interfaceName string) (uint32, error) {
+	nfc := ethtoolRxnfc{Cmd: ethtoolGetRxRings}
+	if err := ethtoolIoctl(interfaceName, unsafe.Pointer(&nfc)); err != nil {
+		return 0, err
+	}
+	return uint32(nfc.Data), nil
+}
+
+/*
+getRssTable returns the RSS indirection table of the device.
+*/
+func getRssTable(interfaceName string) ([]uint32, error) {
+	// first call with a size of zero returns the table size
+	header := []uint32{ethtoolGetRxfhIndir, 0}
+	if err := ethtoolIoctl(interfaceName, unsafe.Pointer(&header[0])); err != nil {
+		return nil, err
+	}
+
+	size := header[1]
+	if size == 0 {
+		return []uint32{}, nil
+	}
+
+	buf := make([]uint32, 2+size)
+	buf[0] = ethtoolGetRxfhIndir
+	buf[1] = size
+	if err := ethtoolIoctl(interfaceName, unsafe.Pointer(&buf[0])); err != nil {
+		return nil, err
+	}
+
+	return buf[2:], nil
+}
+
+/*
+setRssTable writes the RSS indirection table of the device.
+An empty table resets the device to its default indirection table.
+*/
+func setRssTable(interfaceName string, table []uint32) error {
+	buf := make([]uint32, 2+len(table))
+	buf[0] = ethtoolSetRxfhIndir
+	buf[1] = uint32(len(table))
+	copy(buf[2:], table)
+
+	return ethtoolIoctl(interfaceName, unsafe.Pointer(&buf[0]))
+}
+
+/*
+isDefaultRssTable returns true if table matches the kernel default spread of
+entries across rxRings, see ethtool_rxfh_indir_default().
+*/
+func isDefaultRssTable(table []uint32, rxRings uint32) bool {
+	if rxRings == 0 {
+		return false
+	}
+	for i, ring := range table {
+		if ring != uint32(i)%rxRings {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+getRingParam returns the current and maximum ring sizes of the device.
+*/
+func getRingParam(interfaceName string) (*ethtoolRingParam, error) {
+	rings := ethtoolRingParam{Cmd: ethtoolGetRingParam}
+	if err := ethtoolIoctl(interfaceName, unsafe.Pointer(&rings)); err != nil {
+		return nil, err
+	}
+	return &rings, nil
+}
+
+/*
+setRingParam sets the ring sizes of the device to the pending values in rings.
+*/
+func setRingParam(interfaceName string, rings *ethtoolRingParam) error {
+	rings.Cmd = ethtoolSetRingParam
+	return ethtoolIoctl(interfaceName, unsafe.Pointer(rings))
+}
+
+/*
+insertRule inserts an ntuple rule. If spec.Location is rxClsLocAny and the driver does
+not choose locations itself, the first free location is used. An explicit location that
+already holds a rule is rejected, rather than overwriting a rule that may belong to
+another attachment. The location of the inserted rule is returned.
+*/
+func insertRule(interfaceName string, spec ethtoolRxFlowSpec, rssContext uint32) (uint32, error) {
+	unlock := lockRuleTable(interfaceName)
+	defer unlock()
+
+	if err := enableNtuple(interfaceName); err != nil {
+		return 0, err
+	}
+
+	locs, tableSize, special, err := getRuleLocations(interfaceName)
+	if err != nil {
+		return 0, err
+	}
+	if spec.Location == rxClsLocAny {
+		if !special {
+			loc, err := freeRuleLocation(locs, tableSize)
+			if err != nil {
+				return 0, err
+			}
+			spec.Location = loc
+		}
+	} else {
+		for _, loc := range locs {
+			if loc == spec.Location {
+				return 0, fmt.Errorf("ntuple rule location %d is already in use", loc)
+			}
+		}
+	}
+
+	nfc := ethtoolRxnfc{
+		Cmd:      ethtoolInsRule,
+		FlowType: spec.FlowType,
+		Fs:       spec,
+		RuleCnt:  rssContext, // rss_context shares a union with rule_cnt
+	}
+	if err := ethtoolIoctl(interfaceName, unsafe.Pointer(&nfc)); err != nil {
+		return 0, err
+	}
+
+	return nfc.Fs.Location, nil
+}
+
+/*
+lockRuleTable takes an exclusive lock on the ntuple rule table of a device, so that
+concurrent CNI invocations sharing a port do not claim the same rule location.
+If the lock file cannot be opened, the insert goes ahead without the lock.
+*/
+func lockRuleTable(interfaceName string) func() {
+	lockDir := constants.EthtoolFilter.LockDir
+	if err := os.MkdirAll(lockDir, 0700); err != nil {
+		logging.Debugf("Unable to create ethtool lock directory %s: %v", lockDir, err)
+		return func() {}
+	}
+
+	f, err := os.OpenFile(filepath.Join(lockDir, "ntuple-"+interfaceName+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		logging.Debugf("Unable to open ethtool lock file for %s: %v", interfaceName, err)
+		return func() {}
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		logging.Debugf("Unable to lock ethtool rule table of %s: %v", interfaceName, err)
+		f.Close()
+		return func() {}
+	}
+
+	return func() {
+		unix.Flock(int(f.Fd()), unix.LOCK_UN)
+		f.Close()
+	}
+}
+
+/*
+enableNtuple turns on the ntuple feature of the device, if it is off. A marker file records
+that the feature was turned on by the plugin, so that restoreNtuple turns it back off once
+the last rule is removed. It must be called with the rule table locked.
+*/
+func enableNtuple(interfaceName string) error {
+	enabled, err := ntupleEnabled(interfaceName)
+	if err != nil || enabled {
+		return err
+	}
+
+	if err := os.WriteFile(ntupleMarker(interfaceName), nil, 0600); err != nil {
+		logging.Warningf("Unable to record ntuple state of %s, it will not be restored: %v", interfaceName, err)
+	}
+
+	return flowDirector(interfaceName, true)
+}
+
+/*
+restoreNtuple turns the ntuple feature of the device back off if it was turned on by
+enableNtuple and no ntuple rules are left on the device. The device may be a port shared
+by many pods, so the feature stays on while any of their rules remain.
+*/
+func restoreNtuple(interfaceName string) error {
+	unlock := lockRuleTable(interfaceName)
+	defer unlock()
+
+	marker := ntupleMarker(interfaceName)
+	if _, err := os.Stat(marker); err != nil {
+		return nil
+	}
+
+	locs, _, _, err := getRuleLocations(interfaceName)
+	if err != nil {
+		return err
+	}
+	if len(locs) > 0 {
+		return nil
+	}
+
+	if err := flowDirector(interfaceName, false); err != nil {
+		return err
+	}
+	return os.Remove(marker)
+}
+
+/*
+ntupleEnabled returns true if the ntuple feature of the device is on.
+*/
+func ntupleEnabled(interfaceName string) (bool, error) {
+	e, err := _ethtool.NewEthtool()
+	if err != nil {
+		return false, &EthtoolError{Device: interfaceName, Op: "features", Err: err}
+	}
+	defer e.Close()
+
+	features, err := e.Features(interfaceName)
+	if err != nil {
+		return false, &EthtoolError{Device: interfaceName, Op: "features", Err: err}
+	}
+	return features[ntupleFeature], nil
+}
+
+/*
+ntupleMarker returns the path of the file recording that the plugin turned on the
+ntuple feature of the device.
+*/
+func ntupleMarker(interfaceName string) string {
+	return filepath.Join(constants.EthtoolFilter.LockDir, "ntuple-"+interfaceName+".enabled")
+}
+
+/*
+deleteRule deletes the ntuple rule at location loc.
+*/
+func deleteRule(interfaceName string, loc uint32) error {
+	nfc := ethtoolRxnfc{Cmd: ethtoolDelRule}
+	nfc.Fs.Location = loc
+	return ethtoolIoctl(interfaceName, unsafe.Pointer(&nfc))
+}
+
+/*
+getRuleLocations returns the locations of all ntuple rules on the device, the size of the
+rule table, and whether the driver supports choosing rule locations itself.
+*/
+func getRuleLocations(interfaceName string) ([]uint32, uint32, bool, error) {
+	count := ethtoolRxnfc{Cmd: ethtoolGetRuleCount}
+	if err := ethtoolIoctl(interfaceName, unsafe.Pointer(&count)); err != nil {
+		return nil, 0, false, err
+	}
+	special := count.Data&rxClsLocSpecial != 0
+
+	// rule_locs is a flexible array following struct ethtool_rxnfc
+	locsOffset := unsafe.Offsetof(count.RuleCnt) + 4
+	buf := make([]uint64, (locsOffset+uintptr(count.RuleCnt)*4+7)/8)
+	all := (*ethtoolRxnfc)(unsafe.Pointer(&buf[0]))
+	all.Cmd = ethtoolGetRuleAll
+	all.RuleCnt = count.RuleCnt
+	if err := ethtoolIoctl(interfaceName, unsafe.Pointer(&buf[0])); err != nil {
+		return nil, 0, false, err
+	}
+
+	locs := make([]uint32, all.RuleCnt)
+	for i := range locs {
+		locs[i] = *(*uint32)(unsafe.Pointer(uintptr(unsafe.Pointer(&buf[0])) + locsOffset + uintptr(i)*4))
+	}
+
+	return locs, uint32(all.Data), special, nil
+}
+
+/*
+getRule returns the ntuple rule at location loc.
+*/
+func getRule(interfaceName string, loc uint32) (*ethtoolRxFlowSpec, error) {
+	nfc := ethtoolRxnfc{Cmd: ethtoolGetRule}
+	nfc.Fs.Location = loc
+	if err := ethtoolIoctl(interfaceName, unsafe.Pointer(&nfc)); err != nil {
+		return nil, err
+	}
+	return &nfc.Fs, nil
+}
+
+/*
+getRuleQueues returns the queues the ntuple rules of the device steer packets to. Rules that
+drop packets or direct them to an RSS context are skipped, their queues are in the RSS table.
+*/
+func getRuleQueues(interfaceName string) ([]uint32, error) {
+	locs, _, _, err := getRuleLocations(interfaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var queues []uint32
+	for _, loc := range locs {
+		rule, err := getRule(interfaceName, loc)
+		if err != nil {
+			return nil, err
+		}
+		if rule.RingCookie == rxClsFlowDisc || rule.FlowType&flowRss != 0 {
+			continue
+		}
+		queues = append(queues, uint32(rule.RingCookie))
+	}
+	return queues, nil
+}
+
+/*
+freeRuleLocation returns the first rule location not in use, searching from the end of
+the table as the ethtool binary does.
+*/
+func freeRuleLocation(locs []uint32, tableSize uint32) (uint32, error) {
+	used := make(map[uint32]bool, len(locs))
+	for _, loc := range locs {
+		used[loc] = true
+	}
+	for loc := tableSize; loc > 0; loc-- {
+		if !used[loc-1] {
+			return loc - 1, nil
+		}
+	}
+	return 0, fmt.Errorf("no free ntuple rule locations, table size %d", tableSize)
+}
@@ -0,0 +1,621 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	_ethtool "github.com/safchain/ethtool"
+	logging "github.com/sirupsen/logrus"
+)
+
+/*
+ethtool flow types, see include/uapi/linux/ethtool.h
+*/
+const (
+	tcpV4Flow    = 0x01 // TCP_V4_FLOW
+	udpV4Flow    = 0x02 // UDP_V4_FLOW
+	sctpV4Flow   = 0x03 // SCTP_V4_FLOW
+	tcpV6Flow    = 0x05 // TCP_V6_FLOW
+	udpV6Flow    = 0x06 // UDP_V6_FLOW
+	sctpV6Flow   = 0x07 // SCTP_V6_FLOW
+	ipV4UserFlow = 0x0d // IPV4_USER_FLOW
+	ipV6UserFlow = 0x0e // IPV6_USER_FLOW
+	etherFlow    = 0x12 // ETHER_FLOW
+	ethRxNfcIp4  = 1    // ETH_RX_NFC_IP4
+)
+
+var flowTypes = map[string]uint32{
+	"tcp4":  tcpV4Flow,
+	"udp4":  udpV4Flow,
+	"sctp4": sctpV4Flow,
+	"ip4":   ipV4UserFlow,
+	"tcp6":  tcpV6Flow,
+	"udp6":  udpV6Flow,
+	"sctp6": sctpV6Flow,
+	"ip6":   ipV6UserFlow,
+	"ether": etherFlow,
+}
+
+/*
+featureAliases maps the short feature names accepted by the ethtool binary to kernel feature names
+*/
+var featureAliases = map[string]string{
+	"ntuple": ntupleFeature,
+	"rxhash": "rx-hashing",
+	"rxvlan": "rx-vlan-hw-parse",
+	"txvlan": "tx-vlan-hw-insert",
+	"gro":    "rx-gro",
+	"lro":    "rx-lro",
+	"rx":     "rx-checksum",
+}
+
+/*
+ethtoolOp is an ethtool command that can be applied through the native backend
+*/
+type ethtoolOp interface {
+	apply() error
+}
+
+/*
+parseEthtoolCmd takes an ethtool command line, split into arguments, and returns the
+native operation for it. Commands and options the native backend does not implement
+return errNativeUnsupported. The supported subset is:
+
+	-X|--set-rxfh-indir|--rxfh <dev> equal <n> [start <n>] | weight <w...> | default
+	-N|-U|--config-ntuple|--config-nfc <dev> flow-type <type> [options] | delete <loc>
+	-L|--set-channels <dev> [rx <n>] [tx <n>] [other <n>] [combined <n>]
+	-G|--set-ring <dev> [rx <n>] [tx <n>]
+	-K|--features|--offload <dev> <feature> on|off ...
+*/
+func parseEthtoolCmd(args []string) (ethtoolOp, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("ethtool command [%s] is missing a device", strings.Join(args, " "))
+	}
+	device, params := args[1], args[2:]
+
+	switch args[0] {
+	case "-X", "--set-rxfh-indir", "--rxfh":
+		return parseRss(device, params)
+	case "-N", "-U", "--config-ntuple", "--config-nfc":
+		return parseNtuple(device, params)
+	case "-L", "--set-channels":
+		return parseChannels(device, params)
+	case "-G", "--set-ring":
+		return parseRings(device, params)
+	case "-K", "--features", "--offload":
+		return parseFeatures(device, params)
+	}
+
+	return nil, fmt.Errorf("command %s %w", args[0], errNativeUnsupported)
+}
+
+/*
+rssOp sets the RSS indirection table, see parseRss
+*/
+type rssOp struct {
+	device  string
+	start   uint32
+	equal   uint32
+	weights []uint32
+	reset   bool
+}
+
+func parseRss(device string, params []string) (ethtoolOp, error) {
+	op := &rssOp{device: device}
+
+	if len(params) == 1 && params[0] == "default" {
+		op.reset = true
+		return op, nil
+	}
+
+	for i := 0; i < len(params); i++ {
+		switch params[i] {
+		case "equal":
+			n, err := parseUint(params, &i)
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("RSS equal must be at least 1")
+			}
+			op.equal = n
+			op.weights = nil
+		case "weight":
+			op.equal = 0
+			for i+1 < len(params) {
+				w, err := strconv.ParseUint(params[i+1], 10, 32)
+				if err != nil {
+					break
+				}
+				op.weights = append(op.weights, uint32(w))
+				i++
+			}
+		case "start":
+			n, err := parseUint(params, &i)
+			if err != nil {
+				return nil, err
+			}
+			op.start = n
+		default:
+			return nil, fmt.Errorf("RSS option %s %w", params[i], errNativeUnsupported)
+		}
+	}
+
+	if op.equal == 0 && len(op.weights) == 0 {
+		return nil, fmt.Errorf("RSS command requires equal, weight or default")
+	}
+
+	return op, nil
+}
+
+func (op *rssOp) apply() error {
+	if op.reset {
+		if err := setRssTable(op.device, []uint32{}); err != nil {
+			return &EthtoolError{Device: op.device, Op: "RSS reset", Err: err}
+		}
+		return nil
+	}
+
+	current, err := getRssTable(op.device)
+	if err != nil {
+		return &EthtoolError{Device: op.device, Op: "RSS get", Err: err}
+	}
+
+	var table []uint32
+	if op.equal > 0 {
+		table, err = rssEqualTable(len(current), op.start, op.equal)
+	} else {
+		table, err = rssTable(len(current), op.start, op.weights)
+	}
+	if err != nil {
+		return &EthtoolError{Device: op.device, Op: "RSS set", Err: err}
+	}
+
+	if err := setRssTable(op.device, table); err != nil {
+		return &EthtoolError{Device: op.device, Op: "RSS set", Err: err}
+	}
+	return nil
+}
+
+/*
+rssEqualTable fills a table of size entries round robin across n queues, the first
+queue being start. This matches the ethtool binary, which uses the kernel's default
+indirection for equal rather than its weight distribution.
+*/
+func rssEqualTable(size int, start uint32, n uint32) ([]uint32, error) {
+	if n == 0 || size == 0 {
+		return nil, fmt.Errorf("invalid RSS queue count or table size")
+	}
+
+	table := make([]uint32, size)
+	for i := range table {
+		table[i] = start + uint32(i)%n
+	}
+	return table, nil
+}
+
+/*
+rssTable spreads a table of size entries across queues in proportion to weights,
+the first queue being start. This matches the ethtool binary's weight distribution.
+*/
+func rssTable(size int, start uint32, weights []uint32) ([]uint32, error) {
+	var sum uint64
+	for _, w := range weights {
+		sum += uint64(w)
+	}
+	if sum == 0 || size == 0 {
+		return nil, fmt.Errorf("invalid RSS weights or table size")
+	}
+
+	table := make([]uint32, size)
+	var partial uint64
+	queue := 0
+	for i := range table {
+		for uint64(i) >= uint64(size)*(partial+uint64(weights[queue]))/sum {
+			partial += uint64(weights[queue])
+			queue++
+		}
+		table[i] = start + uint32(queue)
+	}
+	return table, nil
+}
+
+/*
+ntupleOp inserts or deletes an ntuple rule, see parseNtuple.
+After a successful insert, location holds the location of the rule.
+*/
+type ntupleOp struct {
+	device     string
+	spec       ethtoolRxFlowSpec
+	rssContext uint32
+	delete     bool
+	location   uint32
+}
+
+func parseNtuple(device string, params []string) (ethtoolOp, error) {
+	op := &ntupleOp{device: device}
+
+	if len(params) == 2 && params[0] == "delete" {
+		loc, err := strconv.ParseUint(params[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule location %s", params[1])
+		}
+		op.delete = true
+		op.location = uint32(loc)
+		return op, nil
+	}
+
+	if len(params) < 2 || params[0] != "flow-type" {
+		return nil, fmt.Errorf("ntuple command requires flow-type or delete")
+	}
+	flowType, ok := flowTypes[params[1]]
+	if !ok {
+		return nil, fmt.Errorf("flow-type %s %w", params[1], errNativeUnsupported)
+	}
+	op.spec.FlowType = flowType
+	op.spec.Location = rxClsLocAny
+	if flowType == ipV4UserFlow {
+		op.spec.HU[13] = ethRxNfcIp4 // ip_ver, must be set and not masked
+	}
+
+	for i := 2; i < len(params); i++ {
+		var err error
+		switch params[i] {
+		case "src-ip", "dst-ip":
+			err = op.setIP(params, &i)
+		case "src-port", "dst-port":
+			err = op.setPort(params, &i)
+		case "l4proto":
+			err = op.setProto(params, &i)
+		case "action":
+			if i+1 >= len(params) {
+				return nil, fmt.Errorf("action requires a value")
+			}
+			i++
+			var action int64
+			action, err = strconv.ParseInt(params[i], 10, 64)
+			if action < -1 {
+				err = fmt.Errorf("invalid action %s", params[i])
+			}
+			if action == -1 {
+				op.spec.RingCookie = rxClsFlowDisc
+			} else {
+				op.spec.RingCookie = uint64(action)
+			}
+		case "context":
+			var ctx uint32
+			ctx, err = parseUint(params, &i)
+			op.rssContext = ctx
+			op.spec.FlowType |= flowRss
+		case "loc":
+			var loc uint32
+			loc, err = parseUint(params, &i)
+			op.spec.Location = loc
+		default:
+			return nil, fmt.Errorf("ntuple option %s %w", params[i], errNativeUnsupported)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return op, nil
+}
+
+/*
+setIP sets the src-ip or dst-ip field of the flow spec, and its mask
+*/
+func (op *ntupleOp) setIP(params []string, i *int) error {
+	if *i+1 >= len(params) {
+		return fmt.Errorf("%s requires a value", params[*i])
+	}
+	field := params[*i]
+	*i++
+	ip := net.ParseIP(params[*i])
+	if ip == nil {
+		return fmt.Errorf("invalid %s %s", field, params[*i])
+	}
+
+	var offset, length int
+	switch op.spec.FlowType &^ flowRss {
+	case tcpV4Flow, udpV4Flow, sctpV4Flow, ipV4UserFlow:
+		if ip = ip.To4(); ip == nil {
+			return fmt.Errorf("%s %s is not an IPv4 address", field, params[*i])
+		}
+		offset, length = 0, net.IPv4len
+	case tcpV6Flow, udpV6Flow, sctpV6Flow, ipV6UserFlow:
+		if ip.To4() != nil {
+			return fmt.Errorf("%s %s is not an IPv6 address", field, params[*i])
+		}
+		offset, length = 0, net.IPv6len
+	default:
+		return fmt.Errorf("%s for this flow-type %w", field, errNativeUnsupported)
+	}
+	if field == "dst-ip" {
+		offset += length
+	}
+
+	copy(op.spec.HU[offset:offset+length], ip)
+	fill(op.spec.MU[offset : offset+length])
+	return nil
+}
+
+/*
+setPort sets the src-port or dst-port field of the flow spec, and its mask
+*/
+func (op *ntupleOp) setPort(params []string, i *int) error {
+	field := params[*i]
+	port, err := parseUint(params, i)
+	if err != nil {
+		return err
+	}
+	if port > 0xffff {
+		return fmt.Errorf("invalid %s %d", field, port)
+	}
+
+	var offset int
+	switch op.spec.FlowType &^ flowRss {
+	case tcpV4Flow, udpV4Flow, sctpV4Flow:
+		offset = 8
+	case tcpV6Flow, udpV6Flow, sctpV6Flow:
+		offset = 32
+	default:
+		return fmt.Errorf("%s for this flow-type %w", field, errNativeUnsupported)
+	}
+	if field == "dst-port" {
+		offset += 2
+	}
+
+	binary.BigEndian.PutUint16(op.spec.HU[offset:offset+2], uint16(port))
+	fill(op.spec.MU[offset : offset+2])
+	return nil
+}
+
+/*
+setProto sets the l4proto field of an ip4 or ip6 flow spec, and its mask
+*/
+func (op *ntupleOp) setProto(params []string, i *int) error {
+	proto, err := parseUint(params, i)
+	if err != nil {
+		return err
+	}
+	if proto > 0xff {
+		return fmt.Errorf("invalid l4proto %d", proto)
+	}
+
+	var offset int
+	switch op.spec.FlowType &^ flowRss {
+	case ipV4UserFlow:
+		offset = 14
+	case ipV6UserFlow:
+		offset = 37
+	default:
+		return fmt.Errorf("l4proto for this flow-type %w", errNativeUnsupported)
+	}
+
+	op.spec.HU[offset] = uint8(proto)
+	op.spec.MU[offset] = 0xff
+	return nil
+}
+
+func (op *ntupleOp) apply() error {
+	if op.delete {
+		if err := deleteRule(op.device, op.location); err != nil {
+			return &EthtoolError{Device: op.device, Op: "ntuple delete", Err: err}
+		}
+		return nil
+	}
+
+	loc, err := insertRule(op.device, op.spec, op.rssContext)
+	if err != nil {
+		return &EthtoolError{Device: op.device, Op: "ntuple insert", Err: err}
+	}
+	op.location = loc
+	logging.Debugf("Ntuple rule inserted on device %s at location %d", op.device, loc)
+	return nil
+}
+
+/*
+channelsOp sets channel counts, see parseChannels
+*/
+type channelsOp struct {
+	device   string
+	rx       *uint32
+	tx       *uint32
+	other    *uint32
+	combined *uint32
+}
+
+func parseChannels(device string, params []string) (ethtoolOp, error) {
+	op := &channelsOp{device: device}
+
+	for i := 0; i < len(params); i++ {
+		var target **uint32
+		switch params[i] {
+		case "rx":
+			target = &op.rx
+		case "tx":
+			target = &op.tx
+		case "other":
+			target = &op.other
+		case "combined":
+			target = &op.combined
+		default:
+			return nil, fmt.Errorf("channels option %s %w", params[i], errNativeUnsupported)
+		}
+		n, err := parseUint(params, &i)
+		if err != nil {
+			return nil, err
+		}
+		*target = &n
+	}
+
+	return op, nil
+}
+
+func (op *channelsOp) apply() error {
+	e, err := _ethtool.NewEthtool()
+	if err != nil {
+		return &EthtoolError{Device: op.device, Op: "channels", Err: err}
+	}
+	defer e.Close()
+
+	channels, err := e.GetChannels(op.device)
+	if err != nil {
+		return &EthtoolError{Device: op.device, Op: "channels", Err: err}
+	}
+	if op.rx != nil {
+		channels.RxCount = *op.rx
+	}
+	if op.tx != nil {
+		channels.TxCount = *op.tx
+	}
+	if op.other != nil {
+		channels.OtherCount = *op.other
+	}
+	if op.combined != nil {
+		channels.CombinedCount = *op.combined
+	}
+
+	if _, err := e.SetChannels(op.device, channels); err != nil {
+		return &EthtoolError{Device: op.device, Op: "channels", Err: err}
+	}
+	return nil
+}
+
+/*
+ringsOp sets ring sizes, see parseRings
+*/
+type ringsOp struct {
+	device string
+	rx     *uint32
+	tx     *uint32
+}
+
+func parseRings(device string, params []string) (ethtoolOp, error) {
+	op := &ringsOp{device: device}
+
+	for i := 0; i < len(params); i++ {
+		var target **uint32
+		switch params[i] {
+		case "rx":
+			target = &op.rx
+		case "tx":
+			target = &op.tx
+		default:
+			return nil, fmt.Errorf("ring option %s %w", params[i], errNativeUnsupported)
+		}
+		n, err := parseUint(params, &i)
+		if err != nil {
+			return nil, err
+		}
+		*target = &n
+	}
+
+	return op, nil
+}
+
+func (op *ringsOp) apply() error {
+	rings, err := getRingParam(op.device)
+	if err != nil {
+		return &EthtoolError{Device: op.device, Op: "rings", Err: err}
+	}
+	if op.rx != nil {
+		rings.RxPending = *op.rx
+	}
+	if op.tx != nil {
+		rings.TxPending = *op.tx
+	}
+
+	if err := setRingParam(op.device, rings); err != nil {
+		return &EthtoolError{Device: op.device, Op: "rings", Err: err}
+	}
+	return nil
+}
+
+/*
+featuresOp sets device features, see parseFeatures
+*/
+type featuresOp struct {
+	device   string
+	features map[string]bool
+}
+
+func parseFeatures(device string, params []string) (ethtoolOp, error) {
+	op := &featuresOp{device: device, features: make(map[string]bool)}
+
+	if len(params) == 0 || len(params)%2 != 0 {
+		return nil, fmt.Errorf("features command requires feature on|off pairs")
+	}
+	for i := 0; i < len(params); i += 2 {
+		name := params[i]
+		if alias, ok := featureAliases[name]; ok {
+			name = alias
+		}
+		switch params[i+1] {
+		case "on":
+			op.features[name] = true
+		case "off":
+			op.features[name] = false
+		default:
+			return nil, fmt.Errorf("feature %s must be on or off", params[i])
+		}
+	}
+
+	return op, nil
+}
+
+func (op *featuresOp) apply() error {
+	e, err := _ethtool.NewEthtool()
+	if err != nil {
+		return &EthtoolError{Device: op.device, Op: "features", Err: err}
+	}
+	defer e.Close()
+
+	if err := e.Change(op.device, op.features); err != nil {
+		return &EthtoolError{Device: op.device, Op: "features", Err: err}
+	}
+	return nil
+}
+
+/*
+parseUint parses the value following the option at params[*i] and advances *i past it
+*/
+func parseUint(params []string, i *int) (uint32, error) {
+	if *i+1 >= len(params) {
+		return 0, fmt.Errorf("%s requires a value", params[*i])
+	}
+	*i++
+	n, err := strconv.ParseUint(params[*i], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %s", params[*i-1], params[*i])
+	}
+	return uint32(n), nil
+}
+
+/*
+fill sets every byte of b to 0xff
+*/
+func fill(b []byte) {
+	for i := range b {
+		b[i] = 0xff
+	}
+}
@@ -0,0 +1,475 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func uint32Ptr(n uint32) *uint32 {
+	return &n
+}
+
+func TestParseEthtoolCmd(t *testing.T) {
+	testCases := []struct {
+		name           string
+		cmd            string
+		expOp          ethtoolOp
+		expError       string
+		expUnsupported bool
+	}{
+		{
+			name:     "missing device",
+			cmd:      "-X",
+			expError: "is missing a device",
+		},
+		{
+			name:           "unsupported command",
+			cmd:            "-A eth0 rx on",
+			expUnsupported: true,
+		},
+		{
+			name:  "rss equal",
+			cmd:   "-X eth0 equal 4",
+			expOp: &rssOp{device: "eth0", equal: 4},
+		},
+		{
+			name:  "rss equal with start",
+			cmd:   "--set-rxfh-indir eth0 equal 2 start 6",
+			expOp: &rssOp{device: "eth0", equal: 2, start: 6},
+		},
+		{
+			name:  "rss weight",
+			cmd:   "-X eth0 weight 1 2 0 1",
+			expOp: &rssOp{device: "eth0", weights: []uint32{1, 2, 0, 1}},
+		},
+		{
+			name:  "rss weight with start",
+			cmd:   "--rxfh eth0 weight 3 1 start 2",
+			expOp: &rssOp{device: "eth0", weights: []uint32{3, 1}, start: 2},
+		},
+		{
+			name:  "rss default",
+			cmd:   "-X eth0 default",
+			expOp: &rssOp{device: "eth0", reset: true},
+		},
+		{
+			name:     "rss equal zero",
+			cmd:      "-X eth0 equal 0",
+			expError: "RSS equal must be at least 1",
+		},
+		{
+			name:     "rss equal missing value",
+			cmd:      "-X eth0 equal",
+			expError: "equal requires a value",
+		},
+		{
+			name:     "rss start only",
+			cmd:      "-X eth0 start 2",
+			expError: "RSS command requires equal, weight or default",
+		},
+		{
+			name:           "rss hfunc",
+			cmd:            "-X eth0 hfunc toeplitz",
+			expUnsupported: true,
+		},
+		{
+			name:  "channels",
+			cmd:   "-L eth0 combined 4 rx 2",
+			expOp: &channelsOp{device: "eth0", combined: uint32Ptr(4), rx: uint32Ptr(2)},
+		},
+		{
+			name:  "channels long option",
+			cmd:   "--set-channels eth0 tx 1 other 1",
+			expOp: &channelsOp{device: "eth0", tx: uint32Ptr(1), other: uint32Ptr(1)},
+		},
+		{
+			name:     "channels invalid count",
+			cmd:      "-L eth0 combined four",
+			expError: "invalid combined value four",
+		},
+		{
+			name:           "channels unknown option",
+			cmd:            "-L eth0 queues 4",
+			expUnsupported: true,
+		},
+		{
+			name:  "rings",
+			cmd:   "-G eth0 rx 512 tx 1024",
+			expOp: &ringsOp{device: "eth0", rx: uint32Ptr(512), tx: uint32Ptr(1024)},
+		},
+		{
+			name:     "rings missing value",
+			cmd:      "--set-ring eth0 rx",
+			expError: "rx requires a value",
+		},
+		{
+			name:           "rings jumbo",
+			cmd:            "-G eth0 rx-jumbo 256",
+			expUnsupported: true,
+		},
+		{
+			name:  "features with aliases",
+			cmd:   "-K eth0 ntuple on rxhash off rx-gro on",
+			expOp: &featuresOp{device: "eth0", features: map[string]bool{ntupleFeature: true, "rx-hashing": false, "rx-gro": true}},
+		},
+		{
+			name:     "features missing state",
+			cmd:      "--features eth0 ntuple",
+			expError: "features command requires feature on|off pairs",
+		},
+		{
+			name:     "features invalid state",
+			cmd:      "--offload eth0 ntuple yes",
+			expError: "feature ntuple must be on or off",
+		},
+		{
+			name:     "ntuple missing flow-type",
+			cmd:      "-N eth0 dst-port 80",
+			expError: "ntuple command requires flow-type or delete",
+		},
+		{
+			name:  "ntuple delete",
+			cmd:   "-N eth0 delete 1023",
+			expOp: &ntupleOp{device: "eth0", delete: true, location: 1023},
+		},
+		{
+			name:     "ntuple delete invalid location",
+			cmd:      "-U eth0 delete all",
+			expError: "invalid rule location all",
+		},
+		{
+			name:           "ntuple unsupported flow-type",
+			cmd:            "-N eth0 flow-type ah4 action 1",
+			expUnsupported: true,
+		},
+		{
+			name:           "ntuple unsupported option",
+			cmd:            "-N eth0 flow-type udp4 vlan 10 action 1",
+			expUnsupported: true,
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			op, err := parseEthtoolCmd(strings.Fields(tc.cmd))
+
+			switch {
+			case tc.expUnsupported:
+				require.Error(t, err, "Expected error")
+				assert.True(t, errors.Is(err, errNativeUnsupported), "Expected errNativeUnsupported, got: "+err.Error())
+			case tc.expError != "":
+				require.Error(t, err, "Expected error")
+				assert.Contains(t, err.Error(), tc.expError, "Unexpected error")
+				assert.False(t, errors.Is(err, errNativeUnsupported), "Unexpected fallback to ethtool binary")
+			default:
+				require.NoError(t, err, "Unexpected error")
+				assert.Equal(t, tc.expOp, op, "Unexpected operation")
+			}
+		})
+	}
+}
+
+func TestParseNtuple(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cmd         string
+		expFlowType uint32
+		expHU       map[int][]byte
+		expMU       map[int][]byte
+		expCookie   uint64
+		expLocation uint32
+		expContext  uint32
+		expError    string
+	}{
+		{
+			name:        "udp4 destination",
+			cmd:         "-N eth0 flow-type udp4 dst-ip 192.168.1.10 dst-port 4789 action 3",
+			expFlowType: udpV4Flow,
+			expHU:       map[int][]byte{4: {192, 168, 1, 10}, 10: {0x12, 0xb5}},
+			expMU:       map[int][]byte{4: {0xff, 0xff, 0xff, 0xff}, 10: {0xff, 0xff}},
+			expCookie:   3,
+			expLocation: rxClsLocAny,
+		},
+		{
+			name:        "tcp4 source with location",
+			cmd:         "-N eth0 flow-type tcp4 src-ip 10.0.0.1 src-port 80 action 0 loc 7",
+			expFlowType: tcpV4Flow,
+			expHU:       map[int][]byte{0: {10, 0, 0, 1}, 8: {0x00, 0x50}},
+			expMU:       map[int][]byte{0: {0xff, 0xff, 0xff, 0xff}, 8: {0xff, 0xff}},
+			expLocation: 7,
+		},
+		{
+			name:        "ip4 protocol drop",
+			cmd:         "-N eth0 flow-type ip4 l4proto 17 action -1",
+			expFlowType: ipV4UserFlow,
+			expHU:       map[int][]byte{13: {ethRxNfcIp4}, 14: {17}},
+			expMU:       map[int][]byte{13: {0}, 14: {0xff}},
+			expCookie:   rxClsFlowDisc,
+			expLocation: rxClsLocAny,
+		},
+		{
+			name:        "udp6 destination",
+			cmd:         "-N eth0 flow-type udp6 dst-ip fd00::1 dst-port 53 action 1",
+			expFlowType: udpV6Flow,
+			expHU:       map[int][]byte{16: {0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, 34: {0x00, 0x35}},
+			expMU:       map[int][]byte{34: {0xff, 0xff}},
+			expCookie:   1,
+			expLocation: rxClsLocAny,
+		},
+		{
+			name:        "ip6 protocol",
+			cmd:         "-N eth0 flow-type ip6 l4proto 6 action 2",
+			expFlowType: ipV6UserFlow,
+			expHU:       map[int][]byte{37: {6}},
+			expMU:       map[int][]byte{37: {0xff}},
+			expCookie:   2,
+			expLocation: rxClsLocAny,
+		},
+		{
+			name:        "rss context",
+			cmd:         "-N eth0 flow-type tcp4 dst-port 443 context 1 action 0",
+			expFlowType: tcpV4Flow | flowRss,
+			expHU:       map[int][]byte{10: {0x01, 0xbb}},
+			expMU:       map[int][]byte{10: {0xff, 0xff}},
+			expContext:  1,
+			expLocation: rxClsLocAny,
+		},
+		{
+			name:     "ipv6 address on ipv4 flow",
+			cmd:      "-N eth0 flow-type udp4 dst-ip fd00::1",
+			expError: "dst-ip fd00::1 is not an IPv4 address",
+		},
+		{
+			name:     "ipv4 address on ipv6 flow",
+			cmd:      "-N eth0 flow-type tcp6 src-ip 10.0.0.1",
+			expError: "src-ip 10.0.0.1 is not an IPv6 address",
+		},
+		{
+			name:     "invalid address",
+			cmd:      "-N eth0 flow-type udp4 dst-ip 10.0.0",
+			expError: "invalid dst-ip 10.0.0",
+		},
+		{
+			name:     "port out of range",
+			cmd:      "-N eth0 flow-type udp4 dst-port 65536",
+			expError: "invalid dst-port 65536",
+		},
+		{
+			name:     "protocol out of range",
+			cmd:      "-N eth0 flow-type ip4 l4proto 256",
+			expError: "invalid l4proto 256",
+		},
+		{
+			name:     "invalid action",
+			cmd:      "-N eth0 flow-type udp4 action -2",
+			expError: "invalid action -2",
+		},
+		{
+			name:     "missing action",
+			cmd:      "-N eth0 flow-type udp4 action",
+			expError: "action requires a value",
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			op, err := parseEthtoolCmd(strings.Fields(tc.cmd))
+
+			if tc.expError != "" {
+				require.Error(t, err, "Expected error")
+				assert.Contains(t, err.Error(), tc.expError, "Unexpected error")
+				return
+			}
+			require.NoError(t, err, "Unexpected error")
+			ntuple, ok := op.(*ntupleOp)
+			require.True(t, ok, "Expected an ntuple operation")
+
+			assert.Equal(t, tc.expFlowType, ntuple.spec.FlowType, "Unexpected flow type")
+			assert.Equal(t, tc.expCookie, ntuple.spec.RingCookie, "Unexpected action")
+			assert.Equal(t, tc.expLocation, ntuple.spec.Location, "Unexpected location")
+			assert.Equal(t, tc.expContext, ntuple.rssContext, "Unexpected RSS context")
+			for offset, value := range tc.expHU {
+				assert.Equal(t, value, ntuple.spec.HU[offset:offset+len(value)], "Unexpected header value")
+			}
+			for offset, value := range tc.expMU {
+				assert.Equal(t, value, ntuple.spec.MU[offset:offset+len(value)], "Unexpected header mask")
+			}
+		})
+	}
+}
+
+func TestRssTable(t *testing.T) {
+	testCases := []struct {
+		name     string
+		size     int
+		start    uint32
+		equal    uint32
+		weights  []uint32
+		expTable []uint32
+		expError string
+	}{
+		{
+			name:     "equal is round robin",
+			size:     8,
+			equal:    3,
+			expTable: []uint32{0, 1, 2, 0, 1, 2, 0, 1},
+		},
+		{
+			name:     "equal with start",
+			size:     8,
+			start:    4,
+			equal:    2,
+			expTable: []uint32{4, 5, 4, 5, 4, 5, 4, 5},
+		},
+		{
+			name:     "equal single queue",
+			size:     4,
+			start:    2,
+			equal:    1,
+			expTable: []uint32{2, 2, 2, 2},
+		},
+		{
+			name:     "equal empty table",
+			size:     0,
+			equal:    2,
+			expError: "invalid RSS queue count or table size",
+		},
+		{
+			name:     "weights are contiguous",
+			size:     8,
+			weights:  []uint32{1, 1},
+			expTable: []uint32{0, 0, 0, 0, 1, 1, 1, 1},
+		},
+		{
+			name:     "weights proportional with start",
+			size:     8,
+			start:    1,
+			weights:  []uint32{3, 1},
+			expTable: []uint32{1, 1, 1, 1, 1, 1, 2, 2},
+		},
+		{
+			name:     "zero weight queue is skipped",
+			size:     4,
+			weights:  []uint32{1, 0, 1},
+			expTable: []uint32{0, 0, 2, 2},
+		},
+		{
+			name:     "all weights zero",
+			size:     4,
+			weights:  []uint32{0, 0},
+			expError: "invalid RSS weights or table size",
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			var table []uint32
+			var err error
+			if tc.equal > 0 {
+				table, err = rssEqualTable(tc.size, tc.start, tc.equal)
+			} else {
+				table, err = rssTable(tc.size, tc.start, tc.weights)
+			}
+
+			if tc.expError != "" {
+				require.Error(t, err, "Expected error")
+				assert.Contains(t, err.Error(), tc.expError, "Unexpected error")
+			} else {
+				require.NoError(t, err, "Unexpected error")
+				assert.Equal(t, tc.expTable, table, "Unexpected RSS table")
+			}
+		})
+	}
+}
+
+func TestRunEthtoolCmdFallback(t *testing.T) {
+	defer func(binary string) { ethtool = binary }(ethtool)
+	binDir := t.TempDir()
+
+	testCases := []struct {
+		name        string
+		cmd         string
+		script      string
+		expLocation []uint32
+		expError    string
+		expOutput   string
+	}{
+		{
+			name:   "unsupported command runs binary",
+			cmd:    "-A eth0 rx on",
+			script: "#!/bin/sh\nexit 0\n",
+		},
+		{
+			name:        "rule location read from binary output",
+			cmd:         "-N eth0 flow-type udp4 vlan 10 action 1",
+			script:      "#!/bin/sh\necho \"Added rule with ID 1021\"\n",
+			expLocation: []uint32{1021},
+		},
+		{
+			name:      "binary failure reports output",
+			cmd:       "-A eth0 rx on",
+			script:    "#!/bin/sh\necho \"Cannot set device pause parameters: Operation not supported\"\nexit 1\n",
+			expError:  "ethtool command failed on device eth0 [-A eth0 rx on]",
+			expOutput: "Cannot set device pause parameters: Operation not supported",
+		},
+		{
+			name:     "binary not installed",
+			cmd:      "-A eth0 rx on",
+			expError: "ethtool command failed on device eth0 [-A eth0 rx on]",
+		},
+		{
+			name:     "parse error does not fall back",
+			cmd:      "-X eth0 equal 0",
+			script:   "#!/bin/sh\nexit 1\n",
+			expError: "RSS equal must be at least 1",
+		},
+	}
+
+	for i, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			ethtool = filepath.Join(binDir, "ethtool-"+string(rune('a'+i)))
+			if tc.script != "" {
+				require.NoError(t, os.WriteFile(ethtool, []byte(tc.script), 0700), "Unexpected error writing script")
+			}
+
+			locations, err := runEthtoolCmd(tc.cmd)
+
+			if tc.expError != "" {
+				require.Error(t, err, "Expected error")
+				assert.Contains(t, err.Error(), tc.expError, "Unexpected error")
+				var ethtoolErr *EthtoolError
+				if tc.expOutput != "" && assert.True(t, errors.As(err, &ethtoolErr), "Expected EthtoolError") {
+					assert.Equal(t, tc.expOutput, ethtoolErr.Output, "Unexpected output")
+				}
+			} else {
+				require.NoError(t, err, "Unexpected error")
+				assert.Equal(t, tc.expLocation, locations, "Unexpected rule locations")
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ipv4Only  = []string{"192.168.1.200"}
+	ipv6Only  = []string{"fd00::c8"}
+	dualStack = []string{"fd00::c8", "192.168.1.200"}
+)
+
+func TestExpandEthtoolCmd(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cmd      string
+		ipAddrs  []string
+		expCmds  []string
+		expError string
+	}{
+		{
+			name:    "no placeholders",
+			cmd:     "-X eth0 equal 4",
+			ipAddrs: dualStack,
+			expCmds: []string{"-X eth0 equal 4"},
+		},
+		{
+			name:    "generic placeholder on an IPv4 pod",
+			cmd:     "-N eth0 flow-type udp4 dst-ip -ip- action 3",
+			ipAddrs: ipv4Only,
+			expCmds: []string{"-N eth0 flow-type udp4 dst-ip 192.168.1.200 action 3"},
+		},
+		{
+			name:    "generic placeholder on an IPv6 pod",
+			cmd:     "-N eth0 flow-type udp4 dst-ip -ip- action 3",
+			ipAddrs: ipv6Only,
+			expCmds: []string{"-N eth0 flow-type udp6 dst-ip fd00::c8 action 3"},
+		},
+		{
+			name:    "generic placeholder on a dual-stack pod",
+			cmd:     "-N eth0 flow-type tcp6 src-ip -ip- dst-port 80 action 1",
+			ipAddrs: dualStack,
+			expCmds: []string{
+				"-N eth0 flow-type tcp4 src-ip 192.168.1.200 dst-port 80 action 1",
+				"-N eth0 flow-type tcp6 src-ip fd00::c8 dst-port 80 action 1",
+			},
+		},
+		{
+			name:     "generic placeholder with no pod address",
+			cmd:      "-N eth0 flow-type udp4 dst-ip -ip- action 3",
+			ipAddrs:  nil,
+			expError: "no pod IP address available",
+		},
+		{
+			name:    "IPv4 placeholder on a dual-stack pod",
+			cmd:     "-N eth0 flow-type udp4 dst-ip -ip4- action 3",
+			ipAddrs: dualStack,
+			expCmds: []string{"-N eth0 flow-type udp4 dst-ip 192.168.1.200 action 3"},
+		},
+		{
+			name:    "IPv6 placeholder on a dual-stack pod",
+			cmd:     "-N eth0 flow-type udp6 dst-ip -ip6- action 3",
+			ipAddrs: dualStack,
+			expCmds: []string{"-N eth0 flow-type udp6 dst-ip fd00::c8 action 3"},
+		},
+		{
+			name:     "IPv6 placeholder on an IPv4 pod",
+			cmd:      "-N eth0 flow-type udp6 dst-ip -ip6- action 3",
+			ipAddrs:  ipv4Only,
+			expError: "-ip6- placeholder used but the pod has no IPv6 address",
+		},
+		{
+			name:    "generic and family placeholders together",
+			cmd:     "-N eth0 flow-type udp4 src-ip -ip- dst-ip -ip4- action 3",
+			ipAddrs: dualStack,
+			expCmds: []string{"-N eth0 flow-type udp4 src-ip 192.168.1.200 dst-ip 192.168.1.200 action 3"},
+		},
+		{
+			name:    "generic placeholder without a flow type on a dual-stack pod",
+			cmd:     "-U eth0 delete -ip-",
+			ipAddrs: dualStack,
+			expCmds: []string{"-U eth0 delete 192.168.1.200"},
+		},
+		{
+			name:    "generic placeholder without a flow type on an IPv6 pod",
+			cmd:     "-U eth0 delete -ip-",
+			ipAddrs: ipv6Only,
+			expCmds: []string{"-U eth0 delete fd00::c8"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmds, err := expandEthtoolCmd(tc.cmd, tc.ipAddrs)
+			if tc.expError != "" {
+				require.Error(t, err, "Expected an error")
+				assert.Contains(t, err.Error(), tc.expError, "Unexpected error message")
+				return
+			}
+			require.NoError(t, err, "Unexpected error")
+			assert.Equal(t, tc.expCmds, cmds, "Unexpected commands")
+		})
+	}
+}
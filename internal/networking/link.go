@@ -0,0 +1,219 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	logging "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	physfnLink  = "physfn"  // sysfs link from a VF PCI device to its PF
+	virtfnLinks = "virtfn*" // sysfs links from a PF PCI device to its VFs
+)
+
+/*
+LinkConfig holds link settings to be applied to a netdev.
+Zero values and nil pointers are left unchanged on the device.
+VLAN, trust and spoof checking are VF settings, applied through the VFs parent PF.
+*/
+type LinkConfig struct {
+	Mtu      int
+	Mac      string
+	Vlan     *int
+	Promisc  *bool
+	Trust    *bool
+	Spoofchk *bool
+}
+
+/*
+DeviceVf holds the VF settings of a netdev, as held by its parent PF
+*/
+type DeviceVf struct {
+	Vlan     int
+	Trust    bool
+	Spoofchk bool
+}
+
+/*
+SetLinkConfig takes a netdev name and applies the link settings in config.
+VF settings are applied first, as an untrusted VF may be unable to change its own MAC address.
+*/
+func (r *handler) SetLinkConfig(interfaceName string, config *LinkConfig) error {
+	link, err := netlink.LinkByName(interfaceName)
+	if err != nil {
+		return err
+	}
+
+	if config.Vlan != nil || config.Trust != nil || config.Spoofchk != nil {
+		pf, vf, err := getVf(interfaceName)
+		if err != nil {
+			return err
+		}
+		if err := setVf(pf, vf, config.Vlan, config.Trust, config.Spoofchk); err != nil {
+			return err
+		}
+	}
+
+	if config.Mac != "" {
+		mac, err := net.ParseMAC(config.Mac)
+		if err != nil {
+			return err
+		}
+		if err := netlink.LinkSetHardwareAddr(link, mac); err != nil {
+			return fmt.Errorf("failed to set MAC address %s: %w", config.Mac, err)
+		}
+	}
+
+	if config.Mtu != 0 {
+		if err := netlink.LinkSetMTU(link, config.Mtu); err != nil {
+			return fmt.Errorf("failed to set MTU %d: %w", config.Mtu, err)
+		}
+	}
+
+	if config.Promisc != nil {
+		if err := setPromisc(link, *config.Promisc); err != nil {
+			return fmt.Errorf("failed to set promiscuous mode: %w", err)
+		}
+	}
+
+	return nil
+}
+
+/*
+setVf applies VF settings to VF number vf of the PF link pf. Nil settings are left unchanged.
+*/
+func setVf(pf netlink.Link, vf int, vlan *int, trust *bool, spoofchk *bool) error {
+	if trust != nil {
+		if err := netlink.LinkSetVfTrust(pf, vf, *trust); err != nil {
+			return fmt.Errorf("failed to set VF trust: %w", err)
+		}
+	}
+	if spoofchk != nil {
+		if err := netlink.LinkSetVfSpoofchk(pf, vf, *spoofchk); err != nil {
+			return fmt.Errorf("failed to set VF spoof checking: %w", err)
+		}
+	}
+	if vlan != nil {
+		if err := netlink.LinkSetVfVlan(pf, vf, *vlan); err != nil {
+			return fmt.Errorf("failed to set VF VLAN %d: %w", *vlan, err)
+		}
+	}
+	return nil
+}
+
+/*
+setPromisc sets promiscuous mode on or off
+*/
+func setPromisc(link netlink.Link, on bool) error {
+	if on {
+		return netlink.SetPromiscOn(link)
+	}
+	return netlink.SetPromiscOff(link)
+}
+
+/*
+isPromisc returns true if promiscuous mode is set on the link
+*/
+func isPromisc(link netlink.Link) bool {
+	return link.Attrs().RawFlags&unix.IFF_PROMISC != 0
+}
+
+/*
+getVf takes a netdev name and, if the netdev is an SR-IOV VF, returns its parent PF link
+and its VF number on that PF. VF settings are only supported on SR-IOV VFs, any other
+netdev, including CDQ subfunctions, returns a not supported error.
+*/
+func getVf(interfaceName string) (netlink.Link, int, error) {
+	devicePath := filepath.Join(sysClassNet, interfaceName, pciLink)
+
+	pfPath, err := filepath.EvalSymlinks(filepath.Join(devicePath, physfnLink))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, fmt.Errorf("device %s is not an SR-IOV VF: VLAN, trust and spoofchk settings are not supported", interfaceName)
+		}
+		return nil, 0, err
+	}
+
+	vfPci, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pfNetdevs, err := os.ReadDir(filepath.Join(pfPath, "net"))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(pfNetdevs) == 0 {
+		return nil, 0, fmt.Errorf("no netdev found for the PF of device %s", interfaceName)
+	}
+	pf, err := netlink.LinkByName(pfNetdevs[0].Name())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	virtfns, err := filepath.Glob(filepath.Join(pfPath, virtfnLinks))
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, virtfn := range virtfns {
+		pci, err := filepath.EvalSymlinks(virtfn)
+		if err != nil {
+			continue
+		}
+		if pci == vfPci {
+			vf, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(virtfn), "virtfn"))
+			if err != nil {
+				return nil, 0, err
+			}
+			return pf, vf, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("VF number of device %s not found on PF %s", interfaceName, pf.Attrs().Name)
+}
+
+/*
+getVfState takes a netdev name and, if the netdev is an SR-IOV VF, returns its VF settings.
+A nil state is returned if the netdev is not a VF.
+*/
+func getVfState(interfaceName string) (*DeviceVf, error) {
+	pf, vf, err := getVf(interfaceName)
+	if err != nil {
+		logging.Debugf("No VF state for device %s: %v", interfaceName, err)
+		return nil, nil
+	}
+
+	for _, info := range pf.Attrs().Vfs {
+		if info.ID == vf {
+			return &DeviceVf{
+				Vlan:     info.Vlan,
+				Trust:    info.Trust != 0,
+				Spoofchk: info.Spoofchk,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("VF %d not reported by PF %s", vf, pf.Attrs().Name)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+)
+
+/*
+MacConfig holds the settings used to assign MAC addresses to CDQ subfunctions.
+Oui is the three octet prefix of every address. Seed identifies the node and pool,
+so that the same subfunction on different nodes or pools gets a different address.
+If NodeIndex is set, addresses are taken from the range of the node instead of a hash
+of the seed, and Primaries holds the index of each CDQ primary device on the node.
+*/
+type MacConfig struct {
+	Oui       string
+	Seed      string
+	NodeIndex *int
+	Primaries map[string]int
+}
+
+/*
+AssignCdqMac derives the MAC address of the CDQ subfunction of this device and stores it,
+so that it is set on the subfunction when it is activated. The address is derived from the
+MAC config, the primary device and the subfunction number, giving the subfunction the same
+address each time it is created.
+*/
+func (d *Device) AssignCdqMac(config *MacConfig) error {
+	if d.IsPrimary() {
+		return fmt.Errorf("cannot assign CDQ MAC address to %s. This is a primary device", d.name)
+	}
+
+	sfNum, err := d.SfNum()
+	if err != nil {
+		return err
+	}
+
+	var mac string
+	if config.NodeIndex != nil {
+		primaryIndex, ok := config.Primaries[d.primary.name]
+		if !ok {
+			return fmt.Errorf("error deriving MAC address of subfunction %s: no index for primary device %s", d.name, d.primary.name)
+		}
+		mac, err = indexedCdqMac(config.Oui, *config.NodeIndex, primaryIndex, sfNum)
+	} else {
+		mac, err = deriveCdqMac(config.Oui, config.Seed+"/"+d.primary.name, sfNum)
+	}
+	if err != nil {
+		return fmt.Errorf("error deriving MAC address of subfunction %s: %v", d.name, err)
+	}
+
+	d.macAddress = mac
+	d.fixedMac = true
+	return nil
+}
+
+/*
+SfNum returns the subfunction number of a CDQ subfunction, taken from the device name
+*/
+func (d *Device) SfNum() (int, error) {
+	index := strings.LastIndex(d.name, "sf")
+	if d.IsPrimary() || index < 0 {
+		return 0, fmt.Errorf("device %s is not a CDQ subfunction", d.name)
+	}
+
+	sfNum, err := strconv.Atoi(d.name[index+2:])
+	if err != nil {
+		return 0, fmt.Errorf("error getting subfunction number of %s: %v", d.name, err)
+	}
+	return sfNum, nil
+}
+
+/*
+deriveCdqMac builds a MAC address from a three octet OUI, a hash of the seed and a
+subfunction number. The lower six bits hold the subfunction number, so subfunctions
+of the same primary device never collide. The remaining eighteen bits come from the seed.
+With eighteen bits, seeds sharing an OUI collide with a probability of about 1% for 70
+seeds, the node, pool and primary device combinations, and 50% for 600. Where addresses
+must not collide, give each node its own range with indexedCdqMac.
+*/
+func deriveCdqMac(oui string, seed string, sfNum int) (string, error) {
+	if sfNum < 1 || sfNum > constants.Devices.SecondaryMax {
+		return "", fmt.Errorf("subfunction number %d is out of range", sfNum)
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(seed))
+	return cdqMac(oui, (hash.Sum32()&0x3ffff)<<6|uint32(sfNum-1))
+}
+
+/*
+indexedCdqMac builds a MAC address from a three octet OUI, the index of the node, the
+index of the primary device on the node and a subfunction number. The node index takes
+the upper twelve bits, the primary index and subfunction number six bits each, so no two
+subfunctions collide as long as each node using the OUI has a different index.
+*/
+func indexedCdqMac(oui string, nodeIndex int, primaryIndex int, sfNum int) (string, error) {
+	if nodeIndex < 0 || nodeIndex > constants.Devices.MacNodeMax {
+		return "", fmt.Errorf("node index %d is out of range", nodeIndex)
+	}
+	if primaryIndex < 0 || primaryIndex >= constants.Devices.MacPrimaryMax {
+		return "", fmt.Errorf("primary device index %d is out of range", primaryIndex)
+	}
+	if sfNum < 1 || sfNum > constants.Devices.SecondaryMax {
+		return "", fmt.Errorf("subfunction number %d is out of range", sfNum)
+	}
+
+	return cdqMac(oui, uint32(nodeIndex)<<12|uint32(primaryIndex)<<6|uint32(sfNum-1))
+}
+
+/*
+cdqMac builds a MAC address from a three octet unicast OUI and the lower 24 bits of suffix
+*/
+func cdqMac(oui string, suffix uint32) (string, error) {
+	prefix, err := net.ParseMAC(oui + ":00:00:00")
+	if err != nil {
+		return "", fmt.Errorf("invalid OUI %s: %v", oui, err)
+	}
+	if prefix[0]&0x01 != 0 {
+		return "", fmt.Errorf("invalid OUI %s: multicast addresses cannot be assigned", oui)
+	}
+
+	mac := net.HardwareAddr{prefix[0], prefix[1], prefix[2], byte(suffix >> 16), byte(suffix >> 8), byte(suffix)}
+	return mac.String(), nil
+}
@@ -21,6 +21,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/tools"
@@ -28,6 +29,8 @@ import (
 	_ethtool "github.com/safchain/ethtool"
 	logging "github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
 )
 
 var (
@@ -51,15 +54,34 @@ type Handler interface {
 	GetDeviceByPCI(pci string) (string, error)
 	CycleDevice(interfaceName string) error
 	NetDevExists(device string) (bool, error)
-	CreateCdqSubfunction(parentPci string, pfnum string, sfnum string) error     // see subfunction package
-	DeleteCdqSubfunction(portIndex string) error                                 // see subfunction package
-	IsCdqSubfunction(name string) (bool, error)                                  // see subfunction package
-	NumAvailableCdqSubfunctions(interfaceName string) (int, error)               // see subfunction package
-	GetCdqPortIndex(netdev string) (string, error)                               // see subfucntions package
-	GetCdqPfnum(netdev string) (string, error)                                   // see subfucntions package
-	SetEthtool(ethtoolCmd []string, interfaceName string, ipResult string) error // see ethtool.go
-	DeleteEthtool(interfaceName string) error                                    // see ethtool.go
+	CreateCdqSubfunction(parentPci string, pfnum string, sfnum string, hwAddr string) (string, error)     // see subfunction package
+	DeleteCdqSubfunction(portIndex string) error                                                          // see subfunction package
+	IsCdqSubfunction(name string) (bool, error)                                                           // see subfunction package
+	NumAvailableCdqSubfunctions(interfaceName string) (int, error)                                        // see subfunction package
+	GetCdqPortIndex(netdev string) (string, error)                                                        // see subfucntions package
+	GetCdqPfnum(netdev string) (string, error)                                                            // see subfucntions package
+	GetCdqPrimary(netdev string) (string, error)                                                          // see subfucntions package
+	GetCdqQueueRange(netdev string) (uint32, uint32, error)                                               // see subfucntions package
+	CreateCdqRateNode(parentPci string, node string, rate *RateConfig) error                              // see rate.go
+	DeleteCdqRateNode(parentPci string, node string) error                                                // see rate.go
+	SetCdqRate(portIndex string, node string, rate *RateConfig) error                                     // see rate.go
+	ClearCdqRate(portIndex string) error                                                                  // see rate.go
+	SetEthtool(ethtoolCmd []string, interfaceName string, ipAddrs []string) ([]uint32, error)             // see ethtool.go
+	DeleteEthtool(interfaceName string) error                                                             // see ethtool.go
+	SetEthtoolFilters(filters []*EthtoolFilter, interfaceName string, ipAddrs []string) ([]uint32, error) // see ethtool_filter.go
+	DeleteEthtoolRules(interfaceName string, locations []uint32) error                                    // see ethtool_filter.go
+	GetDeviceState(interfaceName string) (*DeviceState, error)                                            // see state.go
+	RestoreDeviceState(interfaceName string, state *DeviceState) error                                    // see state.go
+	SetLinkConfig(interfaceName string, config *LinkConfig) error                                         // see link.go
+	SetQueueConfig(interfaceName string, config *QueueConfig) error                                       // see queues.go
+	GetDeviceInfo(netnsPath string, interfaceName string) (*DeviceInfo, error)                            // see deviceinfo.go
+	GetDeviceStats(netnsPath string, interfaceName string) (*DeviceStats, error)                          // see stats.go
+	GetNapiSettings(interfaceName string) (*NapiSettings, error)                                          // see busypoll.go
+	SetNapiSettings(interfaceName string, settings *NapiSettings) error                                   // see busypoll.go
 	IsPhysicalPort(name string) (bool, error)
+	RenameDevice(interfaceName string, newName string) error
+	AddAltName(interfaceName string, altName string) error
+	DeleteAltName(interfaceName string, altName string) error
 }
 
 /*
@@ -291,13 +313,70 @@ func (r *handler) IsPhysicalPort(name string) (bool, error) {
 }
 
 /*
-Wrapper for Subfunctions API calls
+RenameDevice takes a netdev name and renames the device to newName.
+The device is set 'DOWN' first, as the kernel will not rename a running device.
+Equivalent to 'ip link set <interface_name> down' and 'ip link set <interface_name> name <new_name>'
 */
-func (r *handler) CreateCdqSubfunction(parentPci string, pfnum string, sfnum string) error {
-	err := subfunctions.CreateCdqSubfunction(parentPci, pfnum, sfnum)
+func (r *handler) RenameDevice(interfaceName string, newName string) error {
+	device, err := netlink.LinkByName(interfaceName)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetDown(device); err != nil {
+		return err
+	}
+
+	return netlink.LinkSetName(device, newName)
+}
+
+/*
+AddAltName takes a netdev name and adds altName as an alternative name of the device.
+Equivalent to 'ip link property add dev <interface_name> altname <alt_name>'
+*/
+func (r *handler) AddAltName(interfaceName string, altName string) error {
+	return altNameRequest(interfaceName, altName, unix.RTM_NEWLINKPROP, unix.NLM_F_ACK|unix.NLM_F_CREATE|unix.NLM_F_EXCL)
+}
+
+/*
+DeleteAltName takes a netdev name and removes altName from the alternative names of the device.
+Equivalent to 'ip link property del dev <interface_name> altname <alt_name>'
+*/
+func (r *handler) DeleteAltName(interfaceName string, altName string) error {
+	return altNameRequest(interfaceName, altName, unix.RTM_DELLINKPROP, unix.NLM_F_ACK)
+}
+
+/*
+altNameRequest sends a link property netlink request carrying a single alternative name.
+The netlink library does not support alternative names, so the request is built here.
+*/
+func altNameRequest(interfaceName string, altName string, proto int, flags int) error {
+	device, err := netlink.LinkByName(interfaceName)
+	if err != nil {
+		return err
+	}
+
+	req := nl.NewNetlinkRequest(proto, flags)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(device.Attrs().Index)
+	req.AddData(msg)
+
+	props := nl.NewRtAttr(unix.IFLA_PROP_LIST|unix.NLA_F_NESTED, nil)
+	props.AddRtAttr(unix.IFLA_ALT_IFNAME, nl.ZeroTerminated(altName))
+	req.AddData(props)
+
+	_, err = req.Execute(unix.NETLINK_ROUTE, 0)
 	return err
 }
 
+/*
+Wrapper for Subfunctions API calls
+*/
+func (r *handler) CreateCdqSubfunction(parentPci string, pfnum string, sfnum string, hwAddr string) (string, error) {
+	portIndex, err := subfunctions.CreateCdqSubfunction(parentPci, pfnum, sfnum, hwAddr)
+	return portIndex, err
+}
+
 /*
 Wrapper for Subfunctions API calls
 */
@@ -337,3 +416,46 @@ func (r *handler) GetCdqPfnum(netdev string) (string, error) {
 	result, err := subfunctions.GetCdqPfnum(netdev)
 	return result, err
 }
+
+/*
+GetCdqPrimary takes the netdev name of a CDQ subfunction and returns the netdev name
+of the parent port, resolved from the devlink port index of the subfunction
+*/
+func (r *handler) GetCdqPrimary(netdev string) (string, error) {
+	portIndex, err := subfunctions.GetCdqPortIndex(netdev)
+	if err != nil {
+		return "", err
+	}
+
+	pci := strings.Split(portIndex, "/")[0]
+	primary, err := r.GetDeviceByPCI(pci)
+	if err != nil {
+		return "", err
+	}
+	if primary == "" {
+		return "", fmt.Errorf("no netdev found for parent port %s of subfunction %s", pci, netdev)
+	}
+
+	return primary, nil
+}
+
+/*
+GetCdqQueueRange takes the netdev name of a CDQ subfunction and returns the first queue
+of the subfunction on its parent port and the number of queues of the subfunction
+*/
+func (r *handler) GetCdqQueueRange(netdev string) (uint32, uint32, error) {
+	base, err := subfunctions.GetCdqQueueBase(netdev)
+	if err != nil {
+		return 0, 0, err
+	}
+	if base < 0 {
+		return 0, 0, fmt.Errorf("invalid queue base %d of subfunction %s", base, netdev)
+	}
+
+	count, err := getRxRings(netdev)
+	if err != nil {
+		return 0, 0, &EthtoolError{Device: netdev, Op: "RX rings", Err: err}
+	}
+
+	return uint32(base), count, nil
+}
@@ -15,18 +15,32 @@
 
 package networking
 
+import "github.com/intel/afxdp-plugins-for-kubernetes/constants"
+
 /*
 FakeHandler interface extends the Handler interface to provide additional testing methods.
 */
 type FakeHandler interface {
 	Handler
 	SetHostDevices(interfaceNames map[string][]string)
+	SetCdqCapacity(available int)
+	SetNetDevExists(exists bool)
+	SetDeviceByMAC(mac string, name string)
+	GetRenamedDevices() map[string]string
+	SetQueueRange(start, count uint32)
 }
 
 /*
 fakeHandler implements the FakeHandler interface.
 */
-type fakeHandler struct{}
+type fakeHandler struct {
+	cdqCapacity   int
+	netDevMissing bool
+	macDevices    map[string]string
+	renames       map[string]string
+	queueStart    uint32
+	queueCount    uint32
+}
 
 /*
 interfaceList holds a map of drivers and net.Interface objects, representing fake netdev objects.
@@ -37,7 +51,7 @@ var interfaceList map[string]*Device
 NewFakeHandler returns an implementation of the FakeHandler interface.
 */
 func NewFakeHandler() FakeHandler {
-	return &fakeHandler{}
+	return &fakeHandler{cdqCapacity: constants.Devices.SecondaryMax}
 }
 
 /*
@@ -48,6 +62,37 @@ func (r *fakeHandler) GetHostDevices() (map[string]*Device, error) {
 	return interfaceList, nil
 }
 
+/*
+SetCdqCapacity sets the number of CDQ subfunctions the fake handler reports available
+*/
+func (r *fakeHandler) SetCdqCapacity(available int) {
+	r.cdqCapacity = available
+}
+
+/*
+SetNetDevExists sets the result the fake handler reports from NetDevExists, by default true
+*/
+func (r *fakeHandler) SetNetDevExists(exists bool) {
+	r.netDevMissing = !exists
+}
+
+/*
+SetDeviceByMAC registers a fake netdev name to be returned by GetDeviceByMAC for the given MAC
+*/
+func (r *fakeHandler) SetDeviceByMAC(mac string, name string) {
+	if r.macDevices == nil {
+		r.macDevices = make(map[string]string)
+	}
+	r.macDevices[mac] = name
+}
+
+/*
+GetRenamedDevices returns a map of the renames performed through RenameDevice, old name to new name
+*/
+func (r *fakeHandler) GetRenamedDevices() map[string]string {
+	return r.renames
+}
+
 /*
 SetHostDevices is a function used to dynamically setup mock devices and drivers
 */
@@ -124,16 +169,16 @@ NetDevExists takes a device name and verifies if device exists on host.
 This function uses fake handler, its purpose is for unit-testing
 */
 func (r *fakeHandler) NetDevExists(device string) (bool, error) {
-	return true, nil
+	return !r.netDevMissing, nil
 }
 
 /*
 CreateCdqSubfunction takes the PCI address of a port and a subfunction number
 It creates that subfunction on top of that port and activates it
-In this fake handler it does nothing
+In this fake handler it returns a port index made of the PCI address and subfunction number
 */
-func (r *fakeHandler) CreateCdqSubfunction(parentPci string, pfnum string, sfnum string) error {
-	return nil
+func (r *fakeHandler) CreateCdqSubfunction(parentPci string, pfnum string, sfnum string, hwAddr string) (string, error) {
+	return parentPci + "/" + sfnum, nil
 }
 
 /*
@@ -172,13 +217,92 @@ func (r *fakeHandler) GetCdqPfnum(netdev string) (string, error) {
 	return "", nil
 }
 
+/*
+GetCdqPrimary takes the netdev name of a CDQ subfunction and returns the netdev name
+of the parent port. In this fake handler it currently returns an empty string
+*/
+func (r *fakeHandler) GetCdqPrimary(netdev string) (string, error) {
+	return "", nil
+}
+
+/*
+GetCdqQueueRange takes the netdev name of a CDQ subfunction and returns the first queue
+of the subfunction on its parent port and the number of queues of the subfunction
+In this fake handler it returns queues 16 to 19
+*/
+func (r *fakeHandler) GetCdqQueueRange(netdev string) (uint32, uint32, error) {
+	return 16, 4, nil
+}
+
+/*
+CreateCdqRateNode takes the PCI address of a port and creates a devlink rate node
+In this fake handler it does nothing
+*/
+func (r *fakeHandler) CreateCdqRateNode(parentPci string, node string, rate *RateConfig) error {
+	return nil
+}
+
+/*
+DeleteCdqRateNode takes the PCI address of a port and deletes a devlink rate node
+In this fake handler it does nothing
+*/
+func (r *fakeHandler) DeleteCdqRateNode(parentPci string, node string) error {
+	return nil
+}
+
+/*
+SetCdqRate takes the port index of a subfunction and applies rates to it
+In this fake handler it does nothing
+*/
+func (r *fakeHandler) SetCdqRate(portIndex string, node string, rate *RateConfig) error {
+	return nil
+}
+
+/*
+ClearCdqRate takes the port index of a subfunction and removes its rates
+In this fake handler it does nothing
+*/
+func (r *fakeHandler) ClearCdqRate(portIndex string) error {
+	return nil
+}
+
+/*
+GetDeviceStats takes a netdev name and returns its DeviceStats.
+In this fake handler it returns a fixed set of counters for a device with one queue.
+*/
+func (r *fakeHandler) GetDeviceStats(netnsPath string, interfaceName string) (*DeviceStats, error) {
+	return &DeviceStats{
+		Link:     &LinkStats{RxPackets: 100, TxPackets: 50, RxBytes: 6400, TxBytes: 3200},
+		Counters: map[string]uint64{"rx_unicast": 100},
+		Queues:   map[uint32]map[string]uint64{0: {"rx_packets": 100}},
+		Xdp:      &XdpStats{ProgramID: 7, Counters: map[string]uint64{"rx_xdp_redirect": 90}},
+	}, nil
+}
+
+/*
+GetNapiSettings takes a netdev name and returns its current NAPI settings.
+In this fake handler it returns the kernel defaults.
+*/
+func (r *fakeHandler) GetNapiSettings(interfaceName string) (*NapiSettings, error) {
+	return &NapiSettings{}, nil
+}
+
+/*
+SetNapiSettings takes a netdev name and writes the given NAPI settings to it.
+In this fake handler it does nothing
+*/
+func (r *fakeHandler) SetNapiSettings(interfaceName string, settings *NapiSettings) error {
+	return nil
+}
+
 /*
 NumAvailableCdqSubfunctions takes the PCI of a physical port and returns how
 many unused CDQ subfunctions are available
-In this fake handler it currently returns 0
+In this fake handler it returns the capacity set by SetCdqCapacity, by default the
+maximum number of secondary devices
 */
 func (r *fakeHandler) NumAvailableCdqSubfunctions(interfaceName string) (int, error) {
-	return 0, nil
+	return r.cdqCapacity, nil
 }
 
 /*
@@ -186,8 +310,8 @@ SetEthtool applies ethtool filters on the physical device during cmdAdd().
 Ethtool filters are set via the DP config.json file. This function uses fake handler,
 its purpose is for unit-testing only.
 */
-func (r *fakeHandler) SetEthtool(ethtoolCmd []string, interfaceName string, ipResult string) error {
-	return nil
+func (r *fakeHandler) SetEthtool(ethtoolCmd []string, interfaceName string, ipAddrs []string) ([]uint32, error) {
+	return nil, nil
 }
 
 /*
@@ -199,6 +323,80 @@ func (r *fakeHandler) DeleteEthtool(interfaceName string) error {
 	return nil
 }
 
+/*
+SetEthtoolFilters inserts structured ethtool filters as ntuple rules on a device.
+In this fake handler it returns one location per filter, starting at zero.
+*/
+func (r *fakeHandler) SetEthtoolFilters(filters []*EthtoolFilter, interfaceName string, ipAddrs []string) ([]uint32, error) {
+	locations := make([]uint32, len(filters))
+	for i := range filters {
+		locations[i] = uint32(i)
+	}
+	return locations, nil
+}
+
+/*
+DeleteEthtoolRules removes ntuple rules from a device.
+In this fake handler it does nothing.
+*/
+func (r *fakeHandler) DeleteEthtoolRules(interfaceName string, locations []uint32) error {
+	return nil
+}
+
+/*
+GetDeviceState takes a netdev name and returns a snapshot of its current state.
+In this fake handler it returns a snapshot containing only the device name.
+*/
+func (r *fakeHandler) GetDeviceState(interfaceName string) (*DeviceState, error) {
+	return &DeviceState{Name: interfaceName}, nil
+}
+
+/*
+RestoreDeviceState takes a netdev name and a snapshot and restores the device to that state.
+In this fake handler it does nothing.
+*/
+func (r *fakeHandler) RestoreDeviceState(interfaceName string, state *DeviceState) error {
+	return nil
+}
+
+/*
+SetLinkConfig takes a netdev name and applies the link settings in config.
+In this fake handler it does nothing.
+*/
+func (r *fakeHandler) SetLinkConfig(interfaceName string, config *LinkConfig) error {
+	return nil
+}
+
+/*
+SetQueueConfig takes a netdev name and applies the queue layout in config.
+In this fake handler it does nothing.
+*/
+func (r *fakeHandler) SetQueueConfig(interfaceName string, config *QueueConfig) error {
+	return nil
+}
+
+/*
+GetDeviceInfo takes a netdev name and returns its DeviceInfo.
+In this fake handler it returns a device with 4 queues and a standard MTU, without multi-buffer support.
+Packets are steered to all 4 queues, unless another range is set with SetQueueRange.
+*/
+func (r *fakeHandler) GetDeviceInfo(netnsPath string, interfaceName string) (*DeviceInfo, error) {
+	multiBuffer := false
+	info := &DeviceInfo{Ifindex: 10, Queues: 4, QueueStart: 0, QueueCount: 4, Mtu: 1500, MultiBuffer: &multiBuffer}
+	if r.queueCount > 0 {
+		info.QueueStart, info.QueueCount = r.queueStart, r.queueCount
+	}
+	return info, nil
+}
+
+/*
+SetQueueRange sets the range of queues returned by GetDeviceInfo.
+*/
+func (r *fakeHandler) SetQueueRange(start, count uint32) {
+	r.queueStart = start
+	r.queueCount = count
+}
+
 /*
 GetDeviceFromFile extracts device map fields from the device file (device.json).
 It creates and populates a new instance of the device map with the device file field values
@@ -217,7 +415,7 @@ func (r *fakeHandler) WriteDeviceFile(device *Device, filepath string) error {
 }
 
 func (r *fakeHandler) GetDeviceByMAC(mac string) (string, error) {
-	return "", nil
+	return r.macDevices[mac], nil
 }
 
 func (r *fakeHandler) GetDeviceByPCI(pci string) (string, error) {
@@ -227,3 +425,31 @@ func (r *fakeHandler) GetDeviceByPCI(pci string) (string, error) {
 func (r *fakeHandler) IsPhysicalPort(name string) (bool, error) {
 	return false, nil
 }
+
+/*
+RenameDevice takes a netdev name and renames the device to newName.
+In this fake handler it records the rename, see GetRenamedDevices.
+*/
+func (r *fakeHandler) RenameDevice(interfaceName string, newName string) error {
+	if r.renames == nil {
+		r.renames = make(map[string]string)
+	}
+	r.renames[interfaceName] = newName
+	return nil
+}
+
+/*
+AddAltName takes a netdev name and adds altName as an alternative name of the device.
+In this fake handler it does nothing.
+*/
+func (r *fakeHandler) AddAltName(interfaceName string, altName string) error {
+	return nil
+}
+
+/*
+DeleteAltName takes a netdev name and removes altName from the alternative names of the device.
+In this fake handler it does nothing.
+*/
+func (r *fakeHandler) DeleteAltName(interfaceName string, altName string) error {
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"fmt"
+
+	_ethtool "github.com/safchain/ethtool"
+	logging "github.com/sirupsen/logrus"
+)
+
+/*
+QueueConfig holds the queue layout to be applied to a netdev.
+Zero values are left unchanged on the device.
+*/
+type QueueConfig struct {
+	Combined uint32
+	RxRing   uint32
+	TxRing   uint32
+}
+
+/*
+DeviceRings holds the RX and TX ring sizes of a netdev
+*/
+type DeviceRings struct {
+	Rx uint32
+	Tx uint32
+}
+
+/*
+SetQueueConfig takes a netdev name and applies the queue layout in config.
+The requested values are validated against the maximums reported by the driver
+before any change is made to the device. Channels and rings are set through the
+ethtool ioctl rather than ethtool netlink, which older kernels do not support.
+*/
+func (r *handler) SetQueueConfig(interfaceName string, config *QueueConfig) error {
+	e, err := _ethtool.NewEthtool()
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	var channels _ethtool.Channels
+	if config.Combined != 0 {
+		channels, err = e.GetChannels(interfaceName)
+		if err != nil {
+			return fmt.Errorf("failed to get channels: %w", err)
+		}
+		if config.Combined > channels.MaxCombined {
+			return fmt.Errorf("%d queues requested, device %s supports a maximum of %d", config.Combined, interfaceName, channels.MaxCombined)
+		}
+	}
+
+	var rings *ethtoolRingParam
+	if config.RxRing != 0 || config.TxRing != 0 {
+		rings, err = getRingParam(interfaceName)
+		if err != nil {
+			return fmt.Errorf("failed to get ring sizes: %w", err)
+		}
+		if config.RxRing > rings.RxMaxPending {
+			return fmt.Errorf("RX ring size %d requested, device %s supports a maximum of %d", config.RxRing, interfaceName, rings.RxMaxPending)
+		}
+		if config.TxRing > rings.TxMaxPending {
+			return fmt.Errorf("TX ring size %d requested, device %s supports a maximum of %d", config.TxRing, interfaceName, rings.TxMaxPending)
+		}
+	}
+
+	if config.Combined != 0 && config.Combined != channels.CombinedCount {
+		logging.Debugf("Setting device %s combined channels to %d", interfaceName, config.Combined)
+		channels.CombinedCount = config.Combined
+		if _, err := e.SetChannels(interfaceName, channels); err != nil {
+			return fmt.Errorf("failed to set channels: %w", err)
+		}
+	}
+
+	if rings != nil {
+		if config.RxRing != 0 {
+			rings.RxPending = config.RxRing
+		}
+		if config.TxRing != 0 {
+			rings.TxPending = config.TxRing
+		}
+		logging.Debugf("Setting device %s ring sizes to rx %d tx %d", interfaceName, rings.RxPending, rings.TxPending)
+		if err := setRingParam(interfaceName, rings); err != nil {
+			return fmt.Errorf("failed to set ring sizes: %w", err)
+		}
+	}
+
+	return nil
+}
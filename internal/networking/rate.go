@@ -0,0 +1,65 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"github.com/intel/afxdp-plugins-for-kubernetes/pkg/subfunctions"
+)
+
+/*
+RateConfig holds devlink rate limits, in devlink rate units such as 100mbit or 1gbit.
+Empty values are not set.
+*/
+type RateConfig struct {
+	TxShare string `json:"TxShare"`
+	TxMax   string `json:"TxMax"`
+}
+
+/*
+CreateCdqRateNode takes the PCI address of a port and creates a devlink rate node
+with the given rates, used to group the subfunctions of a pool
+*/
+func (r *handler) CreateCdqRateNode(parentPci string, node string, rate *RateConfig) error {
+	if rate == nil {
+		rate = &RateConfig{}
+	}
+	return subfunctions.CreateCdqRateNode(parentPci, node, rate.TxShare, rate.TxMax)
+}
+
+/*
+DeleteCdqRateNode takes the PCI address of a port and deletes a devlink rate node
+*/
+func (r *handler) DeleteCdqRateNode(parentPci string, node string) error {
+	return subfunctions.DeleteCdqRateNode(parentPci, node)
+}
+
+/*
+SetCdqRate takes the port index of a subfunction, applies the given rates and
+groups it under the rate node, if one is given
+*/
+func (r *handler) SetCdqRate(portIndex string, node string, rate *RateConfig) error {
+	if rate == nil {
+		rate = &RateConfig{}
+	}
+	return subfunctions.SetCdqRate(portIndex, node, rate.TxShare, rate.TxMax)
+}
+
+/*
+ClearCdqRate takes the port index of a subfunction and removes its rates and rate node
+*/
+func (r *handler) ClearCdqRate(portIndex string) error {
+	return subfunctions.ClearCdqRate(portIndex)
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	_ethtool "github.com/safchain/ethtool"
+	logging "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+const ntupleFeature = "rx-ntuple-filter" // ethtool feature name of the ntuple filter feature
+
+/*
+DeviceState is a snapshot of the host side configuration of a netdev.
+It is taken by the CNI before a device is modified or moved into a pod,
+and is used to put the device back exactly as it was found.
+Fields that could not be read from the device are left nil and are not restored.
+*/
+type DeviceState struct {
+	Name       string
+	Mtu        int
+	Mac        string
+	Up         bool
+	Promisc    bool
+	Vf         *DeviceVf
+	Channels   *DeviceChannels
+	Rings      *DeviceRings
+	RssTable   []uint32
+	RssDefault bool
+	Ntuple     *bool
+}
+
+/*
+DeviceChannels holds the channel counts of a netdev
+*/
+type DeviceChannels struct {
+	Rx       uint32
+	Tx       uint32
+	Other    uint32
+	Combined uint32
+}
+
+/*
+GetDeviceState takes a netdev name and returns a snapshot of its current state.
+*/
+func (r *handler) GetDeviceState(interfaceName string) (*DeviceState, error) {
+	link, err := netlink.LinkByName(interfaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := link.Attrs()
+	state := &DeviceState{
+		Name:    attrs.Name,
+		Mtu:     attrs.MTU,
+		Mac:     attrs.HardwareAddr.String(),
+		Up:      attrs.Flags&net.FlagUp != 0,
+		Promisc: isPromisc(link),
+	}
+
+	state.Vf, err = getVfState(interfaceName)
+	if err != nil {
+		logging.Debugf("Unable to read VF state of device %s: %v", interfaceName, err)
+	}
+
+	e, err := _ethtool.NewEthtool()
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+
+	channels, err := e.GetChannels(interfaceName)
+	if err != nil {
+		logging.Debugf("Unable to read channels of device %s: %v", interfaceName, err)
+	} else {
+		state.Channels = &DeviceChannels{
+			Rx:       channels.RxCount,
+			Tx:       channels.TxCount,
+			Other:    channels.OtherCount,
+			Combined: channels.CombinedCount,
+		}
+	}
+
+	rings, err := getRingParam(interfaceName)
+	if err != nil {
+		logging.Debugf("Unable to read ring sizes of device %s: %v", interfaceName, err)
+	} else {
+		state.Rings = &DeviceRings{
+			Rx: rings.RxPending,
+			Tx: rings.TxPending,
+		}
+	}
+
+	table, err := getRssTable(interfaceName)
+	if err != nil {
+		logging.Debugf("Unable to read RSS table of device %s: %v", interfaceName, err)
+	} else {
+		state.RssTable = table
+		rxRings, err := getRxRings(interfaceName)
+		if err != nil {
+			logging.Debugf("Unable to read RX rings of device %s: %v", interfaceName, err)
+		}
+		state.RssDefault = isDefaultRssTable(table, rxRings)
+	}
+
+	features, err := e.Features(interfaceName)
+	if err != nil {
+		logging.Debugf("Unable to read features of device %s: %v", interfaceName, err)
+	} else if ntuple, ok := features[ntupleFeature]; ok {
+		state.Ntuple = &ntuple
+	}
+
+	return state, nil
+}
+
+/*
+RestoreDeviceState takes a netdev name and a previously taken snapshot and puts the
+device back into the snapshot state. Restoration is best effort, every attribute is
+attempted and any failures are returned together in a single error.
+*/
+func (r *handler) RestoreDeviceState(interfaceName string, state *DeviceState) error {
+	var failures []string
+
+	if state == nil {
+		return fmt.Errorf("no state to restore on device %s", interfaceName)
+	}
+
+	link, err := netlink.LinkByName(interfaceName)
+	if err != nil {
+		return err
+	}
+	attrs := link.Attrs()
+
+	if err := netlink.LinkSetDown(link); err != nil {
+		failures = append(failures, fmt.Sprintf("admin state down: %v", err))
+	}
+
+	e, err := _ethtool.NewEthtool()
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	if state.Channels != nil {
+		current, err := e.GetChannels(interfaceName)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("channels: %v", err))
+		} else if current.RxCount != state.Channels.Rx || current.TxCount != state.Channels.Tx ||
+			current.OtherCount != state.Channels.Other || current.CombinedCount != state.Channels.Combined {
+			current.RxCount = state.Channels.Rx
+			current.TxCount = state.Channels.Tx
+			current.OtherCount = state.Channels.Other
+			current.CombinedCount = state.Channels.Combined
+			if _, err := e.SetChannels(interfaceName, current); err != nil {
+				failures = append(failures, fmt.Sprintf("channels: %v", err))
+			}
+		}
+	}
+
+	if state.Rings != nil {
+		current, err := getRingParam(interfaceName)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("ring sizes: %v", err))
+		} else if current.RxPending != state.Rings.Rx || current.TxPending != state.Rings.Tx {
+			current.RxPending = state.Rings.Rx
+			current.TxPending = state.Rings.Tx
+			if err := setRingParam(interfaceName, current); err != nil {
+				failures = append(failures, fmt.Sprintf("ring sizes: %v", err))
+			}
+		}
+	}
+
+	if state.RssTable != nil {
+		table := state.RssTable
+		if state.RssDefault {
+			table = []uint32{}
+		}
+		if err := setRssTable(interfaceName, table); err != nil {
+			failures = append(failures, fmt.Sprintf("RSS table: %v", err))
+		}
+	}
+
+	if state.Ntuple != nil {
+		if err := e.Change(interfaceName, map[string]bool{ntupleFeature: *state.Ntuple}); err != nil {
+			failures = append(failures, fmt.Sprintf("ntuple: %v", err))
+		}
+	}
+
+	if state.Mtu != 0 && attrs.MTU != state.Mtu {
+		if err := netlink.LinkSetMTU(link, state.Mtu); err != nil {
+			failures = append(failures, fmt.Sprintf("MTU: %v", err))
+		}
+	}
+
+	if state.Vf != nil {
+		pf, vf, err := getVf(interfaceName)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("VF: %v", err))
+		} else if err := setVf(pf, vf, &state.Vf.Vlan, &state.Vf.Trust, &state.Vf.Spoofchk); err != nil {
+			failures = append(failures, fmt.Sprintf("VF: %v", err))
+		}
+	}
+
+	if state.Mac != "" && attrs.HardwareAddr.String() != state.Mac {
+		mac, err := net.ParseMAC(state.Mac)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("MAC: %v", err))
+		} else if err := netlink.LinkSetHardwareAddr(link, mac); err != nil {
+			failures = append(failures, fmt.Sprintf("MAC: %v", err))
+		}
+	}
+
+	if isPromisc(link) != state.Promisc {
+		if err := setPromisc(link, state.Promisc); err != nil {
+			failures = append(failures, fmt.Sprintf("promiscuous mode: %v", err))
+		}
+	}
+
+	if state.Name != "" && attrs.Name != state.Name {
+		if err := netlink.LinkSetName(link, state.Name); err != nil {
+			failures = append(failures, fmt.Sprintf("name: %v", err))
+		}
+	}
+
+	if state.Up {
+		if err := netlink.LinkSetUp(link); err != nil {
+			failures = append(failures, fmt.Sprintf("admin state up: %v", err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to restore device %s: %s", interfaceName, strings.Join(failures, "; "))
+	}
+
+	logging.Debugf("Device %s restored to its original state", interfaceName)
+	return nil
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package networking
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	_ethtool "github.com/safchain/ethtool"
+	logging "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	bpfProgInfoSize      = 208 // size of struct bpf_prog_info up to and including run_cnt
+	bpfProgInfoRunTimeNs = 192 // offset of run_time_ns in struct bpf_prog_info
+	bpfProgInfoRunCnt    = 200 // offset of run_cnt in struct bpf_prog_info
+)
+
+// queueStatRegex matches per queue ethtool counters, e.g. rx-0.packets, tx_queue_1_bytes or rx2_xdp_drop
+var queueStatRegex = regexp.MustCompile(`^(rx|tx)[-_]?(?:queue[-_]?)?(\d+)[-_.](.+)$`)
+
+/*
+DeviceStats holds the counters of a netdev. Counters holds the ethtool counters of the device,
+and Queues the per queue ethtool counters, keyed by queue and named without the queue number,
+e.g. rx_packets. The counters available depend on the driver.
+*/
+type DeviceStats struct {
+	Link     *LinkStats
+	Counters map[string]uint64
+	Queues   map[uint32]map[string]uint64
+	Xdp      *XdpStats
+}
+
+/*
+LinkStats holds the kernel counters of a netdev.
+*/
+type LinkStats struct {
+	RxPackets uint64
+	TxPackets uint64
+	RxBytes   uint64
+	TxBytes   uint64
+	RxErrors  uint64
+	TxErrors  uint64
+	RxDropped uint64
+	TxDropped uint64
+}
+
+/*
+XdpStats holds the counters of the XDP program attached to a netdev. RunCount and RunTimeNs are
+only counted by the kernel while kernel.bpf_stats_enabled is set. Counters holds the XDP counters
+of the driver, such as redirects and drops, summed over the queues.
+*/
+type XdpStats struct {
+	ProgramID uint32
+	RunCount  uint64
+	RunTimeNs uint64
+	Counters  map[string]uint64
+}
+
+/*
+GetDeviceStats takes a netdev name and returns its DeviceStats. If netnsPath is not empty the
+netdev is looked up in that network namespace, as in GetDeviceInfo.
+*/
+func (r *handler) GetDeviceStats(netnsPath string, interfaceName string) (*DeviceStats, error) {
+	if netnsPath == "" {
+		return getDeviceStats(interfaceName)
+	}
+
+	var stats *DeviceStats
+	err := ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		var err error
+		stats, err = getDeviceStats(interfaceName)
+		return err
+	})
+	return stats, err
+}
+
+func getDeviceStats(interfaceName string) (*DeviceStats, error) {
+	link, err := netlink.LinkByName(interfaceName)
+	if err != nil {
+		return nil, err
+	}
+	attrs := link.Attrs()
+
+	stats := &DeviceStats{
+		Counters: make(map[string]uint64),
+		Queues:   make(map[uint32]map[string]uint64),
+	}
+
+	if attrs.Statistics != nil {
+		stats.Link = &LinkStats{
+			RxPackets: attrs.Statistics.RxPackets,
+			TxPackets: attrs.Statistics.TxPackets,
+			RxBytes:   attrs.Statistics.RxBytes,
+			TxBytes:   attrs.Statistics.TxBytes,
+			RxErrors:  attrs.Statistics.RxErrors,
+			TxErrors:  attrs.Statistics.TxErrors,
+			RxDropped: attrs.Statistics.RxDropped,
+			TxDropped: attrs.Statistics.TxDropped,
+		}
+	}
+
+	xdpCounters := make(map[string]uint64)
+
+	e, err := _ethtool.NewEthtool()
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+
+	counters, err := e.Stats(attrs.Name)
+	if err != nil {
+		logging.Debugf("Unable to read ethtool stats of device %s: %v", interfaceName, err)
+	}
+
+	maxQueues := attrs.NumRxQueues
+	if attrs.NumTxQueues > maxQueues {
+		maxQueues = attrs.NumTxQueues
+	}
+
+	for name, value := range counters {
+		counter := name
+		if queue, queueCounter, ok := parseQueueStat(name, maxQueues); ok {
+			if stats.Queues[queue] == nil {
+				stats.Queues[queue] = make(map[string]uint64)
+			}
+			stats.Queues[queue][queueCounter] = value
+			counter = queueCounter
+		} else {
+			stats.Counters[name] = value
+		}
+
+		if strings.Contains(strings.ToLower(counter), "xdp") {
+			xdpCounters[counter] += value
+		}
+	}
+
+	if attrs.Xdp != nil && attrs.Xdp.ProgId != 0 {
+		stats.Xdp = &XdpStats{ProgramID: attrs.Xdp.ProgId, Counters: xdpCounters}
+		stats.Xdp.RunCount, stats.Xdp.RunTimeNs, err = getBpfProgRunStats(attrs.Xdp.ProgId)
+		if err != nil {
+			logging.Debugf("Unable to read stats of XDP program %d on device %s: %v", attrs.Xdp.ProgId, interfaceName, err)
+		}
+	} else if len(xdpCounters) > 0 {
+		stats.Xdp = &XdpStats{Counters: xdpCounters}
+	}
+
+	return stats, nil
+}
+
+/*
+parseQueueStat takes an ethtool counter name and, if it is a per queue counter, returns the
+queue and the counter name without the queue number. Queues beyond the number of queues of
+the device are not accepted, so counters such as rx_1024_to_1518_packets are not mistaken
+for queue counters.
+*/
+func parseQueueStat(name string, maxQueues int) (uint32, string, bool) {
+	match := queueStatRegex.FindStringSubmatch(name)
+	if match == nil {
+		return 0, "", false
+	}
+
+	queue, err := strconv.Atoi(match[2])
+	if err != nil || queue >= maxQueues {
+		return 0, "", false
+	}
+
+	counter := strings.NewReplacer(".", "_", "-", "_").Replace(match[3])
+	if !strings.HasPrefix(counter, match[1]+"_") {
+		counter = match[1] + "_" + counter
+	}
+	return uint32(queue), counter, true
+}
+
+/*
+getBpfProgRunStats reads the run count and run time of a BPF program from the kernel.
+Only the start of struct bpf_prog_info is requested, the kernel accepts a shorter struct.
+*/
+func getBpfProgRunStats(progID uint32) (uint64, uint64, error) {
+	idAttr := struct {
+		progID    uint32
+		nextID    uint32
+		openFlags uint32
+	}{progID: progID}
+
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_GET_FD_BY_ID, uintptr(unsafe.Pointer(&idAttr)), unsafe.Sizeof(idAttr))
+	if errno != 0 {
+		return 0, 0, fmt.Errorf("error opening BPF program %d: %w", progID, errno)
+	}
+	defer unix.Close(int(fd))
+
+	var info [bpfProgInfoSize]byte
+	infoAttr := struct {
+		bpfFd   uint32
+		infoLen uint32
+		info    unsafe.Pointer
+	}{
+		bpfFd:   uint32(fd),
+		infoLen: uint32(len(info)),
+		info:    unsafe.Pointer(&info[0]),
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_OBJ_GET_INFO_BY_FD, uintptr(unsafe.Pointer(&infoAttr)), unsafe.Sizeof(infoAttr)); errno != 0 {
+		return 0, 0, fmt.Errorf("error reading info of BPF program %d: %w", progID, errno)
+	}
+
+	runTime := nl.NativeEndian().Uint64(info[bpfProgInfoRunTimeNs:])
+	runCount := nl.NativeEndian().Uint64(info[bpfProgInfoRunCnt:])
+	return runCount, runTime, nil
+}
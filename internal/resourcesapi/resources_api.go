@@ -16,12 +16,16 @@
 package resourcesapi
 
 import (
+	"encoding/json"
+	"fmt"
 	logging "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 	api "k8s.io/kubelet/pkg/apis/podresources/v1"
 	"net"
+	"os"
 	"time"
 )
 
@@ -29,8 +33,20 @@ const (
 	podResSockDir  = "/var/lib/kubelet/pod-resources"
 	podResSockPath = podResSockDir + "/kubelet.sock"
 	grpcTimeout    = 5 * time.Second
+	checkpointFile = pluginapi.DevicePluginPath + "kubelet_internal_checkpoint"
 )
 
+/*
+Allocation is a set of devices the kubelet has allocated to a container, as recorded
+in the kubelet device manager checkpoint
+*/
+type Allocation struct {
+	PodUID        string
+	ContainerName string
+	ResourceName  string
+	DeviceIDs     []string
+}
+
 /*
 Handler is the device plugins interface to the K8s pod resources API.
 The interface exists for testing purposes, allowing unit tests to test
@@ -38,6 +54,7 @@ against a fake API.
 */
 type Handler interface {
 	GetPodResources() (map[string]api.PodResources, error)
+	GetAllocations() ([]Allocation, error)
 }
 
 /*
@@ -53,7 +70,15 @@ func NewHandler() Handler {
 }
 
 /*
-GetPodResources calls the pod resources api and returns a map of pods and associated devices
+PodKey returns the key of a pod in the map returned by GetPodResources, namespace/name
+*/
+func PodKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+/*
+GetPodResources calls the pod resources api and returns a map of pods and associated devices.
+The map is keyed by namespace/name, see PodKey.
 */
 func (r *handler) GetPodResources() (map[string]api.PodResources, error) {
 	podResourceMap := make(map[string]api.PodResources)
@@ -65,7 +90,7 @@ func (r *handler) GetPodResources() (map[string]api.PodResources, error) {
 	}
 
 	for _, pod := range resp.GetPodResources() {
-		podResourceMap[pod.GetName()] = *pod
+		podResourceMap[PodKey(pod.GetNamespace(), pod.GetName())] = *pod
 	}
 
 	return podResourceMap, nil
@@ -102,3 +127,60 @@ func getPodResources(socket string) (*api.ListPodResourcesResponse, error) {
 
 	return resp, nil
 }
+
+/*
+GetAllocations reads the kubelet device manager checkpoint and returns the devices allocated
+to each container. Unlike the pod resources API, the checkpoint records the pod UID.
+*/
+func (r *handler) GetAllocations() ([]Allocation, error) {
+	data, err := os.ReadFile(checkpointFile)
+	if err != nil {
+		logging.Errorf("Error reading kubelet checkpoint: %v", err)
+		return nil, err
+	}
+
+	return parseCheckpoint(data)
+}
+
+/*
+parseCheckpoint parses the kubelet device manager checkpoint. Device IDs are recorded per NUMA
+node since Kubernetes 1.20, and as a plain list before that. Both formats are accepted.
+*/
+func parseCheckpoint(data []byte) ([]Allocation, error) {
+	var checkpoint struct {
+		Data struct {
+			PodDeviceEntries []struct {
+				PodUID        string
+				ContainerName string
+				ResourceName  string
+				DeviceIDs     json.RawMessage
+			}
+		}
+	}
+
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("error parsing kubelet checkpoint: %v", err)
+	}
+
+	var allocations []Allocation
+	for _, entry := range checkpoint.Data.PodDeviceEntries {
+		allocation := Allocation{
+			PodUID:        entry.PodUID,
+			ContainerName: entry.ContainerName,
+			ResourceName:  entry.ResourceName,
+		}
+
+		var perNuma map[string][]string
+		if err := json.Unmarshal(entry.DeviceIDs, &perNuma); err == nil {
+			for _, ids := range perNuma {
+				allocation.DeviceIDs = append(allocation.DeviceIDs, ids...)
+			}
+		} else if err := json.Unmarshal(entry.DeviceIDs, &allocation.DeviceIDs); err != nil {
+			return nil, fmt.Errorf("error parsing device IDs of pod %s in kubelet checkpoint: %v", entry.PodUID, err)
+		}
+
+		allocations = append(allocations, allocation)
+	}
+
+	return allocations, nil
+}
@@ -68,11 +68,34 @@ func (f *fakeHandler) GetPodResources() (map[string]api.PodResources, error) {
 	}
 
 	podResourceMap := make(map[string]api.PodResources)
-	podResourceMap[f.podName] = fakePod
+	podResourceMap[PodKey(f.namespace, f.podName)] = fakePod
 
 	return podResourceMap, nil
 }
 
+/*
+GetAllocations returns the devices allocated to each container.
+In this FakeHandler, it returns the devices of the pod configured through the CreateFakePod
+function, allocated to a pod with the UID returned by FakePodUID.
+*/
+func (f *fakeHandler) GetAllocations() ([]Allocation, error) {
+	return []Allocation{
+		{
+			PodUID:        FakePodUID(f.namespace, f.podName),
+			ContainerName: "container-01",
+			ResourceName:  f.resourceName,
+			DeviceIDs:     f.deviceIds,
+		},
+	}, nil
+}
+
+/*
+FakePodUID returns the UID of a pod created with CreateFakePod
+*/
+func FakePodUID(namespace string, podName string) string {
+	return "uid-" + namespace + "-" + podName
+}
+
 /*
 CreateFakePod allows us to configure our own fake pod and its associated devices.
 This pods data is what is returned when GetPodResources is called.
@@ -0,0 +1,128 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resourcesapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+perNumaCheckpoint is a kubelet device manager checkpoint as written since Kubernetes 1.20,
+with the device IDs of each allocation recorded per NUMA node
+*/
+const perNumaCheckpoint = `{
+	"Data": {
+		"PodDeviceEntries": [
+			{
+				"PodUID": "0a1b2c3d-1111-2222-3333-444455556666",
+				"ContainerName": "app",
+				"ResourceName": "afxdp/myPool",
+				"DeviceIDs": {"0": ["ens801f0"], "1": ["ens802f0"]},
+				"AllocResp": "CgQKAkEBEgA="
+			},
+			{
+				"PodUID": "6f5e4d3c-7777-8888-9999-000011112222",
+				"ContainerName": "sidecar",
+				"ResourceName": "intel.com/sriov",
+				"DeviceIDs": {"-1": ["0000:81:02.0"]},
+				"AllocResp": "CgA="
+			}
+		],
+		"RegisteredDevices": {"afxdp/myPool": ["ens801f0", "ens802f0"]}
+	},
+	"Checksum": 1234567890
+}`
+
+/*
+listCheckpoint is a kubelet device manager checkpoint as written before Kubernetes 1.20,
+with the device IDs of each allocation recorded as a plain list
+*/
+const listCheckpoint = `{
+	"Data": {
+		"PodDeviceEntries": [
+			{
+				"PodUID": "0a1b2c3d-1111-2222-3333-444455556666",
+				"ContainerName": "app",
+				"ResourceName": "afxdp/myPool",
+				"DeviceIDs": ["ens801f0", "ens802f0"],
+				"AllocResp": "CgQKAkEBEgA="
+			}
+		],
+		"RegisteredDevices": {"afxdp/myPool": ["ens801f0", "ens802f0"]}
+	},
+	"Checksum": 1234567890
+}`
+
+func TestParseCheckpoint(t *testing.T) {
+	testCases := []struct {
+		name           string
+		checkpoint     string
+		expAllocations []Allocation
+		expErr         string
+	}{
+		{
+			name:       "device IDs per NUMA node",
+			checkpoint: perNumaCheckpoint,
+			expAllocations: []Allocation{
+				{PodUID: "0a1b2c3d-1111-2222-3333-444455556666", ContainerName: "app", ResourceName: "afxdp/myPool", DeviceIDs: []string{"ens801f0", "ens802f0"}},
+				{PodUID: "6f5e4d3c-7777-8888-9999-000011112222", ContainerName: "sidecar", ResourceName: "intel.com/sriov", DeviceIDs: []string{"0000:81:02.0"}},
+			},
+		},
+		{
+			name:       "device IDs as a list",
+			checkpoint: listCheckpoint,
+			expAllocations: []Allocation{
+				{PodUID: "0a1b2c3d-1111-2222-3333-444455556666", ContainerName: "app", ResourceName: "afxdp/myPool", DeviceIDs: []string{"ens801f0", "ens802f0"}},
+			},
+		},
+		{
+			name:       "no allocations",
+			checkpoint: `{"Data": {"PodDeviceEntries": null, "RegisteredDevices": {}}, "Checksum": 0}`,
+		},
+		{
+			name:       "malformed checkpoint",
+			checkpoint: `{"Data": {"PodDeviceEntries": [`,
+			expErr:     "error parsing kubelet checkpoint",
+		},
+		{
+			name:       "malformed device IDs",
+			checkpoint: `{"Data": {"PodDeviceEntries": [{"PodUID": "uid", "ContainerName": "app", "ResourceName": "afxdp/myPool", "DeviceIDs": 1}]}}`,
+			expErr:     "error parsing device IDs of pod uid",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			allocations, err := parseCheckpoint([]byte(tc.checkpoint))
+			if tc.expErr != "" {
+				require.Error(t, err, "Expected an error")
+				assert.Contains(t, err.Error(), tc.expErr, "Unexpected error message")
+				return
+			}
+			require.NoError(t, err, "Unexpected error")
+			require.Len(t, allocations, len(tc.expAllocations), "Unexpected number of allocations")
+			for i, expected := range tc.expAllocations {
+				assert.Equal(t, expected.PodUID, allocations[i].PodUID, "Unexpected pod UID")
+				assert.Equal(t, expected.ContainerName, allocations[i].ContainerName, "Unexpected container name")
+				assert.Equal(t, expected.ResourceName, allocations[i].ResourceName, "Unexpected resource name")
+				assert.ElementsMatch(t, expected.DeviceIDs, allocations[i].DeviceIDs, "Unexpected device IDs")
+			}
+		})
+	}
+}
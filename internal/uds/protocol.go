@@ -0,0 +1,256 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uds
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+The v1 protocol exchanges JSON messages, each prefixed with its length as a 4 byte big endian
+integer. The first byte of a v1 message is always zero, while the requests of the original
+string protocol (0.1) always begin with a slash, so a server can serve both on the same socket.
+Every request carries an ID, which is returned in the response to that request.
+*/
+
+/*
+Message types of the v1 protocol
+*/
+const (
+	MessageVersion       = "version"          // negotiates the protocol version and capabilities, may be sent before connect
+	MessageConnect       = "connect"          // validates the pod and namespace, must succeed before the other requests are served
+	MessageXskMapFd      = "xsk_map_fd"       // requests the XSK map file descriptor of a device, returned in the control buffer
+	MessageBusyPoll      = "busy_poll"        // configures busy poll on the socket file descriptor in the request control buffer
+	MessageDeviceInfo    = "device_info"      // requests the ifindex, queues, allowed queue range, MTU and multi-buffer support of a device
+	MessageQueueXskMapFd = "queue_xsk_map_fd" // requests the XSK map file descriptor of a device for a range of queues, checked against the allowed range
+	MessageCreateXsk     = "create_xsk"       // creates an AF_XDP socket on the UMEM memfd in the request control buffer, returned in the response control buffer
+	MessageSockOpt       = "sockopt"          // sets privileged socket options, allowed by the pool, on the socket file descriptor in the request control buffer
+	MessageStats         = "stats"            // requests the device, queue and XDP counters of a device, and of its parent port in cdq mode
+	MessageFin           = "fin"              // ends the session
+)
+
+/*
+ErrorCode identifies the type of error in a v1 response
+*/
+type ErrorCode string
+
+/*
+Error codes of the v1 protocol
+*/
+const (
+	ErrBadRequest         ErrorCode = "bad_request"         // the request could not be decoded or has missing or invalid fields
+	ErrUnsupportedVersion ErrorCode = "unsupported_version" // none of the protocol versions offered by the client are supported
+	ErrNotConnected       ErrorCode = "not_connected"       // the request needs a validated pod, send connect first
+	ErrPodNotValid        ErrorCode = "pod_not_valid"       // the pod could not be validated for this socket
+	ErrDeviceNotFound     ErrorCode = "device_not_found"    // the device is not served on this socket
+	ErrBusyPoll           ErrorCode = "busy_poll_failed"    // busy poll could not be configured
+	ErrQueueRange         ErrorCode = "queue_out_of_range"  // the requested queues are outside the range allowed to the pod
+	ErrXsk                ErrorCode = "xsk_failed"          // the AF_XDP socket could not be created
+	ErrXskLimit           ErrorCode = "xsk_limit"           // the pod has reached the number of sockets or the UMEM size allowed to it
+	ErrInternal           ErrorCode = "internal"            // an error occurred on the device plugin end
+)
+
+/*
+Capabilities lists the requests, beyond version, connect and fin, that a server of this
+version can serve. The server returns the capabilities both it and the client support.
+*/
+var Capabilities = []string{MessageXskMapFd, MessageBusyPoll, MessageDeviceInfo, MessageQueueXskMapFd, MessageCreateXsk, MessageSockOpt, MessageStats}
+
+/*
+Request is a v1 protocol request. Fields not used by the request type are left empty.
+*/
+type Request struct {
+	ID           uint32    `json:"id"`
+	Type         string    `json:"type"`
+	Versions     []string  `json:"versions,omitempty"`
+	Capabilities []string  `json:"capabilities,omitempty"`
+	Pod          string    `json:"pod,omitempty"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Device       string    `json:"device,omitempty"`
+	BusyTimeout  int       `json:"busyTimeout,omitempty"`
+	BusyBudget   int       `json:"busyBudget,omitempty"`
+	QueueStart   int       `json:"queueStart,omitempty"`
+	QueueCount   int       `json:"queueCount,omitempty"`
+	Xsk          *Xsk      `json:"xsk,omitempty"`
+	SockOpts     []SockOpt `json:"sockOpts,omitempty"`
+}
+
+/*
+Xsk holds the settings of an AF_XDP socket created by the device plugin. The socket is bound to
+QueueID of the device and uses the UMEM memfd sent with the request. Sizes left at zero take the
+device plugin defaults, a chunk size of 4096 and rings of 2048 descriptors.
+*/
+type Xsk struct {
+	QueueID    uint32 `json:"queueId"`
+	ChunkSize  uint32 `json:"chunkSize,omitempty"`
+	Headroom   uint32 `json:"headroom,omitempty"`
+	FillSize   uint32 `json:"fillSize,omitempty"`
+	CompSize   uint32 `json:"compSize,omitempty"`
+	RxSize     uint32 `json:"rxSize,omitempty"`
+	TxSize     uint32 `json:"txSize,omitempty"`
+	NeedWakeup bool   `json:"needWakeup,omitempty"`
+}
+
+/*
+SockOpt is a socket option to set, named as in the socket(7) man page, e.g. SO_PRIORITY.
+*/
+type SockOpt struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+/*
+SockOptResult reports whether a requested socket option was set. Reason explains why an
+option was rejected or could not be set.
+*/
+type SockOptResult struct {
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+/*
+Response is a v1 protocol response. Error is nil if the request succeeded.
+*/
+type Response struct {
+	ID           uint32          `json:"id"`
+	Type         string          `json:"type"`
+	Error        *Error          `json:"error,omitempty"`
+	Version      string          `json:"version,omitempty"`
+	Capabilities []string        `json:"capabilities,omitempty"`
+	DeviceInfo   *DeviceInfo     `json:"deviceInfo,omitempty"`
+	SockOpts     []SockOptResult `json:"sockOpts,omitempty"`
+	Stats        *Stats          `json:"stats,omitempty"`
+}
+
+/*
+DeviceInfo describes a device served on the socket, as seen in the pod network namespace.
+The pod may bind XSKs to queues QueueStart to QueueStart+QueueCount-1, the queues packets are
+steered to by the RSS table and ntuple rules of the device. MultiBuffer is
+omitted if the kernel does not report whether the device supports multi-buffer XDP.
+*/
+type DeviceInfo struct {
+	Ifindex     int    `json:"ifindex"`
+	Queues      uint32 `json:"queues"`
+	QueueStart  uint32 `json:"queueStart"`
+	QueueCount  uint32 `json:"queueCount"`
+	Mtu         int    `json:"mtu"`
+	MultiBuffer *bool  `json:"multiBuffer,omitempty"`
+}
+
+/*
+Error is the error of a failed v1 request
+*/
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return string(e.Code)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+/*
+IsMessage returns true if a message read from the socket is a v1 protocol message
+*/
+func IsMessage(msg string) bool {
+	return len(msg) >= 4 && msg[0] == 0
+}
+
+/*
+EncodeMessage encodes a v1 request or response as length-prefixed JSON
+*/
+func EncodeMessage(v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(msg, uint32(len(payload)))
+	copy(msg[4:], payload)
+	return string(msg), nil
+}
+
+/*
+DecodeMessage decodes a length-prefixed JSON v1 message into a request or response
+*/
+func DecodeMessage(msg string, v interface{}) error {
+	if !IsMessage(msg) {
+		return fmt.Errorf("not a v1 protocol message")
+	}
+
+	length := binary.BigEndian.Uint32([]byte(msg[:4]))
+	if int(length) != len(msg)-4 {
+		return fmt.Errorf("message length %d does not match the %d bytes received", length, len(msg)-4)
+	}
+
+	return json.Unmarshal([]byte(msg[4:]), v)
+}
+
+/*
+Stats holds the counters of a device served on the socket. Link holds the kernel counters and
+Counters the driver ethtool counters, which vary by driver. Queues holds the per queue ethtool
+counters, named without the queue number, e.g. rx_packets. Parent holds the counters of the
+parent port of a CDQ subfunction, which the pod cannot see.
+*/
+type Stats struct {
+	Device   string            `json:"device"`
+	Link     *LinkStats        `json:"link,omitempty"`
+	Counters map[string]uint64 `json:"counters,omitempty"`
+	Queues   []QueueStats      `json:"queues,omitempty"`
+	Xdp      *XdpStats         `json:"xdp,omitempty"`
+	Parent   *Stats            `json:"parent,omitempty"`
+}
+
+/*
+LinkStats holds the kernel counters of a device.
+*/
+type LinkStats struct {
+	RxPackets uint64 `json:"rxPackets"`
+	TxPackets uint64 `json:"txPackets"`
+	RxBytes   uint64 `json:"rxBytes"`
+	TxBytes   uint64 `json:"txBytes"`
+	RxErrors  uint64 `json:"rxErrors"`
+	TxErrors  uint64 `json:"txErrors"`
+	RxDropped uint64 `json:"rxDropped"`
+	TxDropped uint64 `json:"txDropped"`
+}
+
+/*
+QueueStats holds the ethtool counters of a queue.
+*/
+type QueueStats struct {
+	Queue    uint32            `json:"queue"`
+	Counters map[string]uint64 `json:"counters"`
+}
+
+/*
+XdpStats holds the counters of the XDP program loaded on a device. RunCount and RunTimeNs are
+only counted while kernel.bpf_stats_enabled is set on the node. Counters holds the XDP counters
+of the driver, such as redirects and drops, summed over the queues.
+*/
+type XdpStats struct {
+	ProgramID uint32            `json:"programId,omitempty"`
+	RunCount  uint64            `json:"runCount"`
+	RunTimeNs uint64            `json:"runTimeNs"`
+	Counters  map[string]uint64 `json:"counters,omitempty"`
+}
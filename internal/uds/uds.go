@@ -16,8 +16,10 @@
 package uds
 
 import (
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/host"
 	logging "github.com/sirupsen/logrus"
 	"net"
@@ -35,11 +37,23 @@ on a real socket.
 type Handler interface {
 	Init(socketPath string, protocol string, msgBufSize int, ctlBufSize int, timeout time.Duration, uid string) error
 	Listen() (CleanupFunc, error)
+	Accept() (Conn, error)
 	Dial() (CleanupFunc, error)
 	Read() (string, int, error)
 	Write(response string, fd int) error
 }
 
+/*
+Conn is a single connection accepted on a listening Unix domain socket.
+A server can hold several connections on the same socket, each read and written independently.
+*/
+type Conn interface {
+	Read() (string, int, error)
+	Write(response string, fd int) error
+	PeerCredentials() (*syscall.Ucred, error)
+	Close()
+}
+
 /*
 handler implements the Handler interface.
 */
@@ -95,9 +109,10 @@ func (h *handler) Init(socketPath string, protocol string, msgBufSize int, ctlBu
 }
 
 /*
-Listen listens for and accepts new connections.
+Listen creates the Unix domain socket and listens for new connections.
+Connections are then taken with Accept.
 A CleanupFunc function is returned. This function should be deferred by the calling code
-to ensure proper socket cleanup.
+to ensure proper socket cleanup. Calling it also stops any Accept waiting on the socket.
 */
 func (h *handler) Listen() (CleanupFunc, error) {
 	var err error
@@ -121,30 +136,40 @@ func (h *handler) Listen() (CleanupFunc, error) {
 		}
 	}
 
-	if h.timeout > 0 {
-		if err := h.listener.SetDeadline(time.Now().Add(h.timeout)); err != nil {
-			logging.Errorf("Error setting listener timeout: %v", err)
-			return func() { h.cleanup() }, err
-		}
+	return func() { h.cleanup() }, nil
+}
+
+/*
+Accept waits for and accepts a new connection on the listening socket.
+The returned connection shares the settings of the handler, including the read timeout,
+and must be closed by the calling code.
+*/
+func (h *handler) Accept() (Conn, error) {
+	if h.listener == nil {
+		return nil, fmt.Errorf("socket %s is not listening", h.socketPath)
 	}
 
-	h.conn, err = h.listener.AcceptUnix()
+	conn, err := h.listener.AcceptUnix()
 	if err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			logging.Errorf("Listener timed out: %v", err)
-			return func() { h.cleanup() }, err
+		if errors.Is(err, net.ErrClosed) {
+			logging.Debugf("Unix listener for %s closed", h.socketPath)
+			return nil, err
 		}
 		logging.Errorf("Listener Accept error: %v", err)
-		return func() { h.cleanup() }, err
+		return nil, err
 	}
 
-	return func() { h.cleanup() }, nil
+	c := *h
+	c.listener = nil
+	c.conn = conn
+	return &c, nil
 }
 
 /*
 Dial creates a new connection
 A CleanupFunc function is returned. This function should be deferred by the calling code
-to ensure proper socket cleanup.
+to close the connection. The socket file belongs to the server and is left in place, so
+the client can connect again later.
 */
 func (h *handler) Dial() (CleanupFunc, error) {
 	var err error
@@ -153,21 +178,22 @@ func (h *handler) Dial() (CleanupFunc, error) {
 	h.conn, err = net.DialUnix(h.protocol, nil, h.addr)
 	if err != nil {
 		logging.Errorf("Error dialling Unix connection on %s: %v", h.socketPath, err)
-		return func() { h.cleanup() }, err
+		return func() {}, err
 	}
 
-	return func() { h.cleanup() }, nil
+	return func() { h.Close() }, nil
 }
 
 /*
 Read will read the incoming message from the UDS.
 Message byte array is converted and returned as a string.
 The control messages are also checked and returns the FD as an int, if present.
+The message buffer is sized to the message if it is larger than the buffer size of the
+handler, as v1 messages such as device stats can be, up to the message limit.
 */
 func (h *handler) Read() (string, int, error) {
 	var request = ""
 	var fd int = 0
-	msgBuf := make([]byte, h.msgBufSize)
 	ctrlBuf := make([]byte, syscall.CmsgSpace(h.ctlBufSize))
 
 	if h.timeout > 0 {
@@ -177,7 +203,21 @@ func (h *handler) Read() (string, int, error) {
 		}
 	}
 
-	n, _, _, _, err := h.conn.ReadMsgUnix(msgBuf, ctrlBuf)
+	bufSize := h.msgBufSize
+	size, err := h.messageSize()
+	if err != nil {
+		// the same error is returned by the read below
+		logging.Debugf("Unable to get size of next message: %v", err)
+	} else if size > constants.Uds.MsgLimit {
+		err = fmt.Errorf("message of %d bytes is larger than the limit of %d bytes", size, constants.Uds.MsgLimit)
+		logging.Errorf("Read error: %v", err)
+		return request, fd, err
+	} else if size > bufSize {
+		bufSize = size
+	}
+	msgBuf := make([]byte, bufSize)
+
+	n, _, flags, _, err := h.conn.ReadMsgUnix(msgBuf, ctrlBuf)
 	if err != nil {
 		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 			logging.Errorf("Connection timed out: %v", err)
@@ -186,6 +226,11 @@ func (h *handler) Read() (string, int, error) {
 		logging.Errorf("ReadMsgUnix error: %v", err)
 		return request, fd, err
 	}
+	if flags&syscall.MSG_TRUNC != 0 {
+		err = fmt.Errorf("message truncated to %d bytes", n)
+		logging.Errorf("Read error: %v", err)
+		return request, fd, err
+	}
 
 	request = string(msgBuf[0:n])
 	logging.Debugf("Read: %s", request)
@@ -211,6 +256,30 @@ func (h *handler) Read() (string, int, error) {
 	return request, fd, err
 }
 
+/*
+messageSize returns the size of the next message on the connection, without reading it.
+The message is peeked with MSG_TRUNC, so the full size of a SOCK_SEQPACKET message is
+returned whatever the size of the peek buffer.
+*/
+func (h *handler) messageSize() (int, error) {
+	raw, err := h.conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var size int
+	var recvErr error
+	err = raw.Read(func(fd uintptr) bool {
+		var peek [4]byte
+		size, _, recvErr = syscall.Recvfrom(int(fd), peek[:], syscall.MSG_PEEK|syscall.MSG_TRUNC)
+		return recvErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, recvErr
+}
+
 /*
 Write will take a string, convert it to byte array and write to UDS
 If a file descriptor is included, Write will configure and include it
@@ -236,6 +305,45 @@ func (h *handler) Write(response string, fd int) error {
 	return nil
 }
 
+/*
+PeerCredentials returns the credentials of the process on the other end of the connection,
+as reported by the kernel through SO_PEERCRED. These are the credentials of the peer when it
+connected, and cannot be set by the peer. The PID is in the PID namespace of this process.
+*/
+func (h *handler) PeerCredentials() (*syscall.Ucred, error) {
+	if h.conn == nil {
+		return nil, fmt.Errorf("socket %s is not connected", h.socketPath)
+	}
+
+	rawConn, err := h.conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, fmt.Errorf("error getting peer credentials: %v", credErr)
+	}
+
+	return cred, nil
+}
+
+/*
+Close closes the connection. The socket itself is left in place.
+*/
+func (h *handler) Close() {
+	if h.conn != nil {
+		logging.Debugf("Closing connection")
+		h.conn.Close()
+	}
+}
+
 /*
 GenerateRandomSocketName will take the file directory path, and apply a unique name per each
 UDS socket file created.
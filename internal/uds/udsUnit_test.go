@@ -17,8 +17,10 @@ package uds
 
 import (
 	"errors"
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -96,3 +98,114 @@ func TestInit(t *testing.T) {
 		})
 	}
 }
+
+func TestMessage(t *testing.T) {
+	request := &Request{ID: 7, Type: MessageXskMapFd, Device: "ens801f0"}
+	encoded, err := EncodeMessage(request)
+	require.NoError(t, err, "Unexpected error encoding message")
+
+	testCases := []struct {
+		name      string
+		msg       string
+		isMessage bool
+		expReq    *Request
+		expErr    bool
+	}{
+		{
+			name:      "v1 request",
+			msg:       encoded,
+			isMessage: true,
+			expReq:    request,
+		},
+		{
+			name:      "0.1 request",
+			msg:       "/xsk_map_fd, ens801f0",
+			isMessage: false,
+			expErr:    true,
+		},
+		{
+			name:      "truncated request",
+			msg:       encoded[:len(encoded)-1],
+			isMessage: true,
+			expErr:    true,
+		},
+		{
+			name:      "short request",
+			msg:       "\x00\x00",
+			isMessage: false,
+			expErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.isMessage, IsMessage(tc.msg), "Unexpected message detection")
+
+			var decoded Request
+			err := DecodeMessage(tc.msg, &decoded)
+			if tc.expErr {
+				assert.Error(t, err, "Error was expected")
+				return
+			}
+			require.NoError(t, err, "Unexpected error decoding message")
+			assert.Equal(t, *tc.expReq, decoded, "Decoded request does not match")
+		})
+	}
+}
+
+func TestReadLargeMessage(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+
+	server := NewHandler()
+	require.NoError(t, server.Init(socketPath, constants.Uds.Protocol, constants.Uds.MaxMsgSize, constants.Uds.CtlBufSize, time.Second, "0"), "Unexpected error initialising server")
+	cleanup, err := server.Listen()
+	require.NoError(t, err, "Unexpected error listening")
+	defer cleanup()
+
+	client := NewHandler()
+	require.NoError(t, client.Init(socketPath, constants.Uds.Protocol, constants.Uds.MaxMsgSize, constants.Uds.CtlBufSize, time.Second, "0"), "Unexpected error initialising client")
+	disconnect, err := client.Dial()
+	require.NoError(t, err, "Unexpected error dialling")
+	defer disconnect()
+
+	conn, err := server.Accept()
+	require.NoError(t, err, "Unexpected error accepting")
+	defer conn.Close()
+
+	stats := &Stats{Device: "ens801f0"}
+	for queue := uint32(0); queue < 256; queue++ {
+		stats.Queues = append(stats.Queues, QueueStats{Queue: queue, Counters: map[string]uint64{"packets": 1000000, "bytes": 64000000}})
+	}
+	response := &Response{ID: 7, Type: MessageStats, Stats: stats}
+	msg, err := EncodeMessage(response)
+	require.NoError(t, err, "Unexpected error encoding message")
+	require.Greater(t, len(msg), constants.Uds.MaxMsgSize, "Message should be larger than the message buffer")
+
+	testCases := []struct {
+		name   string
+		msg    string
+		expMsg string
+	}{
+		{
+			name:   "message larger than the buffer",
+			msg:    msg,
+			expMsg: msg,
+		},
+		{
+			name:   "message smaller than the buffer",
+			msg:    "/version",
+			expMsg: "/version",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, conn.Write(tc.msg, -1), "Unexpected error writing")
+
+			read, fd, err := client.Read()
+			require.NoError(t, err, "Unexpected error reading")
+			assert.Equal(t, 0, fd, "Unexpected file descriptor")
+			assert.Equal(t, tc.expMsg, read, "Message read does not match")
+		})
+	}
+}
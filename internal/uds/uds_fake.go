@@ -15,14 +15,25 @@
 
 package uds
 
-import "time"
+import (
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
 
 /*
 FakeHandler interface extends the Handler interface to provide additional testing methods.
 */
 type FakeHandler interface {
 	Handler
+	Close()
+	PeerCredentials() (*syscall.Ucred, error)
 	SetRequests(requests map[int]string)
+	SetRequestFds(fds map[int]int)
+	SetSessions(sessions int)
+	SetKeepListening(keep bool)
+	SetPeerPid(pid int32)
 	GetResponses() map[int]string
 }
 
@@ -31,7 +42,14 @@ fakeHandler implements the Handler interface.
 */
 type fakeHandler struct {
 	counter         int
+	sessions        int
+	open            chan struct{}
+	listening       chan struct{}
+	keepListening   bool
+	mutex           sync.Mutex
+	peerPid         int32
 	fakeRequests    map[int]string
+	fakeRequestFds  map[int]int
 	actualResponses map[int]string
 }
 
@@ -54,10 +72,61 @@ func (f *fakeHandler) Init(socketPath string, protocol string, msgbufSize int, c
 
 /*
 Listen listens for and accepts new connections.
-In this fakeHandler it does nothing.
+In this fakeHandler it returns a cleanup function that stops Accept waiting for new sessions.
 */
 func (f *fakeHandler) Listen() (CleanupFunc, error) {
-	return func() {}, nil
+	listening := make(chan struct{})
+	var once sync.Once
+
+	f.mutex.Lock()
+	f.listening = listening
+	f.mutex.Unlock()
+
+	return func() { once.Do(func() { close(listening) }) }, nil
+}
+
+/*
+Accept waits for and accepts a new connection.
+In this fakeHandler it returns itself as the connection, once for each session set with SetSessions.
+It waits for the previous connection to be closed, so sessions are served one after another, and
+returns a closed listener error once all sessions have been accepted. If SetKeepListening was
+set, it first waits for the listener to be closed.
+*/
+func (f *fakeHandler) Accept() (Conn, error) {
+	f.mutex.Lock()
+	open := f.open
+	f.mutex.Unlock()
+	if open != nil {
+		<-open
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.sessions <= 0 {
+		if f.keepListening && f.listening != nil {
+			listening := f.listening
+			f.mutex.Unlock()
+			<-listening
+			f.mutex.Lock()
+		}
+		return nil, net.ErrClosed
+	}
+	f.sessions--
+	f.open = make(chan struct{})
+	return f, nil
+}
+
+/*
+Close closes the connection.
+In this fakeHandler it allows the next session to be accepted.
+*/
+func (f *fakeHandler) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.open != nil {
+		close(f.open)
+		f.open = nil
+	}
 }
 
 /*
@@ -70,11 +139,12 @@ func (f *fakeHandler) Dial() (CleanupFunc, error) {
 
 /*
 Read should read the incoming message from the UDS.
-In this fakeHandler it will sequentially return a set of predetermined strings.
+In this fakeHandler it will sequentially return a set of predetermined strings,
+and the file descriptors set with SetRequestFds.
 */
 func (f *fakeHandler) Read() (string, int, error) {
 	request := f.fakeRequests[f.counter]
-	return request, 0, nil
+	return request, f.fakeRequestFds[f.counter], nil
 }
 
 /*
@@ -87,6 +157,21 @@ func (f *fakeHandler) Write(response string, fd int) error {
 	return nil
 }
 
+/*
+PeerCredentials returns the credentials of the process on the other end of the connection.
+In this fakeHandler it returns the PID set with SetPeerPid.
+*/
+func (f *fakeHandler) PeerCredentials() (*syscall.Ucred, error) {
+	return &syscall.Ucred{Pid: f.peerPid}, nil
+}
+
+/*
+SetPeerPid sets the PID returned by PeerCredentials.
+*/
+func (f *fakeHandler) SetPeerPid(pid int32) {
+	f.peerPid = pid
+}
+
 /*
 SetRequests takes a map of strings. These strings will be sequentially returned
 each time the Read function is called. This allows us to build a list of fake
@@ -94,7 +179,35 @@ requests we want to make over the UDS.
 */
 func (f *fakeHandler) SetRequests(requests map[int]string) {
 	f.fakeRequests = requests
+	f.fakeRequestFds = nil
 	f.counter = 0
+	f.sessions = 1
+}
+
+/*
+SetRequestFds takes a map of file descriptors, returned by the Read function along with
+the request of the same index set with SetRequests.
+*/
+func (f *fakeHandler) SetRequestFds(fds map[int]int) {
+	f.fakeRequestFds = fds
+}
+
+/*
+SetSessions sets the number of connections Accept returns before the listener is closed.
+The requests set with SetRequests are read across all sessions in order.
+*/
+func (f *fakeHandler) SetSessions(sessions int) {
+	f.sessions = sessions
+}
+
+/*
+SetKeepListening sets whether Accept keeps waiting for the listener to be closed once all
+sessions have been accepted, rather than returning straight away.
+*/
+func (f *fakeHandler) SetKeepListening(keep bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.keepListening = keep
 }
 
 /*
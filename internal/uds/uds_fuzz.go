@@ -21,7 +21,10 @@ import (
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/logformats"
 	logging "github.com/sirupsen/logrus"
 	"io"
+	"net"
 	"os"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -43,13 +46,15 @@ type FuzzHandler interface {
 fuzzHandler implements the Handler interface.
 */
 type fuzzHandler struct {
+	accepted bool
+	closed   chan struct{}
 }
 
 /*
 NewFuzzHandler returns a fuzz implementation of the Handler interface.
 */
 func NewFuzzHandler() Handler {
-	return &fuzzHandler{}
+	return &fuzzHandler{closed: make(chan struct{})}
 }
 
 /*
@@ -65,11 +70,32 @@ func (f *fuzzHandler) Init(socketPath string, protocol string, msgbufSize int, c
 }
 
 /*
-Listen listens for and accepts new connections.
-fuzzHandler returns nil as it's functionality isn't required for fuzz testing.
+Listen listens for new connections.
+fuzzHandler returns a cleanup function that stops Accept, as listening isn't required for fuzz testing.
 */
 func (f *fuzzHandler) Listen() (CleanupFunc, error) {
-	return func() {}, nil
+	var once sync.Once
+	return func() { once.Do(func() { close(f.closed) }) }, nil
+}
+
+/*
+Accept waits for and accepts a new connection.
+fuzzHandler returns itself as a single connection, then waits for the listener to be cleaned up.
+*/
+func (f *fuzzHandler) Accept() (Conn, error) {
+	if !f.accepted {
+		f.accepted = true
+		return f, nil
+	}
+	<-f.closed
+	return nil, net.ErrClosed
+}
+
+/*
+Close closes the connection.
+fuzzHandler does nothing as it's functionality isn't required for fuzz testing.
+*/
+func (f *fuzzHandler) Close() {
 }
 
 /*
@@ -100,6 +126,14 @@ func (f *fuzzHandler) Read() (string, int, error) {
 	return fuzzResponse, fd, nil
 }
 
+/*
+PeerCredentials returns the credentials of the process on the other end of the connection.
+fuzzHandler returns the credentials of this process, as the fuzzer is its own peer.
+*/
+func (f *fuzzHandler) PeerCredentials() (*syscall.Ucred, error) {
+	return &syscall.Ucred{Pid: int32(os.Getpid()), Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}, nil
+}
+
 /*
 Write should write a string to the UDS.
 fuzzHandler returns nil as it's functionality isn't required for fuzz testing.
@@ -0,0 +1,518 @@
+/*
+ * Copyright(c) 2022 Intel Corporation.
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udsserver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/bpf"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/tools"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/uds"
+	logging "github.com/sirupsen/logrus"
+)
+
+/*
+handleMessage serves a request of the v1 protocol. Version requests can be sent at any time,
+other requests need a validated pod. A failed pod validation ends the session, as in the
+original protocol. It returns true when the session should end.
+A file descriptor received with the request is closed once the request is served, unless the
+request reaches a handler that takes ownership of it, as the create_xsk and sockopt handlers do.
+*/
+func (s *session) handleMessage(msg string, fd int) (bool, error) {
+	var request uds.Request
+	err := uds.DecodeMessage(msg, &request)
+	handlerOwnsFd := err == nil && s.connected && (request.Type == uds.MessageCreateXsk || request.Type == uds.MessageSockOpt)
+	if fd > 0 && !handlerOwnsFd {
+		defer syscall.Close(fd)
+	}
+	if err != nil {
+		logging.Warningf("Pod "+s.podName+" - Unable to decode request: %v", err)
+		return false, s.writeError(&request, uds.ErrBadRequest, err.Error())
+	}
+
+	if !s.connected && request.Type != uds.MessageVersion && request.Type != uds.MessageConnect && request.Type != uds.MessageFin {
+		return false, s.writeError(&request, uds.ErrNotConnected, "connect must succeed before "+request.Type)
+	}
+
+	switch request.Type {
+	case uds.MessageVersion:
+		return false, s.handleVersionMessage(&request)
+
+	case uds.MessageConnect:
+		return s.handleConnectMessage(&request)
+
+	case uds.MessageXskMapFd:
+		return false, s.handleFdMessage(&request)
+
+	case uds.MessageBusyPoll:
+		return false, s.handleBusyPollMessage(&request, fd)
+
+	case uds.MessageDeviceInfo:
+		return false, s.handleDeviceInfoMessage(&request)
+
+	case uds.MessageQueueXskMapFd:
+		return false, s.handleQueueFdMessage(&request)
+
+	case uds.MessageCreateXsk:
+		return false, s.handleCreateXskMessage(&request, fd)
+
+	case uds.MessageSockOpt:
+		return false, s.handleSockOptMessage(&request, fd)
+
+	case uds.MessageStats:
+		return false, s.handleStatsMessage(&request)
+
+	case uds.MessageFin:
+		return true, s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type}, -1)
+
+	default:
+		return false, s.writeError(&request, uds.ErrBadRequest, "unknown request type "+request.Type)
+	}
+}
+
+/*
+handleVersionMessage picks the protocol version from those offered by the client and returns
+the capabilities supported by both the server and the client. If the client offers no
+capabilities, all server capabilities are returned.
+*/
+func (s *session) handleVersionMessage(request *uds.Request) error {
+	supported := false
+	major := strings.Split(constants.Uds.Handshake.ProtocolVersion, ".")[0]
+	for _, version := range request.Versions {
+		if strings.Split(version, ".")[0] == major {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return s.writeError(request, uds.ErrUnsupportedVersion, fmt.Sprintf("server supports protocol version %s", constants.Uds.Handshake.ProtocolVersion))
+	}
+
+	capabilities := uds.Capabilities
+	if len(request.Capabilities) > 0 {
+		capabilities = nil
+		for _, capability := range uds.Capabilities {
+			if tools.ArrayContains(request.Capabilities, capability) {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+
+	return s.writeMessage(&uds.Response{
+		ID:           request.ID,
+		Type:         request.Type,
+		Version:      constants.Uds.Handshake.ProtocolVersion,
+		Capabilities: capabilities,
+	}, -1)
+}
+
+func (s *session) handleConnectMessage(request *uds.Request) (bool, error) {
+	if request.Pod == "" {
+		return false, s.writeError(request, uds.ErrBadRequest, "pod name is required")
+	}
+
+	connected, err := s.validatePod(request.Pod, request.Namespace)
+	if err != nil {
+		logging.Errorf("Error validating host %s: %v", request.Pod, err)
+		return true, s.writeError(request, uds.ErrInternal, "unable to validate pod")
+	}
+	if !connected {
+		return true, s.writeError(request, uds.ErrPodNotValid, "pod "+request.Pod+" is not valid for this socket")
+	}
+
+	s.connected = true
+	s.podName = request.Pod
+	return false, s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type}, -1)
+}
+
+func (s *session) handleFdMessage(request *uds.Request) error {
+	fd, ok := s.devices[request.Device]
+	if !ok {
+		logging.Warningf("Pod " + s.podName + " - Device " + request.Device + " not recognised")
+		return s.writeError(request, uds.ErrDeviceNotFound, "device "+request.Device+" is not served on this socket")
+	}
+
+	logging.Debugf("Pod " + s.podName + " - Device " + request.Device + " recognised")
+	return s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type}, fd)
+}
+
+func (s *session) handleDeviceInfoMessage(request *uds.Request) error {
+	if _, ok := s.devices[request.Device]; !ok {
+		logging.Warningf("Pod " + s.podName + " - Device " + request.Device + " not recognised")
+		return s.writeError(request, uds.ErrDeviceNotFound, "device "+request.Device+" is not served on this socket")
+	}
+
+	info, err := s.deviceInfo(request.Device)
+	if err != nil {
+		logging.Errorf("Pod "+s.podName+" - Error getting info of device "+request.Device+": %v", err)
+		return s.writeError(request, uds.ErrInternal, "unable to get info of device "+request.Device)
+	}
+
+	return s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type, DeviceInfo: info}, -1)
+}
+
+/*
+handleQueueFdMessage returns the XSK map file descriptor of a device, but only if the requested
+queues are within the range allowed to the pod. The range is checked against the device as it
+is now, so queues changed since allocation are taken into account.
+*/
+func (s *session) handleQueueFdMessage(request *uds.Request) error {
+	fd, ok := s.devices[request.Device]
+	if !ok {
+		logging.Warningf("Pod " + s.podName + " - Device " + request.Device + " not recognised")
+		return s.writeError(request, uds.ErrDeviceNotFound, "device "+request.Device+" is not served on this socket")
+	}
+
+	if request.QueueStart < 0 || request.QueueCount < 1 {
+		return s.writeError(request, uds.ErrBadRequest, "queue start must be zero or more and queue count one or more")
+	}
+
+	info, err := s.deviceInfo(request.Device)
+	if err != nil {
+		logging.Errorf("Pod "+s.podName+" - Error getting info of device "+request.Device+": %v", err)
+		return s.writeError(request, uds.ErrInternal, "unable to get info of device "+request.Device)
+	}
+
+	start, end := uint64(request.QueueStart), uint64(request.QueueStart)+uint64(request.QueueCount)
+	if start < uint64(info.QueueStart) || end > uint64(info.QueueStart)+uint64(info.QueueCount) {
+		logging.Warningf("Pod %s - Queues %d-%d of device %s requested, outside allowed queues %d-%d", s.podName, start, end-1, request.Device, info.QueueStart, info.QueueStart+info.QueueCount-1)
+		return s.writeError(request, uds.ErrQueueRange, fmt.Sprintf("queues %d-%d requested, device %s allows queues %d-%d", start, end-1, request.Device, info.QueueStart, info.QueueStart+info.QueueCount-1))
+	}
+
+	logging.Debugf("Pod %s - Device %s queues %d-%d recognised", s.podName, request.Device, start, end-1)
+	return s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type}, fd)
+}
+
+/*
+handleCreateXskMessage creates an AF_XDP socket for the pod on the UMEM memfd sent with the
+request, so the pod needs no privileges to use AF_XDP. The socket is bound to a queue in the
+range allowed to the pod and inserted into the XSK map of the device, then its file descriptor
+is passed to the pod, with the busy poll policy of the pool applied. The copies of the memfd and
+socket held by the device plugin are closed.
+*/
+func (s *session) handleCreateXskMessage(request *uds.Request, umemFd int) error {
+	if umemFd > 0 {
+		defer syscall.Close(umemFd)
+	}
+
+	mapFd, ok := s.devices[request.Device]
+	if !ok {
+		logging.Warningf("Pod " + s.podName + " - Device " + request.Device + " not recognised")
+		return s.writeError(request, uds.ErrDeviceNotFound, "device "+request.Device+" is not served on this socket")
+	}
+
+	if request.Xsk == nil {
+		return s.writeError(request, uds.ErrBadRequest, "request must include the socket settings")
+	}
+	if umemFd <= 0 {
+		logging.Errorf("Pod " + s.podName + " - Invalid file descriptor")
+		return s.writeError(request, uds.ErrBadRequest, "request must include the UMEM memfd")
+	}
+
+	info, err := s.deviceInfo(request.Device)
+	if err != nil {
+		logging.Errorf("Pod "+s.podName+" - Error getting info of device "+request.Device+": %v", err)
+		return s.writeError(request, uds.ErrInternal, "unable to get info of device "+request.Device)
+	}
+
+	queue := request.Xsk.QueueID
+	if queue < info.QueueStart || uint64(queue) >= uint64(info.QueueStart)+uint64(info.QueueCount) {
+		logging.Warningf("Pod %s - Socket on queue %d of device %s requested, outside allowed queues %d-%d", s.podName, queue, request.Device, info.QueueStart, info.QueueStart+info.QueueCount-1)
+		return s.writeError(request, uds.ErrQueueRange, fmt.Sprintf("queue %d requested, device %s allows queues %d-%d", queue, request.Device, info.QueueStart, info.QueueStart+info.QueueCount-1))
+	}
+
+	withDefault := func(size uint32, def int) uint32 {
+		if size == 0 {
+			return uint32(def)
+		}
+		return size
+	}
+
+	key := xskKey{device: request.Device, queue: queue}
+	maxUmemSize, settle, ok := s.reserveXsk(key)
+	if !ok {
+		logging.Warningf("Pod %s - Socket on queue %d of device %s requested, the pod has %d sockets", s.podName, queue, request.Device, constants.Afxdp.MaxXsks)
+		return s.writeError(request, uds.ErrXskLimit, fmt.Sprintf("the pod is allowed %d sockets", constants.Afxdp.MaxXsks))
+	}
+
+	config := &bpf.XskConfig{
+		Netns:       s.netnsPath(),
+		Ifindex:     info.Ifindex,
+		QueueID:     queue,
+		XskMapFd:    mapFd,
+		UmemFd:      umemFd,
+		ChunkSize:   withDefault(request.Xsk.ChunkSize, constants.Afxdp.DefaultChunkSize),
+		Headroom:    request.Xsk.Headroom,
+		FillSize:    withDefault(request.Xsk.FillSize, constants.Afxdp.DefaultRingSize),
+		CompSize:    withDefault(request.Xsk.CompSize, constants.Afxdp.DefaultRingSize),
+		RxSize:      withDefault(request.Xsk.RxSize, constants.Afxdp.DefaultRingSize),
+		TxSize:      withDefault(request.Xsk.TxSize, constants.Afxdp.DefaultRingSize),
+		NeedWakeup:  request.Xsk.NeedWakeup,
+		MaxUmemSize: maxUmemSize,
+	}
+
+	logging.Infof("Pod %s - Creating AF_XDP socket on device %s queue %d", s.podName, request.Device, queue)
+	xskFd, umemSize, err := s.bpf.CreateXsk(config)
+	settle(umemSize, err == nil)
+	if err != nil {
+		logging.Errorf("Pod "+s.podName+" - Error creating AF_XDP socket: %v", err)
+		if errors.Is(err, bpf.ErrUmemLimit) {
+			return s.writeError(request, uds.ErrXskLimit, err.Error())
+		}
+		return s.writeError(request, uds.ErrXsk, err.Error())
+	}
+	defer syscall.Close(xskFd)
+
+	if s.busyPoll != nil {
+		logging.Infof("Pod %s - Configuring busy poll from pool policy, Timeout: %d, Budget: %d", s.podName, s.busyPoll.Timeout, s.busyPoll.Budget)
+		if err := s.bpf.ConfigureBusyPoll(xskFd, s.busyPoll.Timeout, s.busyPoll.Budget, s.busyPoll.Prefer); err != nil {
+			logging.Errorf("Pod "+s.podName+" - Error configuring busy poll: %v", err)
+			return s.writeError(request, uds.ErrBusyPoll, err.Error())
+		}
+	}
+
+	return s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type}, xskFd)
+}
+
+/*
+reserveXsk reserves a socket on a device queue for the pod, within the number of sockets allowed
+to the pod, and returns the UMEM size left to the pod. The UMEM size left is held by the socket
+until the returned function records the size registered, or releases the reservation if the
+socket was not created. A socket on the queue of an earlier socket replaces it, as the earlier
+socket must have been closed by the pod for the new one to bind to the queue.
+*/
+func (s *server) reserveXsk(key xskKey) (uint64, func(size uint64, created bool), bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.xsks == nil {
+		s.xsks = make(map[xskKey]uint64)
+	}
+
+	previous, replaces := s.xsks[key]
+	if !replaces && len(s.xsks) >= constants.Afxdp.MaxXsks {
+		return 0, nil, false
+	}
+
+	var used uint64
+	for k, size := range s.xsks {
+		if k != key {
+			used += size
+		}
+	}
+	var left uint64
+	if limit := uint64(constants.Afxdp.MaxUmemSize); used < limit {
+		left = limit - used
+	}
+	s.xsks[key] = left
+
+	settle := func(size uint64, created bool) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		switch {
+		case created:
+			s.xsks[key] = size
+		case replaces:
+			s.xsks[key] = previous
+		default:
+			delete(s.xsks, key)
+		}
+	}
+	return left, settle, true
+}
+
+/*
+netnsPath returns the path of the network namespace of the peer process, or an empty path
+if the peer process is unknown.
+*/
+func (s *session) netnsPath() string {
+	if s.peerPid > 0 {
+		return fmt.Sprintf("/proc/%d/ns/net", s.peerPid)
+	}
+	return ""
+}
+
+/*
+deviceInfo reads the info of a device in the network namespace of the peer process, where the
+CNI has moved the device. The pod is allowed the queues packets are steered to, by the RSS table
+and ntuple rules of the device, as set up by the CNI and the pool ethtool filters. If the peer
+process is unknown the device is looked up in the network namespace of the device plugin.
+*/
+func (s *session) deviceInfo(device string) (*uds.DeviceInfo, error) {
+	info, err := s.netHandler.GetDeviceInfo(s.netnsPath(), device)
+	if err != nil {
+		return nil, err
+	}
+
+	return &uds.DeviceInfo{
+		Ifindex:     info.Ifindex,
+		Queues:      info.Queues,
+		QueueStart:  info.QueueStart,
+		QueueCount:  info.QueueCount,
+		Mtu:         info.Mtu,
+		MultiBuffer: info.MultiBuffer,
+	}, nil
+}
+
+/*
+handleStatsMessage returns the counters of a device, read in the pod network namespace. For a
+CDQ subfunction the counters of its parent port are read on the host and returned with them.
+*/
+func (s *session) handleStatsMessage(request *uds.Request) error {
+	if _, ok := s.devices[request.Device]; !ok {
+		logging.Warningf("Pod " + s.podName + " - Device " + request.Device + " not recognised")
+		return s.writeError(request, uds.ErrDeviceNotFound, "device "+request.Device+" is not served on this socket")
+	}
+
+	deviceStats, err := s.netHandler.GetDeviceStats(s.netnsPath(), request.Device)
+	if err != nil {
+		logging.Errorf("Pod "+s.podName+" - Error getting stats of device "+request.Device+": %v", err)
+		return s.writeError(request, uds.ErrInternal, "unable to get stats of device "+request.Device)
+	}
+	stats := convertStats(request.Device, deviceStats)
+
+	if parent, ok := s.parents[request.Device]; ok {
+		parentStats, err := s.netHandler.GetDeviceStats("", parent)
+		if err != nil {
+			logging.Errorf("Pod "+s.podName+" - Error getting stats of parent port "+parent+": %v", err)
+			return s.writeError(request, uds.ErrInternal, "unable to get stats of the parent port of device "+request.Device)
+		}
+		stats.Parent = convertStats(parent, parentStats)
+	}
+
+	return s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type, Stats: stats}, -1)
+}
+
+/*
+convertStats converts the stats of a device to their protocol form, with the queues in order.
+*/
+func convertStats(device string, deviceStats *networking.DeviceStats) *uds.Stats {
+	stats := &uds.Stats{
+		Device:   device,
+		Counters: deviceStats.Counters,
+	}
+
+	if deviceStats.Link != nil {
+		stats.Link = &uds.LinkStats{
+			RxPackets: deviceStats.Link.RxPackets,
+			TxPackets: deviceStats.Link.TxPackets,
+			RxBytes:   deviceStats.Link.RxBytes,
+			TxBytes:   deviceStats.Link.TxBytes,
+			RxErrors:  deviceStats.Link.RxErrors,
+			TxErrors:  deviceStats.Link.TxErrors,
+			RxDropped: deviceStats.Link.RxDropped,
+			TxDropped: deviceStats.Link.TxDropped,
+		}
+	}
+
+	for queue, counters := range deviceStats.Queues {
+		stats.Queues = append(stats.Queues, uds.QueueStats{Queue: queue, Counters: counters})
+	}
+	sort.Slice(stats.Queues, func(i, j int) bool { return stats.Queues[i].Queue < stats.Queues[j].Queue })
+
+	if deviceStats.Xdp != nil {
+		stats.Xdp = &uds.XdpStats{
+			ProgramID: deviceStats.Xdp.ProgramID,
+			RunCount:  deviceStats.Xdp.RunCount,
+			RunTimeNs: deviceStats.Xdp.RunTimeNs,
+			Counters:  deviceStats.Xdp.Counters,
+		}
+	}
+
+	return stats
+}
+
+func (s *session) handleBusyPollMessage(request *uds.Request, fd int) error {
+	if fd <= 0 {
+		logging.Errorf("Pod " + s.podName + " - Invalid file descriptor")
+		return s.writeError(request, uds.ErrBadRequest, "request must include the socket file descriptor")
+	}
+
+	timeout, budget, prefer := s.busyPollSettings(request.BusyTimeout, request.BusyBudget)
+	logging.Infof("Pod " + s.podName + " - Configuring busy poll, FD: " + strconv.Itoa(fd) + ", Timeout: " + strconv.Itoa(timeout) + ", Budget: " + strconv.Itoa(budget))
+
+	if err := s.bpf.ConfigureBusyPoll(fd, timeout, budget, prefer); err != nil {
+		logging.Errorf("Error configuring busy poll: %v", err)
+		return s.writeError(request, uds.ErrBusyPoll, err.Error())
+	}
+
+	return s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type}, -1)
+}
+
+/*
+handleSockOptMessage sets socket options the pod cannot set itself on the socket file descriptor
+sent with the request. Only options allowed by the pool are set. Each option is reported as
+applied or rejected, with the reason, and one option failing does not stop the others.
+*/
+func (s *session) handleSockOptMessage(request *uds.Request, fd int) error {
+	if fd <= 0 {
+		logging.Errorf("Pod " + s.podName + " - Invalid file descriptor")
+		return s.writeError(request, uds.ErrBadRequest, "request must include the socket file descriptor")
+	}
+	defer syscall.Close(fd)
+
+	if len(request.SockOpts) == 0 {
+		return s.writeError(request, uds.ErrBadRequest, "request must include socket options")
+	}
+
+	results := make([]uds.SockOptResult, 0, len(request.SockOpts))
+	for _, option := range request.SockOpts {
+		result := uds.SockOptResult{Name: option.Name}
+		switch {
+		case !tools.ArrayContains(s.sockOpts, option.Name):
+			logging.Warningf("Pod %s - Socket option %s is not allowed in this pool", s.podName, option.Name)
+			result.Reason = "socket option " + option.Name + " is not allowed in this pool"
+		case option.Value < 0:
+			result.Reason = "socket option value must be zero or more"
+		default:
+			if err := s.bpf.SetSocketOption(fd, option.Name, option.Value); err != nil {
+				logging.Errorf("Pod "+s.podName+" - Error setting socket option: %v", err)
+				result.Reason = err.Error()
+			} else {
+				result.Applied = true
+			}
+		}
+		results = append(results, result)
+	}
+
+	return s.writeMessage(&uds.Response{ID: request.ID, Type: request.Type, SockOpts: results}, -1)
+}
+
+func (s *session) writeError(request *uds.Request, code uds.ErrorCode, message string) error {
+	return s.writeMessage(&uds.Response{
+		ID:    request.ID,
+		Type:  request.Type,
+		Error: &uds.Error{Code: code, Message: message},
+	}, -1)
+}
+
+func (s *session) writeMessage(response *uds.Response, fd int) error {
+	msg, err := uds.EncodeMessage(response)
+	if err != nil {
+		return err
+	}
+
+	logging.Infof("Pod " + s.podName + " - Response: " + msg[4:])
+	return s.conn.Write(msg, fd)
+}
@@ -16,14 +16,18 @@
 package udsserver
 
 import (
+	"errors"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/bpf"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/host"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/resourcesapi"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/uds"
 	logging "github.com/sirupsen/logrus"
@@ -35,7 +39,9 @@ Implementations of this interface are the main type of this UDSServer package.
 */
 type Server interface {
 	AddDevice(dev string, fd int)
+	SetParent(dev string, parent string)
 	Start()
+	Stop()
 }
 
 /*
@@ -45,22 +51,60 @@ UDSServer container is created the factory will create a Server to serve the
 associated Unix domain socket.
 */
 type ServerFactory interface {
-	CreateServer(deviceType, user string, timeout int, udsFuzz bool) (Server, string, error)
+	CreateServer(deviceType, user string, timeout int, udsFuzz bool, busyPoll *networking.BusyPollConfig, sockOpts []string) (Server, string, error)
 }
 
 /*
 server implements the Server interface. It is the main type for this package.
 */
 type server struct {
-	podName        string
 	deviceType     string
 	devices        map[string]int
+	parents        map[string]string
 	udsPath        string
 	uds            uds.Handler
 	bpf            bpf.Handler
 	podRes         resourcesapi.Handler
+	host           host.Handler
+	netHandler     networking.Handler
 	udsIdleTimeout time.Duration
 	uid            string
+	busyPoll       *networking.BusyPollConfig
+	sockOpts       []string
+	mutex          sync.Mutex
+	stopped        bool
+	stopListener   uds.CleanupFunc
+	conns          map[uds.Conn]bool
+	xsks           map[xskKey]uint64
+	idleTimer      *time.Timer
+	closeDevices   sync.Once
+	boundPod       string
+	boundUID       string
+	boundContainer string
+}
+
+/*
+xskKey identifies an AF_XDP socket created for the pod by its device and queue. Only one socket
+can be bound to a queue, so a socket created on the queue of an earlier one replaces it.
+*/
+type xskKey struct {
+	device string
+	queue  uint32
+}
+
+/*
+session holds the state of a single connection to the server. Each connection must
+validate its pod before any other requests are served. The peer pod UID and container ID
+are resolved from the kernel credentials of the connection, not from the client requests.
+*/
+type session struct {
+	*server
+	conn          uds.Conn
+	podName       string
+	connected     bool
+	peerPid       int
+	peerUID       string
+	peerContainer string
 }
 
 /*
@@ -81,7 +125,7 @@ func NewServerFactory() ServerFactory {
 CreateServer creates, initialises, and returns an implementation of the Server interface.
 It also returns the filepath of the UDS being served.
 */
-func (f *serverFactory) CreateServer(deviceType, user string, timeout int, udsFuzz bool) (Server, string, error) {
+func (f *serverFactory) CreateServer(deviceType, user string, timeout int, udsFuzz bool, busyPoll *networking.BusyPollConfig, sockOpts []string) (Server, string, error) {
 	var udsHandler uds.Handler
 
 	if udsFuzz {
@@ -101,15 +145,18 @@ func (f *serverFactory) CreateServer(deviceType, user string, timeout int, udsFu
 	timeoutUds := time.Duration(timeout) * time.Second
 
 	server := &server{
-		podName:        "unvalidated",
 		deviceType:     deviceType,
 		devices:        make(map[string]int),
 		udsPath:        udsPath,
 		uds:            udsHandler,
 		bpf:            bpf.NewHandler(),
 		podRes:         resourcesapi.NewHandler(),
+		host:           host.NewHandler(),
+		netHandler:     networking.NewHandler(),
 		udsIdleTimeout: timeoutUds,
 		uid:            user,
+		busyPoll:       busyPoll,
+		sockOpts:       sockOpts,
 	}
 
 	return server, udsPath, nil
@@ -130,56 +177,232 @@ func (s *server) AddDevice(dev string, fd int) {
 	s.devices[dev] = fd
 }
 
+/*
+SetParent records the parent port of a CDQ subfunction served by the Server, so the pod can
+request the counters of the port.
+*/
+func (s *server) SetParent(dev string, parent string) {
+	if s.parents == nil {
+		s.parents = make(map[string]string)
+	}
+	s.parents[dev] = parent
+}
+
+/*
+Stop closes the Unix domain socket and any open connections, and removes the socket file.
+It is called when the devices of the server are released. Stop can be called more than once.
+*/
+func (s *server) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+
+	logging.Infof("Stopping UDS server on %s", s.udsPath)
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	if s.stopListener != nil {
+		s.stopListener()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+/*
+stopIdle stops the Server when no connection has been open for the UDS timeout.
+It is the release path of a Server whose devices are never released by the device plugin.
+*/
+func (s *server) stopIdle() {
+	s.mutex.Lock()
+	idle := !s.stopped && len(s.conns) == 0
+	s.mutex.Unlock()
+
+	if idle {
+		logging.Infof("No connection to UDS server on %s for %v", s.udsPath, s.udsIdleTimeout)
+		s.Stop()
+	}
+}
+
+/*
+releaseDevices closes the XSK map file descriptors of the Server once it has stopped for good.
+*/
+func (s *server) releaseDevices() {
+	s.closeDevices.Do(func() {
+		for dev, fd := range s.devices {
+			if err := s.bpf.CloseXskMap(fd); err != nil {
+				logging.Warningf("Error closing XSK map of device %s: %v", dev, err)
+			}
+		}
+	})
+}
+
 /*
 start is a private method and the main loop of the Server.
-It listens for and serves a single connection. Across this connection it validates the pod hostname
-and serves XSK file descriptors to the UDS Server app within the pod.
+It listens on the socket until the server is stopped, serving each connection in its own session.
+A pod can reconnect as many times as it needs, for example after its application restarts.
+If no connection is open for the UDS timeout the server stops, as the pod is assumed to be gone.
 */
 func (s *server) start() {
+	defer s.releaseDevices()
 	logging.Debugf("Initialising Unix domain socket: " + s.udsPath)
 
 	// init
-	if err := s.uds.Init(s.udsPath, constants.Uds.Protocol, constants.Uds.MsgBufSize, constants.Uds.CtlBufSize, s.udsIdleTimeout, s.uid); err != nil {
+	if err := s.uds.Init(s.udsPath, constants.Uds.Protocol, constants.Uds.MaxMsgSize, constants.Uds.CtlBufSize, s.udsIdleTimeout, s.uid); err != nil {
 		logging.Errorf("Error Initialising UDS: %v", err)
 		return
 	}
 
-	logging.Infof("Unix domain socket initialised. Listening for new connection.")
-
 	cleanup, err := s.uds.Listen()
 	if err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			logging.Errorf("Listener timed out: %v", err)
-			cleanup()
-			return
-		}
-		logging.Errorf("Listener Accept error: %v", err)
+		logging.Errorf("Listener error: %v", err)
 		cleanup()
 		return
 	}
-	defer cleanup()
 
-	logging.Infof("New connection accepted. Waiting for requests.")
+	s.mutex.Lock()
+	if s.stopped {
+		s.mutex.Unlock()
+		cleanup()
+		return
+	}
+	s.stopListener = cleanup
+	s.conns = make(map[uds.Conn]bool)
+	if s.udsIdleTimeout > 0 {
+		s.idleTimer = time.AfterFunc(s.udsIdleTimeout, s.stopIdle)
+	}
+	s.mutex.Unlock()
 
-	// read incoming request
-	request, _, err := s.read()
-	if err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			logging.Errorf("Connection timed out: %v", err)
+	logging.Infof("Unix domain socket initialised. Listening for new connections.")
+
+	var sessions sync.WaitGroup
+	for {
+		conn, err := s.uds.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logging.Errorf("Listener Accept error: %v", err)
+			}
+			break
+		}
+
+		s.mutex.Lock()
+		if s.stopped {
+			s.mutex.Unlock()
+			conn.Close()
+			break
+		}
+		s.conns[conn] = true
+		if s.idleTimer != nil {
+			s.idleTimer.Stop()
+		}
+		s.mutex.Unlock()
+
+		logging.Infof("New connection accepted. Waiting for requests.")
+
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			s.serve(conn)
+
+			s.mutex.Lock()
+			delete(s.conns, conn)
+			if len(s.conns) == 0 && !s.stopped && s.idleTimer != nil {
+				s.idleTimer.Reset(s.udsIdleTimeout)
+			}
+			s.mutex.Unlock()
+		}()
+	}
+
+	s.Stop()
+	sessions.Wait()
+	logging.Infof("UDS server on %s stopped", s.udsPath)
+}
+
+/*
+serve handles a single connection. Across this connection it validates the pod hostname
+and serves XSK file descriptors to the UDS Server app within the pod. The connection is
+closed when the pod finishes, or on error or timeout. The server keeps listening for new connections.
+*/
+func (s *server) serve(conn uds.Conn) {
+	defer conn.Close()
+	sess := &session{server: s, conn: conn, podName: "unvalidated"}
+	sess.resolvePeer()
+
+	for {
+		// read incoming request
+		request, fd, err := sess.read()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				logging.Errorf("Pod "+sess.podName+" - Connection timed out: %v", err)
+				return
+			}
+			logging.Errorf("Pod "+sess.podName+" - Connection read error: %v", err)
+			return
+		}
+
+		var done bool
+		if uds.IsMessage(request) {
+			done, err = sess.handleMessage(request, fd)
+		} else {
+			done, err = sess.handleRequest(request, fd)
+		}
+
+		if err != nil {
+			logging.Errorf("Pod "+sess.podName+" - Error handling request: %v", err)
+			return
+		}
+		if done {
 			return
 		}
-		logging.Errorf("Connection read error: %v", err)
+	}
+}
+
+/*
+resolvePeer reads the credentials of the peer process from the kernel and resolves the pod UID
+and container ID of its cgroup. If the peer cannot be resolved the identity is left empty, and
+the pod cannot be validated on this connection.
+*/
+func (s *session) resolvePeer() {
+	cred, err := s.conn.PeerCredentials()
+	if err != nil {
+		logging.Warningf("Unable to get peer credentials: %v", err)
+		return
+	}
+	s.peerPid = int(cred.Pid)
+
+	s.peerUID, s.peerContainer, err = s.host.PodIdentity(int(cred.Pid))
+	if err != nil {
+		logging.Warningf("Unable to resolve pod of peer PID %d: %v", cred.Pid, err)
 		return
 	}
 
-	// first request should validate hostname/podname
-	connected := false
-	var podName string
-	if strings.Contains(request, constants.Uds.Handshake.RequestConnect) {
+	logging.Infof("Connection from PID %d, pod UID %s, container ID %s", cred.Pid, s.peerUID, s.peerContainer)
+}
+
+/*
+handleRequest serves a request of the original string protocol (0.1).
+The first request of the session must validate the pod, otherwise the session ends.
+It returns true when the session should end.
+*/
+func (s *session) handleRequest(request string, fd int) (bool, error) {
+	if !s.connected {
+		if !strings.Contains(request, constants.Uds.Handshake.RequestConnect) {
+			return true, nil
+		}
+
+		var podName, namespace string
+		var err error
 		words := strings.Split(request, ",")
-		if len(words) == 2 && words[0] == constants.Uds.Handshake.RequestConnect {
+		if len(words) == 3 {
+			namespace = strings.ReplaceAll(words[2], " ", "")
+		}
+		if (len(words) == 2 || namespace != "") && words[0] == constants.Uds.Handshake.RequestConnect {
 			podName = strings.ReplaceAll(words[1], " ", "")
-			connected, err = s.validatePod(podName)
+			s.connected, err = s.validatePod(podName, namespace)
 			if err != nil {
 				logging.Errorf("Error validating host %s: %v", podName, err)
 				if err := s.write(constants.Uds.Handshake.ResponseError); err != nil {
@@ -187,85 +410,70 @@ func (s *server) start() {
 				}
 			}
 		}
-		if connected {
+		if s.connected {
 			s.podName = podName
 			if err := s.write(constants.Uds.Handshake.ResponseHostOk); err != nil {
 				logging.Errorf("Connection write error: %v", err)
 			}
-		} else {
-			if err := s.write(constants.Uds.Handshake.ResponseHostNak); err != nil {
-				logging.Errorf("Connection write error: %v", err)
-			}
+			return false, nil
 		}
-	}
-
-	// once valid, maintain connection and loop for remaining requests
-	for connected {
-		// read incoming request
-		request, fd, err := s.read()
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				logging.Errorf("Pod "+s.podName+" - Connection timed out: %v", err)
-				return
-			}
-			logging.Errorf("Pod "+s.podName+" - Connection read error: %v", err)
-			return
+		if err := s.write(constants.Uds.Handshake.ResponseHostNak); err != nil {
+			logging.Errorf("Connection write error: %v", err)
 		}
+		return true, nil
+	}
 
-		// process request
-		switch {
-		case strings.Contains(request, constants.Uds.Handshake.RequestFd):
-			err = s.handleFdRequest(request)
-
-		case request == constants.Uds.Handshake.RequestVersion:
-			err = s.write(constants.Uds.Handshake.Version)
+	// once valid, maintain connection and serve remaining requests
+	switch {
+	case strings.Contains(request, constants.Uds.Handshake.RequestFd):
+		return false, s.handleFdRequest(request)
 
-		case strings.Contains(request, constants.Uds.Handshake.RequestBusyPoll):
-			err = s.handleBusyPollRequest(request, fd)
+	case request == constants.Uds.Handshake.RequestVersion:
+		return false, s.write(constants.Uds.Handshake.Version)
 
-		case request == constants.Uds.Handshake.RequestFin:
-			err = s.write(constants.Uds.Handshake.ResponseFinAck)
-			connected = false
+	case strings.Contains(request, constants.Uds.Handshake.RequestBusyPoll):
+		return false, s.handleBusyPollRequest(request, fd)
 
-		default:
-			err = s.write(constants.Uds.Handshake.ResponseBadRequest)
-		}
+	case request == constants.Uds.Handshake.RequestFin:
+		return true, s.write(constants.Uds.Handshake.ResponseFinAck)
 
-		if err != nil {
-			logging.Errorf("Pod "+s.podName+" - Error handling request: %v", err)
-			return
-		}
+	default:
+		return false, s.write(constants.Uds.Handshake.ResponseBadRequest)
 	}
 }
 
-func (s *server) read() (string, int, error) {
-	request, fd, err := s.uds.Read()
+func (s *session) read() (string, int, error) {
+	request, fd, err := s.conn.Read()
 	if err != nil {
 		logging.Errorf("Pod "+s.podName+" - Read error: %v", err)
 		return "", 0, err
 	}
 
-	logging.Infof("Pod " + s.podName + " - Request: " + request)
+	if uds.IsMessage(request) {
+		logging.Infof("Pod " + s.podName + " - Request: " + request[4:])
+	} else {
+		logging.Infof("Pod " + s.podName + " - Request: " + request)
+	}
 	return request, fd, nil
 }
 
-func (s *server) write(response string) error {
+func (s *session) write(response string) error {
 	logging.Infof("Pod " + s.podName + " - Response: " + response)
-	if err := s.uds.Write(response, -1); err != nil {
+	if err := s.conn.Write(response, -1); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *server) writeWithFD(response string, fd int) error {
+func (s *session) writeWithFD(response string, fd int) error {
 	logging.Infof("Pod " + s.podName + " - Response: " + response + ", FD: " + strconv.Itoa(fd))
-	if err := s.uds.Write(response, fd); err != nil {
+	if err := s.conn.Write(response, fd); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *server) handleFdRequest(request string) error {
+func (s *session) handleFdRequest(request string) error {
 	words := strings.Split(request, ",")
 	if len(words) != 2 || words[0] != constants.Uds.Handshake.RequestFd {
 		if err := s.write(constants.Uds.Handshake.ResponseBadRequest); err != nil {
@@ -290,7 +498,7 @@ func (s *server) handleFdRequest(request string) error {
 	return nil
 }
 
-func (s *server) handleBusyPollRequest(request string, fd int) error {
+func (s *session) handleBusyPollRequest(request string, fd int) error {
 	if fd <= 0 {
 		logging.Errorf("Pod " + s.podName + " - Invalid file descriptor")
 		if err := s.write(constants.Uds.Handshake.ResponseBusyPollNak); err != nil {
@@ -321,9 +529,10 @@ func (s *server) handleBusyPollRequest(request string, fd int) error {
 		return err
 	}
 
-	logging.Infof("Pod " + s.podName + " - Configuring busy poll, FD: " + strconv.Itoa(fd) + ", Timeout: " + timeoutString + ", Budget: " + budgetString)
+	timeout, budget, prefer := s.busyPollSettings(timeout, budget)
+	logging.Infof("Pod " + s.podName + " - Configuring busy poll, FD: " + strconv.Itoa(fd) + ", Timeout: " + strconv.Itoa(timeout) + ", Budget: " + strconv.Itoa(budget))
 
-	if err := s.bpf.ConfigureBusyPoll(fd, timeout, budget); err != nil {
+	if err := s.bpf.ConfigureBusyPoll(fd, timeout, budget, prefer); err != nil {
 		logging.Errorf("Error configuring busy poll: %v", err)
 		if err := s.write(constants.Uds.Handshake.ResponseBusyPollNak); err != nil {
 			logging.Errorf("Connection write error: %v", err)
@@ -337,53 +546,159 @@ func (s *server) handleBusyPollRequest(request string, fd int) error {
 	return nil
 }
 
-func (s *server) validatePod(podName string) (bool, error) {
+/*
+busyPollSettings takes the busy poll timeout and budget requested by a pod and returns the
+settings to apply to its socket. Values the pod leaves at 0 are taken from the busy poll
+policy of the pool, if it has one. Without a policy, busy polling is always preferred.
+*/
+func (s *server) busyPollSettings(timeout, budget int) (int, int, bool) {
+	if s.busyPoll == nil {
+		return timeout, budget, true
+	}
+	if timeout == 0 {
+		timeout = s.busyPoll.Timeout
+	}
+	if budget == 0 {
+		budget = s.busyPoll.Budget
+	}
+	return timeout, budget, s.busyPoll.Prefer
+}
+
+/*
+validatePod checks that the named pod holds the devices of this server in the container they are
+allocated to, see bindAllocation, and that the connecting process runs in that container.
+The namespace is optional, older clients send only the pod name.
+*/
+func (s *session) validatePod(podName string, namespace string) (bool, error) {
 	logging.Debugf("Pod " + podName + " - Validating pod hostname")
 
+	podUID, containerName, err := s.bindAllocation()
+	if err != nil {
+		return false, err
+	}
+	if podUID == "" {
+		logging.Warningf("Pod " + podName + " - Allocation of the devices of this UDS server not found")
+		return false, nil
+	}
+
 	podResourceMap, err := s.podRes.GetPodResources()
 	if err != nil {
 		logging.Errorf("Error getting pod resources: %v", err)
 		return false, err
 	}
 
-	if _, ok := podResourceMap[podName]; ok {
-		logging.Debugf("Pod " + podName + " - Found on node")
-	} else {
-		logging.Warningf("Pod " + podName + " - Not found on node")
+	var podKey string
+	for key, pod := range podResourceMap {
+		if pod.GetName() != podName || (namespace != "" && pod.GetNamespace() != namespace) {
+			continue
+		}
+		for _, container := range pod.GetContainers() {
+			if container.GetName() != containerName {
+				continue
+			}
+			var contDevs []string
+			for _, devType := range container.GetDevices() {
+				if devType.GetResourceName() == s.deviceType {
+					contDevs = append(contDevs, devType.GetDeviceIds()...)
+				}
+			}
+			// compare known devices (from Allocate) vs devices from resource api
+			if s.holdsDevices(contDevs) {
+				podKey = key
+			}
+		}
+	}
+
+	if podKey == "" {
+		logging.Warningf("Pod " + podName + " could not be validated for this UDS connection")
 		return false, nil
 	}
+	logging.Debugf("Pod " + podKey + " - Found on node, container " + containerName)
 
-	pod := podResourceMap[podName]
-	valid := false
+	if s.peerUID != podUID {
+		logging.Warningf("Pod " + podKey + " - UID " + podUID + " does not match UID " + s.peerUID + " of the connecting process")
+		return false, nil
+	}
 
-	for _, container := range pod.GetContainers() {
-		var contDevs []string
+	containerUID, containerRuntimeName, err := s.host.ContainerIdentity(s.peerContainer)
+	if err != nil {
+		logging.Warningf("Pod "+podKey+" - Unable to resolve container %s of the connecting process: %v", s.peerContainer, err)
+		return false, nil
+	}
+	if containerUID != podUID || containerRuntimeName != containerName {
+		logging.Warningf("Pod " + podKey + " - Container " + s.peerContainer + " of the connecting process is container " + containerRuntimeName +
+			" of pod UID " + containerUID + ", not allocated container " + containerName)
+		return false, nil
+	}
 
-		for _, devType := range container.GetDevices() {
-			if devType.GetResourceName() == s.deviceType {
-				contDevs = append(contDevs, devType.GetDeviceIds()...)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-			}
-		}
+	if s.boundPod == "" {
+		s.boundPod = podKey
+	} else if s.boundPod != podKey {
+		logging.Warningf("Pod " + podKey + " does not match pod " + s.boundPod + " bound to this UDS server")
+		return false, nil
+	}
 
-		if len(contDevs) == len(s.devices) {
-			// compare known devices (from Allocate) vs devices from resource api
-			for _, dev := range contDevs {
-				if _, exists := s.devices[dev]; exists {
-					valid = true // valid while devices match
-				} else {
-					valid = false
-					break // not valid if any device does not match
-				}
-			}
-		}
+	logging.Infof("Pod " + podKey + " is valid for this UDS connection")
+	return true, nil
+}
 
-		if valid {
-			logging.Infof("Pod " + podName + " is valid for this UDS connection")
-			return true, nil
+/*
+bindAllocation returns the pod UID and container name the devices of this server are allocated
+to, as recorded in the kubelet checkpoint. The kubelet writes the checkpoint after Allocate, so the
+allocation is read on the first validation and the server is then bound to it. The allocation is
+found from the devices, not from the pod a client claims to be, so the first client to connect
+cannot choose it, and a pod reusing the name of a deleted pod cannot connect. An empty pod UID is
+returned if the devices are not allocated to a single container, or no longer to the bound one.
+*/
+func (s *server) bindAllocation() (string, string, error) {
+	allocations, err := s.podRes.GetAllocations()
+	if err != nil {
+		logging.Errorf("Unable to read pod UID from kubelet checkpoint: %v", err)
+		return "", "", err
+	}
+
+	var matches []resourcesapi.Allocation
+	for _, allocation := range allocations {
+		if allocation.ResourceName == s.deviceType && s.holdsDevices(allocation.DeviceIDs) {
+			matches = append(matches, allocation)
 		}
 	}
+	if len(matches) != 1 {
+		logging.Warningf("Devices of UDS server %s found in %d allocations of the kubelet checkpoint", s.udsPath, len(matches))
+		return "", "", nil
+	}
+	allocation := matches[0]
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.boundUID == "" {
+		s.boundUID = allocation.PodUID
+		s.boundContainer = allocation.ContainerName
+		logging.Infof("UDS server " + s.udsPath + " bound to pod UID " + allocation.PodUID + ", container " + allocation.ContainerName)
+	} else if s.boundUID != allocation.PodUID || s.boundContainer != allocation.ContainerName {
+		logging.Warningf("Devices of UDS server " + s.udsPath + " are allocated to pod UID " + allocation.PodUID + ", container " + allocation.ContainerName +
+			", not pod UID " + s.boundUID + ", container " + s.boundContainer + " bound to this UDS server")
+		return "", "", nil
+	}
+
+	return s.boundUID, s.boundContainer, nil
+}
 
-	logging.Warningf("Pod " + podName + " could not be validated for this UDS connection")
-	return false, nil
+/*
+holdsDevices returns true if a list of devices is exactly the set of devices of this server
+*/
+func (s *server) holdsDevices(devices []string) bool {
+	if len(devices) == 0 || len(devices) != len(s.devices) {
+		return false
+	}
+	for _, dev := range devices {
+		if _, exists := s.devices[dev]; !exists {
+			return false // not valid if any device does not match
+		}
+	}
+	return true
 }
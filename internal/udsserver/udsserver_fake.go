@@ -15,6 +15,10 @@
 
 package udsserver
 
+import (
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
+)
+
 /*
 fakeServer is a fake implementation the Server interface.
 */
@@ -37,7 +41,7 @@ CreateServer creates, initialises, and returns an implementation of the Server i
 In this fakeServerFactory it returnss an empty fakeServer implementation and a hardcoded
 fake UDS filepath.
 */
-func (f *fakeServerFactory) CreateServer(deviceType, user string, timeout int, udsFuzz bool) (Server, string, error) {
+func (f *fakeServerFactory) CreateServer(deviceType, user string, timeout int, udsFuzz bool, busyPoll *networking.BusyPollConfig, sockOpts []string) (Server, string, error) {
 	return &fakeServer{}, "/tmp/fake-socket.sock", nil
 }
 
@@ -48,9 +52,23 @@ In this fakeServer it does nothing.
 func (s *fakeServer) Start() {
 }
 
+/*
+Stop closes the Unix domain socket and any open connections.
+In this fakeServer it does nothing.
+*/
+func (s *fakeServer) Stop() {
+}
+
 /*
 AddDevice appends a netdev and its associated XSK file descriptor to the Servers map of devices.
 In this fakeServer it does nothing.
 */
 func (s *fakeServer) AddDevice(dev string, fd int) {
 }
+
+/*
+SetParent records the parent port of a CDQ subfunction served by the Server.
+In this fakeServer it does nothing.
+*/
+func (s *fakeServer) SetParent(dev string, parent string) {
+}
@@ -16,11 +16,18 @@
 package udsserver
 
 import (
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/bpf"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/host"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/networking"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/resourcesapi"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/uds"
+	"golang.org/x/sys/unix"
 	"gotest.tools/assert"
 )
 
@@ -92,6 +99,7 @@ func TestAddDevice(t *testing.T) {
 func TestStart(t *testing.T) {
 	fakeUDS := uds.NewFakeHandler()
 	fakeResAPI := resourcesapi.NewFakeHandler()
+	fakeHost := host.NewFakeHandler()
 
 	testCases := []struct {
 		testName         string
@@ -125,6 +133,24 @@ func TestStart(t *testing.T) {
 				1: constants.Uds.Handshake.ResponseFinAck,
 			},
 		},
+		{
+			//Try connect good podA with its namespace
+			testName:         "Connect successfully with namespace and disconnect",
+			fakePodName:      "podA",
+			fakePodNamespace: "default",
+			fakeResourceName: "uds/testing",
+			udsServerDevType: "uds/testing",
+			fakePodDevices:   []string{"devA"},
+			udsServerDevices: []string{"devA"},
+			fakeRequests: map[int]string{
+				0: constants.Uds.Handshake.RequestConnect + ", podA, default",
+				1: constants.Uds.Handshake.RequestFin,
+			},
+			expectedResponse: map[int]string{
+				0: constants.Uds.Handshake.ResponseHostOk,
+				1: constants.Uds.Handshake.ResponseFinAck,
+			},
+		},
 		{
 			//Try connect good podA which has 2 good devices - devA and devB
 			testName:         "Connect successfully and disconnect, 2 device",
@@ -278,6 +304,24 @@ func TestStart(t *testing.T) {
 		Including it anyway to prevent hanging in case we manage to make an unexpected connect
 		i.e. in case of bad code!
 		*************************************************************************************/
+		{
+			//Try connect podA with the wrong namespace
+			testName:         "Connect with wrong namespace",
+			fakePodName:      "podA",
+			fakePodNamespace: "default",
+			fakeResourceName: "uds/testing",
+			udsServerDevType: "uds/testing",
+			fakePodDevices:   []string{"devA"},
+			udsServerDevices: []string{"devA"},
+			fakeRequests: map[int]string{
+				0: constants.Uds.Handshake.RequestConnect + ", podA, other",
+				1: constants.Uds.Handshake.RequestFin,
+			},
+			expectedResponse: map[int]string{
+				0: constants.Uds.Handshake.ResponseHostNak,
+				1: "should not get " + constants.Uds.Handshake.ResponseFinAck + " as should not have connected",
+			},
+		},
 		{
 			//Try connect without passing any pod
 			testName:         "No hostname (1)",
@@ -1871,10 +1915,13 @@ func TestStart(t *testing.T) {
 				deviceType: tc.udsServerDevType,
 				devices:    make(map[string]int),
 				uds:        fakeUDS,
+				bpf:        bpf.NewFakeHandler(),
 				podRes:     fakeResAPI,
+				host:       fakeHost,
 			}
 
 			fakeResAPI.CreateFakePod(tc.fakePodName, tc.fakePodNamespace, tc.fakeResourceName, tc.fakePodDevices)
+			fakeHost.SetPodIdentity(resourcesapi.FakePodUID(tc.fakePodNamespace, tc.fakePodName), "containerid01")
 			fakeUDS.SetRequests(tc.fakeRequests)
 
 			for fd, device := range tc.udsServerDevices {
@@ -1895,9 +1942,11 @@ func TestStart(t *testing.T) {
 func TestRead(t *testing.T) {
 	fakeUDS := uds.NewFakeHandler()
 
-	server := &server{
-		devices: make(map[string]int),
-		uds:     fakeUDS,
+	server := &session{
+		server: &server{
+			devices: make(map[string]int),
+		},
+		conn: fakeUDS,
 	}
 
 	testCases := []struct {
@@ -1972,3 +2021,925 @@ func TestRead(t *testing.T) {
 		})
 	}
 }
+
+func TestStartReconnect(t *testing.T) {
+	fakeUDS := uds.NewFakeHandler()
+	fakeResAPI := resourcesapi.NewFakeHandler()
+	fakeHost := host.NewFakeHandler()
+
+	testCases := []struct {
+		testName         string
+		sessions         int
+		fakeRequests     map[int]string
+		expectedResponse map[int]string
+	}{
+		{
+			testName: "Reconnect after disconnect",
+			sessions: 2,
+			fakeRequests: map[int]string{
+				0: constants.Uds.Handshake.RequestConnect + ", podA",
+				1: constants.Uds.Handshake.RequestFin,
+				2: constants.Uds.Handshake.RequestConnect + ", podA",
+				3: constants.Uds.Handshake.RequestVersion,
+				4: constants.Uds.Handshake.RequestFin,
+			},
+			expectedResponse: map[int]string{
+				0: constants.Uds.Handshake.ResponseHostOk,
+				1: constants.Uds.Handshake.ResponseFinAck,
+				2: constants.Uds.Handshake.ResponseHostOk,
+				3: constants.Uds.Handshake.Version,
+				4: constants.Uds.Handshake.ResponseFinAck,
+			},
+		},
+		{
+			testName: "Each session is validated",
+			sessions: 2,
+			fakeRequests: map[int]string{
+				0: constants.Uds.Handshake.RequestConnect + ", podA",
+				1: constants.Uds.Handshake.RequestFin,
+				2: constants.Uds.Handshake.RequestVersion,
+			},
+			expectedResponse: map[int]string{
+				0: constants.Uds.Handshake.ResponseHostOk,
+				1: constants.Uds.Handshake.ResponseFinAck,
+			},
+		},
+		{
+			testName: "Reconnect after failed validation",
+			sessions: 2,
+			fakeRequests: map[int]string{
+				0: constants.Uds.Handshake.RequestConnect + ", podB",
+				1: constants.Uds.Handshake.RequestConnect + ", podA",
+				2: constants.Uds.Handshake.RequestFin,
+			},
+			expectedResponse: map[int]string{
+				0: constants.Uds.Handshake.ResponseHostNak,
+				1: constants.Uds.Handshake.ResponseHostOk,
+				2: constants.Uds.Handshake.ResponseFinAck,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			server := &server{
+				deviceType: "uds/testing",
+				devices:    make(map[string]int),
+				uds:        fakeUDS,
+				bpf:        bpf.NewFakeHandler(),
+				podRes:     fakeResAPI,
+				host:       fakeHost,
+			}
+
+			fakeResAPI.CreateFakePod("podA", "default", "uds/testing", []string{"devA"})
+			fakeHost.SetPodIdentity(resourcesapi.FakePodUID("default", "podA"), "containerid01")
+			fakeUDS.SetRequests(tc.fakeRequests)
+			fakeUDS.SetSessions(tc.sessions)
+			server.AddDevice("devA", 1)
+
+			server.start()
+
+			assert.DeepEqual(t, fakeUDS.GetResponses(), tc.expectedResponse)
+		})
+	}
+}
+
+func TestValidatePodBinding(t *testing.T) {
+	fakeResAPI := resourcesapi.NewFakeHandler()
+	fakeHost := host.NewFakeHandler()
+
+	testCases := []struct {
+		testName         string
+		newPodName       string
+		newPodNamespace  string
+		newPodDevices    []string
+		connectName      string
+		connectNamespace string
+		peerUID          string
+		expValid         bool
+	}{
+		{
+			testName:         "Same pod reconnects",
+			newPodName:       "podA",
+			newPodNamespace:  "default",
+			newPodDevices:    []string{"devA"},
+			connectName:      "podA",
+			connectNamespace: "default",
+			peerUID:          resourcesapi.FakePodUID("default", "podA"),
+			expValid:         true,
+		},
+		{
+			testName:         "Same pod reconnects without namespace",
+			newPodName:       "podA",
+			newPodNamespace:  "default",
+			newPodDevices:    []string{"devA"},
+			connectName:      "podA",
+			connectNamespace: "",
+			peerUID:          resourcesapi.FakePodUID("default", "podA"),
+			expValid:         true,
+		},
+		{
+			testName:         "Pod of the same name in another namespace",
+			newPodName:       "podA",
+			newPodNamespace:  "other",
+			newPodDevices:    []string{"devA"},
+			connectName:      "podA",
+			connectNamespace: "",
+			peerUID:          resourcesapi.FakePodUID("other", "podA"),
+			expValid:         false,
+		},
+		{
+			testName:         "Another pod holding the same devices",
+			newPodName:       "podB",
+			newPodNamespace:  "default",
+			newPodDevices:    []string{"devA"},
+			connectName:      "podB",
+			connectNamespace: "default",
+			peerUID:          resourcesapi.FakePodUID("default", "podB"),
+			expValid:         false,
+		},
+		{
+			testName:         "Same pod without the devices",
+			newPodName:       "podA",
+			newPodNamespace:  "default",
+			newPodDevices:    []string{"devB"},
+			connectName:      "podA",
+			connectNamespace: "default",
+			peerUID:          resourcesapi.FakePodUID("default", "podA"),
+			expValid:         false,
+		},
+		{
+			testName:         "Process of another pod claims the pod name",
+			newPodName:       "podA",
+			newPodNamespace:  "default",
+			newPodDevices:    []string{"devA"},
+			connectName:      "podA",
+			connectNamespace: "default",
+			peerUID:          resourcesapi.FakePodUID("default", "podB"),
+			expValid:         false,
+		},
+		{
+			testName:         "Process not in a pod",
+			newPodName:       "podA",
+			newPodNamespace:  "default",
+			newPodDevices:    []string{"devA"},
+			connectName:      "podA",
+			connectNamespace: "default",
+			peerUID:          "",
+			expValid:         false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			server := &server{
+				deviceType: "uds/testing",
+				devices:    make(map[string]int),
+				podRes:     fakeResAPI,
+				host:       fakeHost,
+			}
+			server.AddDevice("devA", 1)
+
+			fakeResAPI.CreateFakePod("podA", "default", "uds/testing", []string{"devA"})
+			fakeHost.SetPodIdentity(resourcesapi.FakePodUID("default", "podA"), "containerid01")
+			sess := &session{server: server, peerUID: resourcesapi.FakePodUID("default", "podA"), peerContainer: "containerid01"}
+			valid, err := sess.validatePod("podA", "default")
+			assert.NilError(t, err)
+			assert.Assert(t, valid)
+			assert.Equal(t, server.boundUID, resourcesapi.FakePodUID("default", "podA"))
+			assert.Equal(t, server.boundContainer, "container-01")
+
+			fakeResAPI.CreateFakePod(tc.newPodName, tc.newPodNamespace, "uds/testing", tc.newPodDevices)
+			fakeHost.SetPodIdentity(tc.peerUID, "containerid01")
+			sess = &session{server: server, peerUID: tc.peerUID, peerContainer: "containerid01"}
+			valid, err = sess.validatePod(tc.connectName, tc.connectNamespace)
+			assert.NilError(t, err)
+			assert.Equal(t, valid, tc.expValid)
+		})
+	}
+}
+
+func TestValidatePodAllocation(t *testing.T) {
+	fakeResAPI := resourcesapi.NewFakeHandler()
+	server := &server{
+		deviceType: "uds/testing",
+		devices:    make(map[string]int),
+		podRes:     fakeResAPI,
+	}
+	server.AddDevice("devA", 1)
+
+	// a process of another pod connects first, the server is still bound to the allocation
+	fakeResAPI.CreateFakePod("podA", "default", "uds/testing", []string{"devA"})
+	sess := &session{server: server, peerUID: resourcesapi.FakePodUID("default", "podB")}
+	valid, err := sess.validatePod("podA", "default")
+	assert.NilError(t, err)
+	assert.Assert(t, !valid)
+	assert.Equal(t, server.boundUID, resourcesapi.FakePodUID("default", "podA"))
+	assert.Equal(t, server.boundContainer, "container-01")
+	assert.Equal(t, server.boundPod, "")
+
+	// the devices are allocated to another pod before the allocated pod connects
+	fakeResAPI.CreateFakePod("podB", "default", "uds/testing", []string{"devA"})
+	sess = &session{server: server, peerUID: resourcesapi.FakePodUID("default", "podB")}
+	valid, err = sess.validatePod("podB", "default")
+	assert.NilError(t, err)
+	assert.Assert(t, !valid)
+	assert.Equal(t, server.boundUID, resourcesapi.FakePodUID("default", "podA"))
+}
+
+func TestValidatePodContainer(t *testing.T) {
+	fakeResAPI := resourcesapi.NewFakeHandler()
+	fakeHost := host.NewFakeHandler()
+	defer fakeHost.SetContainerName("container-01")
+
+	testCases := []struct {
+		testName      string
+		peerContainer string
+		containerName string
+		expValid      bool
+	}{
+		{
+			testName:      "Allocated container",
+			peerContainer: "containerid01",
+			containerName: "container-01",
+			expValid:      true,
+		},
+		{
+			testName:      "Another container of the pod",
+			peerContainer: "containerid01",
+			containerName: "sidecar",
+			expValid:      false,
+		},
+		{
+			testName:      "Container unknown to the runtime",
+			peerContainer: "containerid02",
+			containerName: "container-01",
+			expValid:      false,
+		},
+		{
+			testName:      "Container not resolved",
+			peerContainer: "",
+			containerName: "container-01",
+			expValid:      false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			server := &server{
+				deviceType: "uds/testing",
+				devices:    make(map[string]int),
+				podRes:     fakeResAPI,
+				host:       fakeHost,
+			}
+			server.AddDevice("devA", 1)
+
+			fakeResAPI.CreateFakePod("podA", "default", "uds/testing", []string{"devA"})
+			fakeHost.SetPodIdentity(resourcesapi.FakePodUID("default", "podA"), "containerid01")
+			fakeHost.SetContainerName(tc.containerName)
+			sess := &session{server: server, peerUID: resourcesapi.FakePodUID("default", "podA"), peerContainer: tc.peerContainer}
+			valid, err := sess.validatePod("podA", "default")
+			assert.NilError(t, err)
+			assert.Equal(t, valid, tc.expValid)
+		})
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	fakeUDS := uds.NewFakeHandler()
+	fakeUDS.SetRequests(map[int]string{
+		0: constants.Uds.Handshake.RequestConnect + ", podA",
+	})
+
+	server := &server{
+		devices: make(map[string]int),
+		uds:     fakeUDS,
+		bpf:     bpf.NewFakeHandler(),
+		podRes:  resourcesapi.NewFakeHandler(),
+	}
+
+	server.Stop()
+	server.start()
+	server.Stop()
+
+	assert.Equal(t, len(fakeUDS.GetResponses()), 0)
+}
+
+func TestStartIdleTimeout(t *testing.T) {
+	fakeUDS := uds.NewFakeHandler()
+	fakeResAPI := resourcesapi.NewFakeHandler()
+	fakeHost := host.NewFakeHandler()
+
+	testCases := []struct {
+		testName         string
+		sessions         int
+		fakeRequests     map[int]string
+		expectedResponse map[int]string
+	}{
+		{
+			testName:         "No connection",
+			sessions:         0,
+			fakeRequests:     map[int]string{},
+			expectedResponse: map[int]string{},
+		},
+		{
+			testName: "No connection after the last session",
+			sessions: 1,
+			fakeRequests: map[int]string{
+				0: constants.Uds.Handshake.RequestConnect + ", podA",
+				1: constants.Uds.Handshake.RequestFin,
+			},
+			expectedResponse: map[int]string{
+				0: constants.Uds.Handshake.ResponseHostOk,
+				1: constants.Uds.Handshake.ResponseFinAck,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			server := &server{
+				deviceType:     "uds/testing",
+				devices:        make(map[string]int),
+				uds:            fakeUDS,
+				bpf:            bpf.NewFakeHandler(),
+				podRes:         fakeResAPI,
+				host:           fakeHost,
+				udsIdleTimeout: 50 * time.Millisecond,
+			}
+
+			fakeResAPI.CreateFakePod("podA", "default", "uds/testing", []string{"devA"})
+			fakeHost.SetPodIdentity(resourcesapi.FakePodUID("default", "podA"), "containerid01")
+			fakeUDS.SetRequests(tc.fakeRequests)
+			fakeUDS.SetSessions(tc.sessions)
+			fakeUDS.SetKeepListening(true)
+			defer fakeUDS.SetKeepListening(false)
+			server.AddDevice("devA", 1)
+
+			done := make(chan struct{})
+			go func() {
+				server.start()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				server.Stop()
+				t.Fatal("server did not stop after the idle timeout")
+			}
+
+			assert.Assert(t, server.stopped)
+			assert.DeepEqual(t, fakeUDS.GetResponses(), tc.expectedResponse)
+		})
+	}
+}
+
+func TestStartV1(t *testing.T) {
+	fakeUDS := uds.NewFakeHandler()
+	fakeResAPI := resourcesapi.NewFakeHandler()
+	fakeHost := host.NewFakeHandler()
+
+	encode := func(request *uds.Request) string {
+		msg, _ := uds.EncodeMessage(request)
+		return msg
+	}
+
+	testCases := []struct {
+		testName         string
+		fakeRequests     map[int]string
+		queueRange       []uint32
+		fdRequests       []int
+		parents          map[string]string
+		expectedResponse map[int]*uds.Response
+	}{
+		{
+			testName: "Negotiate version, connect and request FD",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageVersion, Versions: []string{"1.0"}, Capabilities: []string{uds.MessageXskMapFd, "unknown"}}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageConnect, Pod: "podA"}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageXskMapFd, Device: "devA"}),
+				3: encode(&uds.Request{ID: 4, Type: uds.MessageXskMapFd, Device: "devB"}),
+				4: encode(&uds.Request{ID: 5, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageVersion, Version: constants.Uds.Handshake.ProtocolVersion, Capabilities: []string{uds.MessageXskMapFd}},
+				1: {ID: 2, Type: uds.MessageConnect},
+				2: {ID: 3, Type: uds.MessageXskMapFd},
+				3: {ID: 4, Type: uds.MessageXskMapFd, Error: &uds.Error{Code: uds.ErrDeviceNotFound, Message: "device devB is not served on this socket"}},
+				4: {ID: 5, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Device info and queue FD",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageDeviceInfo, Device: "devA"}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageDeviceInfo, Device: "devB"}),
+				3: encode(&uds.Request{ID: 4, Type: uds.MessageQueueXskMapFd, Device: "devA", QueueStart: 2, QueueCount: 2}),
+				4: encode(&uds.Request{ID: 5, Type: uds.MessageQueueXskMapFd, Device: "devA", QueueStart: 3, QueueCount: 2}),
+				5: encode(&uds.Request{ID: 6, Type: uds.MessageQueueXskMapFd, Device: "devA", QueueStart: 1}),
+				6: encode(&uds.Request{ID: 7, Type: uds.MessageQueueXskMapFd, Device: "devB", QueueCount: 1}),
+				7: encode(&uds.Request{ID: 8, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect},
+				1: {ID: 2, Type: uds.MessageDeviceInfo, DeviceInfo: &uds.DeviceInfo{Ifindex: 10, Queues: 4, QueueStart: 0, QueueCount: 4, Mtu: 1500, MultiBuffer: new(bool)}},
+				2: {ID: 3, Type: uds.MessageDeviceInfo, Error: &uds.Error{Code: uds.ErrDeviceNotFound, Message: "device devB is not served on this socket"}},
+				3: {ID: 4, Type: uds.MessageQueueXskMapFd},
+				4: {ID: 5, Type: uds.MessageQueueXskMapFd, Error: &uds.Error{Code: uds.ErrQueueRange, Message: "queues 3-4 requested, device devA allows queues 0-3"}},
+				5: {ID: 6, Type: uds.MessageQueueXskMapFd, Error: &uds.Error{Code: uds.ErrBadRequest, Message: "queue start must be zero or more and queue count one or more"}},
+				6: {ID: 7, Type: uds.MessageQueueXskMapFd, Error: &uds.Error{Code: uds.ErrDeviceNotFound, Message: "device devB is not served on this socket"}},
+				7: {ID: 8, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Queues steered by the device",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageDeviceInfo, Device: "devA"}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageQueueXskMapFd, Device: "devA", QueueStart: 2, QueueCount: 1}),
+				3: encode(&uds.Request{ID: 4, Type: uds.MessageQueueXskMapFd, Device: "devA", QueueStart: 1, QueueCount: 1}),
+				4: encode(&uds.Request{ID: 5, Type: uds.MessageCreateXsk, Device: "devA", Xsk: &uds.Xsk{QueueID: 0}}),
+				5: encode(&uds.Request{ID: 6, Type: uds.MessageFin}),
+			},
+			fdRequests: []int{4},
+			queueRange: []uint32{2, 2},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect},
+				1: {ID: 2, Type: uds.MessageDeviceInfo, DeviceInfo: &uds.DeviceInfo{Ifindex: 10, Queues: 4, QueueStart: 2, QueueCount: 2, Mtu: 1500, MultiBuffer: new(bool)}},
+				2: {ID: 3, Type: uds.MessageQueueXskMapFd},
+				3: {ID: 4, Type: uds.MessageQueueXskMapFd, Error: &uds.Error{Code: uds.ErrQueueRange, Message: "queues 1-1 requested, device devA allows queues 2-3"}},
+				4: {ID: 5, Type: uds.MessageCreateXsk, Error: &uds.Error{Code: uds.ErrQueueRange, Message: "queue 0 requested, device devA allows queues 2-3"}},
+				5: {ID: 6, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Create XSK",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageCreateXsk, Device: "devA", Xsk: &uds.Xsk{QueueID: 3}}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageCreateXsk, Device: "devA", Xsk: &uds.Xsk{QueueID: 4}}),
+				3: encode(&uds.Request{ID: 4, Type: uds.MessageCreateXsk, Device: "devA", Xsk: &uds.Xsk{QueueID: 0}}),
+				4: encode(&uds.Request{ID: 5, Type: uds.MessageCreateXsk, Device: "devA"}),
+				5: encode(&uds.Request{ID: 6, Type: uds.MessageCreateXsk, Device: "devB", Xsk: &uds.Xsk{QueueID: 0}}),
+				6: encode(&uds.Request{ID: 7, Type: uds.MessageFin}),
+			},
+			fdRequests: []int{1, 2, 4, 5},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect},
+				1: {ID: 2, Type: uds.MessageCreateXsk},
+				2: {ID: 3, Type: uds.MessageCreateXsk, Error: &uds.Error{Code: uds.ErrQueueRange, Message: "queue 4 requested, device devA allows queues 0-3"}},
+				3: {ID: 4, Type: uds.MessageCreateXsk, Error: &uds.Error{Code: uds.ErrBadRequest, Message: "request must include the UMEM memfd"}},
+				4: {ID: 5, Type: uds.MessageCreateXsk, Error: &uds.Error{Code: uds.ErrBadRequest, Message: "request must include the socket settings"}},
+				5: {ID: 6, Type: uds.MessageCreateXsk, Error: &uds.Error{Code: uds.ErrDeviceNotFound, Message: "device devB is not served on this socket"}},
+				6: {ID: 7, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Socket options",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageSockOpt, SockOpts: []uds.SockOpt{{Name: "SO_PRIORITY", Value: 6}, {Name: "SO_MARK", Value: 1}, {Name: "SO_BUSY_POLL", Value: -1}}}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageSockOpt}),
+				3: encode(&uds.Request{ID: 4, Type: uds.MessageSockOpt, SockOpts: []uds.SockOpt{{Name: "SO_PRIORITY", Value: 6}}}),
+				4: encode(&uds.Request{ID: 5, Type: uds.MessageFin}),
+			},
+			fdRequests: []int{1, 2},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect},
+				1: {ID: 2, Type: uds.MessageSockOpt, SockOpts: []uds.SockOptResult{
+					{Name: "SO_PRIORITY", Applied: true},
+					{Name: "SO_MARK", Reason: "socket option SO_MARK is not allowed in this pool"},
+					{Name: "SO_BUSY_POLL", Reason: "socket option value must be zero or more"},
+				}},
+				2: {ID: 3, Type: uds.MessageSockOpt, Error: &uds.Error{Code: uds.ErrBadRequest, Message: "request must include socket options"}},
+				3: {ID: 4, Type: uds.MessageSockOpt, Error: &uds.Error{Code: uds.ErrBadRequest, Message: "request must include the socket file descriptor"}},
+				4: {ID: 5, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Stats",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageStats, Device: "devA"}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageStats, Device: "devB"}),
+				3: encode(&uds.Request{ID: 4, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect},
+				1: {ID: 2, Type: uds.MessageStats, Stats: &uds.Stats{
+					Device:   "devA",
+					Link:     &uds.LinkStats{RxPackets: 100, TxPackets: 50, RxBytes: 6400, TxBytes: 3200},
+					Counters: map[string]uint64{"rx_unicast": 100},
+					Queues:   []uds.QueueStats{{Queue: 0, Counters: map[string]uint64{"rx_packets": 100}}},
+					Xdp:      &uds.XdpStats{ProgramID: 7, Counters: map[string]uint64{"rx_xdp_redirect": 90}},
+				}},
+				2: {ID: 3, Type: uds.MessageStats, Error: &uds.Error{Code: uds.ErrDeviceNotFound, Message: "device devB is not served on this socket"}},
+				3: {ID: 4, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Stats with parent port",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageStats, Device: "devA"}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageFin}),
+			},
+			parents: map[string]string{"devA": "ens801f0"},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect},
+				1: {ID: 2, Type: uds.MessageStats, Stats: &uds.Stats{
+					Device:   "devA",
+					Link:     &uds.LinkStats{RxPackets: 100, TxPackets: 50, RxBytes: 6400, TxBytes: 3200},
+					Counters: map[string]uint64{"rx_unicast": 100},
+					Queues:   []uds.QueueStats{{Queue: 0, Counters: map[string]uint64{"rx_packets": 100}}},
+					Xdp:      &uds.XdpStats{ProgramID: 7, Counters: map[string]uint64{"rx_xdp_redirect": 90}},
+					Parent: &uds.Stats{
+						Device:   "ens801f0",
+						Link:     &uds.LinkStats{RxPackets: 100, TxPackets: 50, RxBytes: 6400, TxBytes: 3200},
+						Counters: map[string]uint64{"rx_unicast": 100},
+						Queues:   []uds.QueueStats{{Queue: 0, Counters: map[string]uint64{"rx_packets": 100}}},
+						Xdp:      &uds.XdpStats{ProgramID: 7, Counters: map[string]uint64{"rx_xdp_redirect": 90}},
+					},
+				}},
+				2: {ID: 3, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Unsupported version",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageVersion, Versions: []string{"2.0"}}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageVersion, Error: &uds.Error{Code: uds.ErrUnsupportedVersion, Message: "server supports protocol version " + constants.Uds.Handshake.ProtocolVersion}},
+				1: {ID: 2, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Request before connect",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageXskMapFd, Device: "devA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageXskMapFd, Error: &uds.Error{Code: uds.ErrNotConnected, Message: "connect must succeed before " + uds.MessageXskMapFd}},
+				1: {ID: 2, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Connect with namespace",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA", Namespace: "default"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect},
+				1: {ID: 2, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Wrong namespace ends the session",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA", Namespace: "other"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect, Error: &uds.Error{Code: uds.ErrPodNotValid, Message: "pod podA is not valid for this socket"}},
+			},
+		},
+		{
+			testName: "Invalid pod ends the session",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podB"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect, Error: &uds.Error{Code: uds.ErrPodNotValid, Message: "pod podB is not valid for this socket"}},
+			},
+		},
+		{
+			testName: "Busy poll without file descriptor",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageBusyPoll, BusyTimeout: 20, BusyBudget: 64}),
+				2: encode(&uds.Request{ID: 3, Type: "bad"}),
+				3: encode(&uds.Request{ID: 4, Type: uds.MessageFin}),
+			},
+			expectedResponse: map[int]*uds.Response{
+				0: {ID: 1, Type: uds.MessageConnect},
+				1: {ID: 2, Type: uds.MessageBusyPoll, Error: &uds.Error{Code: uds.ErrBadRequest, Message: "request must include the socket file descriptor"}},
+				2: {ID: 3, Type: "bad", Error: &uds.Error{Code: uds.ErrBadRequest, Message: "unknown request type bad"}},
+				3: {ID: 4, Type: uds.MessageFin},
+			},
+		},
+		{
+			testName: "Mixed with 0.1 requests",
+			fakeRequests: map[int]string{
+				0: constants.Uds.Handshake.RequestConnect + ", podA",
+				1: encode(&uds.Request{ID: 1, Type: uds.MessageXskMapFd, Device: "devA"}),
+				2: constants.Uds.Handshake.RequestFin,
+			},
+			expectedResponse: map[int]*uds.Response{
+				1: {ID: 1, Type: uds.MessageXskMapFd},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			fakeNet := networking.NewFakeHandler()
+			if len(tc.queueRange) == 2 {
+				fakeNet.SetQueueRange(tc.queueRange[0], tc.queueRange[1])
+			}
+			server := &server{
+				deviceType: "uds/testing",
+				devices:    make(map[string]int),
+				uds:        fakeUDS,
+				podRes:     fakeResAPI,
+				host:       fakeHost,
+				netHandler: fakeNet,
+				bpf:        bpf.NewFakeHandler(),
+				sockOpts:   []string{"SO_PRIORITY", "SO_BUSY_POLL"},
+			}
+
+			fakeResAPI.CreateFakePod("podA", "default", "uds/testing", []string{"devA"})
+			fakeHost.SetPodIdentity(resourcesapi.FakePodUID("default", "podA"), "containerid01")
+			fakeUDS.SetRequests(tc.fakeRequests)
+
+			// the server closes the fds it receives, so each request gets its own
+			requestFds := make(map[int]int)
+			for _, i := range tc.fdRequests {
+				fd, err := unix.Open(os.DevNull, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+				assert.NilError(t, err)
+				requestFds[i] = fd
+			}
+			fakeUDS.SetRequestFds(requestFds)
+			server.AddDevice("devA", 1)
+			for device, parent := range tc.parents {
+				server.SetParent(device, parent)
+			}
+
+			server.start()
+
+			responses := fakeUDS.GetResponses()
+			for i, response := range responses {
+				if !uds.IsMessage(response) {
+					continue
+				}
+				var decoded uds.Response
+				assert.NilError(t, uds.DecodeMessage(response, &decoded))
+				assert.DeepEqual(t, &decoded, tc.expectedResponse[i])
+			}
+			for i := range tc.expectedResponse {
+				_, ok := responses[i]
+				assert.Assert(t, ok, "missing response %d", i)
+			}
+		})
+	}
+}
+
+func TestStartV1ClosesFds(t *testing.T) {
+	fakeUDS := uds.NewFakeHandler()
+	fakeResAPI := resourcesapi.NewFakeHandler()
+	fakeHost := host.NewFakeHandler()
+
+	encode := func(request *uds.Request) string {
+		msg, _ := uds.EncodeMessage(request)
+		return msg
+	}
+
+	testCases := []struct {
+		testName     string
+		fakeRequests map[int]string
+		fdRequest    int
+	}{
+		{
+			testName: "Fd sent with a version request",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageVersion, Versions: []string{"1.0"}}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			fdRequest: 0,
+		},
+		{
+			testName: "Fd sent with a busy poll request",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA", Namespace: "default"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageBusyPoll, BusyTimeout: 20, BusyBudget: 64}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageFin}),
+			},
+			fdRequest: 1,
+		},
+		{
+			testName: "Fd sent before connect",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageBusyPoll, BusyTimeout: 20, BusyBudget: 64}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			fdRequest: 0,
+		},
+		{
+			testName: "Fd sent with a create xsk request before connect",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageCreateXsk, Device: "devA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			fdRequest: 0,
+		},
+		{
+			testName: "Fd sent with a sockopt request before connect",
+			fakeRequests: map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageSockOpt, Device: "devA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			fdRequest: 0,
+		},
+		{
+			testName: "Fd sent with a malformed request",
+			fakeRequests: map[int]string{
+				0: string([]byte{0, 0, 0, 1}) + "{",
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageFin}),
+			},
+			fdRequest: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			server := &server{
+				deviceType: "uds/testing",
+				devices:    make(map[string]int),
+				uds:        fakeUDS,
+				podRes:     fakeResAPI,
+				host:       fakeHost,
+				netHandler: networking.NewFakeHandler(),
+				bpf:        bpf.NewFakeHandler(),
+			}
+
+			fakeResAPI.CreateFakePod("podA", "default", "uds/testing", []string{"devA"})
+			fakeHost.SetPodIdentity(resourcesapi.FakePodUID("default", "podA"), "containerid01")
+			fakeUDS.SetRequests(tc.fakeRequests)
+
+			fd, err := unix.Open(os.DevNull, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+			assert.NilError(t, err)
+			fakeUDS.SetRequestFds(map[int]int{tc.fdRequest: fd})
+			server.AddDevice("devA", 1)
+
+			server.start()
+
+			_, err = unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+			assert.Equal(t, err, unix.EBADF)
+		})
+	}
+}
+
+func TestCreateXskLimits(t *testing.T) {
+	fakeUDS := uds.NewFakeHandler()
+	fakeResAPI := resourcesapi.NewFakeHandler()
+	fakeHost := host.NewFakeHandler()
+	maxUmem := uint64(constants.Afxdp.MaxUmemSize)
+
+	encode := func(request *uds.Request) string {
+		msg, _ := uds.EncodeMessage(request)
+		return msg
+	}
+
+	fullSockets := make(map[xskKey]uint64)
+	for i := 0; i < constants.Afxdp.MaxXsks; i++ {
+		fullSockets[xskKey{device: "devA", queue: uint32(100 + i)}] = 4096
+	}
+
+	testCases := []struct {
+		testName     string
+		xsks         map[xskKey]uint64
+		umemSize     int64
+		queue        uint32
+		expectedXsks int
+		expectedErr  *uds.Error
+	}{
+		{
+			testName:     "Socket within the limits",
+			umemSize:     4096,
+			expectedXsks: 1,
+		},
+		{
+			testName:     "UMEM larger than allowed",
+			umemSize:     int64(maxUmem) + 1,
+			expectedXsks: 0,
+			expectedErr:  &uds.Error{Code: uds.ErrXskLimit, Message: fmt.Sprintf("UMEM of %d bytes, %d bytes allowed: UMEM size limit exceeded", maxUmem+1, maxUmem)},
+		},
+		{
+			testName:     "UMEM larger than left to the pod",
+			xsks:         map[xskKey]uint64{{device: "devA", queue: 1}: maxUmem - 1024},
+			umemSize:     4096,
+			expectedXsks: 1,
+			expectedErr:  &uds.Error{Code: uds.ErrXskLimit, Message: "UMEM of 4096 bytes, 1024 bytes allowed: UMEM size limit exceeded"},
+		},
+		{
+			testName:     "UMEM of a replaced socket is not counted",
+			xsks:         map[xskKey]uint64{{device: "devA", queue: 0}: maxUmem},
+			umemSize:     4096,
+			expectedXsks: 1,
+		},
+		{
+			testName:     "Sockets limit reached",
+			xsks:         fullSockets,
+			umemSize:     4096,
+			expectedXsks: constants.Afxdp.MaxXsks,
+			expectedErr:  &uds.Error{Code: uds.ErrXskLimit, Message: fmt.Sprintf("the pod is allowed %d sockets", constants.Afxdp.MaxXsks)},
+		},
+		{
+			testName:     "Socket replaced when the sockets limit is reached",
+			xsks:         fullSockets,
+			umemSize:     4096,
+			queue:        100,
+			expectedXsks: constants.Afxdp.MaxXsks,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			fakeNet := networking.NewFakeHandler()
+			fakeNet.SetQueueRange(0, 200)
+			server := &server{
+				deviceType: "uds/testing",
+				devices:    make(map[string]int),
+				uds:        fakeUDS,
+				podRes:     fakeResAPI,
+				host:       fakeHost,
+				netHandler: fakeNet,
+				bpf:        bpf.NewFakeHandler(),
+				xsks:       make(map[xskKey]uint64),
+			}
+			for key, size := range tc.xsks {
+				server.xsks[key] = size
+			}
+
+			fakeResAPI.CreateFakePod("podA", "default", "uds/testing", []string{"devA"})
+			fakeHost.SetPodIdentity(resourcesapi.FakePodUID("default", "podA"), "containerid01")
+			fakeUDS.SetRequests(map[int]string{
+				0: encode(&uds.Request{ID: 1, Type: uds.MessageConnect, Pod: "podA"}),
+				1: encode(&uds.Request{ID: 2, Type: uds.MessageCreateXsk, Device: "devA", Xsk: &uds.Xsk{QueueID: tc.queue}}),
+				2: encode(&uds.Request{ID: 3, Type: uds.MessageFin}),
+			})
+
+			// a sparse memfd, the fake handler only reads its size
+			umemFd, err := unix.MemfdCreate("umem", unix.MFD_CLOEXEC)
+			assert.NilError(t, err)
+			assert.NilError(t, unix.Ftruncate(umemFd, tc.umemSize))
+			fakeUDS.SetRequestFds(map[int]int{1: umemFd})
+			server.AddDevice("devA", 1)
+
+			server.start()
+
+			var response uds.Response
+			assert.NilError(t, uds.DecodeMessage(fakeUDS.GetResponses()[1], &response))
+			assert.DeepEqual(t, response.Error, tc.expectedErr)
+			assert.Equal(t, len(server.xsks), tc.expectedXsks)
+			if tc.expectedErr == nil {
+				assert.Equal(t, server.xsks[xskKey{device: "devA", queue: tc.queue}], uint64(tc.umemSize))
+			}
+		})
+	}
+}
+
+func TestBusyPollSettings(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		busyPoll        *networking.BusyPollConfig
+		timeout         int
+		budget          int
+		expectedTimeout int
+		expectedBudget  int
+		expectedPrefer  bool
+	}{
+		{
+			testName:        "No pool policy",
+			timeout:         20,
+			budget:          32,
+			expectedTimeout: 20,
+			expectedBudget:  32,
+			expectedPrefer:  true,
+		},
+		{
+			testName:        "Pool policy fills unset values",
+			busyPoll:        &networking.BusyPollConfig{Timeout: 50, Budget: 64},
+			expectedTimeout: 50,
+			expectedBudget:  64,
+			expectedPrefer:  false,
+		},
+		{
+			testName:        "Requested values override pool policy",
+			busyPoll:        &networking.BusyPollConfig{Timeout: 50, Budget: 64, Prefer: true},
+			timeout:         20,
+			expectedTimeout: 20,
+			expectedBudget:  64,
+			expectedPrefer:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			server := &server{busyPoll: tc.busyPoll}
+			timeout, budget, prefer := server.busyPollSettings(tc.timeout, tc.budget)
+			assert.Equal(t, timeout, tc.expectedTimeout)
+			assert.Equal(t, budget, tc.expectedBudget)
+			assert.Equal(t, prefer, tc.expectedPrefer)
+		})
+	}
+}
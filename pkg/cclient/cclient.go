@@ -2,8 +2,10 @@ package main
 
 import (
 	"C"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/uds"
 	"github.com/intel/afxdp-plugins-for-kubernetes/pkg/goclient"
@@ -40,6 +42,24 @@ func GetUdsServerVersion() *C.char {
 	return C.CString(response)
 }
 
+/*
+GetUdsServerCapabilities is an exported version for c of the goclient GetServerCapabilities()
+The capabilities are returned as a comma separated list
+*/
+//export GetUdsServerCapabilities
+func GetUdsServerCapabilities() *C.char {
+	capabilities, function, err := goclient.GetServerCapabilities()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		function()
+		return C.CString("-1")
+	}
+
+	cleaner = function
+
+	return C.CString(strings.Join(capabilities, ","))
+}
+
 /*
 GetXskMapFd is an exported version for c of the goclient XskMapFd()
 */
@@ -61,6 +81,152 @@ func RequestXskMapFd(device *C.char) (fd C.int) {
 	return -1
 }
 
+/*
+RequestDeviceInfo is an exported version for c of the goclient RequestDeviceInfo()
+The device info is written to the int pointers. multiBuffer is 1 or 0, or -1 if unknown.
+It returns 0 on success and -1 on failure.
+*/
+//export RequestDeviceInfo
+func RequestDeviceInfo(device *C.char, ifindex, queues, queueStart, queueCount, mtu, multiBuffer *C.int) C.int {
+	if device == nil || ifindex == nil || queues == nil || queueStart == nil || queueCount == nil || mtu == nil || multiBuffer == nil {
+		return -1
+	}
+
+	info, function, err := goclient.RequestDeviceInfo(C.GoString(device))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		function()
+		return -1
+	}
+
+	*ifindex = C.int(info.Ifindex)
+	*queues = C.int(info.Queues)
+	*queueStart = C.int(info.QueueStart)
+	*queueCount = C.int(info.QueueCount)
+	*mtu = C.int(info.Mtu)
+	*multiBuffer = -1
+	if info.MultiBuffer != nil {
+		*multiBuffer = 0
+		if *info.MultiBuffer {
+			*multiBuffer = 1
+		}
+	}
+
+	cleaner = function
+	return 0
+}
+
+/*
+RequestQueueXskMapFd is an exported version for c of the goclient RequestQueueXSKmapFD()
+*/
+//export RequestQueueXskMapFd
+func RequestQueueXskMapFd(device *C.char, queueStart, queueCount C.int) C.int {
+	if device == nil {
+		return -1
+	}
+
+	fd, function, err := goclient.RequestQueueXSKmapFD(C.GoString(device), int(queueStart), int(queueCount))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		function()
+		return -1
+	}
+
+	cleaner = function
+	return C.int(fd)
+}
+
+/*
+RequestXsk is an exported version for c of the goclient RequestXsk()
+*/
+//export RequestXsk
+func RequestXsk(device *C.char, umemFd, queueID, chunkSize, headroom, fillSize, compSize, rxSize, txSize, needWakeup C.int) C.int {
+	if device == nil || umemFd <= 0 {
+		return -1
+	}
+	for _, value := range []C.int{queueID, chunkSize, headroom, fillSize, compSize, rxSize, txSize} {
+		if value < 0 {
+			return -1
+		}
+	}
+
+	xsk := &uds.Xsk{
+		QueueID:    uint32(queueID),
+		ChunkSize:  uint32(chunkSize),
+		Headroom:   uint32(headroom),
+		FillSize:   uint32(fillSize),
+		CompSize:   uint32(compSize),
+		RxSize:     uint32(rxSize),
+		TxSize:     uint32(txSize),
+		NeedWakeup: needWakeup != 0,
+	}
+
+	fd, function, err := goclient.RequestXsk(C.GoString(device), xsk, int(umemFd))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		function()
+		return -1
+	}
+
+	cleaner = function
+	return C.int(fd)
+}
+
+/*
+RequestSockOpt is an exported version for c of the goclient RequestSockOpts(), setting a single option.
+It returns 0 if the option was set, or -1 and prints the reason if it was not.
+*/
+//export RequestSockOpt
+func RequestSockOpt(fd C.int, name *C.char, value C.int) C.int {
+	if name == nil || fd <= 0 {
+		return -1
+	}
+
+	results, function, err := goclient.RequestSockOpts(int(fd), []uds.SockOpt{{Name: C.GoString(name), Value: int(value)}})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		function()
+		return -1
+	}
+	cleaner = function
+
+	if len(results) != 1 || !results[0].Applied {
+		for _, result := range results {
+			fmt.Fprintln(os.Stderr, "Library Error: Socket option "+result.Name+" was not set: "+result.Reason)
+		}
+		return -1
+	}
+
+	return 0
+}
+
+/*
+RequestStats is an exported version for c of the goclient RequestStats(). The stats are
+returned as a JSON string, which the caller must free, or NULL on error.
+*/
+//export RequestStats
+func RequestStats(device *C.char) *C.char {
+	if device == nil {
+		return nil
+	}
+
+	stats, function, err := goclient.RequestStats(C.GoString(device))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		function()
+		return nil
+	}
+	cleaner = function
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Library Error: Error encoding stats: "+err.Error())
+		return nil
+	}
+
+	return C.CString(string(data))
+}
+
 /*
 RequestBusyPoll is an exported version for c of the goclient RequestBusyPoll()
 */
@@ -2,10 +2,13 @@ package goclient
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/intel/afxdp-plugins-for-kubernetes/constants"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/host"
+	"github.com/intel/afxdp-plugins-for-kubernetes/internal/tools"
 	"github.com/intel/afxdp-plugins-for-kubernetes/internal/uds"
 )
 
@@ -14,13 +17,16 @@ var (
 	hostPod       host.Handler
 	cleanupGlobal uds.CleanupFunc
 	connected     bool = false
+	serverVersion string
+	capabilities  []string
+	requestID     uint32
 )
 
 /*
 GetClientVersion returns the version of our Handshake from the client
 */
 func GetClientVersion() string {
-	return constants.Uds.Handshake.Version
+	return constants.Uds.Handshake.ProtocolVersion
 }
 
 /*
@@ -34,18 +40,24 @@ func GetServerVersion() (string, uds.CleanupFunc, error) {
 		}
 	}
 
-	if err := hostUds.Write(constants.Uds.Handshake.RequestVersion, -1); err != nil {
-		return "", cleanupGlobal, fmt.Errorf("Library Error: Writing Error: %v", err)
-	}
+	return serverVersion,
+		cleanupGlobal,
+		nil
+}
 
-	response, _, err := hostUds.Read()
-	if err != nil {
-		return "", cleanupGlobal, fmt.Errorf("Library Error: Reading Error: %v", err)
+/*
+GetServerCapabilities returns the requests supported by both the client and the server,
+as agreed when the connection was made
+*/
+func GetServerCapabilities() ([]string, uds.CleanupFunc, error) {
+	if !connected {
+		err := initFunc()
+		if err != nil {
+			return nil, cleanupGlobal, err
+		}
 	}
 
-	return response,
-		cleanupGlobal,
-		nil
+	return capabilities, cleanupGlobal, nil
 }
 
 /*
@@ -60,23 +72,154 @@ func RequestXSKmapFD(device string) (int, uds.CleanupFunc, error) {
 		}
 	}
 
-	if err := hostUds.Write(constants.Uds.Handshake.RequestFd+", "+device, -1); err != nil {
-		return 0, cleanupGlobal, fmt.Errorf("Library Error: UDS Write error: %v", err)
+	_, fd, err := request(&uds.Request{Type: uds.MessageXskMapFd, Device: device}, -1)
+	if err != nil {
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: Request for FD was not acknowledged: %v", err)
+	}
+
+	if fd <= 0 {
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: No FD was received for device %s", device)
+	}
+
+	return fd, cleanupGlobal, nil
+}
+
+/*
+RequestDeviceInfo requires a device name and returns the device ifindex, queue count, the range of
+queues the pod may use, MTU and multi-buffer support, a cleanup function to close the connection, and an error
+*/
+func RequestDeviceInfo(device string) (*uds.DeviceInfo, uds.CleanupFunc, error) {
+	if !connected {
+		if err := initFunc(); err != nil {
+			return nil, cleanupGlobal, fmt.Errorf("Library Error: Initializing Error: %v", err)
+		}
+	}
+
+	if !tools.ArrayContains(capabilities, uds.MessageDeviceInfo) {
+		return nil, cleanupGlobal, fmt.Errorf("Library Error: Device plugin does not support %s requests", uds.MessageDeviceInfo)
+	}
+
+	response, _, err := request(&uds.Request{Type: uds.MessageDeviceInfo, Device: device}, -1)
+	if err != nil {
+		return nil, cleanupGlobal, fmt.Errorf("Library Error: Request for device info failed: %v", err)
+	}
+
+	if response.DeviceInfo == nil {
+		return nil, cleanupGlobal, fmt.Errorf("Library Error: No info was received for device %s", device)
+	}
+
+	return response.DeviceInfo, cleanupGlobal, nil
+}
+
+/*
+RequestQueueXSKmapFD requires a device name and a range of queues, and returns the XSK map fd of the device
+if the pod may use those queues, a cleanup function to close the connection, and an error
+*/
+func RequestQueueXSKmapFD(device string, queueStart, queueCount int) (int, uds.CleanupFunc, error) {
+	if !connected {
+		if err := initFunc(); err != nil {
+			return 0, cleanupGlobal, fmt.Errorf("Library Error: Initializing Error: %v", err)
+		}
+	}
+
+	if !tools.ArrayContains(capabilities, uds.MessageQueueXskMapFd) {
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: Device plugin does not support %s requests", uds.MessageQueueXskMapFd)
+	}
+
+	_, fd, err := request(&uds.Request{Type: uds.MessageQueueXskMapFd, Device: device, QueueStart: queueStart, QueueCount: queueCount}, -1)
+	if err != nil {
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: Request for FD was not acknowledged: %v", err)
+	}
+
+	if fd <= 0 {
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: No FD was received for device %s", device)
+	}
+
+	return fd, cleanupGlobal, nil
+}
+
+/*
+RequestXsk requires a device name, the settings of an AF_XDP socket and a memfd holding the
+UMEM of the pod. The device plugin creates the socket on the UMEM, binds it to the queue and
+inserts it into the XSK map of the device. The socket fd, a cleanup function to close the
+connection, and an error are returned. Ring sizes and chunk size left at 0 use the defaults.
+*/
+func RequestXsk(device string, xsk *uds.Xsk, umemFd int) (int, uds.CleanupFunc, error) {
+	if !connected {
+		if err := initFunc(); err != nil {
+			return 0, cleanupGlobal, fmt.Errorf("Library Error: Initializing Error: %v", err)
+		}
+	}
+
+	if !tools.ArrayContains(capabilities, uds.MessageCreateXsk) {
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: Device plugin does not support %s requests", uds.MessageCreateXsk)
+	}
 
+	if xsk == nil || umemFd <= 0 {
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: Socket settings and a UMEM memfd are required")
 	}
 
-	response, fd, err := hostUds.Read()
+	_, fd, err := request(&uds.Request{Type: uds.MessageCreateXsk, Device: device, Xsk: xsk}, umemFd)
 	if err != nil {
-		return 0, cleanupGlobal, fmt.Errorf("Library Error: UDS Read error: %v", err)
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: Request for AF_XDP socket was not acknowledged: %v", err)
+	}
 
+	if fd <= 0 {
+		return 0, cleanupGlobal, fmt.Errorf("Library Error: No AF_XDP socket was received for device %s", device)
 	}
 
-	if response == constants.Uds.Handshake.ResponseFdAck {
-		return fd, cleanupGlobal, nil
-	} else {
-		return 0, cleanupGlobal, fmt.Errorf("Library Error: Request for FD was not acknowledged")
+	return fd, cleanupGlobal, nil
+}
+
+/*
+RequestSockOpts takes a socket fd and a list of socket options for the device plugin to set on it.
+Options the pod cannot set itself, such as SO_RCVBUFFORCE or SO_MARK, are set if the pool allows them.
+The result of each option, a cleanup function to close the connection, and an error are returned.
+*/
+func RequestSockOpts(fd int, options []uds.SockOpt) ([]uds.SockOptResult, uds.CleanupFunc, error) {
+	if !connected {
+		if err := initFunc(); err != nil {
+			return nil, cleanupGlobal, fmt.Errorf("Library Error: Initializing Error: %v", err)
+		}
 	}
 
+	if !tools.ArrayContains(capabilities, uds.MessageSockOpt) {
+		return nil, cleanupGlobal, fmt.Errorf("Library Error: Device plugin does not support %s requests", uds.MessageSockOpt)
+	}
+
+	response, _, err := request(&uds.Request{Type: uds.MessageSockOpt, SockOpts: options}, fd)
+	if err != nil {
+		return nil, cleanupGlobal, fmt.Errorf("Library Error: Request for socket options was not acknowledged: %v", err)
+	}
+
+	return response.SockOpts, cleanupGlobal, nil
+}
+
+/*
+RequestStats requires a device name and returns the counters of the device, a cleanup function
+to close the connection, and an error. In cdq mode the counters of the parent port are included.
+*/
+func RequestStats(device string) (*uds.Stats, uds.CleanupFunc, error) {
+	if !connected {
+		if err := initFunc(); err != nil {
+			return nil, cleanupGlobal, fmt.Errorf("Library Error: Initializing Error: %v", err)
+		}
+	}
+
+	if !tools.ArrayContains(capabilities, uds.MessageStats) {
+		return nil, cleanupGlobal, fmt.Errorf("Library Error: Device plugin does not support %s requests", uds.MessageStats)
+	}
+
+	response, _, err := request(&uds.Request{Type: uds.MessageStats, Device: device}, -1)
+	if err != nil {
+		return nil, cleanupGlobal, fmt.Errorf("Library Error: Request for stats was not acknowledged: %v", err)
+	}
+
+	if response.Stats == nil {
+		return nil, cleanupGlobal, fmt.Errorf("Library Error: No stats were received for device %s", device)
+	}
+
+	return response.Stats, cleanupGlobal, nil
 }
 
 /*
@@ -90,34 +233,82 @@ func RequestBusyPoll(busyTimeout, busyBudget, fd int) (uds.CleanupFunc, error) {
 		}
 	}
 
-	pollString := fmt.Sprintf("%s, %d, %d", constants.Uds.Handshake.RequestBusyPoll, busyTimeout, busyBudget)
+	_, _, err := request(&uds.Request{Type: uds.MessageBusyPoll, BusyTimeout: busyTimeout, BusyBudget: busyBudget}, fd)
+	if err != nil {
+		return cleanupGlobal, fmt.Errorf("Library Error: Device plugin error configuring busy poll: %v", err)
+	}
+
+	return cleanupGlobal, nil
+}
+
+/*
+request sends a v1 protocol request and waits for its response. The file descriptor in the
+response control buffer, if any, is also returned. If the device plugin returns an error,
+it is returned as a *uds.Error.
+*/
+func request(req *uds.Request, fd int) (*uds.Response, int, error) {
+	requestID++
+	req.ID = requestID
 
-	if err := hostUds.Write(pollString, fd); err != nil {
-		return cleanupGlobal, fmt.Errorf("Library Error: Failed to write to UDS error: %v", err)
+	msg, err := uds.EncodeMessage(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Encoding error: %v", err)
 	}
 
-	response, _, err := hostUds.Read()
+	if err := hostUds.Write(msg, fd); err != nil {
+		return nil, 0, fmt.Errorf("UDS Write error: %v", err)
+	}
+
+	msg, rfd, err := hostUds.Read()
 	if err != nil {
-		return cleanupGlobal, fmt.Errorf("Library Error: Failed to read UDS error: %v", err)
+		return nil, 0, fmt.Errorf("UDS Read error: %v", err)
 	}
 
-	if response == constants.Uds.Handshake.ResponseBusyPollNak {
-		return cleanupGlobal, fmt.Errorf("Library Error: Device plugin error configuring busy poll")
+	var response uds.Response
+	if !uds.IsMessage(msg) {
+		return nil, 0, fmt.Errorf("device plugin does not support UDS protocol %s, response: %s", constants.Uds.Handshake.ProtocolVersion, msg)
+	}
+	if err := uds.DecodeMessage(msg, &response); err != nil {
+		return nil, 0, fmt.Errorf("Decoding error: %v", err)
+	}
+	if response.ID != req.ID {
+		return nil, 0, fmt.Errorf("response ID %d does not match request ID %d", response.ID, req.ID)
+	}
+	if response.Error != nil {
+		return &response, rfd, response.Error
 	}
 
-	return cleanupGlobal, nil
+	return &response, rfd, nil
+}
+
+/*
+podNamespace returns the namespace of the pod, from the POD_NAMESPACE env var or else from the
+service account namespace file. An empty namespace is returned if neither is available,
+in which case the device plugin validates the pod by name only.
+*/
+func podNamespace() string {
+	if namespace, ok := os.LookupEnv(constants.Uds.PodNsEnv); ok && namespace != "" {
+		return namespace
+	}
+
+	data, err := os.ReadFile(constants.Uds.PodNsFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
 }
 
 /*
 initFunc initializes the library, returns a cleanup function and an error
+The protocol version and capabilities are agreed with the server, then the pod is validated
+by name and namespace.
 */
 func initFunc() error {
 	hostUds = uds.NewHandler()
 	hostPod = host.NewHandler()
-	var response string
 
 	// init uds Handler for reading and writing
-	if err := hostUds.Init(constants.Uds.PodPath, constants.Uds.Protocol, constants.Uds.MsgBufSize, constants.Uds.CtlBufSize, 0*time.Second, ""); err != nil {
+	if err := hostUds.Init(constants.Uds.PodPath, constants.Uds.Protocol, constants.Uds.MaxMsgSize, constants.Uds.CtlBufSize, 0*time.Second, ""); err != nil {
 		return fmt.Errorf("Library Error: Error Initialising UDS server: %v", err)
 	}
 
@@ -127,22 +318,26 @@ func initFunc() error {
 		return fmt.Errorf("Library Error: UDS Dial error: %v", err)
 	}
 
-	hostname, err := hostPod.Hostname()
+	response, _, err := request(&uds.Request{
+		Type:         uds.MessageVersion,
+		Versions:     []string{constants.Uds.Handshake.ProtocolVersion},
+		Capabilities: uds.Capabilities,
+	}, -1)
 	if err != nil {
-		return fmt.Errorf("Library Error: Failed to initialize host: %v", err)
-	}
-
-	if err = hostUds.Write(constants.Uds.Handshake.RequestConnect+", "+hostname, -1); err != nil {
-		return fmt.Errorf("Library Error: UDS Write error: %v", err)
+		return fmt.Errorf("Library Error: Version negotiation error: %v", err)
 	}
+	serverVersion = response.Version
+	capabilities = response.Capabilities
 
-	if response, _, err = hostUds.Read(); err != nil {
-		return fmt.Errorf("Library Error: UDS Read error : %v", err)
+	hostname, err := hostPod.Hostname()
+	if err != nil {
+		return fmt.Errorf("Library Error: Failed to initialize host: %v", err)
 	}
 
-	if response == constants.Uds.Handshake.ResponseHostOk {
-		connected = true
+	if _, _, err = request(&uds.Request{Type: uds.MessageConnect, Pod: hostname, Namespace: podNamespace()}, -1); err != nil {
+		return fmt.Errorf("Library Error: Connect error: %v", err)
 	}
 
+	connected = true
 	return nil
 }
@@ -27,27 +27,53 @@ import (
 /*
 CreateCdqSubfunction takes the PCI address of a port and a subfunction number
 It creates that subfunction on top of that port and activates it
+If hwAddr is not empty it is set as the MAC address of the subfunction before activation
+The port index (pci/index) of the new subfunction is returned, without the pci/ prefix
+If the subfunction cannot be configured or activated, its port is deleted
 */
-func CreateCdqSubfunction(parentPci string, pfnum string, sfnum string) error {
+func CreateCdqSubfunction(parentPci string, pfnum string, sfnum string, hwAddr string) (string, error) {
 	app := "devlink"
 	args := []string{"port", "add", "pci/" + parentPci, "flavour", "pcisf", "pfnum", pfnum, "sfnum", sfnum}
 
 	output, err := exec.Command(app, args...).Output()
 	if err != nil {
 		logging.Errorf("Error creating sub-function %s on pci %s: %v", sfnum, parentPci, err.Error())
-		return err
+		return "", err
 	}
 
 	portIndex := strings.Split(string(output), ": ")[0]
+
+	if hwAddr != "" {
+		args = []string{"port", "function", "set", portIndex, "hw_addr", hwAddr}
+
+		output, err = exec.Command(app, args...).CombinedOutput()
+		if err != nil {
+			logging.Errorf("Error setting MAC address %s of sub-function %s on pci %s: %v: %s", hwAddr, sfnum, parentPci, err, strings.TrimSpace(string(output)))
+			deletePort(portIndex)
+			return "", err
+		}
+	}
+
 	args = []string{"port", "function", "set", portIndex, "state", "active"}
 
 	_, err = exec.Command(app, args...).Output()
 	if err != nil {
 		logging.Errorf("Error activating sub-function %s on pci %s: %v", sfnum, parentPci, err.Error())
-		return err
+		deletePort(portIndex)
+		return "", err
 	}
 
-	return nil
+	return strings.TrimPrefix(portIndex, "pci/"), nil
+}
+
+/*
+deletePort deletes the devlink port of a subfunction that failed to be created
+*/
+func deletePort(portIndex string) {
+	output, err := exec.Command("devlink", "port", "del", portIndex).CombinedOutput()
+	if err != nil {
+		logging.Errorf("Error deleting sub-function port %s: %v: %s", portIndex, err, strings.TrimSpace(string(output)))
+	}
 }
 
 /*
@@ -146,6 +172,32 @@ func GetCdqPfnum(netdev string) (string, error) {
 	return "", fmt.Errorf("device %s not found by devlink (2)", netdev)
 }
 
+/*
+GetCdqQueueBase takes the netdev name of a CDQ subfunction and returns the index on the
+parent port of the first queue of the subfunction, from the queue_base of its devlink port
+Other netdevs will return a "device not found by devlink" error
+*/
+func GetCdqQueueBase(netdev string) (int, error) {
+	devlinkList := "devlink port list | grep " + `"\b` + netdev + `\b"`
+
+	devList, err := exec.Command("sh", "-c", devlinkList).CombinedOutput()
+	if err != nil {
+		if strings.Contains(err.Error(), "exit status 1") {
+			return 0, fmt.Errorf("device %s not found by devlink (1)", netdev)
+		}
+		return 0, err
+	}
+
+	fields := strings.Fields(string(devList))
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] == "queue_base" {
+			return strconv.Atoi(fields[i+1])
+		}
+	}
+
+	return 0, fmt.Errorf("devlink reports no queue base for device %s", netdev)
+}
+
 /*
 NumAvailableCdqSubfunctions takes the PCI of a physical port and returns how
 many unused CDQ subfunctions are available
@@ -161,6 +213,9 @@ func NumAvailableCdqSubfunctions(pci string) (int, error) {
 	}
 
 	lines := strings.Split(string(resourceInfo), "\n")
+	if len(lines) < 4 || len(strings.Fields(lines[3])) < 6 {
+		return 0, fmt.Errorf("unexpected devlink resource output for pci %s", pci)
+	}
 	totalSFs, err := strconv.Atoi(strings.Fields(lines[3])[3]) //line 3, word 3 - "size"
 	if err != nil {
 		logging.Errorf("Error converting total available SFs to int %s", err)
@@ -173,3 +228,87 @@ func NumAvailableCdqSubfunctions(pci string) (int, error) {
 	}
 	return totalSFs - inUseSFs, nil
 }
+
+/*
+CreateCdqRateNode takes the PCI address of a port and creates a devlink rate node on it
+Subfunctions can be grouped under the node, which limits their combined rate
+Empty rates are not set
+*/
+func CreateCdqRateNode(parentPci string, node string, txShare string, txMax string) error {
+	app := "devlink"
+	args := append([]string{"port", "function", "rate", "add", "pci/" + parentPci + "/" + node}, rateArgs(txShare, txMax)...)
+
+	output, err := exec.Command(app, args...).CombinedOutput()
+	if err != nil {
+		logging.Errorf("Error creating rate node %s on pci %s: %v: %s", node, parentPci, err, strings.TrimSpace(string(output)))
+		return err
+	}
+
+	return nil
+}
+
+/*
+DeleteCdqRateNode takes the PCI address of a port and deletes a devlink rate node from it
+The node must no longer have any subfunctions grouped under it
+*/
+func DeleteCdqRateNode(parentPci string, node string) error {
+	app := "devlink"
+	args := []string{"port", "function", "rate", "del", "pci/" + parentPci + "/" + node}
+
+	output, err := exec.Command(app, args...).CombinedOutput()
+	if err != nil {
+		logging.Errorf("Error deleting rate node %s on pci %s: %v: %s", node, parentPci, err, strings.TrimSpace(string(output)))
+		return err
+	}
+
+	return nil
+}
+
+/*
+SetCdqRate takes the port index of a subfunction and sets its rates
+If node is not empty the subfunction is grouped under that rate node
+Empty rates are not set
+*/
+func SetCdqRate(portIndex string, node string, txShare string, txMax string) error {
+	app := "devlink"
+	args := append([]string{"port", "function", "rate", "set", "pci/" + portIndex}, rateArgs(txShare, txMax)...)
+	if node != "" {
+		args = append(args, "parent", node)
+	}
+
+	output, err := exec.Command(app, args...).CombinedOutput()
+	if err != nil {
+		logging.Errorf("Error setting rate of sub-function %s: %v: %s", portIndex, err, strings.TrimSpace(string(output)))
+		return err
+	}
+
+	return nil
+}
+
+/*
+ClearCdqRate takes the port index of a subfunction, removes its rates and
+removes it from any rate node
+*/
+func ClearCdqRate(portIndex string) error {
+	app := "devlink"
+	args := []string{"port", "function", "rate", "set", "pci/" + portIndex, "tx_share", "0", "tx_max", "0", "noparent"}
+
+	output, err := exec.Command(app, args...).CombinedOutput()
+	if err != nil {
+		logging.Errorf("Error clearing rate of sub-function %s: %v: %s", portIndex, err, strings.TrimSpace(string(output)))
+		return err
+	}
+
+	return nil
+}
+
+func rateArgs(txShare string, txMax string) []string {
+	var args []string
+	if txShare != "" {
+		args = append(args, "tx_share", txShare)
+	}
+	if txMax != "" {
+		args = append(args, "tx_max", txMax)
+	}
+	return args
+}
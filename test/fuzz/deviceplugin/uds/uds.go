@@ -91,7 +91,14 @@ func reader(udsPath string, data []byte) {
 	}
 	cleanup, _ := uds.Listen()
 	defer cleanup()
-	msg, _, err := uds.Read()
+	conn, err := uds.Accept()
+	if err != nil {
+		logging.Errorf("Error accepting connection: %v", err)
+		ch <- ""
+		return
+	}
+	defer conn.Close()
+	msg, _, err := conn.Read()
 	if err != nil {
 		logging.Errorf("Data at time of error: %s", string(data))
 	}